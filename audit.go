@@ -0,0 +1,194 @@
+package proto2mysql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luyuancpp/proto2mysql/pbconv"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// 审计表（WithAuditTable）中记录的操作类型
+const (
+	AuditOpUpdate = "update"
+	AuditOpDelete = "delete"
+)
+
+// WithAuditTable 为表开启审计：按主键的更新/删除（Update、UpdateFieldsByPK、UpdateKVByPK、UpdateIfVersion、
+// UpdateFieldsIfVersion、IncrByPK、DecrByPKIfEnough、Delete、BatchDelete）执行前，在同一事务内按主键加锁读出当前行，
+// 把旧行的protobuf二进制连同操作类型、主键与时间（UTC）写入审计表auditTableName，再执行写操作；
+// 审计写入失败时整个操作回滚。已在RunInTransaction内调用时复用该事务。行不存在或写入条件不满足（版本冲突、余额不足）时不写审计记录。
+// 旧行按库中原值记录：不调用WithRowHook钩子，WithEncryptedColumn列保留密文（因此加密列须为string/bytes字段）。
+// 审计表与主表同库，CreateOrUpdateTable/UpdateTableField时自动创建（CREATE TABLE IF NOT EXISTS），结构为
+// `id` BIGINT自增主键、`op`、`pk`（主键值，复合主键以逗号拼接）、`row_data`（MEDIUMBLOB）、`changed_at`（DATETIME）。
+// 按条件批量更新/删除（UpdateByWhere、DeleteByWhere等）无法按主键定位旧行，不记录审计；
+// GormDB不支持审计，对配置了审计表的表调用其更新/删除返回ErrInvalidTableOption。
+func WithAuditTable(auditTableName string) TableOption {
+	return func(t *MessageTable) {
+		t.auditTable = auditTableName
+	}
+}
+
+// validateAuditTable 校验审计表名：须有主键（按主键读旧行），且不能与主表同名
+func (m *MessageTable) validateAuditTable() error {
+	if m.auditTable == "" {
+		return nil
+	}
+	if m.auditTable == m.tableName {
+		return fmt.Errorf("%w: audit table of %s must differ from the table itself", ErrInvalidTableOption, m.tableName)
+	}
+	if len(m.primaryKey) == 0 {
+		return fmt.Errorf("%w: audit table %s requires a primary key on table %s", ErrInvalidTableOption, m.auditTable, m.tableName)
+	}
+	// 审计快照中加密列保留密文，只有string/bytes字段放得下
+	for col := range m.encryptedColumns {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field != nil && field.Kind() != protoreflect.StringKind && field.Kind() != protoreflect.BytesKind {
+			return fmt.Errorf("%w: audit table %s requires encrypted column %s of table %s to be a string or bytes field",
+				ErrInvalidTableOption, m.auditTable, col, m.tableName)
+		}
+	}
+	return nil
+}
+
+// auditSQLName 审计表在SQL中的转义名，与主表同库
+func (m *MessageTable) auditSQLName() string {
+	if m.database == "" {
+		return escapeMySQLName(m.auditTable)
+	}
+	return escapeMySQLName(m.database) + "." + escapeMySQLName(m.auditTable)
+}
+
+// GetCreateAuditTableSQL 生成审计表的建表语句（字符集与主表一致）
+func (m *MessageTable) GetCreateAuditTableSQL() string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n"+
+		"  `id` BIGINT NOT NULL AUTO_INCREMENT,\n"+
+		"  `op` VARCHAR(16) NOT NULL,\n"+
+		"  `pk` VARCHAR(255) NOT NULL,\n"+
+		"  `row_data` MEDIUMBLOB NOT NULL,\n"+
+		"  `changed_at` DATETIME NOT NULL,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  KEY `idx_pk` (`pk`)\n"+
+		") ENGINE=InnoDB %s COMMENT='audit of %s';",
+		m.auditSQLName(), charsetSQL(m.charset, m.collation, "DEFAULT CHARSET=", " COLLATE="), escapeMySQLComment(m.tableName))
+}
+
+// createAuditTable 配置了审计表时创建（已存在则跳过）
+func (p *DB) createAuditTable(table *MessageTable) error {
+	if table.auditTable == "" {
+		return nil
+	}
+	if _, err := p.conn().Exec(table.GetCreateAuditTableSQL()); err != nil {
+		return fmt.Errorf("create audit table %s for table %s: %w", table.auditTable, table.tableName, err)
+	}
+	return nil
+}
+
+// audited 执行写操作write；表配置了审计时先在同一事务内按主键加锁读出messages对应的旧行写入审计表（见WithAuditTable）。
+// matches非nil时只记录满足写入条件的旧行（乐观锁版本、余额等），行已加锁，判断结果与随后的写入一致
+func (p *DB) audited(table *MessageTable, op string, messages []proto.Message, matches func(old proto.Message) bool, write func(db *DB) error) error {
+	if table.auditTable == "" {
+		return write(p)
+	}
+	run := func(db *DB) error {
+		for _, message := range messages {
+			old, err := db.loadAuditRow(table, message)
+			if errors.Is(err, ErrNoRowsFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("load row for audit of table %s: %w", table.tableName, err)
+			}
+			if matches != nil && !matches(old) {
+				continue
+			}
+			if err := db.recordAudit(table, old, op); err != nil {
+				return err
+			}
+		}
+		return write(db)
+	}
+	if p.tx != nil {
+		return run(p)
+	}
+	return p.RunInTransaction(run)
+}
+
+// recordAudit 把loadAuditRow读出的旧行写入审计表
+func (p *DB) recordAudit(table *MessageTable, old proto.Message, op string) error {
+	pkValues, err := table.primaryKeyValues(old)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(old)
+	if err != nil {
+		return fmt.Errorf("marshal row for audit of table %s: %w", table.tableName, err)
+	}
+
+	pk := make([]string, len(pkValues))
+	for i, v := range pkValues {
+		pk[i] = fmt.Sprint(v)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (`op`, `pk`, `row_data`, `changed_at`) VALUES (?, ?, ?, UTC_TIMESTAMP())", table.auditSQLName())
+	if _, err := p.conn().Exec(stmt, op, strings.Join(pk, ","), data); err != nil {
+		return fmt.Errorf("insert audit row for table %s: %w", table.tableName, err)
+	}
+	return nil
+}
+
+// loadAuditRow 按主键加锁读出库中的当前行：加密列保留密文、不调用WithRowHook钩子，
+// 结果只含库中的值（不带message中的新值）
+func (p *DB) loadAuditRow(table *MessageTable, message proto.Message) (proto.Message, error) {
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
+	if err != nil {
+		return nil, err
+	}
+	rows, release, err := p.conn().Query(fmt.Sprintf("%s WHERE %s FOR UPDATE;", table.selectFieldsSQL, whereClause), whereArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoRowsFound
+	}
+	row, err := scanRowBytes(rows)
+	if err != nil {
+		return nil, err
+	}
+	old := message.ProtoReflect().New().Interface()
+	if err := table.parseColumns(old, row, false); err != nil {
+		return nil, err
+	}
+	return old, rows.Err()
+}
+
+// versionMatches 旧行的版本字段等于curVersion（乐观锁更新将会生效）
+func (m *MessageTable) versionMatches(versionDesc protoreflect.FieldDescriptor, curVersion string) func(old proto.Message) bool {
+	return func(old proto.Message) bool {
+		version, err := pbconv.SerializeFieldWithOptions(old, versionDesc, m.fieldOptions(versionDesc))
+		return err == nil && version == curVersion
+	}
+}
+
+// atLeast 旧行的数值字段不小于delta（DecrByPKIfEnough将会扣减）
+func atLeast(field protoreflect.FieldDescriptor, delta int64) func(old proto.Message) bool {
+	return func(old proto.Message) bool {
+		v := old.ProtoReflect().Get(field)
+		switch field.Kind() {
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+			return v.Uint() >= uint64(delta)
+		case protoreflect.FloatKind, protoreflect.DoubleKind:
+			return v.Float() >= float64(delta)
+		case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+			protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+			return v.Int() >= delta
+		}
+		return true
+	}
+}
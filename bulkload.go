@@ -0,0 +1,97 @@
+package proto2mysql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/protobuf/proto"
+)
+
+// bulkLoadSeq 区分并发BulkLoad注册的reader名
+var bulkLoadSeq atomic.Uint64
+
+// bulkLoadEscaper LOAD DATA默认 ESCAPED BY '\\' 下需要转义的字符
+var bulkLoadEscaper = map[byte]string{
+	'\\': `\\`,
+	'\t': `\t`,
+	'\n': `\n`,
+	'\r': `\r`,
+	0:    `\0`,
+}
+
+// BulkLoad 用 LOAD DATA LOCAL INFILE 批量导入messages（须为同一张表），百万行级导入比多VALUES的BatchInsert快得多。
+// 行在内存中序列化为TSV（制表符、换行、反斜杠等按MySQL转义规则转义，NULL写为\N），
+// 通过mysql.RegisterReaderHandler交给驱动发送，列顺序与INSERT一致（不含MySQL维护的列）。
+// 需要服务端开启 local_infile=ON；Reader:: 形式的文件名不需要DSN的allowAllFiles。
+// 不支持WithSpatialPoint与WithBitColumn的表（这些列写入需要表达式转换）。
+func (p *DB) BulkLoad(messages []proto.Message) error {
+	if len(messages) == 0 {
+		return errors.New("no messages to load")
+	}
+	table, err := p.tableForMessage(messages[0])
+	if err != nil {
+		return err
+	}
+	if len(table.spatialPoints) > 0 || len(table.bitFields) > 0 {
+		return fmt.Errorf("bulk load table %s: spatial and bit columns are not supported", table.tableName)
+	}
+	if err := p.checkUTF8mb4(table, messages...); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for i, message := range messages {
+		if err := table.validateMessageDescriptor(message); err != nil {
+			return err
+		}
+		args, err := table.insertArgs(message)
+		if err != nil {
+			return fmt.Errorf("serialize row %d for table %s: %w", i, table.tableName, err)
+		}
+		appendBulkLoadRow(&buf, args)
+	}
+
+	name := "proto2mysql_bulk_" + strconv.FormatUint(bulkLoadSeq.Add(1), 10)
+	data := buf.Bytes()
+	mysql.RegisterReaderHandler(name, func() io.Reader { return bytes.NewReader(data) })
+	defer mysql.DeregisterReaderHandler(name)
+
+	if _, err := p.conn().Exec(table.bulkLoadSQL(name)); err != nil {
+		return fmt.Errorf("exec bulk load for table %s (%d rows): %w", table.tableName, len(messages), err)
+	}
+	return nil
+}
+
+// bulkLoadSQL 读取reader name的LOAD DATA语句，列清单与insertSQLTemplate一致
+func (m *MessageTable) bulkLoadSQL(name string) string {
+	return fmt.Sprintf(`LOAD DATA LOCAL INFILE 'Reader::%s' INTO TABLE %s CHARACTER SET utf8mb4 `+
+		`FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (%s)`,
+		name, m.sqlName(), m.insertFieldsListSQL)
+}
+
+// appendBulkLoadRow 把一行参数（insertArgs的结果：string或nil）追加为一行TSV
+func appendBulkLoadRow(buf *bytes.Buffer, args []interface{}) {
+	for i, arg := range args {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+		if arg == nil {
+			buf.WriteString(`\N`)
+			continue
+		}
+		text := fmt.Sprint(arg)
+		for j := 0; j < len(text); j++ {
+			if escaped, ok := bulkLoadEscaper[text[j]]; ok {
+				buf.WriteString(escaped)
+			} else {
+				buf.WriteByte(text[j])
+			}
+		}
+	}
+	buf.WriteByte('\n')
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // ErrCacheMiss 缓存未命中时Cache.Get应返回的错误
@@ -88,20 +89,29 @@ func (p *DB) cacheEnabled() bool {
 }
 
 // cacheKeyFor 生成缓存key：pb:<表名>:<主键值1>:<主键值2>...
+// 设置了WithDatabase的表为 pb:<库>.<表>:...，避免不同库的同名表共用key。
 func cacheKeyFor(table *MessageTable, message proto.Message) (string, error) {
 	values, err := table.primaryKeyValues(message)
 	if err != nil {
 		return "", err
 	}
+	return cacheKeyForValues(table, values), nil
+}
 
+// cacheKeyForValues 按主键值（与primaryKey顺序一致）生成缓存key，格式同cacheKeyFor
+func cacheKeyForValues(table *MessageTable, values []interface{}) string {
 	var b strings.Builder
 	b.WriteString("pb:")
+	if table.database != "" {
+		b.WriteString(table.database)
+		b.WriteString(".")
+	}
 	b.WriteString(table.tableName)
 	for _, v := range values {
 		b.WriteString(":")
 		b.WriteString(fmt.Sprint(v))
 	}
-	return b.String(), nil
+	return b.String()
 }
 
 // cacheGetProto 读缓存并反序列化到message；返回是否命中。任何错误都视为未命中（降级）。
@@ -119,10 +129,28 @@ func (p *DB) cacheGetProto(table *MessageTable, message proto.Message) bool {
 		return false
 	}
 
-	if err := proto.Unmarshal(data, message); err != nil {
+	if len(table.ignoredFields) == 0 {
+		if err := proto.Unmarshal(data, message); err != nil {
+			log.Printf("proto2mysql: cache unmarshal %s failed (fallback to db): %v", key, err)
+			return false
+		}
+		return true
+	}
+
+	// 有不持久化字段时只覆盖持久化列，与查库行为一致（被忽略字段保留内存值）
+	cached := message.ProtoReflect().New()
+	if err := proto.Unmarshal(data, cached.Interface()); err != nil {
 		log.Printf("proto2mysql: cache unmarshal %s failed (fallback to db): %v", key, err)
 		return false
 	}
+	dst := message.ProtoReflect()
+	for _, fd := range table.columns {
+		if cached.Has(fd) {
+			dst.Set(fd, cached.Get(fd))
+		} else {
+			dst.Clear(fd)
+		}
+	}
 	return true
 }
 
@@ -133,6 +161,15 @@ func (p *DB) cacheSetProto(table *MessageTable, message proto.Message) {
 		return
 	}
 
+	if len(table.ignoredFields) > 0 {
+		// 不持久化的字段不进缓存
+		message = proto.Clone(message)
+		for _, name := range table.ignoredFields {
+			if fd := table.Descriptor.Fields().ByName(protoreflect.Name(name)); fd != nil {
+				message.ProtoReflect().Clear(fd)
+			}
+		}
+	}
 	data, err := proto.Marshal(message)
 	if err != nil {
 		log.Printf("proto2mysql: cache marshal %s failed: %v", key, err)
@@ -168,10 +205,26 @@ func (p *DB) invalidateMessages(table *MessageTable, messages ...proto.Message)
 		}
 		keys = append(keys, key)
 	}
-	if len(keys) == 0 {
+	p.invalidateKeys(keys)
+}
+
+// invalidatePrimaryKeys 按单列主键值失效缓存（只有值、没有消息的批量写使用），语义同invalidateMessages
+func (p *DB) invalidatePrimaryKeys(table *MessageTable, pkValues []interface{}) {
+	if !p.cacheEnabled() || len(table.primaryKey) != 1 {
 		return
 	}
+	keys := make([]string, 0, len(pkValues))
+	for _, v := range pkValues {
+		keys = append(keys, cacheKeyForValues(table, []interface{}{v}))
+	}
+	p.invalidateKeys(keys)
+}
 
+// invalidateKeys 事务内暂存key，提交成功后统一删除；非事务立即删除
+func (p *DB) invalidateKeys(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
 	if p.tx != nil {
 		p.pendingCacheDels = append(p.pendingCacheDels, keys...)
 		return
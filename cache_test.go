@@ -3,6 +3,7 @@ package proto2mysql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"sync"
 	"testing"
@@ -124,6 +125,25 @@ func TestCacheHitAndBackfill(t *testing.T) {
 	}
 }
 
+// TestCacheIgnoredFields 不持久化的字段不写入缓存，命中时也不覆盖调用方内存中的值
+func TestCacheIgnoredFields(t *testing.T) {
+	cache := newFakeCache()
+	db := NewDB()
+	db.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithIgnoredFields("player"))
+	db.EnableCache(cache, time.Minute)
+	table := db.Tables[GetTableName(&testpb.GolangTest{})]
+
+	db.cacheSetProto(table, &testpb.GolangTest{Id: 7, Port: 80, Player: &testpb.Player{PlayerId: 1}})
+
+	got := &testpb.GolangTest{Id: 7, Player: &testpb.Player{PlayerId: 2}}
+	if !db.cacheGetProto(table, got) {
+		t.Fatal("预期缓存命中")
+	}
+	if got.Port != 80 || got.Player.GetPlayerId() != 2 {
+		t.Errorf("应只覆盖持久化列: port=%d player=%v", got.Port, got.Player)
+	}
+}
+
 // TestCacheDegradation Redis故障时读写全部降级，不影响调用方
 func TestCacheDegradation(t *testing.T) {
 	cache := newFakeCache()
@@ -229,3 +249,29 @@ func TestCacheDisabledNoop(t *testing.T) {
 		t.Errorf("未启用缓存时InvalidateCache应为空操作: %v", err)
 	}
 }
+
+// TestReplaceAllByKeyInvalidatesOldRows 整体替换时加锁读出旧行主键，提交后连同新行一起失效缓存
+func TestReplaceAllByKeyInvalidatesOldRows(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+	cache := newFakeCache()
+	db := newCacheTestDB(cache)
+	db.DB = sqlDB
+	table := db.Tables[GetTableName(&testpb.GolangTest{})]
+
+	for _, id := range []uint32{1, 2, 3} {
+		db.cacheSetProto(table, &testpb.GolangTest{Id: id, GroupId: 5})
+	}
+	fake.queryRows = [][]driver.Value{{int64(1)}, {int64(2)}}
+
+	if err := db.ReplaceAllByKey("group_id", uint32(5), []proto.Message{&testpb.GolangTest{Id: 3, GroupId: 5}}); err != nil {
+		t.Fatalf("ReplaceAllByKey失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || queries[0].query != "SELECT `id` FROM `golang_test` WHERE `group_id` = ? FOR UPDATE" {
+		t.Errorf("应先加锁读出旧行主键: %+v", queries)
+	}
+	if len(cache.data) != 0 {
+		t.Errorf("旧行与新行的缓存都应失效，剩余: %v", cache.data)
+	}
+}
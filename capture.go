@@ -0,0 +1,131 @@
+package proto2mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// 捕获模式（SetCaptureMode）下记录的语句类型
+const (
+	CaptureOpExec  = "exec"
+	CaptureOpQuery = "query"
+)
+
+// CapturedStatement 捕获模式下记录的一条SQL与其绑定参数
+type CapturedStatement struct {
+	Op   string // CaptureOpExec / CaptureOpQuery
+	SQL  string
+	Args []interface{}
+}
+
+// statementCapture 捕获模式的状态，WithContext/事务派生的实例共享同一份记录
+type statementCapture struct {
+	mu         sync.Mutex
+	statements []CapturedStatement
+	real       *sql.DB // 开启捕获前的连接，关闭捕获时恢复
+	db         *sql.DB // 只记录不执行的内存连接
+}
+
+// record 追加一条语句
+func (c *statementCapture) record(op, query string, args []driver.NamedValue) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, CapturedStatement{Op: op, SQL: query, Args: values})
+}
+
+// SetCaptureMode 开启/关闭捕获模式：开启后所有语句（含事务内语句）只按顺序记录到
+// CapturedStatements，不发往MySQL；写操作返回成功（影响行数与自增id均为0），查询返回空结果集。
+// 同步表结构时读取INFORMATION_SCHEMA仍走开启前的真实连接（不记录），因此CreateOrUpdateTable、UpdateTableField、
+// GenerateMigrationSQL可按线上结构预览将执行的DDL；开启前没有连接时视为表不存在。用于测试断言生成的SQL或预览迁移将执行的语句。
+// 开启期间p.DB被替换为内存连接，关闭时恢复原连接并丢弃已记录的语句；须在根实例上调用。
+func (p *DB) SetCaptureMode(enabled bool) {
+	if enabled == (p.capture != nil) {
+		return
+	}
+	if enabled {
+		capture := &statementCapture{real: p.DB}
+		capture.db = sql.OpenDB(captureConnector{c: capture})
+		p.capture = capture
+		p.DB = capture.db
+		return
+	}
+	p.DB = p.capture.real
+	_ = p.capture.db.Close()
+	p.capture = nil
+}
+
+// schemaDB 读取INFORMATION_SCHEMA用的连接：捕获模式下用开启前的真实连接（只读元数据，
+// 使CreateOrUpdateTable等能按线上结构生成DDL），未开启或开启前没有连接时用p.DB
+func (p *DB) schemaDB() *sql.DB {
+	if p.capture != nil && p.capture.real != nil {
+		return p.capture.real
+	}
+	return p.DB
+}
+
+// CapturedStatements 返回捕获模式下已记录的语句（拷贝），未开启时返回nil
+func (p *DB) CapturedStatements() []CapturedStatement {
+	if p.capture == nil {
+		return nil
+	}
+	p.capture.mu.Lock()
+	defer p.capture.mu.Unlock()
+	return append([]CapturedStatement(nil), p.capture.statements...)
+}
+
+// captureConnector 捕获模式的内存驱动：记录语句后直接返回成功/空结果集
+type captureConnector struct{ c *statementCapture }
+
+func (cc captureConnector) Connect(context.Context) (driver.Conn, error) { return captureConn(cc), nil }
+func (cc captureConnector) Driver() driver.Driver                        { return cc }
+func (cc captureConnector) Open(string) (driver.Conn, error)             { return captureConn(cc), nil }
+
+type captureConn struct{ c *statementCapture }
+
+func (captureConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("capture mode: prepare not supported")
+}
+func (captureConn) Close() error              { return nil }
+func (captureConn) Begin() (driver.Tx, error) { return captureTx{}, nil }
+func (captureConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return captureTx{}, nil
+}
+
+// CheckNamedValue 参数原样记录，不做driver.Value转换
+func (captureConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (cc captureConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	cc.c.record(CaptureOpExec, query, args)
+	return captureResult{}, nil
+}
+
+func (cc captureConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	cc.c.record(CaptureOpQuery, query, args)
+	return captureRows{}, nil
+}
+
+type captureTx struct{}
+
+func (captureTx) Commit() error   { return nil }
+func (captureTx) Rollback() error { return nil }
+
+// captureResult 写操作结果：影响行数与自增id均为0
+type captureResult struct{}
+
+func (captureResult) LastInsertId() (int64, error) { return 0, nil }
+func (captureResult) RowsAffected() (int64, error) { return 0, nil }
+
+// captureRows 空结果集
+type captureRows struct{}
+
+func (captureRows) Columns() []string         { return nil }
+func (captureRows) Close() error              { return nil }
+func (captureRows) Next([]driver.Value) error { return io.EOF }
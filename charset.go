@@ -0,0 +1,205 @@
+package proto2mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultCharset / DefaultCollation 未配置字符集时建库、建表与连接（NewMysqlConfig）使用的字符集与排序规则
+const (
+	DefaultCharset   = "utf8mb4"
+	DefaultCollation = "utf8mb4_unicode_ci"
+)
+
+// charsetNameRegex 字符集/排序规则名，如 utf8mb4、latin1_swedish_ci
+var charsetNameRegex = regexp.MustCompile(`(?i)^[a-z0-9_]+$`)
+
+// WithCharset 指定表的默认字符集与排序规则，建表生成 DEFAULT CHARSET=charset [COLLATE=collation]，
+// collation为空时使用该字符集在MySQL中的默认排序规则。用于对接latin1等旧库，
+// 须与连接字符集（JsonConfig.Charset / DSN的charset参数）一致，否则读写会乱码。未指定时为utf8mb4。
+func WithCharset(charset, collation string) TableOption {
+	return func(t *MessageTable) {
+		t.charset = charset
+		t.collation = collation
+	}
+}
+
+// SetCharset 设置本实例的默认字符集与排序规则：之后RegisterTable与RegisterAllTables注册的表（未用WithCharset单独指定时）
+// 及CreateDatabaseIfNotExists都使用它，需在RegisterTable之前调用。Open会按DSN的charset参数自动设置。
+func (p *DB) SetCharset(charset, collation string) error {
+	if err := validateCharset(charset, collation); err != nil {
+		return err
+	}
+	p.charset = charset
+	p.collation = collation
+	return nil
+}
+
+// validateCharset 校验字符集名，以及collation（可为空）属于该字符集
+func validateCharset(charset, collation string) error {
+	if !charsetNameRegex.MatchString(charset) {
+		return fmt.Errorf("invalid charset %q", charset)
+	}
+	if collation != "" && !collationMatchesCharset(collation, charset) {
+		return fmt.Errorf("collation %q is not a %s collation", collation, charset)
+	}
+	return nil
+}
+
+// collationMatchesCharset collation是否属于charset（MySQL排序规则以 字符集名_ 开头，binary字符集只有binary）
+func collationMatchesCharset(collation, charset string) bool {
+	if !charsetNameRegex.MatchString(collation) {
+		return false
+	}
+	if strings.EqualFold(charset, "binary") {
+		return strings.EqualFold(collation, "binary")
+	}
+	return len(collation) > len(charset) && strings.EqualFold(collation[:len(charset)+1], charset+"_")
+}
+
+// charsetSQL 建库/建表的字符集子句，未配置时为 utf8mb4 / utf8mb4_unicode_ci；
+// charsetKeyword如 "DEFAULT CHARSET="，collateKeyword如 " COLLATE="
+func charsetSQL(charset, collation, charsetKeyword, collateKeyword string) string {
+	if charset == "" {
+		charset, collation = DefaultCharset, DefaultCollation
+	}
+	clause := charsetKeyword + charset
+	if collation != "" {
+		clause += collateKeyword + collation
+	}
+	return clause
+}
+
+// tableCharset 表的字符集（未配置时为DefaultCharset）
+func (m *MessageTable) tableCharset() string {
+	if m.charset == "" {
+		return DefaultCharset
+	}
+	return m.charset
+}
+
+// setCharsetFromParams 按DSN参数charset（go-sql-driver允许逗号分隔的候选列表，取第一个）设置默认字符集，
+// 未设置或为utf8mb4时保持默认
+func (p *DB) setCharsetFromParams(params map[string]string) error {
+	charset, _, _ := strings.Cut(params["charset"], ",")
+	charset = strings.TrimSpace(charset)
+	if charset == "" || strings.EqualFold(charset, DefaultCharset) {
+		return nil
+	}
+	return p.SetCharset(charset, "")
+}
+
+// WithValidateUTF8mb4 插入（Insert/InsertPresent/BatchInsert）前检查这些string字段：不是合法UTF-8时报错；
+// 含4字节字符（emoji等）而线上列为3字节的utf8/utf8mb3字符集时也报错，代替MySQL费解的1366错误。
+// 线上列字符集在首次遇到4字节字符时查询INFORMATION_SCHEMA并缓存（InvalidateTableCache清除）。
+func WithValidateUTF8mb4(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.utf8mb4Fields = append(t.utf8mb4Fields, fields...)
+	}
+}
+
+// validateUTF8mb4Fields 校验WithValidateUTF8mb4的字段均为单值string字段
+func (m *MessageTable) validateUTF8mb4Fields() error {
+	for _, col := range m.utf8mb4Fields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: utf8mb4 column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.StringKind || field.IsList() {
+			return fmt.Errorf("%w: utf8mb4 column %s in table %s must be a string field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	return nil
+}
+
+// isThreeByteUTF8 字符集是否为最多3字节的utf8（MySQL 8.0.30起报告为utf8mb3）
+func isThreeByteUTF8(charset string) bool {
+	return strings.EqualFold(charset, "utf8") || strings.EqualFold(charset, "utf8mb3")
+}
+
+// firstFourByteRune 返回text中第一个需要4字节编码的字符
+func firstFourByteRune(text string) (rune, bool) {
+	for _, r := range text {
+		if utf8.RuneLen(r) == 4 {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// checkUTF8mb4 按WithValidateUTF8mb4检查待插入消息的string字段，见WithValidateUTF8mb4
+func (p *DB) checkUTF8mb4(table *MessageTable, messages ...proto.Message) error {
+	if len(table.utf8mb4Fields) == 0 {
+		return nil
+	}
+	var charsets map[string]string
+	for _, message := range messages {
+		reflection := message.ProtoReflect()
+		for _, name := range table.utf8mb4Fields {
+			text := reflection.Get(table.Descriptor.Fields().ByName(protoreflect.Name(name))).String()
+			if !utf8.ValidString(text) {
+				return fmt.Errorf("%w: field %s in table %s is not valid UTF-8", ErrInvalidText, name, table.tableName)
+			}
+			r, ok := firstFourByteRune(text)
+			if !ok {
+				continue
+			}
+			if charsets == nil {
+				var err error
+				if charsets, err = p.columnCharsets(table); err != nil {
+					return err
+				}
+			}
+			column := table.columnName(name)
+			if charset := charsets[column]; isThreeByteUTF8(charset) {
+				return fmt.Errorf("%w: field %s contains 4-byte character %U but column %s.%s uses charset %s, convert it to utf8mb4",
+					ErrInvalidText, name, r, table.tableName, column, charset)
+			}
+		}
+	}
+	return nil
+}
+
+// columnCharsets 查询线上表文本列的字符集（列名->字符集），结果缓存在表上
+func (p *DB) columnCharsets(table *MessageTable) (map[string]string, error) {
+	table.columnsMu.RLock()
+	cached := table.cachedCharsets
+	table.columnsMu.RUnlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	query := `
+		SELECT COLUMN_NAME, CHARACTER_SET_NAME
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND CHARACTER_SET_NAME IS NOT NULL
+	`
+	rows, release, err := p.conn().Query(query, p.tableSchema(table), table.tableName)
+	if err != nil {
+		return nil, fmt.Errorf("query column charsets for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	charsets := make(map[string]string)
+	for rows.Next() {
+		var column, charset string
+		if err := rows.Scan(&column, &charset); err != nil {
+			return nil, fmt.Errorf("scan column charsets for table %s: %w", table.tableName, err)
+		}
+		charsets[column] = charset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error for table %s column charsets: %w", table.tableName, err)
+	}
+
+	table.columnsMu.Lock()
+	table.cachedCharsets = charsets
+	table.columnsMu.Unlock()
+	return charsets, nil
+}
@@ -0,0 +1,126 @@
+package proto2mysql
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// encryptedColumn WithEncryptedColumn配置的加密列；err为密钥不合法时的错误，由Validate报告
+type encryptedColumn struct {
+	aead cipher.AEAD
+	err  error
+}
+
+// WithEncryptedColumn 对字段做透明的AES-GCM加密存储：写入时把字段原本的序列化结果加密，
+// 以 base64(nonce||密文) 存入MEDIUMBLOB列；读取时解密后按原编码解析。key须为16/24/32字节（AES-128/192/256）。
+// GCM每次使用随机nonce，同一明文每次加密结果都不同，因此不能对该列做等值查询、建唯一键或按它去重；
+// 主键、索引/唯一键中的列、POINT列、生成列与WithTimestamps的时间戳列不能加密。更换密钥后旧数据无法解密，需自行迁移。
+func WithEncryptedColumn(field string, key []byte) TableOption {
+	return func(t *MessageTable) {
+		if t.encryptedColumns == nil {
+			t.encryptedColumns = make(map[string]encryptedColumn)
+		}
+		col := encryptedColumn{}
+		block, err := aes.NewCipher(key)
+		if err == nil {
+			col.aead, err = cipher.NewGCM(block)
+		}
+		col.err = err
+		t.encryptedColumns[field] = col
+	}
+}
+
+// isEncryptedField 字段是否按WithEncryptedColumn加密存储
+func (m *MessageTable) isEncryptedField(fieldName string) bool {
+	_, ok := m.encryptedColumns[fieldName]
+	return ok
+}
+
+// validateEncryptedColumns 校验加密列的密钥与字段（不能是主键、索引列等）
+func (m *MessageTable) validateEncryptedColumns() error {
+	for col, enc := range m.encryptedColumns {
+		if enc.err != nil {
+			return fmt.Errorf("%w: encrypted column %s in table %s: %v", ErrInvalidTableOption, col, m.tableName, enc.err)
+		}
+		if m.Descriptor.Fields().ByName(protoreflect.Name(col)) == nil {
+			return fmt.Errorf("%w: encrypted column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		_, spatial := m.spatialPointFor(col)
+		if slices.Contains(m.primaryKey, col) || spatial || m.isDBGeneratedField(col) {
+			return fmt.Errorf("%w: encrypted column %s in table %s cannot be a primary key, spatial, generated or timestamp column",
+				ErrInvalidTableOption, col, m.tableName)
+		}
+		// 密文每次不同，索引/唯一键对加密列没有意义
+		for _, def := range m.fieldIndexDefs() {
+			if slices.Contains(def.cols, col) {
+				return fmt.Errorf("%w: encrypted column %s in table %s cannot be part of index %s",
+					ErrInvalidTableOption, col, m.tableName, def.name)
+			}
+		}
+	}
+	return nil
+}
+
+// encryptColumnValue 加密字段的序列化结果，返回 base64(nonce||密文)
+func (m *MessageTable) encryptColumnValue(fieldName, plain string) (string, error) {
+	aead := m.encryptedColumns[fieldName].aead
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce for encrypted column %s: %w", fieldName, err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptColumnValue 解密encryptColumnValue写入的值，返回字段原本的序列化结果
+func (m *MessageTable) decryptColumnValue(fieldName string, raw []byte) ([]byte, error) {
+	aead := m.encryptedColumns[fieldName].aead
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(raw)))
+	n, err := base64.StdEncoding.Decode(sealed, raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode encrypted column %s: %w", fieldName, err)
+	}
+	sealed = sealed[:n]
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("decrypt column %s: ciphertext too short", fieldName)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt column %s: %w", fieldName, err)
+	}
+	return plain, nil
+}
+
+// decryptNamedRow 按列名（proto字段名）解密scanRowStrings读出的一行中加密列的值（原地替换），
+// 供按列名解析的路径（QueryIntoList、FindAggregate）使用；空值（含NULL）原样保留
+func (m *MessageTable) decryptNamedRow(fields []string, row []string) error {
+	if len(m.encryptedColumns) == 0 {
+		return nil
+	}
+	for i, field := range fields {
+		if !m.isEncryptedField(field) || row[i] == "" {
+			continue
+		}
+		plain, err := m.decryptColumnValue(field, []byte(row[i]))
+		if err != nil {
+			return err
+		}
+		row[i] = string(plain)
+	}
+	return nil
+}
+
+// setCiphertext 把加密列的密文原样写入string/bytes字段（审计快照不落明文，见WithAuditTable）
+func setCiphertext(reflection protoreflect.Message, field protoreflect.FieldDescriptor, raw []byte) {
+	if field.Kind() == protoreflect.BytesKind {
+		reflection.Set(field, protoreflect.ValueOfBytes(append([]byte(nil), raw...)))
+		return
+	}
+	reflection.Set(field, protoreflect.ValueOfString(string(raw)))
+}
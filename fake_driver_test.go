@@ -0,0 +1,263 @@
+package proto2mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// fakeDriver 记录下发SQL的内存驱动，用于无需MySQL即可验证生成/分批行为的单元测试
+type fakeDriver struct {
+	mu      sync.Mutex
+	execs   []fakeExec
+	queries []fakeExec
+	// execErr 非nil时Exec返回该错误（模拟MySQL报错）
+	execErr error
+	// execErrAfter 前execErrAfter次Exec正常执行，之后才返回execErr（模拟中途失败）
+	execErrAfter int
+	// queryRows Query返回的结果集（每行按列顺序），nil时返回空结果集
+	queryRows [][]driver.Value
+	// queryFor 非nil时按SQL与参数返回结果集（优先于queryRows），用于一次调用内多条不同查询的场景
+	queryFor func(query string, args []driver.NamedValue) [][]driver.Value
+	// queryStream 非nil时Query返回按需生成的结果集（优先于queryFor）：第i行在Next时才调用queryStream(i)生成，
+	// 返回nil表示结束；用于验证大结果集逐行读取而不是整体缓冲
+	queryStream func(i int) []driver.Value
+	// execDelay Exec记录后等待的时长（模拟慢DDL），期间ctx取消则返回ctx.Err()
+	execDelay time.Duration
+	// queryDelay Query记录后等待的时长（模拟慢查询），期间ctx取消则返回ctx.Err()
+	queryDelay time.Duration
+	// onExec 非nil时每次Exec记录后回调（参数为已执行次数），用于在批次之间注入取消等事件
+	onExec func(n int)
+	// queryColumns 非nil时作为结果集的列名（默认c0..cN），用于按列名解析的路径
+	queryColumns []string
+	// queryCtxs 每次Query收到的context，用于验证语句结束后context已释放
+	queryCtxs []context.Context
+}
+
+// fakeExec 一次Exec/Query调用的SQL与参数
+type fakeExec struct {
+	query string
+	args  []driver.NamedValue
+}
+
+// values 返回按顺序绑定的参数值
+func (e fakeExec) values() []interface{} {
+	values := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// newFakeDB 返回绑定fakeDriver的*sql.DB与驱动本身
+func newFakeDB() (*sql.DB, *fakeDriver) {
+	d := &fakeDriver{}
+	return sql.OpenDB(fakeConnector{d: d}), d
+}
+
+// newFakeGormDB 以内存驱动为连接池打开gorm.DB，用于无需MySQL即可验证GormDB的单元测试
+func newFakeGormDB() (*gorm.DB, *fakeDriver, error) {
+	sqlDB, d := newFakeDB()
+	db, err := gorm.Open(fakeDialector{conn: sqlDB}, &gorm.Config{SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	return db, d, err
+}
+
+// fakeDialector 最小的MySQL风格gorm方言：注册默认回调，反引号引用标识符，占位符为?
+type fakeDialector struct {
+	conn *sql.DB
+}
+
+func (fakeDialector) Name() string { return "mysql" }
+
+func (d fakeDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = d.conn
+	return nil
+}
+
+func (fakeDialector) Migrator(*gorm.DB) gorm.Migrator { return nil }
+
+func (fakeDialector) DataTypeOf(*schema.Field) string { return "" }
+
+func (fakeDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (fakeDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	writer.WriteByte('?')
+}
+
+func (fakeDialector) QuoteTo(writer clause.Writer, str string) {
+	for i, part := range strings.Split(str, ".") {
+		if i > 0 {
+			writer.WriteByte('.')
+		}
+		writer.WriteString("`" + strings.ReplaceAll(part, "`", "``") + "`")
+	}
+}
+
+func (fakeDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, "'", vars...)
+}
+
+// recorded 返回已记录的Exec调用（拷贝）
+func (d *fakeDriver) recorded() []fakeExec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]fakeExec(nil), d.execs...)
+}
+
+// recordedQueries 返回已记录的Query调用（拷贝）
+func (d *fakeDriver) recordedQueries() []fakeExec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]fakeExec(nil), d.queries...)
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+
+type fakeConnector struct{ d *fakeDriver }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{d: c.d}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return c.d }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDriver: prepare not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	c.d.execs = append(c.d.execs, fakeExec{query: query, args: args})
+	if c.d.onExec != nil {
+		c.d.onExec(len(c.d.execs))
+	}
+	execErr := c.d.execErr
+	if len(c.d.execs) <= c.d.execErrAfter {
+		execErr = nil
+	}
+	delay := c.d.execDelay
+	c.d.mu.Unlock()
+
+	if err := fakeSleep(ctx, delay); err != nil {
+		return nil, err
+	}
+	if execErr != nil {
+		return nil, execErr
+	}
+	// 多行VALUES按组数计影响行数，其余语句视为影响1行
+	affected := int64(1)
+	if strings.Contains(query, " VALUES (") {
+		affected = int64(strings.Count(query, "), (") + 1)
+	}
+	return fakeResult{lastID: 1, affected: affected}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	c.d.queries = append(c.d.queries, fakeExec{query: query, args: args})
+	c.d.queryCtxs = append(c.d.queryCtxs, ctx)
+	delay := c.d.queryDelay
+	c.d.mu.Unlock()
+	if err := fakeSleep(ctx, delay); err != nil {
+		return nil, err
+	}
+
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.queryStream != nil {
+		first := c.d.queryStream(0)
+		return &fakeRows{rows: [][]driver.Value{first}, next: c.d.queryStream}, nil
+	}
+	if c.d.queryFor != nil {
+		return &fakeRows{rows: c.d.queryFor(query, args), cols: c.d.queryColumns}, nil
+	}
+	return &fakeRows{rows: c.d.queryRows, cols: c.d.queryColumns}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeResult struct{ lastID, affected int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// fakeRows 内存结果集（列名默认为c0..cN，按位置解析）
+type fakeRows struct {
+	rows [][]driver.Value
+	cols []string
+	pos  int
+	// next 非nil时为按需生成的结果集：rows只保存第0行（用于列数），之后每次Next调用next(pos)
+	next func(i int) []driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if r.cols != nil {
+		return r.cols
+	}
+	if len(r.rows) == 0 {
+		return nil
+	}
+	cols := make([]string, len(r.rows[0]))
+	for i := range cols {
+		cols[i] = "c" + strconv.Itoa(i)
+	}
+	return cols
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next != nil && r.pos > 0 {
+		row := r.next(r.pos)
+		if row == nil {
+			return io.EOF
+		}
+		copy(dest, row)
+		r.pos++
+		return nil
+	}
+	if r.pos >= len(r.rows) || r.rows[r.pos] == nil {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+// fakeSleep 等待delay（<=0时立即返回），期间ctx取消则返回ctx.Err()
+func fakeSleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
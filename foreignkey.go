@@ -0,0 +1,96 @@
+package proto2mysql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FKAction 外键的引用动作（ON DELETE / ON UPDATE），空串表示不生成该子句，使用MySQL默认（RESTRICT）
+type FKAction string
+
+const (
+	FKCascade  FKAction = "CASCADE"   // 父行删除/主键修改时同步删除/修改子行
+	FKSetNull  FKAction = "SET NULL"  // 子行外键列置NULL，列须可空（WithNullableFields）
+	FKRestrict FKAction = "RESTRICT"  // 存在子行时拒绝删除/修改父行
+	FKNoAction FKAction = "NO ACTION" // InnoDB中与RESTRICT相同
+)
+
+// valid 是否为允许的引用动作（空串表示未指定）
+func (a FKAction) valid() bool {
+	switch a {
+	case "", FKCascade, FKSetNull, FKRestrict, FKNoAction:
+		return true
+	}
+	return false
+}
+
+// foreignKey 外键配置（WithForeignKey）
+type foreignKey struct {
+	column   string // 本表字段名
+	refTable string // 被引用的表（SQL表名）
+	refCol   string // 被引用的列
+	onDelete FKAction
+	onUpdate FKAction
+}
+
+// WithForeignKey 建表时为字段col添加外键 CONSTRAINT fk_<表名>_<col> FOREIGN KEY (col) REFERENCES refTable (refCol)，
+// onDelete/onUpdate非空时追加 ON DELETE / ON UPDATE 子句（如 FKCascade 让父行删除时级联删除子行）。
+// 列类型须与被引用列一致，且被引用的表须先建好；分区表不支持外键。
+// 只作用于建表，已有表需手工 ALTER TABLE ... ADD CONSTRAINT。可多次调用为不同字段添加外键。
+//
+//	WithForeignKey("player_id", "player", "id", proto2mysql.FKCascade, proto2mysql.FKRestrict)
+func WithForeignKey(col, refTable, refCol string, onDelete, onUpdate FKAction) TableOption {
+	return func(t *MessageTable) {
+		t.foreignKeys = append(t.foreignKeys, foreignKey{column: col, refTable: refTable, refCol: refCol, onDelete: onDelete, onUpdate: onUpdate})
+	}
+}
+
+// foreignKeyDefs 建表语句中的外键约束定义
+func (m *MessageTable) foreignKeyDefs() []string {
+	defs := make([]string, 0, len(m.foreignKeys))
+	for _, fk := range m.foreignKeys {
+		def := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+			escapeMySQLName(autoIndexName("fk_"+m.tableName+"_"+fk.column)), m.quotedColumn(fk.column),
+			escapeMySQLName(fk.refTable), escapeMySQLName(fk.refCol))
+		if fk.onDelete != "" {
+			def += " ON DELETE " + string(fk.onDelete)
+		}
+		if fk.onUpdate != "" {
+			def += " ON UPDATE " + string(fk.onUpdate)
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// validateForeignKeys 校验WithForeignKey：字段存在且为单值字段、引用表/列非空、引用动作合法，
+// SET NULL要求列可空，分区表不能有外键
+func (m *MessageTable) validateForeignKeys() error {
+	if len(m.foreignKeys) > 0 && m.partition != nil {
+		return fmt.Errorf("%w: partitioned table %s cannot have foreign keys", ErrInvalidTableOption, m.tableName)
+	}
+	for _, fk := range m.foreignKeys {
+		field, ok := m.fieldNameToDesc[fk.column]
+		if !ok {
+			return fmt.Errorf("%w: foreign key column %s not found in table %s", ErrInvalidTableOption, fk.column, m.tableName)
+		}
+		if field.IsList() || field.IsMap() {
+			return fmt.Errorf("%w: foreign key column %s in table %s must be a singular field", ErrInvalidTableOption, fk.column, m.tableName)
+		}
+		if strings.TrimSpace(fk.refTable) == "" || strings.TrimSpace(fk.refCol) == "" {
+			return fmt.Errorf("%w: foreign key column %s in table %s must reference a table and column",
+				ErrInvalidTableOption, fk.column, m.tableName)
+		}
+		for _, action := range []FKAction{fk.onDelete, fk.onUpdate} {
+			if !action.valid() {
+				return fmt.Errorf("%w: invalid foreign key action %q for column %s in table %s (want CASCADE, SET NULL, RESTRICT or NO ACTION)",
+					ErrInvalidTableOption, action, fk.column, m.tableName)
+			}
+			if action == FKSetNull && !m.isNullableField(fk.column) {
+				return fmt.Errorf("%w: foreign key column %s in table %s must be nullable for SET NULL",
+					ErrInvalidTableOption, fk.column, m.tableName)
+			}
+		}
+	}
+	return nil
+}
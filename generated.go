@@ -0,0 +1,174 @@
+package proto2mysql
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// generatedColumnDefaultType 没有对应proto字段或对应string字段的生成列类型（可直接建索引）
+const generatedColumnDefaultType = "VARCHAR(255)"
+
+// generatedColumn 由其他列计算得到的生成列（WithGeneratedColumn）
+type generatedColumn struct {
+	name    string // 列名；与proto字段同名时查询结果回填到该字段
+	expr    string // 生成表达式（原生SQL，引用库列名）
+	storage string // STORED / VIRTUAL
+}
+
+// WithGeneratedColumn 添加生成列，建表时生成 `name` VARCHAR(255) GENERATED ALWAYS AS (expression) STORED，
+// 常用于给组合值建索引。storedOrVirtual 取 STORED 或 VIRTUAL（不区分大小写）。
+// 生成列由MySQL计算，不出现在INSERT/REPLACE/UPDATE的参数中；若proto中有同名字段，
+// 查询时照常读回（数值/bool/枚举字段按字段类型建列，string字段为VARCHAR(255)），否则只建列不读取。
+//
+//	WithGeneratedColumn("full_addr", "CONCAT(`ip`, ':', `port`)", "STORED"), WithIndexes("full_addr")
+func WithGeneratedColumn(name, expression, storedOrVirtual string) TableOption {
+	return func(t *MessageTable) {
+		t.generatedColumns = append(t.generatedColumns, generatedColumn{name: name, expr: expression, storage: storedOrVirtual})
+	}
+}
+
+// generatedColumnFor 返回字段（或列名）对应的生成列配置
+func (m *MessageTable) generatedColumnFor(name string) (generatedColumn, bool) {
+	for _, gc := range m.generatedColumns {
+		if gc.name == name {
+			return gc, true
+		}
+	}
+	return generatedColumn{}, false
+}
+
+// isGeneratedColumn 判断字段（或列名）是否为WithGeneratedColumn指定的生成列
+func (m *MessageTable) isGeneratedColumn(name string) bool {
+	_, ok := m.generatedColumnFor(name)
+	return ok
+}
+
+// columnType 生成列的完整列类型，kindType为对应proto字段（非string）映射的列类型，没有对应字段或为string字段时传空串
+func (gc generatedColumn) columnType(kindType string) string {
+	baseType := generatedColumnDefaultType
+	if kindType != "" {
+		// 生成列不能有DEFAULT，是否可为NULL由表达式决定
+		baseType = strings.TrimSuffix(kindType, " NOT NULL DEFAULT 0")
+	}
+	return fmt.Sprintf("%s GENERATED ALWAYS AS (%s) %s", baseType, gc.expr, strings.ToUpper(gc.storage))
+}
+
+// standaloneGeneratedColumns 没有对应proto字段的生成列（只参与建表与结构同步）
+func (m *MessageTable) standaloneGeneratedColumns() []generatedColumn {
+	var cols []generatedColumn
+	for _, gc := range m.generatedColumns {
+		if m.Descriptor.Fields().ByName(protoreflect.Name(gc.name)) == nil {
+			cols = append(cols, gc)
+		}
+	}
+	return cols
+}
+
+// validateGeneratedColumns 校验WithGeneratedColumn：列名、表达式、STORED/VIRTUAL，以及对应字段的类型
+func (m *MessageTable) validateGeneratedColumns() error {
+	seen := make(map[string]bool, len(m.columns)+len(m.generatedColumns))
+	for _, fieldDesc := range m.columns {
+		if !m.isGeneratedColumn(string(fieldDesc.Name())) {
+			seen[strings.ToLower(m.columnName(string(fieldDesc.Name())))] = true
+		}
+	}
+	for _, gc := range m.generatedColumns {
+		if gc.name == "" || len(gc.name) > mysqlMaxIdentifierLen {
+			return fmt.Errorf("%w: generated column name %q in table %s must be 1-%d bytes",
+				ErrInvalidTableOption, gc.name, m.tableName, mysqlMaxIdentifierLen)
+		}
+		if strings.TrimSpace(gc.expr) == "" {
+			return fmt.Errorf("%w: generated column %s in table %s has an empty expression", ErrInvalidTableOption, gc.name, m.tableName)
+		}
+		if storage := strings.ToUpper(gc.storage); storage != "STORED" && storage != "VIRTUAL" {
+			return fmt.Errorf("%w: generated column %s in table %s must be STORED or VIRTUAL, got %q",
+				ErrInvalidTableOption, gc.name, m.tableName, gc.storage)
+		}
+		column := strings.ToLower(m.columnName(gc.name))
+		if seen[column] {
+			return fmt.Errorf("%w: generated column %s in table %s duplicates another column", ErrInvalidTableOption, gc.name, m.tableName)
+		}
+		seen[column] = true
+
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(gc.name))
+		if field == nil {
+			continue
+		}
+		if field.IsList() || field.IsMap() || field.Kind() == protoreflect.MessageKind || field.Kind() == protoreflect.BytesKind {
+			return fmt.Errorf("%w: generated column %s in table %s must be a scalar string/number/bool/enum field, got %s",
+				ErrInvalidTableOption, gc.name, m.tableName, field.Kind())
+		}
+		if slices.Contains(m.primaryKey, gc.name) || m.isAutoIncrementField(gc.name) || m.isIgnoredField(gc.name) ||
+			m.isManagedTimestampField(gc.name) {
+			return fmt.Errorf("%w: generated column %s in table %s cannot be a primary key, auto-increment, ignored or timestamp field",
+				ErrInvalidTableOption, gc.name, m.tableName)
+		}
+		if _, ok := m.spatialPointFor(gc.name); ok {
+			return fmt.Errorf("%w: generated column %s in table %s cannot be a spatial column", ErrInvalidTableOption, gc.name, m.tableName)
+		}
+	}
+	return nil
+}
+
+// activeUniqueKey WithActiveUniqueKey的配置，用于校验
+type activeUniqueKey struct {
+	deletedAt string
+	cols      []string
+}
+
+// activeColumnName 只对未软删除行取值的生成列名
+func activeColumnName(col string) string {
+	return col + "_active"
+}
+
+// WithActiveUniqueKey 唯一键只约束未软删除的行：对每个col添加VIRTUAL生成列
+// `<col>_active` = IF(`deletedAtField` IS NULL, `col`, NULL)，并在这些列上建唯一键 uk_active_<cols>。
+// 软删除（把deletedAtField置为非NULL）后生成列变为NULL，不再参与唯一性比较，同样的值可以重新插入。
+// deletedAtField须为WithNullableFields声明的可空字段，未删除的行保持NULL；
+// 配合 WithDefaultWhere("`deleted_at` IS NULL") 即可让查询也只看到未删除的行：
+//
+//	WithNullableFields("deleted_at"), WithDefaultWhere("`deleted_at` IS NULL"), WithActiveUniqueKey("deleted_at", "email")
+//
+// 生成列为VARCHAR(255)，值超过255字符时写入报错；列不能经WithColumnMapping改名。
+func WithActiveUniqueKey(deletedAtField string, cols ...string) TableOption {
+	return func(t *MessageTable) {
+		t.activeUniqueKeys = append(t.activeUniqueKeys, activeUniqueKey{deletedAt: deletedAtField, cols: cols})
+		def := indexDef{kind: "UNIQUE KEY", name: "uk_active_" + strings.Join(cols, "_")}
+		for _, col := range cols {
+			expr := fmt.Sprintf("IF(%s IS NULL, %s, NULL)", escapeMySQLName(deletedAtField), escapeMySQLName(col))
+			t.generatedColumns = append(t.generatedColumns, generatedColumn{name: activeColumnName(col), expr: expr, storage: "VIRTUAL"})
+			def.cols = append(def.cols, activeColumnName(col))
+		}
+		t.namedIndexes = append(t.namedIndexes, def)
+	}
+}
+
+// validateActiveUniqueKeys 校验WithActiveUniqueKey：软删除字段可空，唯一列为已持久化的标量字段，二者都不能改列名
+func (m *MessageTable) validateActiveUniqueKeys() error {
+	for _, key := range m.activeUniqueKeys {
+		if len(key.cols) == 0 {
+			return fmt.Errorf("%w: active unique key in table %s has no columns", ErrInvalidTableOption, m.tableName)
+		}
+		if _, ok := m.fieldNameToDesc[key.deletedAt]; !ok || !m.isNullableField(key.deletedAt) {
+			return fmt.Errorf("%w: soft delete field %s in table %s must be a nullable field (see WithNullableFields)",
+				ErrInvalidTableOption, key.deletedAt, m.tableName)
+		}
+		for _, col := range append([]string{key.deletedAt}, key.cols...) {
+			field, ok := m.fieldNameToDesc[col]
+			if !ok {
+				return fmt.Errorf("%w: active unique key column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+			}
+			if m.columnName(col) != col {
+				return fmt.Errorf("%w: active unique key column %s in table %s cannot be renamed by WithColumnMapping",
+					ErrInvalidTableOption, col, m.tableName)
+			}
+			if col != key.deletedAt && (field.IsList() || field.IsMap() || field.Kind() == protoreflect.MessageKind) {
+				return fmt.Errorf("%w: active unique key column %s in table %s must be a scalar field", ErrInvalidTableOption, col, m.tableName)
+			}
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ module github.com/luyuancpp/proto2mysql
 go 1.26.5
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/go-sql-driver/mysql v1.8.1
 	google.golang.org/protobuf v1.36.10
 	gorm.io/gorm v1.30.0
@@ -0,0 +1,91 @@
+// Package testdyn 在测试中运行时构造testdyn包下的动态proto消息（dynamicpb），
+// testpb中没有的字段类型（时间戳、枚举、有符号整数等）由它按字段描述符拼出
+package testdyn
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Timestamp google.protobuf.Timestamp的全名，字段引用它时NewFile自动加入依赖
+const Timestamp = ".google.protobuf.Timestamp"
+
+// Field 声明一个optional字段，typeName为消息或枚举字段的类型全名；字段编号由Message按声明顺序分配
+func Field(name string, typ descriptorpb.FieldDescriptorProto_Type, typeName ...string) *descriptorpb.FieldDescriptorProto {
+	field := &descriptorpb.FieldDescriptorProto{
+		Name:  proto.String(name),
+		Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:  typ.Enum(),
+	}
+	if len(typeName) > 0 {
+		field.TypeName = proto.String(typeName[0])
+	}
+	return field
+}
+
+// Repeated 把字段改为repeated
+func Repeated(field *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return field
+}
+
+// Message 声明一个消息类型，字段编号从1开始按顺序分配
+func Message(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	for i, field := range fields {
+		field.Number = proto.Int32(int32(i + 1))
+	}
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+}
+
+// Enum 声明一个枚举类型，取值编号从0开始按顺序分配
+func Enum(name string, values ...string) *descriptorpb.EnumDescriptorProto {
+	enum := &descriptorpb.EnumDescriptorProto{Name: proto.String(name)}
+	for i, value := range values {
+		enum.Value = append(enum.Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(value), Number: proto.Int32(int32(i))})
+	}
+	return enum
+}
+
+// NewFile 构造文件名为file、包名为testdyn的proto3文件描述符，types为按顺序声明的
+// *descriptorpb.DescriptorProto或*descriptorpb.EnumDescriptorProto
+func NewFile(t testing.TB, file string, types ...proto.Message) protoreflect.FileDescriptor {
+	t.Helper()
+	fdProto := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(file),
+		Package: proto.String("testdyn"),
+		Syntax:  proto.String("proto3"),
+	}
+	for _, typ := range types {
+		switch typ := typ.(type) {
+		case *descriptorpb.EnumDescriptorProto:
+			fdProto.EnumType = append(fdProto.EnumType, typ)
+		case *descriptorpb.DescriptorProto:
+			fdProto.MessageType = append(fdProto.MessageType, typ)
+			for _, field := range typ.Field {
+				if field.GetTypeName() == Timestamp && len(fdProto.Dependency) == 0 {
+					fdProto.Dependency = []string{"google/protobuf/timestamp.proto"}
+				}
+			}
+		default:
+			t.Fatalf("不支持的类型声明: %T", typ)
+		}
+	}
+	fd, err := protodesc.NewFile(fdProto, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("构造动态描述符失败: %v", err)
+	}
+	return fd
+}
+
+// NewMessage 构造文件file中只含字段fields的消息name，返回其空实例
+func NewMessage(t testing.TB, file, name string, fields ...*descriptorpb.FieldDescriptorProto) *dynamicpb.Message {
+	t.Helper()
+	fd := NewFile(t, file, Message(name, fields...))
+	return dynamicpb.NewMessage(fd.Messages().ByName(protoreflect.Name(name)))
+}
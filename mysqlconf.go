@@ -1,6 +1,13 @@
 package proto2mysql
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
 	"github.com/go-sql-driver/mysql"
 )
 
@@ -10,6 +17,8 @@ type JsonConfig struct {
 	User   string `json:"User"`
 	Passwd string `json:"Passwd"`
 	DBName string `json:"DBName"`
+	// Charset 连接字符集（DSN的charset参数），为空时用DefaultCharset；旧库如latin1须与表字符集一致（Open会自动SetCharset）
+	Charset string `json:"Charset,omitempty"`
 }
 
 func NewMysqlConfig(jsonConfig JsonConfig) *mysql.Config {
@@ -19,9 +28,99 @@ func NewMysqlConfig(jsonConfig JsonConfig) *mysql.Config {
 	cfg.Addr = jsonConfig.Addr
 	cfg.Net = jsonConfig.Net
 	cfg.DBName = jsonConfig.DBName
-	cfg.Params = map[string]string{"charset": "utf8mb4"}
+	charset := jsonConfig.Charset
+	if charset == "" {
+		charset = DefaultCharset
+	}
+	cfg.Params = map[string]string{"charset": charset}
 	cfg.ParseTime = true
 	cfg.MultiStatements = true
 	cfg.InterpolateParams = true
 	return cfg
 }
+
+// ReadJsonConfig 读取JSON格式的连接配置文件（如 db.json，字段见JsonConfig）
+func ReadJsonConfig(path string) (JsonConfig, error) {
+	var jsonConfig JsonConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jsonConfig, fmt.Errorf("read mysql config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &jsonConfig); err != nil {
+		return jsonConfig, fmt.Errorf("parse mysql config %s: %w", path, err)
+	}
+	return jsonConfig, nil
+}
+
+// Open 按cfg创建连接器、打开连接池并Ping，校验DSN选中的库（cfg.DBName）后返回可直接注册表使用的DB。
+// DSN的charset参数不是utf8mb4时，建表默认字符集随之设置（见SetCharset）。
+// 失败时会关闭已打开的连接池。
+//
+//	pbDB, err := proto2mysql.Open(proto2mysql.NewMysqlConfig(jsonConfig))
+func Open(cfg *mysql.Config) (*DB, error) {
+	if cfg == nil {
+		return nil, errors.New("mysql config cannot be nil")
+	}
+	if cfg.DBName == "" {
+		return nil, errors.New("mysql config must select a database (DBName)")
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create mysql connector: %w", err)
+	}
+
+	db := sql.OpenDB(connector)
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping mysql %s: %w", cfg.Addr, err)
+	}
+
+	pdb := NewDB()
+	if err := pdb.setCharsetFromParams(cfg.Params); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := pdb.OpenDB(db, cfg.DBName); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return pdb, nil
+}
+
+// OpenWithJSON 读取JSON连接配置文件（见ReadJsonConfig）并Open
+func OpenWithJSON(path string) (*DB, error) {
+	jsonConfig, err := ReadJsonConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return Open(NewMysqlConfig(jsonConfig))
+}
+
+// EnsureDatabase 用不选库的连接执行CreateDatabaseIfNotExists(cfg.DBName)（字符集同DSN的charset参数），之后即可Open(cfg)。
+// 适合全新环境首次启动：
+//
+//	if err := proto2mysql.EnsureDatabase(cfg); err != nil { ... }
+//	pbDB, err := proto2mysql.Open(cfg)
+func EnsureDatabase(cfg *mysql.Config) error {
+	if cfg == nil {
+		return errors.New("mysql config cannot be nil")
+	}
+	if err := validateDatabaseName(cfg.DBName); err != nil {
+		return err
+	}
+	serverCfg := cfg.Clone()
+	serverCfg.DBName = ""
+	connector, err := mysql.NewConnector(serverCfg)
+	if err != nil {
+		return fmt.Errorf("create mysql connector: %w", err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	pdb := NewDB()
+	if err := pdb.setCharsetFromParams(cfg.Params); err != nil {
+		return err
+	}
+	pdb.DB = db
+	return pdb.CreateDatabaseIfNotExists(cfg.DBName)
+}
@@ -0,0 +1,123 @@
+package proto2mysql
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Partition RANGE分区中的一个分区：名为Name，存放分区列 < LessThan 的行。
+// LessThan原样拼入SQL，可为数值、带引号的日期或MAXVALUE，如 "1000"、"'2024-02-01'"、"MAXVALUE"
+type Partition struct {
+	Name     string
+	LessThan string
+}
+
+// partitionSpec 表分区配置（WithRangePartition/WithHashPartition，后设置的覆盖先设置的）
+type partitionSpec struct {
+	kind       string // RANGE / HASH
+	column     string // 分区字段名
+	partitions []Partition
+	count      int // HASH分区数
+}
+
+// WithRangePartition 建表时按column做RANGE分区（如时序表按月分区），整数列生成 PARTITION BY RANGE (col)，
+// Timestamp/string列生成 PARTITION BY RANGE COLUMNS(col)。MySQL要求分区列属于主键（及唯一键）。
+// 只作用于建表，已有表的分区需手工ALTER TABLE ... PARTITION BY 或 REORGANIZE PARTITION 维护。
+//
+//	WithRangePartition("created_at", []Partition{{"p202401", "'2024-02-01'"}, {"pmax", "MAXVALUE"}})
+func WithRangePartition(column string, partitions []Partition) TableOption {
+	return func(t *MessageTable) {
+		t.partition = &partitionSpec{kind: "RANGE", column: column, partitions: partitions}
+	}
+}
+
+// WithHashPartition 建表时按整数列column做 PARTITION BY HASH (col) PARTITIONS count，
+// MySQL要求分区列属于主键（及唯一键）。只作用于建表。
+func WithHashPartition(column string, count int) TableOption {
+	return func(t *MessageTable) {
+		t.partition = &partitionSpec{kind: "HASH", column: column, count: count}
+	}
+}
+
+// partitionSQL 建表语句末尾的分区子句（含前导空格），未配置分区时为空串
+func (m *MessageTable) partitionSQL() string {
+	spec := m.partition
+	if spec == nil {
+		return ""
+	}
+	column := m.quotedColumn(spec.column)
+	if spec.kind == "HASH" {
+		return fmt.Sprintf(" PARTITION BY HASH (%s) PARTITIONS %d", column, spec.count)
+	}
+
+	by := fmt.Sprintf("RANGE (%s)", column)
+	if field := m.Descriptor.Fields().ByName(protoreflect.Name(spec.column)); field != nil && !isIntegerKind(field.Kind()) {
+		by = fmt.Sprintf("RANGE COLUMNS(%s)", column)
+	}
+	defs := make([]string, len(spec.partitions))
+	for i, p := range spec.partitions {
+		lessThan := p.LessThan
+		if !strings.EqualFold(strings.TrimSpace(lessThan), "MAXVALUE") {
+			lessThan = "(" + lessThan + ")"
+		}
+		defs[i] = fmt.Sprintf("PARTITION %s VALUES LESS THAN %s", escapeMySQLName(p.Name), lessThan)
+	}
+	return fmt.Sprintf(" PARTITION BY %s (%s)", by, strings.Join(defs, ", "))
+}
+
+// validatePartition 校验分区配置：分区列须存在且属于主键与唯一键，HASH分区列须为整数，
+// RANGE分区名不能为空或重复；分区表不支持全文索引与空间索引
+func (m *MessageTable) validatePartition() error {
+	spec := m.partition
+	if spec == nil {
+		return nil
+	}
+	field := m.Descriptor.Fields().ByName(protoreflect.Name(spec.column))
+	if field == nil || m.isIgnoredField(spec.column) {
+		return fmt.Errorf("%w: partition column %s not found in table %s", ErrInvalidTableOption, spec.column, m.tableName)
+	}
+	if !slices.Contains(m.primaryKey, spec.column) {
+		return fmt.Errorf("%w: partition column %s in table %s must be part of the primary key",
+			ErrInvalidTableOption, spec.column, m.tableName)
+	}
+	if m.uniqueKeys != "" && !slices.Contains(splitOptionCSV(m.uniqueKeys), spec.column) {
+		return fmt.Errorf("%w: partition column %s in table %s must be part of the unique key",
+			ErrInvalidTableOption, spec.column, m.tableName)
+	}
+	if len(m.fullTextKeys) > 0 || len(m.spatialPoints) > 0 {
+		return fmt.Errorf("%w: partitioned table %s cannot have fulltext or spatial indexes", ErrInvalidTableOption, m.tableName)
+	}
+
+	if spec.kind == "HASH" {
+		if !isIntegerKind(field.Kind()) {
+			return fmt.Errorf("%w: hash partition column %s in table %s must be an integer field, got %s",
+				ErrInvalidTableOption, spec.column, m.tableName, field.Kind())
+		}
+		if spec.count < 1 {
+			return fmt.Errorf("%w: hash partition count of table %s must be positive, got %d",
+				ErrInvalidTableOption, m.tableName, spec.count)
+		}
+		return nil
+	}
+
+	if len(spec.partitions) == 0 {
+		return fmt.Errorf("%w: range partition of table %s has no partitions", ErrInvalidTableOption, m.tableName)
+	}
+	seen := make(map[string]bool, len(spec.partitions))
+	for _, p := range spec.partitions {
+		name := strings.ToLower(p.Name)
+		if p.Name == "" || seen[name] {
+			return fmt.Errorf("%w: range partition name %q in table %s is empty or duplicated",
+				ErrInvalidTableOption, p.Name, m.tableName)
+		}
+		if strings.TrimSpace(p.LessThan) == "" {
+			return fmt.Errorf("%w: range partition %s in table %s has an empty LESS THAN value",
+				ErrInvalidTableOption, p.Name, m.tableName)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -2,9 +2,13 @@ package pbconv
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/protobuf/proto"
@@ -13,18 +17,121 @@ import (
 )
 
 // SerializeFieldAsString 将消息中的单个字段序列化为字符串：
-//   - Timestamp        -> "2006-01-02 15:04:05"
+//   - Timestamp        -> "2006-01-02 15:04:05"（可用SetDateTimeLayout修改）
 //   - map/list/bytes/嵌套消息 -> proto wire格式 + Base64
 //   - 标量             -> 十进制/布尔字符串
 func SerializeFieldAsString(message proto.Message, fieldDesc protoreflect.FieldDescriptor) (string, error) {
+	return SerializeFieldWithOptions(message, fieldDesc, FieldOptions{})
+}
+
+// FieldOptions 单个字段的编解码选项（由调用方按表配置逐字段传入）
+type FieldOptions struct {
+	// TimestampAsEpoch Timestamp字段按Unix秒存取（BIGINT列），未设置时写0，读到0时保持未设置
+	TimestampAsEpoch bool
+	// BytesAsHex bytes字段按小写十六进制文本存取（如MD5/SHA摘要），替代默认的base64
+	BytesAsHex bool
+	// EnumAsName enum字段按值名存取（MySQL ENUM列），读取时也接受十进制数字
+	EnumAsName bool
+	// BoolAsBit bool字段按BIT(1)存取：写入单字节"\x00"/"\x01"（BIT列按二进制串赋值，文本"1"是0x31会超长），
+	// 读取时解析MySQL返回的单字节0x00/0x01，也接受0/1/true/false文本
+	BoolAsBit bool
+}
+
+// FieldCodec 单个子消息字段的自定义编解码（RegisterFieldCodec注册）
+type FieldCodec struct {
+	Encode func(proto.Message) (string, error)
+	Decode func(string, proto.Message) error
+}
+
+var (
+	fieldCodecsMu sync.RWMutex
+	fieldCodecs   = map[protoreflect.FullName]FieldCodec{}
+)
+
+// RegisterFieldCodec 为指定字段（字段全名，如 "pkg.Player.profile"）注册自定义编解码，
+// 替代默认的proto wire+Base64，如存为可读的JSON。只对单值子消息字段生效（Timestamp、map/repeated除外）；
+// encode收到的是已设置的子消息，decode收到非空文本与一个空的子消息；未设置的字段写空串，读到空串保持未设置。
+// encode或decode为nil时取消该字段的注册。应在初始化时注册，之后并发读写安全。
+//
+//	pbconv.RegisterFieldCodec(field.FullName(),
+//		func(m proto.Message) (string, error) { b, err := protojson.Marshal(m); return string(b), err },
+//		func(s string, m proto.Message) error { return protojson.Unmarshal([]byte(s), m) })
+func RegisterFieldCodec(fieldFullName protoreflect.FullName, encode func(proto.Message) (string, error), decode func(string, proto.Message) error) {
+	fieldCodecsMu.Lock()
+	defer fieldCodecsMu.Unlock()
+	if encode == nil || decode == nil {
+		delete(fieldCodecs, fieldFullName)
+		return
+	}
+	fieldCodecs[fieldFullName] = FieldCodec{Encode: encode, Decode: decode}
+}
+
+// lookupFieldCodec 返回字段注册的自定义编解码（仅单值、非Timestamp的子消息字段）
+func lookupFieldCodec(fieldDesc protoreflect.FieldDescriptor) (FieldCodec, bool) {
+	if fieldDesc.IsMap() || fieldDesc.IsList() || fieldDesc.Kind() != protoreflect.MessageKind || isTimestampField(fieldDesc) {
+		return FieldCodec{}, false
+	}
+	fieldCodecsMu.RLock()
+	defer fieldCodecsMu.RUnlock()
+	codec, ok := fieldCodecs[fieldDesc.FullName()]
+	return codec, ok
+}
+
+// serializeWithCodec 用自定义编解码序列化子消息字段（未设置返回空串）
+func serializeWithCodec(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, codec FieldCodec) (string, error) {
+	if !reflection.Has(fieldDesc) {
+		return "", nil
+	}
+	text, err := codec.Encode(reflection.Get(fieldDesc).Message().Interface())
+	if err != nil {
+		return "", fmt.Errorf("encode field %s: %w", fieldDesc.Name(), err)
+	}
+	return text, nil
+}
+
+// parseWithCodec 用自定义编解码解析子消息字段（空串清除字段）
+func parseWithCodec(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw string, codec FieldCodec) error {
+	if raw == "" {
+		reflection.Clear(fieldDesc)
+		return nil
+	}
+	subMsg := reflection.NewField(fieldDesc).Message()
+	if err := codec.Decode(raw, subMsg.Interface()); err != nil {
+		return fmt.Errorf("decode field %s: %w", fieldDesc.Name(), err)
+	}
+	reflection.Set(fieldDesc, protoreflect.ValueOfMessage(subMsg))
+	return nil
+}
+
+// SerializeFieldWithOptions 同SerializeFieldAsString，按opts调整单个字段的编码
+func SerializeFieldWithOptions(message proto.Message, fieldDesc protoreflect.FieldDescriptor, opts FieldOptions) (string, error) {
 	reflection := message.ProtoReflect()
 
+	if codec, ok := lookupFieldCodec(fieldDesc); ok {
+		return serializeWithCodec(reflection, fieldDesc, codec)
+	}
+
 	if isTimestampField(fieldDesc) {
+		if opts.TimestampAsEpoch {
+			return serializeEpoch(reflection, fieldDesc)
+		}
 		return serializeTimestamp(reflection, fieldDesc)
 	}
 	if fieldDesc.IsMap() || fieldDesc.IsList() {
 		return serializeContainer(reflection, fieldDesc)
 	}
+	if opts.BytesAsHex && fieldDesc.Kind() == protoreflect.BytesKind {
+		return hex.EncodeToString(reflection.Get(fieldDesc).Bytes()), nil
+	}
+	if opts.EnumAsName && fieldDesc.Kind() == protoreflect.EnumKind {
+		return serializeEnumName(reflection, fieldDesc)
+	}
+	if opts.BoolAsBit && fieldDesc.Kind() == protoreflect.BoolKind {
+		if reflection.Get(fieldDesc).Bool() {
+			return "\x01", nil
+		}
+		return "\x00", nil
+	}
 
 	switch fieldDesc.Kind() {
 	case protoreflect.Int32Kind, protoreflect.Int64Kind:
@@ -62,14 +169,38 @@ func serializeTimestamp(reflection protoreflect.Message, fieldDesc protoreflect.
 	if !reflection.Has(fieldDesc) {
 		return "", nil
 	}
-	ts, ok := reflection.Get(fieldDesc).Message().Interface().(*timestamppb.Timestamp)
-	if !ok {
-		return "", fmt.Errorf("field %s is not a Timestamp", fieldDesc.Name())
+	ts, err := timestampTime(reflection.Get(fieldDesc).Message(), fieldDesc)
+	if err != nil {
+		return "", err
 	}
-	if ts.AsTime().IsZero() {
+	if ts.IsZero() {
 		return "", nil
 	}
-	return ts.AsTime().Format(mysqlDateTimeLayout), nil
+	return ts.Format(DateTimeLayout()), nil
+}
+
+// serializeEpoch 将Timestamp字段格式化为Unix秒（未设置返回"0"，BIGINT NOT NULL列不能写空串）
+func serializeEpoch(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor) (string, error) {
+	if !reflection.Has(fieldDesc) {
+		return "0", nil
+	}
+	ts, err := timestampTime(reflection.Get(fieldDesc).Message(), fieldDesc)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(ts.Unix(), 10), nil
+}
+
+// timestampTime 按seconds/nanos字段读取Timestamp消息的时间（UTC）。通过反射读取而不是断言*timestamppb.Timestamp，
+// dynamicpb消息（如按描述符反序列化得到的）中的Timestamp子消息同样适用
+func timestampTime(ts protoreflect.Message, fieldDesc protoreflect.FieldDescriptor) (time.Time, error) {
+	if ts.Descriptor().FullName() != timestampFullName {
+		return time.Time{}, fmt.Errorf("field %s is not a Timestamp", fieldDesc.Name())
+	}
+	fields := ts.Descriptor().Fields()
+	seconds := ts.Get(fields.ByNumber(timestampSecondsNumber)).Int()
+	nanos := ts.Get(fields.ByNumber(timestampNanosNumber)).Int()
+	return time.Unix(seconds, nanos).UTC(), nil
 }
 
 // serializeContainer 序列化map/list字段：将字段放入一个同类型的空消息中，
@@ -94,14 +225,44 @@ var (
 	ErrInvalidFieldKind = errors.New("invalid field kind")
 )
 
-// mysqlDateTimeLayout 是写入MySQL DATETIME列的时间格式
-const mysqlDateTimeLayout = "2006-01-02 15:04:05"
+// google.protobuf.Timestamp 的字段号（seconds = 1, nanos = 2）
+const (
+	timestampSecondsNumber protoreflect.FieldNumber = 1
+	timestampNanosNumber   protoreflect.FieldNumber = 2
+)
+
+// DefaultDateTimeLayout 是写入MySQL DATETIME列的默认时间格式（秒级，UTC）
+const DefaultDateTimeLayout = "2006-01-02 15:04:05"
+
+// dateTimeLayout 当前写入格式（SetDateTimeLayout设置，nil表示默认）
+var dateTimeLayout atomic.Pointer[string]
 
-// timestampParseLayouts 是从MySQL读取时间时支持的格式（按优先级尝试）
+// SetDateTimeLayout 全局设置Timestamp写入时使用的时间格式（Go time layout），传空串恢复默认。
+// 如 DATETIME(6) 列用 "2006-01-02 15:04:05.000000" 保留微秒，存ISO8601文本的旧表用 time.RFC3339Nano。
+// 读取时优先按该格式解析，失败再依次尝试内置格式。应在初始化时设置一次。
+func SetDateTimeLayout(layout string) {
+	if layout == "" {
+		dateTimeLayout.Store(nil)
+		return
+	}
+	dateTimeLayout.Store(&layout)
+}
+
+// DateTimeLayout 返回当前Timestamp写入格式
+func DateTimeLayout() string {
+	if layout := dateTimeLayout.Load(); layout != nil {
+		return *layout
+	}
+	return DefaultDateTimeLayout
+}
+
+// timestampParseLayouts 是从MySQL读取时间时支持的内置格式（按优先级尝试）。
+// 解析时秒后的小数部分可为任意精度，无需为毫秒/微秒单独列格式。
 var timestampParseLayouts = []string{
-	"2006-01-02 15:04:05.999", // 带毫秒
-	"2006-01-02 15:04:05",     // 不带毫秒
-	"2006-01-02",              // 仅日期
+	DefaultDateTimeLayout, // DATETIME / DATETIME(n)
+	time.RFC3339Nano,      // ISO8601带时区，如 2006-01-02T15:04:05.123Z、2006-01-02T15:04:05+08:00
+	"2006-01-02T15:04:05", // ISO8601不带时区（按UTC）
+	"2006-01-02",          // 仅日期
 }
 
 // isTimestampField 判断字段是否为单值的google.protobuf.Timestamp
@@ -131,6 +292,149 @@ func ParseFromString(message proto.Message, row []string) error {
 	return nil
 }
 
+// ParseFromBytes 与ParseFromString相同，但直接接收驱动扫描出的[][]byte：
+// bytes/子消息/map/repeated字段直接从字节解码base64，省去宽blob列先转string的整份拷贝。
+// 解析结果不引用row的内存，调用方可在返回后复用row（如sql.RawBytes）。
+func ParseFromBytes(message proto.Message, row [][]byte) error {
+	reflection := message.ProtoReflect()
+	fields := reflection.Descriptor().Fields()
+
+	count := min(len(row), fields.Len())
+	for i := 0; i < count; i++ {
+		if err := setFieldFromBytes(reflection, fields.Get(i), row[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseFieldFromBytes 把单个字节值反序列化到消息的指定字段，语义同ParseFieldFromString
+func ParseFieldFromBytes(message proto.Message, fieldDesc protoreflect.FieldDescriptor, raw []byte) error {
+	return setFieldFromBytes(message.ProtoReflect(), fieldDesc, raw)
+}
+
+// ParseFieldFromBytesWithOptions 同ParseFieldFromBytes，按opts调整单个字段的解码（与SerializeFieldWithOptions对称）
+func ParseFieldFromBytesWithOptions(message proto.Message, fieldDesc protoreflect.FieldDescriptor, raw []byte, opts FieldOptions) error {
+	if handled, err := parseWithOptions(message.ProtoReflect(), fieldDesc, raw, opts); handled {
+		return err
+	}
+	return setFieldFromBytes(message.ProtoReflect(), fieldDesc, raw)
+}
+
+// parseWithOptions 处理opts改变了编码的字段，返回false表示按默认编码解析
+func parseWithOptions(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw []byte, opts FieldOptions) (bool, error) {
+	switch {
+	case opts.TimestampAsEpoch && isTimestampField(fieldDesc):
+		return true, parseEpoch(reflection, fieldDesc, string(raw))
+	case opts.BytesAsHex && !fieldDesc.IsList() && fieldDesc.Kind() == protoreflect.BytesKind:
+		return true, parseHex(reflection, fieldDesc, raw)
+	case opts.EnumAsName && !fieldDesc.IsList() && fieldDesc.Kind() == protoreflect.EnumKind:
+		return true, parseEnumName(reflection, fieldDesc, string(raw))
+	case opts.BoolAsBit && !fieldDesc.IsList() && fieldDesc.Kind() == protoreflect.BoolKind:
+		return true, parseBit(reflection, fieldDesc, raw)
+	}
+	return false, nil
+}
+
+// ParseFieldFromString 把单个字符串值反序列化到消息的指定字段，与SerializeFieldAsString对称。
+// 供只持久化部分字段（列与字段不一一对应）的调用方逐列解析。
+func ParseFieldFromString(message proto.Message, fieldDesc protoreflect.FieldDescriptor, raw string) error {
+	return setFieldFromString(message.ProtoReflect(), fieldDesc, raw)
+}
+
+// ParseFromStringByName 按列名把一行查询结果反序列化到消息中：columns[i]是row[i]的列名，
+// 与消息字段名精确匹配（匹配不上再忽略大小写）；消息中不存在的列（如JOIN带出的其他表列）直接忽略。
+// 用于原生SQL/投影查询等列顺序与字段声明顺序不一致的场景。
+func ParseFromStringByName(message proto.Message, columns []string, row []string) error {
+	return ParseFromStringByNameWithOptions(message, columns, row, nil)
+}
+
+// ParseFromStringByNameWithOptions 同ParseFromStringByName，optionsFor返回每个匹配字段的编解码选项（可为nil）
+func ParseFromStringByNameWithOptions(message proto.Message, columns []string, row []string,
+	optionsFor func(protoreflect.FieldDescriptor) FieldOptions) error {
+	if len(columns) != len(row) {
+		return fmt.Errorf("column count %d does not match value count %d", len(columns), len(row))
+	}
+	reflection := message.ProtoReflect()
+	fields := reflection.Descriptor().Fields()
+
+	for i, column := range columns {
+		fieldDesc := fields.ByName(protoreflect.Name(column))
+		if fieldDesc == nil {
+			fieldDesc = fieldByNameFold(fields, column)
+		}
+		if fieldDesc == nil {
+			continue
+		}
+		if optionsFor != nil {
+			if handled, err := parseWithOptions(reflection, fieldDesc, []byte(row[i]), optionsFor(fieldDesc)); handled {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := setFieldFromString(reflection, fieldDesc, row[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByNameFold 忽略大小写查找字段（MySQL列名不区分大小写）
+func fieldByNameFold(fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+	for i := 0; i < fields.Len(); i++ {
+		if strings.EqualFold(string(fields.Get(i).Name()), name) {
+			return fields.Get(i)
+		}
+	}
+	return nil
+}
+
+// setFieldFromBytes 以base64存储的字段直接从字节解码，其余字段（值很短）转string后复用setFieldFromString
+func setFieldFromBytes(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw []byte) error {
+	if codec, ok := lookupFieldCodec(fieldDesc); ok {
+		return parseWithCodec(reflection, fieldDesc, string(raw), codec)
+	}
+	if !isBase64Field(fieldDesc) {
+		return setFieldFromString(reflection, fieldDesc, string(raw))
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(raw)))
+	n, err := base64.StdEncoding.Decode(data, raw)
+	if err != nil {
+		return fmt.Errorf("decode field %s: %w", fieldDesc.Name(), err)
+	}
+	data = data[:n]
+
+	switch {
+	case fieldDesc.IsMap() || fieldDesc.IsList():
+		return mergeContainer(reflection, fieldDesc, data)
+	case fieldDesc.Kind() == protoreflect.BytesKind:
+		reflection.Set(fieldDesc, protoreflect.ValueOfBytes(data))
+	default:
+		subMsg := reflection.Mutable(fieldDesc).Message()
+		if err := proto.Unmarshal(data, subMsg.Interface()); err != nil {
+			return fmt.Errorf("unmarshal sub-message field %s: %w", fieldDesc.Name(), err)
+		}
+	}
+	return nil
+}
+
+// isBase64Field 判断字段在MySQL中是否以base64文本存储（bytes、非Timestamp子消息、map/repeated）
+func isBase64Field(fd protoreflect.FieldDescriptor) bool {
+	if fd.IsMap() || fd.IsList() {
+		return true
+	}
+	if isTimestampField(fd) {
+		return false
+	}
+	return fd.Kind() == protoreflect.BytesKind || fd.Kind() == protoreflect.MessageKind
+}
+
 // setFieldFromString 将单个字符串值反序列化到消息的指定字段
 func setFieldFromString(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw string) error {
 	fieldName := fieldDesc.Name()
@@ -141,6 +445,9 @@ func setFieldFromString(reflection protoreflect.Message, fieldDesc protoreflect.
 	if fieldDesc.IsMap() || fieldDesc.IsList() {
 		return parseContainer(reflection, fieldDesc, raw)
 	}
+	if codec, ok := lookupFieldCodec(fieldDesc); ok {
+		return parseWithCodec(reflection, fieldDesc, raw, codec)
+	}
 	if raw == "" {
 		setScalarDefault(reflection, fieldDesc)
 		return nil
@@ -223,13 +530,12 @@ func parseTimestamp(reflection protoreflect.Message, fieldDesc protoreflect.Fiel
 	if raw == "" {
 		return nil
 	}
-	var parsed time.Time
-	var err error
+	parsed, err := time.Parse(DateTimeLayout(), raw)
 	for _, layout := range timestampParseLayouts {
-		parsed, err = time.Parse(layout, raw)
 		if err == nil {
 			break
 		}
+		parsed, err = time.Parse(layout, raw)
 	}
 	if err != nil {
 		return fmt.Errorf("parse timestamp field %s: %w (value: %s)", fieldDesc.Name(), err, raw)
@@ -238,6 +544,78 @@ func parseTimestamp(reflection protoreflect.Message, fieldDesc protoreflect.Fiel
 	return nil
 }
 
+// parseEpoch 解析Unix秒到Timestamp字段（空值或0跳过，与serializeEpoch对称）
+func parseEpoch(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw string) error {
+	if raw == "" || raw == "0" {
+		return nil
+	}
+	sec, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return parseFieldErr("epoch timestamp", fieldDesc.Name(), raw, err)
+	}
+	reflection.Set(fieldDesc, protoreflect.ValueOfMessage(timestamppb.New(time.Unix(sec, 0)).ProtoReflect()))
+	return nil
+}
+
+// parseHex 解析十六进制文本存储的bytes字段（FieldOptions.BytesAsHex），空值保持未设置
+func parseHex(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	data := make([]byte, hex.DecodedLen(len(raw)))
+	if _, err := hex.Decode(data, raw); err != nil {
+		return parseFieldErr("hex bytes", fieldDesc.Name(), string(raw), err)
+	}
+	reflection.Set(fieldDesc, protoreflect.ValueOfBytes(data))
+	return nil
+}
+
+// parseBit 解析BIT(1)列的值（FieldOptions.BoolAsBit）：单字节0x00/0x01，或0/1/true/false文本，空值置false
+func parseBit(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw []byte) error {
+	switch {
+	case len(raw) == 0:
+		setScalarDefault(reflection, fieldDesc)
+		return nil
+	case len(raw) == 1 && raw[0] <= 1:
+		reflection.Set(fieldDesc, protoreflect.ValueOfBool(raw[0] == 1))
+		return nil
+	}
+	v, err := strconv.ParseBool(string(raw))
+	if err != nil {
+		return parseFieldErr("bit", fieldDesc.Name(), string(raw), err)
+	}
+	reflection.Set(fieldDesc, protoreflect.ValueOfBool(v))
+	return nil
+}
+
+// serializeEnumName 将enum字段格式化为值名；未在enum中声明的数值无法写入ENUM列，返回错误
+func serializeEnumName(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor) (string, error) {
+	number := reflection.Get(fieldDesc).Enum()
+	value := fieldDesc.Enum().Values().ByNumber(number)
+	if value == nil {
+		return "", fmt.Errorf("enum field %s: value %d is not declared in %s", fieldDesc.Name(), number, fieldDesc.Enum().FullName())
+	}
+	return string(value.Name()), nil
+}
+
+// parseEnumName 按值名解析enum字段（serializeEnumName的逆操作），空串置零值，数字按枚举值解析
+func parseEnumName(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw string) error {
+	if raw == "" {
+		reflection.Clear(fieldDesc)
+		return nil
+	}
+	if value := fieldDesc.Enum().Values().ByName(protoreflect.Name(raw)); value != nil {
+		reflection.Set(fieldDesc, protoreflect.ValueOfEnum(value.Number()))
+		return nil
+	}
+	number, err := strconv.ParseInt(raw, 10, 32)
+	if err != nil {
+		return parseFieldErr("enum name", fieldDesc.Name(), raw, err)
+	}
+	reflection.Set(fieldDesc, protoreflect.ValueOfEnum(protoreflect.EnumNumber(number)))
+	return nil
+}
+
 // parseContainer 反序列化map/list字段（serializeContainer的逆操作）
 func parseContainer(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, raw string) error {
 	if raw == "" {
@@ -247,7 +625,11 @@ func parseContainer(reflection protoreflect.Message, fieldDesc protoreflect.Fiel
 	if err != nil {
 		return fmt.Errorf("decode field %s: %w (value: %s)", fieldDesc.Name(), err, raw)
 	}
+	return mergeContainer(reflection, fieldDesc, data)
+}
 
+// mergeContainer 把base64解码后的容器数据写回map/list字段（list先清空）
+func mergeContainer(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor, data []byte) error {
 	holder := reflection.New()
 	if err := proto.Unmarshal(data, holder.Interface()); err != nil {
 		return fmt.Errorf("parse field %s: %w", fieldDesc.Name(), err)
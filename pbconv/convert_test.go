@@ -1,10 +1,20 @@
 package pbconv
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/luyuancpp/proto2mysql/internal/testdyn"
 	testpb "github.com/luyuancpp/proto2mysql/internal/testpb"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // TestScalarFieldRoundTrip 验证标量与嵌套消息字段的序列化/反序列化对称性
@@ -95,3 +105,413 @@ func TestEmptyValuesRoundTrip(t *testing.T) {
 		t.Errorf("round trip mismatch\nwant: %s\ngot:  %s", src.String(), dst.String())
 	}
 }
+
+// TestParseFromStringByName 验证按列名解析：列顺序任意、大小写不敏感、未知列忽略
+func TestParseFromStringByName(t *testing.T) {
+	dst := &testpb.GolangTest{}
+	columns := []string{"port", "extra_join_col", "IP", "id"}
+	row := []string{"3306", "ignored", "127.0.0.1", "42"}
+	if err := ParseFromStringByName(dst, columns, row); err != nil {
+		t.Fatalf("parse by name: %v", err)
+	}
+	want := &testpb.GolangTest{Id: 42, Ip: "127.0.0.1", Port: 3306}
+	if !proto.Equal(want, dst) {
+		t.Errorf("parse by name mismatch\nwant: %s\ngot:  %s", want.String(), dst.String())
+	}
+
+	if err := ParseFromStringByName(dst, []string{"id"}, nil); err == nil {
+		t.Error("列数与值数不一致应报错")
+	}
+}
+
+// TestParseFromBytesMatchesString ParseFromBytes与ParseFromString解析结果一致，且不引用row内存
+func TestParseFromBytesMatchesString(t *testing.T) {
+	src := &testpb.GolangTest{
+		Id:      1,
+		GroupId: 2,
+		Ip:      "10.0.0.1",
+		Port:    80,
+		Player:  &testpb.Player{PlayerId: 3, Name: "blob"},
+	}
+	desc := src.ProtoReflect().Descriptor().Fields()
+	row := make([]string, desc.Len())
+	for i := 0; i < desc.Len(); i++ {
+		val, err := SerializeFieldAsString(src, desc.Get(i))
+		if err != nil {
+			t.Fatalf("serialize field %s: %v", desc.Get(i).Name(), err)
+		}
+		row[i] = val
+	}
+
+	fromString := &testpb.GolangTest{}
+	if err := ParseFromString(fromString, row); err != nil {
+		t.Fatalf("ParseFromString: %v", err)
+	}
+
+	byteRow := make([][]byte, len(row))
+	for i, v := range row {
+		byteRow[i] = []byte(v)
+	}
+	fromBytes := &testpb.GolangTest{}
+	if err := ParseFromBytes(fromBytes, byteRow); err != nil {
+		t.Fatalf("ParseFromBytes: %v", err)
+	}
+	if !proto.Equal(fromString, fromBytes) || !proto.Equal(src, fromBytes) {
+		t.Errorf("解析结果不一致\nstring: %v\nbytes:  %v", fromString, fromBytes)
+	}
+
+	// 模拟驱动复用缓冲区（sql.RawBytes）：覆写row后已解析的值不应变化
+	for _, b := range byteRow {
+		for i := range b {
+			b[i] = 'x'
+		}
+	}
+	if !proto.Equal(src, fromBytes) {
+		t.Errorf("解析结果不应引用row内存: %v", fromBytes)
+	}
+
+	if err := ParseFieldFromBytes(&testpb.GolangTest{}, desc.ByName("player"), []byte("!!")); err == nil {
+		t.Error("非法base64应返回错误")
+	}
+}
+
+// BenchmarkParseLargeBlob 对比1MB子消息blob列的两种解析路径：
+// string为旧路径（[]byte转string后解析），bytes直接从字节解码base64
+func BenchmarkParseLargeBlob(b *testing.B) {
+	src := &testpb.GolangTest{
+		Id:     1,
+		Player: &testpb.Player{PlayerId: 1, Name: strings.Repeat("a", 1<<20)},
+	}
+	desc := src.ProtoReflect().Descriptor().Fields()
+	byteRow := make([][]byte, desc.Len())
+	for i := 0; i < desc.Len(); i++ {
+		val, err := SerializeFieldAsString(src, desc.Get(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		byteRow[i] = []byte(val)
+	}
+
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			row := make([]string, len(byteRow))
+			for i, v := range byteRow {
+				row[i] = string(v)
+			}
+			if err := ParseFromString(&testpb.GolangTest{}, row); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if err := ParseFromBytes(&testpb.GolangTest{}, byteRow); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// newTimestampHolder 构造只含一个Timestamp字段 at 的动态消息描述符
+func newTimestampHolder(t *testing.T) (protoreflect.MessageDescriptor, protoreflect.FieldDescriptor) {
+	t.Helper()
+	md := testdyn.NewMessage(t, "pbconv_timestamp_holder.proto", "TimestampHolder",
+		testdyn.Field("at", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, testdyn.Timestamp)).Descriptor()
+	return md, md.Fields().ByName("at")
+}
+
+// TestTimestampLayoutRoundTrip 验证SetDateTimeLayout配置的格式（微秒精度、RFC3339）可往返
+func TestTimestampLayoutRoundTrip(t *testing.T) {
+	defer SetDateTimeLayout("")
+	md, field := newTimestampHolder(t)
+	want := time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC)
+
+	cases := []struct {
+		layout string
+		text   string
+	}{
+		{"2006-01-02 15:04:05.000000", "2024-05-06 07:08:09.123456"},
+		{time.RFC3339Nano, "2024-05-06T07:08:09.123456Z"},
+	}
+	for _, tc := range cases {
+		SetDateTimeLayout(tc.layout)
+		src := dynamicpb.NewMessage(md)
+		src.Set(field, protoreflect.ValueOfMessage(timestamppb.New(want).ProtoReflect()))
+
+		text, err := SerializeFieldAsString(src, field)
+		if err != nil {
+			t.Fatalf("serialize with layout %q: %v", tc.layout, err)
+		}
+		if text != tc.text {
+			t.Errorf("layout %q serialized to %q, want %q", tc.layout, text, tc.text)
+		}
+
+		dst := dynamicpb.NewMessage(md)
+		if err := ParseFieldFromString(dst, field, text); err != nil {
+			t.Fatalf("parse %q: %v", text, err)
+		}
+		if !proto.Equal(src, dst) {
+			t.Errorf("layout %q round trip mismatch: want %v, got %v", tc.layout, src, dst)
+		}
+	}
+
+	// 默认格式下也能读入微秒精度与RFC3339（含时区偏移）的文本
+	SetDateTimeLayout("")
+	if got := DateTimeLayout(); got != DefaultDateTimeLayout {
+		t.Fatalf("empty layout should restore default, got %q", got)
+	}
+	for _, text := range []string{
+		"2024-05-06 07:08:09.123456",
+		"2024-05-06T07:08:09.123456Z",
+		"2024-05-06T15:08:09.123456+08:00",
+		"2024-05-06T07:08:09.123456",
+	} {
+		dst := dynamicpb.NewMessage(md)
+		if err := ParseFieldFromString(dst, field, text); err != nil {
+			t.Fatalf("parse %q with default layout: %v", text, err)
+		}
+		got := dst.Get(field).Message().Interface().(*timestamppb.Timestamp).AsTime()
+		if !got.Equal(want) {
+			t.Errorf("parse %q = %v, want %v", text, got, want)
+		}
+	}
+}
+
+// TestTimestampAsEpoch 验证FieldOptions.TimestampAsEpoch按Unix秒往返，未设置写0
+func TestTimestampAsEpoch(t *testing.T) {
+	md, field := newTimestampHolder(t)
+	opts := FieldOptions{TimestampAsEpoch: true}
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	src := dynamicpb.NewMessage(md)
+	if text, err := SerializeFieldWithOptions(src, field, opts); err != nil || text != "0" {
+		t.Fatalf("unset epoch field should serialize to \"0\", got %q (%v)", text, err)
+	}
+	src.Set(field, protoreflect.ValueOfMessage(timestamppb.New(when).ProtoReflect()))
+	text, err := SerializeFieldWithOptions(src, field, opts)
+	if err != nil {
+		t.Fatalf("serialize epoch: %v", err)
+	}
+	if text != "1714979289" {
+		t.Errorf("epoch serialized to %q, want 1714979289", text)
+	}
+
+	fromBytes := dynamicpb.NewMessage(md)
+	if err := ParseFieldFromBytesWithOptions(fromBytes, field, []byte(text), opts); err != nil {
+		t.Fatalf("parse epoch bytes: %v", err)
+	}
+	fromName := dynamicpb.NewMessage(md)
+	optionsFor := func(protoreflect.FieldDescriptor) FieldOptions { return opts }
+	if err := ParseFromStringByNameWithOptions(fromName, []string{"at"}, []string{text}, optionsFor); err != nil {
+		t.Fatalf("parse epoch by name: %v", err)
+	}
+	if !proto.Equal(src, fromBytes) || !proto.Equal(src, fromName) {
+		t.Errorf("epoch round trip mismatch: want %v, got %v / %v", src, fromBytes, fromName)
+	}
+
+	zero := dynamicpb.NewMessage(md)
+	if err := ParseFieldFromBytesWithOptions(zero, field, []byte("0"), opts); err != nil || zero.Has(field) {
+		t.Errorf("epoch 0 should leave the field unset, has=%v err=%v", zero.Has(field), err)
+	}
+	if err := ParseFieldFromBytesWithOptions(zero, field, []byte("2024-05-06"), opts); err == nil {
+		t.Error("non-numeric epoch should fail to parse")
+	}
+}
+
+// TestDynamicTimestampSubMessage 验证反序列化得到的dynamicpb消息（Timestamp子消息也是dynamicpb）可按DATETIME与Unix秒序列化
+func TestDynamicTimestampSubMessage(t *testing.T) {
+	md, field := newTimestampHolder(t)
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	src := dynamicpb.NewMessage(md)
+	src.Set(field, protoreflect.ValueOfMessage(timestamppb.New(when).ProtoReflect()))
+	data, err := proto.Marshal(src)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	decoded := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := decoded.Get(field).Message().Interface().(*dynamicpb.Message); !ok {
+		t.Fatalf("decoded sub-message should be dynamic, got %T", decoded.Get(field).Message().Interface())
+	}
+
+	if text, err := SerializeFieldAsString(decoded, field); err != nil || text != "2024-05-06 07:08:09" {
+		t.Errorf("datetime serialized to %q (%v), want 2024-05-06 07:08:09", text, err)
+	}
+	if text, err := SerializeFieldWithOptions(decoded, field, FieldOptions{TimestampAsEpoch: true}); err != nil || text != "1714979289" {
+		t.Errorf("epoch serialized to %q (%v), want 1714979289", text, err)
+	}
+}
+
+// TestBytesAsHex 验证BytesAsHex下bytes字段按十六进制文本往返（16字节摘要存为32个字符）
+func TestBytesAsHex(t *testing.T) {
+	opts := FieldOptions{BytesAsHex: true}
+	digest := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	src := wrapperspb.Bytes(digest)
+	field := src.ProtoReflect().Descriptor().Fields().ByName("value")
+
+	text, err := SerializeFieldWithOptions(src, field, opts)
+	if err != nil {
+		t.Fatalf("serialize hex: %v", err)
+	}
+	if text != "00112233445566778899aabbccddeeff" {
+		t.Errorf("16-byte digest serialized to %q, want 32 hex chars", text)
+	}
+
+	fromBytes := &wrapperspb.BytesValue{}
+	if err := ParseFieldFromBytesWithOptions(fromBytes, field, []byte(text), opts); err != nil {
+		t.Fatalf("parse hex bytes: %v", err)
+	}
+	fromName := &wrapperspb.BytesValue{}
+	optionsFor := func(protoreflect.FieldDescriptor) FieldOptions { return opts }
+	if err := ParseFromStringByNameWithOptions(fromName, []string{"value"}, []string{strings.ToUpper(text)}, optionsFor); err != nil {
+		t.Fatalf("parse upper-case hex by name: %v", err)
+	}
+	if !proto.Equal(src, fromBytes) || !proto.Equal(src, fromName) {
+		t.Errorf("hex round trip mismatch: want %v, got %v / %v", src, fromBytes, fromName)
+	}
+
+	if base64Text, _ := SerializeFieldAsString(src, field); base64Text == text {
+		t.Error("default encoding should stay base64")
+	}
+	if err := ParseFieldFromBytesWithOptions(&wrapperspb.BytesValue{}, field, []byte("zz"), opts); err == nil {
+		t.Error("invalid hex should fail to parse")
+	}
+}
+
+// TestRegisterFieldCodec verifies a registered codec replaces base64 for exactly one sub-message field
+func TestRegisterFieldCodec(t *testing.T) {
+	fields := (&testpb.GolangTest3{}).ProtoReflect().Descriptor().Fields()
+	extra := fields.ByName("extra_player")
+	player := fields.ByName("player")
+	RegisterFieldCodec(extra.FullName(),
+		func(m proto.Message) (string, error) {
+			b, err := protojson.Marshal(m)
+			return string(b), err
+		},
+		func(s string, m proto.Message) error { return protojson.Unmarshal([]byte(s), m) })
+	defer RegisterFieldCodec(extra.FullName(), nil, nil)
+
+	src := &testpb.GolangTest3{
+		Player:      &testpb.Player{PlayerId: 1, Name: "base64"},
+		ExtraPlayer: &testpb.Player{PlayerId: 2, Name: "json"},
+	}
+	text, err := SerializeFieldAsString(src, extra)
+	if err != nil {
+		t.Fatalf("serialize with codec: %v", err)
+	}
+	if !strings.Contains(text, `"name":"json"`) && !strings.Contains(text, `"name": "json"`) {
+		t.Errorf("codec field should be stored as JSON, got %q", text)
+	}
+	playerText, err := SerializeFieldAsString(src, player)
+	if err != nil {
+		t.Fatalf("serialize default field: %v", err)
+	}
+	if strings.Contains(playerText, "{") {
+		t.Errorf("field of the same type without a codec should stay base64, got %q", playerText)
+	}
+
+	fromString := &testpb.GolangTest3{}
+	if err := ParseFromStringByName(fromString, []string{"player", "extra_player"}, []string{playerText, text}); err != nil {
+		t.Fatalf("parse by name: %v", err)
+	}
+	fromBytes := &testpb.GolangTest3{}
+	if err := ParseFieldFromBytes(fromBytes, player, []byte(playerText)); err != nil {
+		t.Fatalf("parse default field from bytes: %v", err)
+	}
+	if err := ParseFieldFromBytes(fromBytes, extra, []byte(text)); err != nil {
+		t.Fatalf("parse codec field from bytes: %v", err)
+	}
+	if !proto.Equal(src, fromString) || !proto.Equal(src, fromBytes) {
+		t.Errorf("codec round trip mismatch: want %v, got %v / %v", src, fromString, fromBytes)
+	}
+
+	if empty, err := SerializeFieldAsString(&testpb.GolangTest3{}, extra); err != nil || empty != "" {
+		t.Errorf("unset codec field should serialize to empty string, got %q, %v", empty, err)
+	}
+	if err := ParseFieldFromString(fromString, extra, ""); err != nil || fromString.ExtraPlayer != nil {
+		t.Errorf("empty value should clear the codec field, got %v, %v", fromString.ExtraPlayer, err)
+	}
+	if err := ParseFieldFromString(&testpb.GolangTest3{}, extra, "not json"); err == nil {
+		t.Error("invalid codec value should fail to parse")
+	}
+
+	RegisterFieldCodec(extra.FullName(), nil, nil)
+	if text, _ := SerializeFieldAsString(src, extra); strings.Contains(text, "{") {
+		t.Errorf("unregistered codec should fall back to base64, got %q", text)
+	}
+}
+
+// TestEnumAsName verifies enum fields round-trip through their value names and still accept numbers
+func TestEnumAsName(t *testing.T) {
+	opts := FieldOptions{EnumAsName: true}
+	src := &typepb.Field{Kind: typepb.Field_TYPE_STRING}
+	field := src.ProtoReflect().Descriptor().Fields().ByName("kind")
+
+	text, err := SerializeFieldWithOptions(src, field, opts)
+	if err != nil {
+		t.Fatalf("serialize enum name: %v", err)
+	}
+	if text != "TYPE_STRING" {
+		t.Errorf("enum serialized to %q, want TYPE_STRING", text)
+	}
+	if number, _ := SerializeFieldAsString(src, field); number != "9" {
+		t.Errorf("default enum encoding should stay numeric, got %q", number)
+	}
+
+	fromBytes := &typepb.Field{}
+	if err := ParseFieldFromBytesWithOptions(fromBytes, field, []byte(text), opts); err != nil {
+		t.Fatalf("parse enum name: %v", err)
+	}
+	fromNumber := &typepb.Field{}
+	if err := ParseFieldFromBytesWithOptions(fromNumber, field, []byte("9"), opts); err != nil {
+		t.Fatalf("parse enum number: %v", err)
+	}
+	if fromBytes.Kind != src.Kind || fromNumber.Kind != src.Kind {
+		t.Errorf("enum round trip mismatch: want %v, got %v / %v", src.Kind, fromBytes.Kind, fromNumber.Kind)
+	}
+
+	if err := ParseFieldFromBytesWithOptions(&typepb.Field{}, field, []byte("TYPE_NOPE"), opts); err == nil {
+		t.Error("unknown enum name should fail to parse")
+	}
+	if _, err := SerializeFieldWithOptions(&typepb.Field{Kind: 99}, field, opts); err == nil {
+		t.Error("undeclared enum number should fail to serialize as a name")
+	}
+}
+
+// TestBoolAsBit 验证BoolAsBit下bool字段写入单字节0x00/0x01，并能解析MySQL返回的BIT字节与文本
+func TestBoolAsBit(t *testing.T) {
+	opts := FieldOptions{BoolAsBit: true}
+	field := (&wrapperspb.BoolValue{}).ProtoReflect().Descriptor().Fields().ByName("value")
+
+	for _, want := range []bool{true, false} {
+		text, err := SerializeFieldWithOptions(wrapperspb.Bool(want), field, opts)
+		if err != nil {
+			t.Fatalf("serialize bit: %v", err)
+		}
+		if len(text) != 1 || (text[0] == 1) != want {
+			t.Errorf("bit %v serialized to %q, want a single 0x00/0x01 byte", want, text)
+		}
+		got := &wrapperspb.BoolValue{Value: !want}
+		if err := ParseFieldFromBytesWithOptions(got, field, []byte(text), opts); err != nil {
+			t.Fatalf("parse bit: %v", err)
+		}
+		if got.Value != want {
+			t.Errorf("bit round trip: want %v, got %v", want, got.Value)
+		}
+	}
+
+	for raw, want := range map[string]bool{"1": true, "0": false, "true": true, "": false} {
+		got := &wrapperspb.BoolValue{Value: !want}
+		if err := ParseFieldFromBytesWithOptions(got, field, []byte(raw), opts); err != nil || got.Value != want {
+			t.Errorf("parse %q = %v (%v), want %v", raw, got.Value, err, want)
+		}
+	}
+	if err := ParseFieldFromBytesWithOptions(&wrapperspb.BoolValue{}, field, []byte{2}, opts); err == nil {
+		t.Error("byte 0x02 should fail to parse as BIT(1)")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/luyuancpp/proto2mysql/pbconv"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -46,6 +47,9 @@ func (p *GormDB) CreateOrUpdateTable(m proto.Message) error {
 	if err != nil {
 		return err
 	}
+	if err := table.Validate(); err != nil {
+		return err
+	}
 	return p.DB.Exec(table.GetCreateTableSQL()).Error
 }
 
@@ -69,7 +73,7 @@ func (p *GormDB) Insert(message proto.Message) error {
 		return err
 	}
 
-	return p.DB.Table(escapeMySQLName(table.tableName)).Create(values).Error
+	return wrapExecErr(p.DB.Table(table.sqlName()).Create(values).Error)
 }
 
 func (p *GormDB) BatchInsert(messages []proto.Message) error {
@@ -101,8 +105,8 @@ func (p *GormDB) BatchInsert(messages []proto.Message) error {
 			rows = append(rows, values)
 		}
 
-		if err := p.DB.Table(escapeMySQLName(table.tableName)).Create(rows).Error; err != nil {
-			return err
+		if err := p.DB.Table(table.sqlName()).Create(rows).Error; err != nil {
+			return wrapExecErr(err)
 		}
 	}
 
@@ -120,9 +124,10 @@ func (p *GormDB) Save(message proto.Message) error {
 		return err
 	}
 
-	return p.DB.Table(escapeMySQLName(table.tableName)).
+	err = p.DB.Table(table.sqlName()).
 		Clauses(clause.OnConflict{UpdateAll: true}).
 		Create(values).Error
+	return wrapExecErr(err)
 }
 
 func (p *GormDB) InsertOnDupUpdate(message proto.Message) error {
@@ -141,11 +146,11 @@ func (p *GormDB) InsertIgnore(message proto.Message) (bool, error) {
 		return false, err
 	}
 
-	result := p.DB.Table(escapeMySQLName(table.tableName)).
+	result := p.DB.Table(table.sqlName()).
 		Clauses(clause.OnConflict{DoNothing: true}).
 		Create(values)
 	if result.Error != nil {
-		return false, result.Error
+		return false, wrapExecErr(result.Error)
 	}
 	return result.RowsAffected > 0, nil
 }
@@ -165,7 +170,7 @@ func (p *GormDB) InsertReturningID(message proto.Message) (int64, error) {
 	var id int64
 	err = p.DB.Connection(func(tx *gorm.DB) error {
 		if err := tx.Exec(sqlWithArgs.Sql, sqlWithArgs.Args...).Error; err != nil {
-			return err
+			return wrapExecErr(err)
 		}
 		return tx.Raw("SELECT LAST_INSERT_ID()").Scan(&id).Error
 	})
@@ -202,18 +207,18 @@ func (p *GormDB) BatchSave(messages []proto.Message) error {
 			rows = append(rows, values)
 		}
 
-		err = p.DB.Table(escapeMySQLName(table.tableName)).
+		err = p.DB.Table(table.sqlName()).
 			Clauses(clause.OnConflict{UpdateAll: true}).
 			Create(rows).Error
 		if err != nil {
-			return err
+			return wrapExecErr(err)
 		}
 	}
 	return nil
 }
 
 func (p *GormDB) Update(message proto.Message) error {
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return err
 	}
@@ -222,6 +227,7 @@ func (p *GormDB) Update(message proto.Message) error {
 	if err != nil {
 		return err
 	}
+	table.gormTouch(values)
 	if len(values) == 0 {
 		return fmt.Errorf("no fields to update")
 	}
@@ -231,7 +237,7 @@ func (p *GormDB) Update(message proto.Message) error {
 		return err
 	}
 
-	return p.DB.Table(escapeMySQLName(table.tableName)).Where(whereClause, whereArgs...).Updates(values).Error
+	return wrapExecErr(p.scopedTable(table).Where(whereClause, whereArgs...).Updates(values).Error)
 }
 
 func (p *GormDB) UpdateByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) error {
@@ -244,11 +250,12 @@ func (p *GormDB) UpdateByWhereWithArgs(message proto.Message, whereClause string
 	if err != nil {
 		return err
 	}
+	table.gormTouch(values)
 	if len(values) == 0 {
 		return fmt.Errorf("no fields to update")
 	}
 
-	return p.DB.Table(escapeMySQLName(table.tableName)).Where(whereClause, whereArgs...).Updates(values).Error
+	return wrapExecErr(p.scopedTable(table).Where(whereClause, whereArgs...).Updates(values).Error)
 }
 
 // UpdateFieldsByPK 按主键只更新指定字段（部分更新），避免Update全字段覆盖冲掉并发写入
@@ -256,52 +263,57 @@ func (p *GormDB) UpdateFieldsByPK(message proto.Message, fields ...string) error
 	if len(fields) == 0 {
 		return errors.New("no fields to update")
 	}
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return err
 	}
 
 	values := make(map[string]interface{}, len(fields))
 	for _, field := range fields {
-		desc, ok := table.fieldNameToDesc[field]
-		if !ok {
-			return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
+		desc, err := table.updatableField(field)
+		if err != nil {
+			return err
 		}
-		val, err := pbconv.SerializeFieldAsString(message, desc)
+		val, err := table.gormColumnValue(message, desc)
 		if err != nil {
 			return fmt.Errorf("serialize update field %s: %w", field, err)
 		}
-		values[field] = val
+		values[table.columnName(field)] = val
 	}
+	table.gormTouch(values)
 
 	whereClause, whereArgs, err := table.primaryKeyWhere(message)
 	if err != nil {
 		return err
 	}
-	return p.DB.Table(escapeMySQLName(table.tableName)).Where(whereClause, whereArgs...).Updates(values).Error
+	return wrapExecErr(p.scopedTable(table).Where(whereClause, whereArgs...).Updates(values).Error)
 }
 
 // UpdateKVByPK 按主键设置单个字段的值（如改状态、封号）
 func (p *GormDB) UpdateKVByPK(message proto.Message, field string, value interface{}) error {
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return err
 	}
-	if _, ok := table.fieldNameToDesc[field]; !ok {
-		return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
+	if _, err := table.updatableField(field); err != nil {
+		return err
 	}
 
 	whereClause, whereArgs, err := table.primaryKeyWhere(message)
 	if err != nil {
 		return err
 	}
-	return p.DB.Table(escapeMySQLName(table.tableName)).Where(whereClause, whereArgs...).Update(field, value).Error
+	values := map[string]interface{}{table.columnName(field): value}
+	if field != table.touchField {
+		table.gormTouch(values)
+	}
+	return wrapExecErr(p.scopedTable(table).Where(whereClause, whereArgs...).Updates(values).Error)
 }
 
 // UpdateIfVersion 乐观锁CAS更新：按主键更新消息中已设置的字段（versionField自动+1），
 // 仅当数据库中versionField等于message当前值时生效。返回false表示版本冲突，调用方应重读后重试
 func (p *GormDB) UpdateIfVersion(message proto.Message, versionField string) (bool, error) {
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return false, err
 	}
@@ -310,7 +322,7 @@ func (p *GormDB) UpdateIfVersion(message proto.Message, versionField string) (bo
 		return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, versionField, table.tableName)
 	}
 
-	curVersion, err := pbconv.SerializeFieldAsString(message, versionDesc)
+	curVersion, err := pbconv.SerializeFieldWithOptions(message, versionDesc, table.fieldOptions(versionDesc))
 	if err != nil {
 		return false, fmt.Errorf("serialize version field %s: %w", versionField, err)
 	}
@@ -323,24 +335,25 @@ func (p *GormDB) UpdateIfVersion(message proto.Message, versionField string) (bo
 	for _, pk := range table.primaryKey {
 		delete(values, pk)
 	}
+	table.gormTouch(values)
 	if len(values) == 0 {
 		return false, errors.New("no fields to update")
 	}
 
-	escapedVersion := escapeMySQLName(versionField)
-	values[versionField] = gorm.Expr(escapedVersion + " + 1")
+	escapedVersion := table.quotedColumn(versionField)
+	values[table.columnName(versionField)] = gorm.Expr(escapedVersion + " + 1")
 
 	whereClause, whereArgs, err := table.primaryKeyWhere(message)
 	if err != nil {
 		return false, err
 	}
 
-	result := p.DB.Table(escapeMySQLName(table.tableName)).
+	result := p.scopedTable(table).
 		Where(whereClause, whereArgs...).
 		Where(escapedVersion+" = ?", curVersion).
 		Updates(values)
 	if result.Error != nil {
-		return false, result.Error
+		return false, wrapExecErr(result.Error)
 	}
 	return result.RowsAffected > 0, nil
 }
@@ -351,7 +364,7 @@ func (p *GormDB) UpdateFieldsIfVersion(message proto.Message, versionField strin
 	if len(fields) == 0 {
 		return false, errors.New("no fields to update")
 	}
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return false, err
 	}
@@ -359,7 +372,7 @@ func (p *GormDB) UpdateFieldsIfVersion(message proto.Message, versionField strin
 	if !ok {
 		return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, versionField, table.tableName)
 	}
-	curVersion, err := pbconv.SerializeFieldAsString(message, versionDesc)
+	curVersion, err := pbconv.SerializeFieldWithOptions(message, versionDesc, table.fieldOptions(versionDesc))
 	if err != nil {
 		return false, fmt.Errorf("serialize version field %s: %w", versionField, err)
 	}
@@ -369,36 +382,37 @@ func (p *GormDB) UpdateFieldsIfVersion(message proto.Message, versionField strin
 		if name == versionField {
 			continue // version 由下面统一 +1
 		}
-		desc, ok := table.fieldNameToDesc[name]
-		if !ok {
-			return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, name, table.tableName)
+		desc, err := table.updatableField(name)
+		if err != nil {
+			return false, err
 		}
-		val, err := pbconv.SerializeFieldAsString(message, desc)
+		val, err := table.gormColumnValue(message, desc)
 		if err != nil {
 			return false, fmt.Errorf("serialize update field %s: %w", name, err)
 		}
-		values[name] = val
+		values[table.columnName(name)] = val
 	}
-	escapedVersion := escapeMySQLName(versionField)
-	values[versionField] = gorm.Expr(escapedVersion + " + 1")
+	table.gormTouch(values)
+	escapedVersion := table.quotedColumn(versionField)
+	values[table.columnName(versionField)] = gorm.Expr(escapedVersion + " + 1")
 
 	whereClause, whereArgs, err := table.primaryKeyWhere(message)
 	if err != nil {
 		return false, err
 	}
 
-	result := p.DB.Table(escapeMySQLName(table.tableName)).
+	result := p.scopedTable(table).
 		Where(whereClause, whereArgs...).
 		Where(escapedVersion+" = ?", curVersion).
 		Updates(values)
 	if result.Error != nil {
-		return false, result.Error
+		return false, wrapExecErr(result.Error)
 	}
 	return result.RowsAffected > 0, nil
 }
 
 func (p *GormDB) Delete(message proto.Message) error {
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return err
 	}
@@ -408,7 +422,7 @@ func (p *GormDB) Delete(message proto.Message) error {
 		return err
 	}
 
-	return p.DB.Table(escapeMySQLName(table.tableName)).Where(whereClause, whereArgs...).Delete(nil).Error
+	return wrapExecErr(p.scopedTable(table).Where(whereClause, whereArgs...).Delete(nil).Error)
 }
 
 func (p *GormDB) DeleteByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) error {
@@ -417,12 +431,12 @@ func (p *GormDB) DeleteByWhereWithArgs(message proto.Message, whereClause string
 		return err
 	}
 
-	return p.DB.Table(escapeMySQLName(table.tableName)).Where(whereClause, whereArgs...).Delete(nil).Error
+	return wrapExecErr(p.scopedTable(table).Where(whereClause, whereArgs...).Delete(nil).Error)
 }
 
 // DeleteByKV 按单个字段等值条件删除
 func (p *GormDB) DeleteByKV(message proto.Message, key string, value interface{}) error {
-	return p.DeleteByWhereWithArgs(message, escapeMySQLName(key)+" = ?", []interface{}{value})
+	return p.DeleteByWhereWithArgs(message, quotedColumnOf(p.Tables, message, key)+" = ?", []interface{}{value})
 }
 
 // BatchDelete 按主键批量删除（DELETE ... WHERE pk IN (...)，自动分批）
@@ -431,7 +445,7 @@ func (p *GormDB) BatchDelete(messages []proto.Message) error {
 		return nil
 	}
 
-	table, err := p.tableForMessage(messages[0])
+	table, err := p.auditFreeTable(messages[0])
 	if err != nil {
 		return err
 	}
@@ -444,32 +458,32 @@ func (p *GormDB) BatchDelete(messages []proto.Message) error {
 		if msg.ProtoReflect().Descriptor() != table.Descriptor {
 			return fmt.Errorf("messages have different descriptors")
 		}
-		val, err := pbconv.SerializeFieldAsString(msg, table.primaryKeyField)
+		val, err := pbconv.SerializeFieldWithOptions(msg, table.primaryKeyField, table.fieldOptions(table.primaryKeyField))
 		if err != nil {
 			return fmt.Errorf("serialize primary key: %w", err)
 		}
 		pkValues = append(pkValues, val)
 	}
 
-	pkName := escapeMySQLName(string(table.primaryKeyField.Name()))
+	pkName := table.quotedColumn(string(table.primaryKeyField.Name()))
 	for i := 0; i < len(pkValues); i += BatchInsertMaxSize {
 		end := i + BatchInsertMaxSize
 		if end > len(pkValues) {
 			end = len(pkValues)
 		}
 
-		err := p.DB.Table(escapeMySQLName(table.tableName)).
+		err := p.scopedTable(table).
 			Where(pkName+" IN ?", pkValues[i:end]).
 			Delete(nil).Error
 		if err != nil {
-			return err
+			return wrapExecErr(err)
 		}
 	}
 	return nil
 }
 
 func (p *GormDB) FindOneByKV(message proto.Message, whereKey string, whereVal string) error {
-	return p.FindOneByWhereWithArgs(message, fmt.Sprintf("%s = ?", escapeMySQLName(whereKey)), []interface{}{whereVal})
+	return p.FindOneByWhereWithArgs(message, fmt.Sprintf("%s = ?", quotedColumnOf(p.Tables, message, whereKey)), []interface{}{whereVal})
 }
 
 // FindOneByPK 按消息中的主键值查询单条数据（查到后覆盖message其余字段）
@@ -497,7 +511,7 @@ func (p *GormDB) FindAllByKVIn(list proto.Message, key string, values []interfac
 		return nil
 	}
 
-	return p.FindAllByWhereWithArgs(list, escapeMySQLName(key)+" IN ?", []interface{}{values})
+	return p.FindAllByWhereWithArgs(list, quotedColumnOf(p.Tables, list, key)+" IN ?", []interface{}{values})
 }
 
 // FindAllByPKIn 按主键批量查询，返回列表（类似Redis MGET：不存在的主键自动跳过）
@@ -515,7 +529,7 @@ func (p *GormDB) FindAllByPKIn(list proto.Message, pkValues []interface{}) error
 		return ErrPrimaryKeyNotFound
 	}
 
-	pkName := escapeMySQLName(string(table.primaryKeyField.Name()))
+	pkName := table.quotedColumn(string(table.primaryKeyField.Name()))
 	return p.FindAllByWhereWithArgs(list, pkName+" IN ?", []interface{}{pkValues})
 }
 
@@ -549,7 +563,7 @@ func (p *GormDB) FindOneByPKForUpdate(message proto.Message) error {
 		return err
 	}
 
-	rows, err := p.DB.Table(escapeMySQLName(table.tableName)).
+	rows, err := p.scopedTable(table).
 		Select(table.fieldsListSQL).
 		Where(whereClause, whereArgs...).
 		Clauses(clause.Locking{Strength: "UPDATE"}).
@@ -560,13 +574,13 @@ func (p *GormDB) FindOneByPKForUpdate(message proto.Message) error {
 	}
 	defer rows.Close()
 
-	return scanOneProtoRow(rows, message)
+	return scanOneProtoRow(table, rows, message)
 }
 
 // IncrByPK 按主键对数值字段原子加减（UPDATE ... SET f = f + delta），
 // 适合货币/经验等计数器，避免"读-改-写"竞态
 func (p *GormDB) IncrByPK(message proto.Message, field string, delta int64) error {
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return err
 	}
@@ -579,10 +593,11 @@ func (p *GormDB) IncrByPK(message proto.Message, field string, delta int64) erro
 		return err
 	}
 
-	escapedField := escapeMySQLName(field)
-	return p.DB.Table(escapeMySQLName(table.tableName)).
+	escapedField := table.quotedColumn(field)
+	err = p.scopedTable(table).
 		Where(whereClause, whereArgs...).
-		Update(field, gorm.Expr(escapedField+" + ?", delta)).Error
+		Update(table.columnName(field), gorm.Expr(escapedField+" + ?", delta)).Error
+	return wrapExecErr(err)
 }
 
 // DecrByPKIfEnough 按主键原子扣减数值字段，余额不足时不扣并返回false
@@ -592,7 +607,7 @@ func (p *GormDB) DecrByPKIfEnough(message proto.Message, field string, delta int
 		return false, fmt.Errorf("delta must be non-negative, got %d", delta)
 	}
 
-	table, err := p.tableForMessage(message)
+	table, err := p.auditFreeTable(message)
 	if err != nil {
 		return false, err
 	}
@@ -605,13 +620,13 @@ func (p *GormDB) DecrByPKIfEnough(message proto.Message, field string, delta int
 		return false, err
 	}
 
-	escapedField := escapeMySQLName(field)
-	result := p.DB.Table(escapeMySQLName(table.tableName)).
+	escapedField := table.quotedColumn(field)
+	result := p.scopedTable(table).
 		Where(whereClause, whereArgs...).
 		Where(escapedField+" >= ?", delta).
-		Update(field, gorm.Expr(escapedField+" - ?", delta))
+		Update(table.columnName(field), gorm.Expr(escapedField+" - ?", delta))
 	if result.Error != nil {
-		return false, result.Error
+		return false, wrapExecErr(result.Error)
 	}
 	return result.RowsAffected > 0, nil
 }
@@ -622,7 +637,7 @@ func (p *GormDB) FindOneByWhereWithArgs(message proto.Message, whereClause strin
 		return err
 	}
 
-	rows, err := p.DB.Table(escapeMySQLName(table.tableName)).
+	rows, err := p.scopedTable(table).
 		Select(table.fieldsListSQL).
 		Where(whereClause, whereArgs...).
 		Limit(2).
@@ -632,7 +647,7 @@ func (p *GormDB) FindOneByWhereWithArgs(message proto.Message, whereClause strin
 	}
 	defer rows.Close()
 
-	return scanOneProtoRow(rows, message)
+	return scanOneProtoRow(table, rows, message)
 }
 
 func (p *GormDB) FindAll(message proto.Message) error {
@@ -645,7 +660,7 @@ func (p *GormDB) FindAllByWhereWithArgs(message proto.Message, whereClause strin
 		return err
 	}
 
-	rows, err := p.DB.Table(escapeMySQLName(table.tableName)).
+	rows, err := p.scopedTable(table).
 		Select(table.fieldsListSQL).
 		Where(whereClause, whereArgs...).
 		Rows()
@@ -654,7 +669,7 @@ func (p *GormDB) FindAllByWhereWithArgs(message proto.Message, whereClause strin
 	}
 	defer rows.Close()
 
-	return scanProtoRowsToList(rows, message.ProtoReflect().Mutable(listField).List())
+	return scanProtoRowsToList(table, rows, message.ProtoReflect().Mutable(listField).List())
 }
 
 // FindAllWithOptions 按条件查询批量数据，支持ORDER BY / LIMIT / OFFSET
@@ -664,7 +679,7 @@ func (p *GormDB) FindAllWithOptions(list proto.Message, whereClause string, wher
 		return err
 	}
 
-	query := p.DB.Table(escapeMySQLName(table.tableName)).
+	query := p.scopedTable(table).
 		Select(table.fieldsListSQL).
 		Where(normalizeWhereClause(whereClause), whereArgs...)
 	if opts.OrderBy != "" {
@@ -683,7 +698,7 @@ func (p *GormDB) FindAllWithOptions(list proto.Message, whereClause string, wher
 	}
 	defer rows.Close()
 
-	return scanProtoRowsToList(rows, list.ProtoReflect().Mutable(listField).List())
+	return scanProtoRowsToList(table, rows, list.ProtoReflect().Mutable(listField).List())
 }
 
 // FindPage 分页查询批量数据（pageIndex从1开始）
@@ -705,7 +720,7 @@ func (p *GormDB) FindOneWithOptions(message proto.Message, whereClause string, w
 		return err
 	}
 
-	query := p.DB.Table(escapeMySQLName(table.tableName)).
+	query := p.scopedTable(table).
 		Select(table.fieldsListSQL).
 		Where(normalizeWhereClause(whereClause), whereArgs...)
 	if opts.OrderBy != "" {
@@ -718,7 +733,7 @@ func (p *GormDB) FindOneWithOptions(message proto.Message, whereClause string, w
 	}
 	defer rows.Close()
 
-	return scanOneProtoRow(rows, message)
+	return scanOneProtoRow(table, rows, message)
 }
 
 // FindPageByCursor 游标分页（keyset pagination）：按cursorField升序返回cursorVal之后的pageSize条，
@@ -739,12 +754,12 @@ func (p *GormDB) FindPageByCursor(list proto.Message, whereClause string, whereA
 	where := normalizeWhereClause(whereClause)
 	args := append([]interface{}{}, whereArgs...)
 	if cursorVal != nil {
-		where = fmt.Sprintf("(%s) AND %s > ?", where, escapeMySQLName(cursorField))
+		where = fmt.Sprintf("(%s) AND %s > ?", where, table.quotedColumn(cursorField))
 		args = append(args, cursorVal)
 	}
 
 	return p.FindAllWithOptions(list, where, args, QueryOptions{
-		OrderBy: escapeMySQLName(cursorField) + " ASC",
+		OrderBy: table.quotedColumn(cursorField) + " ASC",
 		Limit:   pageSize,
 	})
 }
@@ -762,7 +777,7 @@ func (p *GormDB) CountByWhereWithArgs(message proto.Message, whereClause string,
 	}
 
 	var count int64
-	err = p.DB.Table(escapeMySQLName(table.tableName)).
+	err = p.scopedTable(table).
 		Where(normalizeWhereClause(whereClause), whereArgs...).
 		Count(&count).Error
 	return count, err
@@ -775,7 +790,7 @@ func (p *GormDB) Exists(message proto.Message, whereClause string, whereArgs []i
 		return false, err
 	}
 
-	rows, err := p.DB.Table(escapeMySQLName(table.tableName)).
+	rows, err := p.scopedTable(table).
 		Select("1").
 		Where(normalizeWhereClause(whereClause), whereArgs...).
 		Limit(1).
@@ -808,6 +823,15 @@ func (p *GormDB) Transaction(fn func(tx *GormDB) error) error {
 	})
 }
 
+// scopedTable 查询/更新/删除使用的表：已附加WithDefaultWhere的默认条件（gorm与后续Where以AND组合）
+func (p *GormDB) scopedTable(table *MessageTable) *gorm.DB {
+	db := p.DB.Table(table.sqlName())
+	if table.defaultWhere != "" {
+		db = db.Where(table.defaultWhere, table.defaultWhereArgs...)
+	}
+	return db
+}
+
 func (p *GormDB) tableForMessage(message proto.Message) (*MessageTable, error) {
 	tableName := GetTableName(message)
 	table, ok := p.Tables[tableName]
@@ -817,35 +841,70 @@ func (p *GormDB) tableForMessage(message proto.Message) (*MessageTable, error) {
 	return table, nil
 }
 
+// auditFreeTable 同tableForMessage，但配置了审计表（WithAuditTable）的表返回ErrInvalidTableOption：
+// 审计只在DB上实现，GormDB按主键更新/删除会绕过审计
+func (p *GormDB) auditFreeTable(message proto.Message) (*MessageTable, error) {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	if table.auditTable != "" {
+		return nil, fmt.Errorf("%w: table %s has audit table %s, which GormDB does not record; use DB",
+			ErrInvalidTableOption, table.tableName, table.auditTable)
+	}
+	return table, nil
+}
+
 func (m *MessageTable) messageValues(message proto.Message, includeUnset bool, skipUnsetAutoIncrement bool) (map[string]interface{}, error) {
 	if err := m.validateMessageDescriptor(message); err != nil {
 		return nil, err
 	}
 
-	values := make(map[string]interface{}, m.Descriptor.Fields().Len())
+	values := make(map[string]interface{}, len(m.columns))
 	reflection := message.ProtoReflect()
 
-	for i := 0; i < m.Descriptor.Fields().Len(); i++ {
-		field := m.Descriptor.Fields().Get(i)
+	for _, field := range m.columns {
 		fieldName := string(field.Name())
 
-		if !includeUnset && !reflection.Has(field) {
+		if !includeUnset && !m.hasColumnValue(reflection, field) {
+			continue
+		}
+		if m.isDBGeneratedField(fieldName) {
 			continue
 		}
 		if skipUnsetAutoIncrement && m.isAutoIncrementField(fieldName) && !reflection.Has(field) {
 			continue
 		}
 
-		val, err := pbconv.SerializeFieldAsString(message, field)
+		val, err := m.gormColumnValue(message, field)
 		if err != nil {
 			return nil, fmt.Errorf("serialize field %s: %w", field.Name(), err)
 		}
-		values[fieldName] = val
+		values[m.columnName(fieldName)] = val
 	}
 
 	return values, nil
 }
 
+// gormTouch 配置了WithUpdatedAtColumn时把该列设为当前时间表达式（覆盖消息中的值）
+func (m *MessageTable) gormTouch(values map[string]interface{}) {
+	if m.touchField != "" {
+		values[m.columnName(m.touchField)] = gorm.Expr(m.touchExpr())
+	}
+}
+
+// gormColumnValue 同columnValue，POINT列包装为gorm.Expr以生成ST_GeomFromText(?)
+func (m *MessageTable) gormColumnValue(message proto.Message, field protoreflect.FieldDescriptor) (interface{}, error) {
+	val, err := m.columnValue(message, field)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := m.spatialPointFor(string(field.Name())); ok {
+		return gorm.Expr(spatialWriteExpr, val), nil
+	}
+	return val, nil
+}
+
 func (m *MessageTable) validateMessageDescriptor(message proto.Message) error {
 	if message == nil {
 		return fmt.Errorf("message cannot be nil")
@@ -871,7 +930,7 @@ func (m *MessageTable) primaryKeyValues(message proto.Message) ([]interface{}, e
 			return nil, fmt.Errorf("%w: primary key %s in table %s", ErrFieldNotFound, primaryKey, m.tableName)
 		}
 
-		val, err := pbconv.SerializeFieldAsString(message, field)
+		val, err := pbconv.SerializeFieldWithOptions(message, field, m.fieldOptions(field))
 		if err != nil {
 			return nil, fmt.Errorf("serialize primary key %s: %w", primaryKey, err)
 		}
@@ -886,44 +945,113 @@ func (m *MessageTable) primaryKeyWhere(message proto.Message) (string, []interfa
 		return "", nil, err
 	}
 
+	return m.primaryKeyCondition(), whereArgs, nil
+}
+
+// primaryKeyCondition 主键等值条件 `pk1` = ? AND `pk2` = ?（按primaryKey顺序）
+func (m *MessageTable) primaryKeyCondition() string {
 	whereClause := ""
 	for i, primaryKey := range m.primaryKey {
 		if i > 0 {
 			whereClause += " AND "
 		}
-		whereClause += fmt.Sprintf("%s = ?", escapeMySQLName(primaryKey))
+		whereClause += fmt.Sprintf("%s = ?", m.quotedColumn(primaryKey))
 	}
-
-	return whereClause, whereArgs, nil
+	return whereClause
 }
 
-func scanOneProtoRow(rows *sql.Rows, message proto.Message) error {
-	found := false
-	for rows.Next() {
-		if found {
-			return ErrMultipleRowsFound
-		}
-
-		result, err := scanRowStrings(rows)
-		if err != nil {
-			return err
-		}
-		if err := pbconv.ParseFromString(message, result); err != nil {
+func scanOneProtoRow(table *MessageTable, rows *sql.Rows, message proto.Message) error {
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
 			return err
 		}
-		found = true
+		return ErrNoRowsFound
 	}
 
+	result, err := scanRowBytes(rows)
+	if err != nil {
+		return err
+	}
+	// 先解析到副本（RawBytes在下一次Next后失效），确认只有一行后再写回，出错时不改动调用方的消息
+	parsed := proto.Clone(message)
+	if err := table.parseRow(parsed, result); err != nil {
+		return err
+	}
+	if rows.Next() {
+		return ErrMultipleRowsFound
+	}
 	if err := rows.Err(); err != nil {
 		return err
 	}
-	if !found {
-		return ErrNoRowsFound
+
+	proto.Reset(message)
+	proto.Merge(message, parsed)
+	return nil
+}
+
+// parseRow 按表的持久化列（与SELECT列顺序一致）把一行结果写入消息，被忽略的字段保持不动；
+// 解析完成后依次调用WithRowHook注册的钩子
+func (m *MessageTable) parseRow(message proto.Message, row [][]byte) error {
+	if err := m.parseColumns(message, row, true); err != nil {
+		return err
 	}
+	return m.runRowHooks(message)
+}
 
+// parseColumns 同parseRow但不调用钩子；decrypt为false时加密列不解密，直接保留库中的密文（审计快照使用）
+func (m *MessageTable) parseColumns(message proto.Message, row [][]byte, decrypt bool) error {
+	count := min(len(row), len(m.columns))
+	for i := 0; i < count; i++ {
+		fieldName := string(m.columns[i].Name())
+		if row[i] == nil && (m.isZeroAsNullField(fieldName) || m.isNullableMessageField(fieldName)) {
+			message.ProtoReflect().Clear(m.columns[i])
+			continue
+		}
+		if len(row[i]) == 0 && m.isNullableMessageField(fieldName) {
+			// 非NULL的空值是已设置但所有字段为默认值的子消息
+			reflection := message.ProtoReflect()
+			reflection.Set(m.columns[i], protoreflect.ValueOfMessage(reflection.NewField(m.columns[i]).Message()))
+			continue
+		}
+		raw := row[i]
+		if len(raw) > 0 && m.isEncryptedField(fieldName) {
+			if !decrypt {
+				setCiphertext(message.ProtoReflect(), m.columns[i], raw)
+				continue
+			}
+			plain, err := m.decryptColumnValue(fieldName, raw)
+			if err != nil {
+				return err
+			}
+			raw = plain
+		}
+		if err := pbconv.ParseFieldFromBytesWithOptions(message, m.columns[i], raw, m.fieldOptions(m.columns[i])); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// scanRowBytes 以sql.RawBytes扫描当前行，返回的切片直接引用驱动缓冲区（不拷贝宽blob列），
+// 仅在下一次rows.Next/Close前有效，必须立即用parseRow解析。
+func scanRowBytes(rows *sql.Rows) ([][]byte, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	columnValues := make([][]byte, len(columns))
+	scans := make([]interface{}, len(columns))
+	for i := range columnValues {
+		scans[i] = (*sql.RawBytes)(&columnValues[i])
+	}
+
+	if err := rows.Scan(scans...); err != nil {
+		return nil, err
+	}
+	return columnValues, nil
+}
+
 func scanRowStrings(rows *sql.Rows) ([]string, error) {
 	columns, err := rows.Columns()
 	if err != nil {
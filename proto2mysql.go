@@ -5,13 +5,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"maps"
+	"reflect"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/luyuancpp/proto2mysql/pbconv"
@@ -19,12 +23,14 @@ import (
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // 常量定义
 const (
-	BatchInsertMaxSize = 1000 // 批量插入最大条数
+	BatchInsertMaxSize = 1000  // 批量插入最大条数
+	MaxPlaceholders    = 65535 // MySQL单条预处理语句的?占位符上限
 	// MySQL关键字列表
 	mysqlKeywordPattern = `^(SELECT|INSERT|UPDATE|DELETE|FROM|WHERE|AND|OR|JOIN|ON|IN|NOT|NULL|PRIMARY|KEY|INDEX|UNIQUE|AUTO_INCREMENT|INT|VARCHAR|TEXT|BLOB|DATETIME|TIMESTAMP|FLOAT|DOUBLE|BOOL|TINYINT|BIGINT)$`
 )
@@ -35,15 +41,22 @@ var (
 	// timestampFullName 是google.protobuf.Timestamp的全名，用于字段类型判断
 	timestampFullName = (&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName()
 
-	ErrTableNotFound      = errors.New("table not found")
-	ErrNoRepeatedField    = errors.New("message has no repeated field")
-	ErrMultipleRepeated   = errors.New("message has multiple repeated fields")
-	ErrPrimaryKeyNotFound = errors.New("primary key not found")
-	ErrFieldNotFound      = errors.New("field not found in message")
-	ErrMultipleRowsFound  = errors.New("multiple rows found")
-	ErrNoRowsFound        = errors.New("no rows found")
-	ErrDuplicateKey       = errors.New("duplicate key")
-	ErrBatchSizeExceeded  = fmt.Errorf("batch size exceeds maximum %d", BatchInsertMaxSize)
+	ErrTableNotFound       = errors.New("table not found")
+	ErrNoRepeatedField     = errors.New("message has no repeated field")
+	ErrMultipleRepeated    = errors.New("message has multiple repeated fields")
+	ErrRepeatedNotMessage  = errors.New("repeated field element is not a message")
+	ErrPrimaryKeyNotFound  = errors.New("primary key not found")
+	ErrFieldNotFound       = errors.New("field not found in message")
+	ErrMultipleRowsFound   = errors.New("multiple rows found")
+	ErrNoRowsFound         = errors.New("no rows found")
+	ErrDuplicateKey        = errors.New("duplicate key")
+	ErrForeignKeyViolation = errors.New("foreign key constraint violation")
+	ErrBatchSizeExceeded   = errors.New("batch size exceeds maximum")
+	ErrInvalidTableOption  = errors.New("invalid table option")
+	ErrReadOnly            = errors.New("database is read-only")
+	ErrEmptyWhereClause    = errors.New("empty where clause")
+	ErrColumnOrderMismatch = errors.New("column order mismatch")
+	ErrInvalidText         = errors.New("text cannot be stored in column")
 )
 
 // SqlWithArgs 存储带?占位符的SQL和对应的参数列表
@@ -54,38 +67,262 @@ type SqlWithArgs struct {
 
 // MessageTable 存储Protobuf消息与MySQL表的映射关系及预生成的SQL片段
 type MessageTable struct {
-	tableName       string
-	Descriptor      protoreflect.MessageDescriptor
-	primaryKey      []string // 主键字段列表
-	primaryKeyField protoreflect.FieldDescriptor
-	indexes         []string // 普通索引（逗号分隔字段）
-	uniqueKeys      string   // 唯一键（逗号分隔字段）
-	autoIncreaseKey string   // 自增字段名
-	nullableFields  []string // 允许为NULL的字段
+	tableName             string
+	database              string // 表所在的库（WithDatabase），空表示DB.DBName
+	Descriptor            protoreflect.MessageDescriptor
+	primaryKey            []string // 主键字段列表
+	primaryKeyField       protoreflect.FieldDescriptor
+	indexes               []string                     // 普通索引（逗号分隔字段）
+	uniqueKeys            string                       // 唯一键（逗号分隔字段）
+	fullTextKeys          []string                     // 全文索引字段（仅限文本列）
+	namedIndexes          []indexDef                   // 显式命名的普通索引
+	invisibleIndexes      [][]string                   // 建为INVISIBLE的索引（按字段列表匹配，WithInvisibleIndex），需MySQL 8.0+
+	autoIncreaseKey       string                       // 自增字段名
+	autoIncrement         uint64                       // 自增起始值（WithAutoIncrementStart），0表示使用MySQL默认
+	nullableFields        []string                     // 允许为NULL的字段
+	zeroAsNullFields      []string                     // 零值/未设置时写NULL、读到NULL时清空的字段（WithZeroValueAsNull），同时允许为NULL
+	nullableMessageFields []string                     // 未设置写NULL、已设置（含全默认值）写序列化结果的子消息字段（WithNullableMessage）
+	createdAtField        string                       // 由MySQL填充创建时间的Timestamp字段（WithTimestamps）
+	updatedAtField        string                       // 由MySQL维护更新时间的Timestamp字段（WithTimestamps）
+	touchField            string                       // 每次UPDATE都设为当前时间的Timestamp字段（WithUpdatedAtColumn）
+	ignoredFields         []string                     // 不持久化的字段（WithIgnoredFields）
+	epochFields           []string                     // 按Unix秒存为BIGINT的Timestamp字段（WithTimestampAsEpoch）
+	hexFields             []string                     // 按十六进制文本存储的bytes字段（WithBytesAsHex）
+	utf8mb4Fields         []string                     // 插入前检查UTF-8与列字符集的string字段（WithValidateUTF8mb4）
+	bitFields             []string                     // 建为BIT(1)列的bool字段（WithBitColumn）
+	zerofillFields        []string                     // 建为 int(10) unsigned zerofill 等补零列的整数字段（WithZerofill）
+	nativeEnumFields      []string                     // 建为MySQL ENUM列、按值名存取的enum字段（WithNativeEnum）
+	collations            map[string]string            // 文本列的排序规则（WithColumnCollation），未配置的列沿用表的默认排序规则
+	textSizes             map[string]TextSize          // TEXT/BLOB列的容量档位（WithTextSize），未配置的列为MEDIUMTEXT/MEDIUMBLOB
+	charset               string                       // 表默认字符集（WithCharset/SetCharset），空表示DefaultCharset
+	collation             string                       // 表默认排序规则，charset非空而collation为空时使用字符集的默认排序规则
+	kindTypes             map[protoreflect.Kind]string // proto类型到列类型的覆盖（WithKindType/SetKindType），未覆盖的用MySQLFieldTypes
+	unsignedOverride      map[string]bool              // 整数列unsigned属性覆盖（WithUnsignedColumns/WithSignedColumns），true为unsigned
+	spatialPoints         []spatialPoint               // 由经纬度合成的POINT列（WithSpatialPoint）
+	partition             *partitionSpec               // 建表分区（WithRangePartition/WithHashPartition），nil表示不分区
+	foreignKeys           []foreignKey                 // 建表时添加的外键（WithForeignKey）
+	columnMapping         map[string]string            // proto字段名→库列名（WithColumnMapping），未映射的字段列名与字段名相同
+	prefixLengths         map[string]int               // 文本/二进制列的索引前缀长度（WithPrefixIndex），未配置时用defaultIndexPrefixLen
+	generatedColumns      []generatedColumn            // 由MySQL计算的生成列（WithGeneratedColumn）
+	columnOrder           []string                     // 排在最前的字段及其顺序（WithColumnOrder），其余字段按proto声明顺序
+	defaultWhere          string                       // 自动AND到所有SELECT/UPDATE/DELETE条件上的默认条件（WithDefaultWhere）
+	defaultWhereArgs      []interface{}                // defaultWhere中?占位符对应的参数
+	maxPlaceholders       int                          // 批量写单条SQL的占位符上限（WithMaxPlaceholders），0表示MaxPlaceholders
+	onlineDDL             bool                         // 同步结构的ALTER追加 ALGORITHM=INPLACE, LOCK=NONE（WithOnlineDDL）
+	tableComment          string                       // 表注释（WithTableComment），空表示使用表名
+	fieldComments         map[string]string            // 字段说明（WithFieldComment），写在列注释的 pb:N 之后
 
 	// 预生成的SQL片段（Init时构建，之后只读）
 	fieldsListSQL                string
+	insertFieldsListSQL          string // INSERT/REPLACE的列清单（不含MySQL维护的时间戳列）
+	insertPlaceholdersSQL        string // 与insertFieldsListSQL对应的VALUES占位符
+	insertArgsPerRow             int    // insertPlaceholdersSQL中?的个数，即批量写每行的参数数
 	selectFieldsSQL              string
 	selectAllSQLWithSemicolon    string
 	selectAllSQLWithoutSemicolon string
 	insertSQLTemplate            string
-	replaceSQLPrefix             string
-
-	// fieldNameToDesc 缓存字段名到描述符的映射
+	replaceSQLTemplate           string
+
+	// columns 持久化为列的字段（排除WithIgnoredFields），与fieldsListSQL/SELECT结果列顺序一致
+	columns []protoreflect.FieldDescriptor
+	// writeFields INSERT/REPLACE写入的字段，与insertFieldsListSQL顺序一致
+	writeFields []protoreflect.FieldDescriptor
+	// columnToField 库列名→proto字段名（columnMapping的反向映射，Init时构建）
+	columnToField map[string]string
+	// fieldNameToDesc 缓存proto字段名到描述符的映射（不含被忽略的字段），库列名需先经fieldNameForColumn换成字段名
 	fieldNameToDesc map[string]protoreflect.FieldDescriptor
+	// encryptedColumns 加密存储的字段（WithEncryptedColumn）
+	encryptedColumns map[string]encryptedColumn
+	// activeUniqueKeys 只约束未软删除行的唯一键（WithActiveUniqueKey），生成列与索引已分别加入generatedColumns/namedIndexes
+	activeUniqueKeys []activeUniqueKey
+	// auditTable Update/Delete前记录旧行的审计表名（WithAuditTable），空表示不审计
+	auditTable string
+	// rowHooks 查询时每行解析后调用的钩子（WithRowHook）
+	rowHooks []func(proto.Message) error
 	// cachedColumns 缓存数据库中的表结构（字段名->类型）
 	cachedColumns map[string]string
-	columnsMu     sync.RWMutex // 保护cachedColumns的并发安全
+	// cachedCharsets 缓存数据库中文本列的字符集（列名->字符集），WithValidateUTF8mb4按需查询
+	cachedCharsets map[string]string
+	columnsMu      sync.RWMutex // 保护cachedColumns/cachedCharsets的并发安全
 }
 
 func (m *MessageTable) isNullableField(fieldName string) bool {
-	return slices.Contains(m.nullableFields, fieldName)
+	return slices.Contains(m.nullableFields, fieldName) || m.isZeroAsNullField(fieldName) || m.isNullableMessageField(fieldName)
+}
+
+// isNullableMessageField 子消息字段是否按WithNullableMessage以NULL区分未设置与已设置的空子消息
+func (m *MessageTable) isNullableMessageField(fieldName string) bool {
+	return slices.Contains(m.nullableMessageFields, fieldName)
+}
+
+// isZeroAsNullField 字段是否按WithZeroValueAsNull把零值存为NULL
+func (m *MessageTable) isZeroAsNullField(fieldName string) bool {
+	return slices.Contains(m.zeroAsNullFields, fieldName)
+}
+
+// isZeroField 单值字段是否未设置或为零值（optional字段显式设置的0同样视为零值）
+func isZeroField(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor) bool {
+	if !reflection.Has(fieldDesc) {
+		return true
+	}
+	switch v := reflection.Get(fieldDesc).Interface().(type) {
+	case int32:
+		return v == 0
+	case int64:
+		return v == 0
+	case uint32:
+		return v == 0
+	case uint64:
+		return v == 0
+	case float32:
+		return v == 0
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case []byte:
+		return len(v) == 0
+	case protoreflect.EnumNumber:
+		return v == 0
+	}
+	return false
 }
 
 func (m *MessageTable) isAutoIncrementField(fieldName string) bool {
 	return m.autoIncreaseKey == fieldName
 }
 
+// columnName 返回字段在库中的列名（WithColumnMapping未映射时即字段名；非字段名原样返回）
+func (m *MessageTable) columnName(fieldName string) string {
+	if col, ok := m.columnMapping[fieldName]; ok {
+		return col
+	}
+	return fieldName
+}
+
+// quotedColumn 返回字段对应的转义列名，用于拼接SQL
+func (m *MessageTable) quotedColumn(fieldName string) string {
+	return escapeMySQLName(m.columnName(fieldName))
+}
+
+// fieldNameForColumn 把库列名映射回proto字段名（用于按列名解析结果集）
+func (m *MessageTable) fieldNameForColumn(column string) string {
+	if field, ok := m.columnToField[column]; ok {
+		return field
+	}
+	return column
+}
+
+// quotedColumnOf 按消息（行消息或列表消息）所属表返回转义列名；表未注册时按原名转义（错误由后续查询报告）
+func quotedColumnOf(tables map[string]*MessageTable, message proto.Message, fieldName string) string {
+	if table, err := resolveAnyTable(tables, message); err == nil {
+		return table.quotedColumn(fieldName)
+	}
+	return escapeMySQLName(fieldName)
+}
+
+// sqlName 返回SQL中引用该表的转义名：设置了WithDatabase时为 `库`.`表`，否则为 `表`
+func (m *MessageTable) sqlName() string {
+	if m.database == "" {
+		return escapeMySQLName(m.tableName)
+	}
+	return escapeMySQLName(m.database) + "." + escapeMySQLName(m.tableName)
+}
+
+// comment 建表使用的表注释：WithTableComment指定的注释，未指定时为表名
+func (m *MessageTable) comment() string {
+	if m.tableComment != "" {
+		return m.tableComment
+	}
+	return m.tableName
+}
+
+// isIgnoredField 判断字段是否被WithIgnoredFields排除在持久化之外
+func (m *MessageTable) isIgnoredField(fieldName string) bool {
+	return slices.Contains(m.ignoredFields, fieldName)
+}
+
+// isManagedTimestampField 判断字段是否为WithTimestamps指定、由MySQL填充的时间戳列
+func (m *MessageTable) isManagedTimestampField(fieldName string) bool {
+	return fieldName != "" && (fieldName == m.createdAtField || fieldName == m.updatedAtField)
+}
+
+// touchExpr 返回WithUpdatedAtColumn字段的当前时间表达式：BIGINT列用UNIX_TIMESTAMP()，
+// WithTimestamps列与其默认值一致用CURRENT_TIMESTAMP，其余DATETIME列与写入时一致用UTC_TIMESTAMP()
+func (m *MessageTable) touchExpr() string {
+	switch {
+	case m.isEpochTimestampField(m.touchField):
+		return "UNIX_TIMESTAMP()"
+	case m.isManagedTimestampField(m.touchField):
+		return "CURRENT_TIMESTAMP"
+	}
+	return "UTC_TIMESTAMP()"
+}
+
+// touchClause 返回WithUpdatedAtColumn字段的SET子句
+func (m *MessageTable) touchClause() string {
+	return m.quotedColumn(m.touchField) + " = " + m.touchExpr()
+}
+
+// withTouch 配置了WithUpdatedAtColumn时在SET子句末尾追加刷新该列的子句
+func (m *MessageTable) withTouch(clauses []string) []string {
+	if m.touchField == "" {
+		return clauses
+	}
+	return append(clauses, m.touchClause())
+}
+
+// isEpochTimestampField 判断Timestamp字段是否按Unix秒存为BIGINT（WithTimestampAsEpoch）
+func (m *MessageTable) isEpochTimestampField(fieldName string) bool {
+	return slices.Contains(m.epochFields, fieldName)
+}
+
+// isBitField 判断bool字段是否建为BIT(1)列（WithBitColumn）
+func (m *MessageTable) isBitField(fieldName string) bool {
+	return slices.Contains(m.bitFields, fieldName)
+}
+
+// isHexBytesField 判断字段是否按十六进制文本存储（WithBytesAsHex）
+func (m *MessageTable) isHexBytesField(fieldName string) bool {
+	return slices.Contains(m.hexFields, fieldName)
+}
+
+func (m *MessageTable) isNativeEnumField(fieldName string) bool {
+	return slices.Contains(m.nativeEnumFields, fieldName)
+}
+
+// fieldOptions 返回字段的pbconv编解码选项
+func (m *MessageTable) fieldOptions(fieldDesc protoreflect.FieldDescriptor) pbconv.FieldOptions {
+	fieldName := string(fieldDesc.Name())
+	return pbconv.FieldOptions{
+		TimestampAsEpoch: m.isEpochTimestampField(fieldName),
+		BytesAsHex:       m.isHexBytesField(fieldName),
+		EnumAsName:       m.isNativeEnumField(fieldName),
+		BoolAsBit:        m.isBitField(fieldName),
+	}
+}
+
+// isDBGeneratedField 判断字段的值是否由MySQL生成（时间戳列与生成列），这类字段不出现在写入参数中
+func (m *MessageTable) isDBGeneratedField(fieldName string) bool {
+	return m.isManagedTimestampField(fieldName) || m.isGeneratedColumn(fieldName)
+}
+
+// updatableField 返回按字段名显式更新的字段：字段不存在返回ErrFieldNotFound，由MySQL维护的
+// 时间戳列与生成列返回ErrInvalidTableOption（WithUpdatedAtColumn字段除外，它总被刷新为当前时间）
+func (m *MessageTable) updatableField(fieldName string) (protoreflect.FieldDescriptor, error) {
+	desc, ok := m.fieldNameToDesc[fieldName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, fieldName, m.tableName)
+	}
+	if fieldName != m.touchField && m.isDBGeneratedField(fieldName) {
+		return nil, fmt.Errorf("%w: field %s in table %s is maintained by MySQL and cannot be updated",
+			ErrInvalidTableOption, fieldName, m.tableName)
+	}
+	return desc, nil
+}
+
 func buildPlaceholders(count int) string {
 	if count <= 0 {
 		return ""
@@ -95,9 +332,31 @@ func buildPlaceholders(count int) string {
 
 // getMySQLFieldType 获取字段对应的MySQL目标类型（支持Timestamp特殊处理）
 func (m *MessageTable) getMySQLFieldType(fieldDesc protoreflect.FieldDescriptor) string {
+	if _, ok := m.spatialPointFor(string(fieldDesc.Name())); ok {
+		return spatialColumnType
+	}
+	if gc, ok := m.generatedColumnFor(string(fieldDesc.Name())); ok {
+		kindType := ""
+		if fieldDesc.Kind() != protoreflect.StringKind {
+			kindType = m.kindType(fieldDesc.Kind())
+		}
+		return gc.columnType(kindType)
+	}
+	if m.isEncryptedField(string(fieldDesc.Name())) {
+		return "MEDIUMBLOB" // base64(nonce||密文)，与字段类型无关
+	}
 	// 特殊处理Timestamp类型
 	if fieldDesc.Message() != nil && fieldDesc.Message().FullName() == timestampFullName {
 		fieldName := string(fieldDesc.Name())
+		switch fieldName {
+		case m.createdAtField:
+			return "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP"
+		case m.updatedAtField:
+			return "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP"
+		}
+		if m.isEpochTimestampField(fieldName) {
+			return "bigint NOT NULL DEFAULT 0"
+		}
 		if m.isNullableField(fieldName) {
 			return "DATETIME"
 		}
@@ -105,13 +364,37 @@ func (m *MessageTable) getMySQLFieldType(fieldDesc protoreflect.FieldDescriptor)
 	}
 
 	if fieldDesc.IsMap() || fieldDesc.IsList() {
+		if size, ok := m.textSizes[string(fieldDesc.Name())]; ok {
+			return size.columnType("BLOB")
+		}
 		return "MEDIUMBLOB" // 集合类型统一用MEDIUMBLOB
 	}
 
 	fieldName := string(fieldDesc.Name())
-	baseType, ok := MySQLFieldTypes[fieldDesc.Kind()]
-	if !ok {
-		baseType = "TEXT" // 默认类型
+	baseType := m.kindType(fieldDesc.Kind())
+	if m.isHexBytesField(fieldName) {
+		baseType = m.kindType(protoreflect.StringKind) // 十六进制是纯ASCII文本
+	}
+	if size, ok := m.textSizes[fieldName]; ok && isTextOrBlobType(baseType) {
+		if fieldDesc.Kind() == protoreflect.StringKind || m.isHexBytesField(fieldName) {
+			baseType = size.columnType("TEXT")
+		} else {
+			baseType = size.columnType("BLOB")
+		}
+	}
+	if m.isNativeEnumField(fieldName) {
+		baseType = nativeEnumType(fieldDesc.Enum())
+	}
+	if m.isBitField(fieldName) {
+		baseType = "BIT(1) NOT NULL DEFAULT b'0'"
+	}
+
+	// 覆盖整数列的unsigned属性（与proto类型无关），isTypeMatch按覆盖后的类型比对，迁移不会来回改
+	if unsigned, ok := m.unsignedOverride[fieldName]; ok {
+		baseType = setUnsigned(baseType, unsigned)
+	}
+	if m.isZerofillField(fieldName) {
+		baseType = setZerofill(baseType)
 	}
 
 	// 处理 nullable 字段
@@ -119,6 +402,10 @@ func (m *MessageTable) getMySQLFieldType(fieldDesc protoreflect.FieldDescriptor)
 		baseType = strings.ReplaceAll(baseType, " NOT NULL", "")
 	}
 
+	if collation, ok := m.collations[fieldName]; ok {
+		baseType += " COLLATE " + collation
+	}
+
 	// 处理自增字段：移除默认值（修复Error 1067）
 	if m.isAutoIncrementField(fieldName) {
 		// 移除DEFAULT 0（避免自增字段默认值冲突）
@@ -129,11 +416,26 @@ func (m *MessageTable) getMySQLFieldType(fieldDesc protoreflect.FieldDescriptor)
 	return baseType
 }
 
+// ColumnType 返回字段在建表语句中的列类型（含可空、自增、unsigned覆盖、排序规则、生成列等表配置），
+// 如 "bigint unsigned NOT NULL DEFAULT 0"，供代码生成器/测试复用类型映射；
+// 字段不存在或被忽略（WithIgnoredFields）时返回ErrFieldNotFound。
+func (m *MessageTable) ColumnType(fieldName string) (string, error) {
+	field, ok := m.fieldNameToDesc[fieldName]
+	if !ok {
+		return "", fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, fieldName, m.tableName)
+	}
+	return m.getMySQLFieldType(field), nil
+}
+
 // DB 管理所有表的数据库实例
 type DB struct {
+	// Tables 已注册的表（键为proto full name）。并发注册与使用时通过tablesMu访问，不要直接读写
 	Tables map[string]*MessageTable
-	DB     *sql.DB
-	DBName string
+	// tablesMu 保护Tables，WithContext/事务派生的实例共享同一把锁；
+	// 直接用结构体字面量构造（未经NewDB）时为nil，退回fallbackTablesMu，见tablesLock
+	tablesMu *sync.RWMutex
+	DB       *sql.DB
+	DBName   string
 	// tx 非空时所有增删改查走事务（由RunInTransaction设置）
 	tx *sql.Tx
 	// cache 可选的cache-aside缓存（EnableCache注入）；nil时全部直读DB
@@ -142,10 +444,27 @@ type DB struct {
 	// pendingCacheDels 事务内暂存待删除的缓存key，提交成功后统一删除
 	pendingCacheDels []string
 	// tableExistsCache 缓存表是否存在的查询结果
-	tableExistsCache map[string]bool
+	tableExistsCache map[string]tableExistsEntry
 	tableExistsMu    sync.RWMutex
+	// tableExistsTTL 表存在缓存的有效期（SetTableExistsTTL），0表示不过期
+	tableExistsTTL time.Duration
 	// ctx 由WithContext绑定，用于超时控制/trace传递；nil时用context.Background()
 	ctx context.Context
+	// batchSize 批量写每条SQL的最大行数（SetBatchSize），0表示BatchInsertMaxSize
+	batchSize int
+	// readOnly 只读模式（SetReadOnly）：所有写操作与建表/改表直接返回ErrReadOnly，不下发SQL
+	readOnly bool
+	// autoCreate 写入遇到表不存在（1146）时自动建表并重试一次（SetAutoCreate）
+	autoCreate bool
+	// charset/collation 建库及之后注册的表默认使用的字符集与排序规则（SetCharset），空表示DefaultCharset
+	charset   string
+	collation string
+	// defaultTimeout 未绑定ctx时每条语句的超时（SetDefaultTimeout），0表示不限
+	defaultTimeout time.Duration
+	// kindTypes 之后注册的表默认使用的proto类型到列类型覆盖（SetKindType），修改时整体替换（写时复制）
+	kindTypes map[protoreflect.Kind]string
+	// capture 捕获模式（SetCaptureMode）的记录，nil表示未开启
+	capture *statementCapture
 }
 
 // contextExecutor 统一*sql.DB与*sql.Tx的context执行接口
@@ -158,28 +477,73 @@ type contextExecutor interface {
 // sqlExecutor 绑定context的执行器：所有内部SQL都经由它下发，
 // 保证WithContext传入的超时/trace能作用到每条语句
 type sqlExecutor struct {
-	ctx context.Context
-	db  contextExecutor
+	ctx      context.Context
+	db       contextExecutor
+	readOnly bool // 只读模式下Exec直接返回ErrReadOnly
+	// createMissingTable 非nil时Exec失败后调用，返回true表示已建好缺失的表，重试一次（SetAutoCreate）
+	createMissingTable func(err error) bool
+	// timeout 每条语句的超时（SetDefaultTimeout），0表示不限
+	timeout time.Duration
 }
 
 func (e sqlExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return e.db.ExecContext(e.ctx, query, args...)
+	if e.readOnly {
+		return nil, ErrReadOnly
+	}
+	ctx, cancel := e.statementContext()
+	defer cancel()
+	result, err := e.db.ExecContext(ctx, query, args...)
+	if err != nil && e.createMissingTable != nil && e.createMissingTable(err) {
+		result, err = e.db.ExecContext(ctx, query, args...)
+	}
+	return result, wrapExecErr(err)
+}
+
+// Query 执行查询，返回的release关闭结果集并释放语句context（超时定时器），调用方读完后须 defer release()
+// 代替 rows.Close()：读取结果集期间仍受超时约束，因此不能在返回前cancel
+func (e sqlExecutor) Query(query string, args ...interface{}) (*sql.Rows, func(), error) {
+	ctx, cancel := e.statementContext()
+	rows, err := e.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, func() {}, err
+	}
+	release := func() {
+		_ = rows.Close()
+		cancel()
+	}
+	return rows, release, nil
 }
 
-func (e sqlExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return e.db.QueryContext(e.ctx, query, args...)
+// QueryRowScan 执行单行查询并Scan到dest，Scan完成后即释放语句context；无结果时返回sql.ErrNoRows
+func (e sqlExecutor) QueryRowScan(query string, args []interface{}, dest ...interface{}) error {
+	ctx, cancel := e.statementContext()
+	defer cancel()
+	return e.db.QueryRowContext(ctx, query, args...).Scan(dest...)
 }
 
-func (e sqlExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
-	return e.db.QueryRowContext(e.ctx, query, args...)
+// statementContext 单条语句使用的context：设置了默认超时（SetDefaultTimeout）时附加超时，否则原样返回
+func (e sqlExecutor) statementContext() (context.Context, context.CancelFunc) {
+	if e.timeout > 0 {
+		return context.WithTimeout(e.ctx, e.timeout)
+	}
+	return e.ctx, func() {}
 }
 
 // conn 返回当前执行器：事务内返回tx，否则返回DB（均绑定当前context）
 func (p *DB) conn() sqlExecutor {
+	var timeout time.Duration
+	if p.ctx == nil {
+		timeout = p.defaultTimeout
+	}
 	if p.tx != nil {
-		return sqlExecutor{ctx: p.context(), db: p.tx}
+		return sqlExecutor{ctx: p.context(), db: p.tx, readOnly: p.readOnly, timeout: timeout}
+	}
+	executor := sqlExecutor{ctx: p.context(), db: p.DB, readOnly: p.readOnly, timeout: timeout}
+	if p.autoCreate {
+		executor.createMissingTable = p.createMissingTable
 	}
-	return sqlExecutor{ctx: p.context(), db: p.DB}
+	return executor
 }
 
 // context 返回当前绑定的context，未绑定时返回Background
@@ -197,23 +561,139 @@ func (p *DB) context() context.Context {
 // 注意：请在根实例上调用；RunInTransaction内请直接使用回调收到的tx实例
 // （事务实例的延迟缓存失效记录不会跨实例传递）。
 func (p *DB) WithContext(ctx context.Context) *DB {
+	derived := p.clone()
+	derived.ctx = ctx
+	return derived
+}
+
+// clone 复制共享配置（Tables/连接/事务/缓存/批量大小/context）得到派生实例，
+// 事务内暂存的缓存失效记录与表存在缓存不复制
+func (p *DB) clone() *DB {
 	return &DB{
 		Tables:           p.Tables,
+		tablesMu:         p.tablesMu,
 		DB:               p.DB,
 		DBName:           p.DBName,
 		tx:               p.tx,
 		cache:            p.cache,
 		cacheTTL:         p.cacheTTL,
-		tableExistsCache: make(map[string]bool),
-		ctx:              ctx,
+		tableExistsCache: make(map[string]tableExistsEntry),
+		tableExistsTTL:   p.tableExistsTTL,
+		ctx:              p.ctx,
+		batchSize:        p.batchSize,
+		readOnly:         p.readOnly,
+		autoCreate:       p.autoCreate,
+		charset:          p.charset,
+		collation:        p.collation,
+		defaultTimeout:   p.defaultTimeout,
+		kindTypes:        p.kindTypes,
+		capture:          p.capture,
+	}
+}
+
+// SetBatchSize 设置批量写（BatchInsert/BatchSave/BatchDelete等）每条SQL的最大行数，默认BatchInsertMaxSize。
+// 宽表可调小以免超过max_allowed_packet，窄表可调大减少往返。n必须大于0。
+func (p *DB) SetBatchSize(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("batch size must be positive, got %d", n)
+	}
+	p.batchSize = n
+	return nil
+}
+
+// SetReadOnly 开启/关闭只读模式，用于只读从库服务：开启后Insert/Save/Update/Delete/批量写、
+// CreateOrUpdateTable/UpdateTableField/SyncAllTables都直接返回ErrReadOnly，不会访问数据库；
+// Find/Count/Exists等查询不受影响。之后派生的实例（WithContext/事务）沿用该设置。
+// 注意：Transaction回调里直接用*sql.Tx执行的SQL不受此限制。
+func (p *DB) SetReadOnly(readOnly bool) {
+	p.readOnly = readOnly
+}
+
+// IsReadOnly 返回是否处于只读模式（SetReadOnly）
+func (p *DB) IsReadOnly() bool {
+	return p.readOnly
+}
+
+// SetDefaultTimeout 设置默认语句超时：未通过WithContext绑定ctx时，每条增删改查语句都在
+// context.WithTimeout(context.Background(), d) 下执行（查询的超时包括读取结果集），防止慢查询无限阻塞；
+// WithContext绑定了ctx时以调用方的ctx为准。d<=0关闭。之后派生的实例（WithContext、事务）沿用该设置。
+func (p *DB) SetDefaultTimeout(d time.Duration) {
+	p.defaultTimeout = max(d, 0)
+}
+
+// SetKindType 设置本实例中proto类型kind映射的列类型，作用于之后RegisterTable与RegisterAllTables注册的表
+// （需在注册前调用，已注册的表用RefreshTable(m, WithKindType(...))调整），不影响其他实例；
+// sqlType为空时恢复默认（MySQLFieldTypes）：
+//
+//	pbDB.SetKindType(protoreflect.StringKind, "VARCHAR(255) NOT NULL DEFAULT ''")
+func (p *DB) SetKindType(kind protoreflect.Kind, sqlType string) {
+	kindTypes := maps.Clone(p.kindTypes)
+	if kindTypes == nil {
+		kindTypes = make(map[protoreflect.Kind]string)
+	}
+	if sqlType == "" {
+		delete(kindTypes, kind)
+	} else {
+		kindTypes[kind] = sqlType
+	}
+	p.kindTypes = kindTypes
+}
+
+// SetAutoCreate 开启后，写操作（Insert/Save/Update/Delete/批量写等）遇到MySQL 1146（表不存在）时，
+// 按已注册的表结构自动建表（同CreateOrUpdateTable）并重试一次该语句；其他错误照常返回。
+// 事务内不会自动建表（DDL会隐式提交事务）。之后派生的实例（WithContext）沿用该设置。
+func (p *DB) SetAutoCreate(enabled bool) {
+	p.autoCreate = enabled
+}
+
+// missingTableRegex 从1146错误信息 "Table 'db.tbl' doesn't exist" 中取出库名与表名
+var missingTableRegex = regexp.MustCompile(`Table '(?:([^'.]*)\.)?([^']+)' doesn't exist`)
+
+// createMissingTable err为1146时按错误信息定位已注册的表并建表，返回是否建表成功（可以重试）
+func (p *DB) createMissingTable(err error) bool {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) || me.Number != 1146 {
+		return false
+	}
+	match := missingTableRegex.FindStringSubmatch(me.Message)
+	if match == nil {
+		return false
+	}
+	schema, tableName := match[1], match[2]
+	for registryKey, table := range p.tablesSnapshot() {
+		if table.tableName != tableName || (schema != "" && p.tableSchema(table) != schema) {
+			continue
+		}
+		p.InvalidateTableCache(tableName)
+		if syncErr := p.syncTableSchema(registryKey, table); syncErr != nil {
+			log.Printf("proto2mysql: auto create table %s failed: %v", tableName, syncErr)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// batchLimit 当前生效的批量大小
+func (p *DB) batchLimit() int {
+	if p.batchSize > 0 {
+		return p.batchSize
 	}
+	return BatchInsertMaxSize
 }
 
-// wrapExecErr 把MySQL 1062（唯一键冲突）包装成可errors.Is(err, ErrDuplicateKey)判断的哨兵错误
+// wrapExecErr 把写操作的MySQL错误包装成可errors.Is判断的哨兵错误（保留原始*mysql.MySQLError）：
+// 1062（唯一键冲突）→ErrDuplicateKey，1451/1452（外键约束）→ErrForeignKeyViolation
 func wrapExecErr(err error) error {
 	var me *mysql.MySQLError
-	if errors.As(err, &me) && me.Number == 1062 {
+	if !errors.As(err, &me) {
+		return err
+	}
+	switch me.Number {
+	case 1062:
 		return fmt.Errorf("%w: %w", ErrDuplicateKey, err)
+	case 1451, 1452:
+		return fmt.Errorf("%w: %w", ErrForeignKeyViolation, err)
 	}
 	return err
 }
@@ -224,16 +704,8 @@ func wrapExecErr(err error) error {
 func (p *DB) RunInTransaction(fn func(tx *DB) error) error {
 	var txDB *DB
 	err := p.Transaction(func(sqlTx *sql.Tx) error {
-		txDB = &DB{
-			Tables:           p.Tables,
-			DB:               p.DB,
-			DBName:           p.DBName,
-			tx:               sqlTx,
-			cache:            p.cache,
-			cacheTTL:         p.cacheTTL,
-			tableExistsCache: make(map[string]bool),
-			ctx:              p.ctx,
-		}
+		txDB = p.clone()
+		txDB.tx = sqlTx
 		return fn(txDB)
 	})
 	if err == nil && txDB != nil {
@@ -243,15 +715,99 @@ func (p *DB) RunInTransaction(fn func(tx *DB) error) error {
 	return err
 }
 
-// OpenDB 打开数据库连接并切换数据库
+// savepointNameRegex 保存点名：字母或下划线开头，由字母、数字、下划线组成，最长64字节
+var savepointNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Savepoint 在当前事务中设置保存点（SAVEPOINT name），只能在RunInTransaction的tx上调用。
+// 与RollbackTo配合可只撤销一段子操作而不回滚整个事务：
+//
+//	err := pbDB.RunInTransaction(func(tx *proto2mysql.DB) error {
+//		if err := tx.Savepoint("gift"); err != nil {
+//			return err
+//		}
+//		if err := tx.Insert(gift); err != nil {
+//			return tx.RollbackTo("gift") // 只撤销发礼物，继续事务
+//		}
+//		return tx.ReleaseSavepoint("gift")
+//	})
+func (p *DB) Savepoint(name string) error {
+	return p.execSavepoint("SAVEPOINT", name)
+}
+
+// RollbackTo 回滚到保存点（ROLLBACK TO SAVEPOINT name），撤销之后的写入，事务继续；保存点仍保留可再次回滚。
+// 事务内已登记的缓存失效仍会在提交后执行（多删缓存无害）
+func (p *DB) RollbackTo(name string) error {
+	return p.execSavepoint("ROLLBACK TO SAVEPOINT", name)
+}
+
+// ReleaseSavepoint 释放保存点（RELEASE SAVEPOINT name），保留其后的写入
+func (p *DB) ReleaseSavepoint(name string) error {
+	return p.execSavepoint("RELEASE SAVEPOINT", name)
+}
+
+// execSavepoint 校验保存点名并在当前事务上执行保存点语句
+func (p *DB) execSavepoint(stmt, name string) error {
+	if p.tx == nil {
+		return fmt.Errorf("%s %s: not in a transaction (use RunInTransaction)", strings.ToLower(stmt), name)
+	}
+	if !savepointNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	if _, err := p.tx.ExecContext(p.context(), stmt+" "+escapeMySQLName(name)); err != nil {
+		return fmt.Errorf("%s %s: %w", strings.ToLower(stmt), name, err)
+	}
+	return nil
+}
+
+// OpenDB 绑定数据库连接池。目标库完全由DSN决定（如NewMysqlConfig中的DBName），
+// 不再执行USE：USE只作用于连接池中的一条连接，池里新建的连接仍会落到DSN中的库，
+// 两者不一致时读写会分散到不同的库。
+// dbname必须与DSN选中的库一致（用于information_schema查询），不一致时返回错误。
 func (p *DB) OpenDB(db *sql.DB, dbname string) error {
+	var current sql.NullString
+	if err := db.QueryRowContext(p.context(), "SELECT DATABASE()").Scan(&current); err != nil {
+		return fmt.Errorf("query current database: %w", err)
+	}
+	if current.String != dbname {
+		return fmt.Errorf("dsn selects database %q, expected %q: set DBName in the DSN", current.String, dbname)
+	}
 	p.DB = db
 	p.DBName = dbname
-	_, err := p.DB.ExecContext(p.context(), "USE "+escapeMySQLName(p.DBName))
-	return err
+	return nil
+}
+
+// CreateDatabaseIfNotExists 在当前连接上创建库（字符集见SetCharset，默认utf8mb4），已存在时不做任何事，用于首次部署初始化。
+// 库不存在时DSN无法选中它，通常用不带DBName的连接调用，见EnsureDatabase。
+func (p *DB) CreateDatabaseIfNotExists(dbname string) error {
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	if err := validateDatabaseName(dbname); err != nil {
+		return err
+	}
+	if p.DB == nil {
+		return errors.New("create database: db is not opened")
+	}
+	stmt := "CREATE DATABASE IF NOT EXISTS " + escapeMySQLName(dbname) + " " + charsetSQL(p.charset, p.collation, "CHARACTER SET ", " COLLATE ")
+	if _, err := p.DB.ExecContext(p.context(), stmt); err != nil {
+		return fmt.Errorf("create database %s: %w", dbname, err)
+	}
+	return nil
+}
+
+// validateDatabaseName 校验库名：1-64字节，不含路径分隔符/点/NUL，且不以空格结尾（MySQL的库名限制）
+func validateDatabaseName(dbname string) error {
+	if dbname == "" || len(dbname) > mysqlMaxIdentifierLen {
+		return fmt.Errorf("invalid database name %q: must be 1-%d bytes", dbname, mysqlMaxIdentifierLen)
+	}
+	if strings.ContainsAny(dbname, "/\\.\x00") || strings.HasSuffix(dbname, " ") {
+		return fmt.Errorf("invalid database name %q", dbname)
+	}
+	return nil
 }
 
-// MySQLFieldTypes MySQL字段类型映射表
+// MySQLFieldTypes 默认的proto类型到MySQL列类型映射表。按实例或按表修改请用SetKindType/WithKindType，
+// 不要直接改这个全局map（影响所有实例且并发不安全）
 var MySQLFieldTypes = map[protoreflect.Kind]string{
 	protoreflect.Int32Kind:   "int NOT NULL DEFAULT 0",
 	protoreflect.Uint32Kind:  "int unsigned NOT NULL DEFAULT 0",
@@ -266,12 +822,56 @@ var MySQLFieldTypes = map[protoreflect.Kind]string{
 	protoreflect.MessageKind: "MEDIUMBLOB",
 }
 
+// setUnsigned 在类型名后加上或去掉unsigned，如 "bigint NOT NULL DEFAULT 0" -> "bigint unsigned NOT NULL DEFAULT 0"
+func setUnsigned(columnType string, unsigned bool) string {
+	parts := strings.Fields(columnType)
+	if len(parts) == 0 {
+		return columnType
+	}
+	rest := slices.DeleteFunc(parts[1:], func(part string) bool { return strings.EqualFold(part, "unsigned") })
+	if unsigned {
+		rest = append([]string{"unsigned"}, rest...)
+	}
+	return strings.Join(append(parts[:1], rest...), " ")
+}
+
+// zerofillWidths 各整数类型unsigned zerofill时MySQL的默认显示宽度（最大值的位数）
+var zerofillWidths = map[string]int{"tinyint": 3, "smallint": 5, "mediumint": 8, "int": 10, "bigint": 20}
+
+// setZerofill 把整数列类型改为带默认显示宽度的unsigned zerofill，
+// 如 "int NOT NULL DEFAULT 0" -> "int(10) unsigned zerofill NOT NULL DEFAULT 0"
+func setZerofill(columnType string) string {
+	parts := strings.Fields(setUnsigned(columnType, true))
+	if len(parts) == 0 {
+		return columnType
+	}
+	name, _, _ := strings.Cut(strings.ToLower(parts[0]), "(")
+	if width, ok := zerofillWidths[name]; ok {
+		parts[0] = fmt.Sprintf("%s(%d)", name, width)
+	}
+	rest := slices.DeleteFunc(parts[2:], func(part string) bool { return strings.EqualFold(part, "zerofill") })
+	return strings.Join(append([]string{parts[0], parts[1], "zerofill"}, rest...), " ")
+}
+
+// isIntegerKind 判断字段是否为可设置unsigned属性的整数类型
+func isIntegerKind(kind protoreflect.Kind) bool {
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind, protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
+
 // 解析MySQL类型信息
 type mysqlTypeInfo struct {
 	baseType string
+	params   string // 括号内的原始参数（小写），ENUM按值列表比对
 	length   int
 	decimal  int
 	unsigned bool
+	zerofill bool
 }
 
 // 解析MySQL类型字符串
@@ -289,6 +889,7 @@ func parseMySQLType(colType string) mysqlTypeInfo {
 		info.baseType = basePart[:idx]
 		// 提取长度和小数位
 		params := strings.Trim(basePart[idx:], "()")
+		info.params = params
 		if strings.Contains(params, ",") {
 			parts := strings.Split(params, ",")
 			if len(parts) >= 1 {
@@ -304,11 +905,14 @@ func parseMySQLType(colType string) mysqlTypeInfo {
 		info.baseType = basePart
 	}
 
-	// 检查是否为unsigned
+	// 检查是否为unsigned/zerofill（zerofill隐含unsigned）
 	for _, part := range parts[1:] {
-		if part == "unsigned" {
+		switch part {
+		case "unsigned":
 			info.unsigned = true
-			break
+		case "zerofill":
+			info.unsigned = true
+			info.zerofill = true
 		}
 	}
 
@@ -324,10 +928,14 @@ func isTypeMatch(currentType, targetType string) bool {
 	typeMap := map[string]string{
 		"bool":       "tinyint",
 		"integer":    "int",
-		"mediumtext": "mediumtext",
+		"tinytext":   "tinytext",
 		"text":       "text",
+		"mediumtext": "mediumtext",
+		"longtext":   "longtext",
+		"tinyblob":   "tinyblob",
 		"blob":       "blob",
 		"mediumblob": "mediumblob",
+		"longblob":   "longblob",
 		"datetime":   "datetime",
 		"timestamp":  "datetime",
 		"varchar":    "varchar",
@@ -354,12 +962,18 @@ func isTypeMatch(currentType, targetType string) bool {
 	case "varchar", "char":
 		// 目标长度大于等于当前长度视为兼容
 		return target.length >= current.length
-	case "int", "bigint", "tinyint", "smallint":
-		// 无符号属性必须一致
-		return current.unsigned == target.unsigned
+	case "int", "bigint", "tinyint", "smallint", "mediumint":
+		// 无符号/补零属性必须一致；显示宽度只对补零列有意义（MySQL 8.0.19起其余整数列不再报告宽度）
+		if current.unsigned != target.unsigned || current.zerofill != target.zerofill {
+			return false
+		}
+		return !current.zerofill || current.length == 0 || target.length == 0 || current.length == target.length
 	case "float", "double":
 		// 小数位兼容检查
 		return target.decimal >= current.decimal
+	case "enum":
+		// 值列表必须完全一致（新增/删除/调整枚举值都需要MODIFY）
+		return current.params == target.params
 	}
 
 	return true
@@ -372,48 +986,35 @@ func escapeMySQLName(name string) string {
 
 // GetCreateTableSQL 生成创建表的SQL语句
 func (m *MessageTable) GetCreateTableSQL() string {
-	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n", escapeMySQLName(m.tableName))
+	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n", m.sqlName())
 	fields := []string{}
 	indexes := []string{}
 
-	desc := m.Descriptor
-	for i := 0; i < desc.Fields().Len(); i++ {
-		field := desc.Fields().Get(i)
+	for _, field := range m.columns {
 		fieldName := string(field.Name())
-		escapedName := escapeMySQLName(fieldName)
+		escapedName := m.quotedColumn(fieldName)
 
 		fieldType := m.getMySQLFieldType(field)
 
-		fields = append(fields, fmt.Sprintf("  %s %s%s", escapedName, fieldType, columnComment(field.Number())))
+		fields = append(fields, fmt.Sprintf("  %s %s%s", escapedName, fieldType, columnComment(field.Number(), m.fieldComments[fieldName])))
+	}
+	for _, gc := range m.standaloneGeneratedColumns() {
+		fields = append(fields, fmt.Sprintf("  %s %s", escapeMySQLName(gc.name), gc.columnType("")))
 	}
 
 	if len(m.primaryKey) > 0 {
 		primaryKeys := make([]string, len(m.primaryKey))
 		for i, pk := range m.primaryKey {
-			primaryKeys[i] = escapeMySQLName(pk)
+			primaryKeys[i] = m.quotedColumn(pk)
 		}
 		fields = append(fields, fmt.Sprintf("  PRIMARY KEY (%s)", strings.Join(primaryKeys, ",")))
 	}
 
-	if len(m.indexes) > 0 {
-		for idx, indexCols := range m.indexes {
-			cols := strings.Split(indexCols, ",")
-			quotedCols := make([]string, len(cols))
-			for i, col := range cols {
-				quotedCols[i] = escapeMySQLName(strings.TrimSpace(col))
-			}
-			indexName := fmt.Sprintf("idx_%s_%d", m.tableName, idx)
-			indexes = append(indexes, fmt.Sprintf("  INDEX %s (%s)", escapeMySQLName(indexName), strings.Join(quotedCols, ",")))
-		}
+	for _, def := range m.indexDefs() {
+		indexes = append(indexes, "  "+def.sql())
 	}
-
-	if m.uniqueKeys != "" {
-		uniqueCols := strings.Split(m.uniqueKeys, ",")
-		quotedUniqueCols := make([]string, len(uniqueCols))
-		for i, col := range uniqueCols {
-			quotedUniqueCols[i] = escapeMySQLName(strings.TrimSpace(col))
-		}
-		indexes = append(indexes, fmt.Sprintf("  UNIQUE KEY %s (%s)", escapeMySQLName("uk_"+m.tableName), strings.Join(quotedUniqueCols, ",")))
+	for _, def := range m.foreignKeyDefs() {
+		indexes = append(indexes, "  "+def)
 	}
 
 	stmt += strings.Join(fields, ",\n")
@@ -421,93 +1022,635 @@ func (m *MessageTable) GetCreateTableSQL() string {
 		stmt += ",\n" + strings.Join(indexes, ",\n")
 	}
 
-	// 表注释简化为表名
-	stmt += "\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='" + escapeMySQLComment(m.tableName) + "';"
-	return stmt
+	stmt += "\n) ENGINE=InnoDB"
+	if m.autoIncreaseKey != "" && m.autoIncrement > 0 {
+		stmt += fmt.Sprintf(" AUTO_INCREMENT=%d", m.autoIncrement)
+	}
+	stmt += " " + charsetSQL(m.charset, m.collation, "DEFAULT CHARSET=", " COLLATE=") + " COMMENT='" + escapeMySQLComment(m.comment()) + "'"
+	return stmt + m.partitionSQL() + ";"
 }
 
-// escapeMySQLComment 转义MySQL注释中的特殊字符（仅保留基础转义）
-func escapeMySQLComment(comment string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(comment, "'", "\\'"), "\n", " ")
+// indexDef 单个索引（不含主键）的定义，建表与迁移补齐索引共用
+type indexDef struct {
+	kind    string   // INDEX / UNIQUE KEY / FULLTEXT INDEX
+	name    string   // 索引名（未转义）
+	cols    []string // 字段名（未转义）
+	lengths []int    // 与cols对应的前缀长度，0表示整列（WithCompositeIndex显式指定，其余按列类型补齐）
+	// desc 与cols对应的排序方向（WithCompositeIndex），非nil时每列都写出ASC/DESC
+	desc []bool
+	// invisible 建为不可见索引（WithInvisibleIndex），优化器不使用但仍然维护
+	invisible bool
 }
 
-// columnCommentPrefix 列注释中记录 proto 字段号的前缀，形如 COMMENT 'pb:3'。
-// 迁移时据此按字段号识别列，从而支持字段改名（CHANGE COLUMN）并保留原有数据。
-const columnCommentPrefix = "pb:"
+// sql 生成索引定义片段，如 INDEX `idx_t_0` (`a`,`b`(191))、INDEX `idx_c` (`a`(20) ASC,`b` DESC)
+func (d indexDef) sql() string {
+	quotedCols := make([]string, len(d.cols))
+	for i, col := range d.cols {
+		quotedCols[i] = escapeMySQLName(col)
+		if i < len(d.lengths) && d.lengths[i] > 0 {
+			quotedCols[i] += fmt.Sprintf("(%d)", d.lengths[i])
+		}
+		if i < len(d.desc) {
+			if d.desc[i] {
+				quotedCols[i] += " DESC"
+			} else {
+				quotedCols[i] += " ASC"
+			}
+		}
+	}
+	stmt := fmt.Sprintf("%s %s (%s)", d.kind, escapeMySQLName(d.name), strings.Join(quotedCols, ","))
+	if d.invisible {
+		stmt += " /*!80000 INVISIBLE */"
+	}
+	return stmt
+}
 
-// columnComment 生成带 proto 字段号的列注释片段（含前导空格），如 " COMMENT 'pb:3'"。
-func columnComment(num protoreflect.FieldNumber) string {
-	return fmt.Sprintf(" COMMENT '%s%d'", columnCommentPrefix, num)
+// indexDefs 按表配置列出全部索引：普通索引 idx_<表名>_<序号>、唯一键 uk_<表名>、全文索引 ft_<表名>，
+// 以及WithNamedIndex指定的命名索引。自动生成的索引名超过MySQL标识符上限时经autoIndexName缩短。
+func (m *MessageTable) indexDefs() []indexDef {
+	defs := m.fieldIndexDefs()
+	// 索引按字段名配置，生成DDL时换成库列名（WithColumnMapping）；
+	// 普通索引/唯一键中的文本/二进制列必须带前缀长度，否则MySQL报错1170
+	for i := range defs {
+		cols := make([]string, len(defs[i].cols))
+		explicit := defs[i].lengths
+		var lengths []int
+		for j, col := range defs[i].cols {
+			cols[j] = m.columnName(col)
+			if defs[i].kind != "INDEX" && defs[i].kind != "UNIQUE KEY" {
+				continue
+			}
+			n := m.indexPrefixLen(col)
+			if j < len(explicit) && explicit[j] > 0 {
+				n = explicit[j]
+			}
+			if n > 0 {
+				if lengths == nil {
+					lengths = make([]int, len(cols))
+				}
+				lengths[j] = n
+			}
+		}
+		defs[i].cols = cols
+		defs[i].lengths = lengths
+	}
+	return defs
 }
 
-// parseFieldNumFromComment 从列注释解析 proto 字段号；无 pb:N 前缀或非法时返回 (0,false)。
-func parseFieldNumFromComment(comment string) (protoreflect.FieldNumber, bool) {
-	if !strings.HasPrefix(comment, columnCommentPrefix) {
-		return 0, false
+// fieldIndexDefs 按表配置列出全部索引，cols仍为proto字段名（未做列名映射与前缀长度）
+func (m *MessageTable) fieldIndexDefs() []indexDef {
+	var defs []indexDef
+	for idx, indexCols := range m.indexes {
+		defs = append(defs, indexDef{
+			kind: "INDEX",
+			name: autoIndexName(fmt.Sprintf("idx_%s_%d", m.tableName, idx)),
+			cols: splitOptionCSV(indexCols),
+		})
+	}
+	defs = append(defs, m.namedIndexes...)
+	if m.uniqueKeys != "" {
+		defs = append(defs, indexDef{kind: "UNIQUE KEY", name: autoIndexName("uk_" + m.tableName), cols: splitOptionCSV(m.uniqueKeys)})
 	}
-	n, err := strconv.Atoi(strings.TrimPrefix(comment, columnCommentPrefix))
-	if err != nil || n < int(protowire.MinValidNumber) || n > int(protowire.MaxValidNumber) {
-		return 0, false
+	if len(m.fullTextKeys) > 0 {
+		defs = append(defs, indexDef{kind: "FULLTEXT INDEX", name: autoIndexName("ft_" + m.tableName), cols: m.fullTextKeys})
+	}
+	for _, sp := range m.spatialPoints {
+		defs = append(defs, indexDef{kind: "SPATIAL INDEX", name: autoIndexName("sp_" + m.tableName + "_" + sp.field), cols: []string{sp.field}})
 	}
-	return protoreflect.FieldNumber(n), true
+	for i := range defs {
+		defs[i].invisible = m.isInvisibleIndex(defs[i].cols)
+	}
+	return defs
 }
 
-// columnMeta 线上单列的元信息：类型 + 从注释解析出的 proto 字段号（0 表示无字段号注释，
-// 通常是旧版本创建的表）。
-type columnMeta struct {
-	colType  string
-	fieldNum protoreflect.FieldNumber
+// hasIndexOn 表配置中是否有字段列表恰为cols的索引（主键除外）
+func (m *MessageTable) hasIndexOn(cols []string) bool {
+	for _, def := range m.fieldIndexDefs() {
+		if slices.Equal(def.cols, cols) {
+			return true
+		}
+	}
+	return false
 }
 
-// getTableColumns 获取表当前字段结构信息
-func (p *DB) getTableColumns(tableName string) (map[string]string, error) {
-	table, ok := p.Tables[tableName]
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+// validateAutoIncrement 校验自增字段：须为整数字段，且是主键或某个普通/唯一索引的首列，
+// 否则MySQL建表报错1075（Incorrect table definition; there can be only one auto column and it must be defined as a key）
+func (m *MessageTable) validateAutoIncrement() error {
+	col := m.autoIncreaseKey
+	if col == "" {
+		return nil
 	}
-
-	table.columnsMu.RLock()
-	if table.cachedColumns != nil {
-		defer table.columnsMu.RUnlock()
-		return table.cachedColumns, nil
+	field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+	if field == nil {
+		return fmt.Errorf("%w: auto-increment column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
 	}
-	table.columnsMu.RUnlock()
-
-	query := `
-		SELECT COLUMN_NAME, COLUMN_TYPE 
-		FROM INFORMATION_SCHEMA.COLUMNS 
-		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
-	`
-	rows, err := p.DB.QueryContext(p.context(), query, p.DBName, table.tableName)
-	if err != nil {
-		return nil, fmt.Errorf("query columns for table %s: %w", table.tableName, err)
+	if !isIntegerKind(field.Kind()) || field.IsList() || field.IsMap() {
+		return fmt.Errorf("%w: auto-increment column %s in table %s must be an integer field, got %s",
+			ErrInvalidTableOption, col, m.tableName, field.Kind())
 	}
-	defer rows.Close()
-
-	columns := make(map[string]string)
-	for rows.Next() {
-		var colName, colType string
-		if err := rows.Scan(&colName, &colType); err != nil {
-			return nil, fmt.Errorf("scan columns for table %s: %w", tableName, err)
+	if len(m.primaryKey) > 0 && m.primaryKey[0] == col {
+		return nil
+	}
+	for _, def := range m.fieldIndexDefs() {
+		if (def.kind == "INDEX" || def.kind == "UNIQUE KEY") && len(def.cols) > 0 && def.cols[0] == col {
+			return nil
 		}
-		columns[colName] = colType
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error for table %s columns: %w", tableName, err)
+	return fmt.Errorf("%w: auto-increment column %s in table %s must be the first column of the primary key or an index",
+		ErrInvalidTableOption, col, m.tableName)
+}
+
+// isInvisibleIndex 字段列表为cols的索引是否配置为不可见（WithInvisibleIndex）
+func (m *MessageTable) isInvisibleIndex(cols []string) bool {
+	for _, invisible := range m.invisibleIndexes {
+		if slices.Equal(invisible, cols) {
+			return true
+		}
 	}
+	return false
+}
 
-	table.columnsMu.Lock()
-	table.cachedColumns = columns
-	table.columnsMu.Unlock()
+// defaultIndexPrefixLen 文本/二进制列的默认索引前缀长度：utf8mb4下191字符不超过767字节的旧版索引上限
+const defaultIndexPrefixLen = 191
 
-	return columns, nil
+// indexPrefixLen 返回字段作为索引列时的前缀长度，非文本/二进制列返回0（整列）
+func (m *MessageTable) indexPrefixLen(fieldName string) int {
+	field := m.Descriptor.Fields().ByName(protoreflect.Name(fieldName))
+	if field == nil || !isTextOrBlobType(m.getMySQLFieldType(field)) {
+		return 0
+	}
+	if n, ok := m.prefixLengths[fieldName]; ok {
+		return n
+	}
+	return defaultIndexPrefixLen
+}
+
+// isTextOrBlobType 判断列类型是否为TEXT/BLOB族（建索引须指定前缀长度）
+func isTextOrBlobType(columnType string) bool {
+	upper := strings.ToUpper(columnType)
+	return strings.Contains(upper, "TEXT") || strings.Contains(upper, "BLOB")
+}
+
+// mysqlMaxIdentifierLen MySQL标识符（表名/索引名等）的最大长度
+const mysqlMaxIdentifierLen = 64
+
+// autoIndexName 自动生成的索引名超过64字节时，截断并追加原名的8位FNV哈希，
+// 保证结果不超长、同一输入稳定且不同长表名之间不易冲突。
+func autoIndexName(name string) string {
+	if len(name) <= mysqlMaxIdentifierLen {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	return truncateUTF8(name, mysqlMaxIdentifierLen-len(suffix)) + suffix
+}
+
+// truncateUTF8 把s截断到不超过n字节，且不会把多字节UTF-8字符截成半个
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// buildIndexAlterClauses 为线上表缺失的索引（按索引名比对existing）生成 ADD 子句
+func (m *MessageTable) buildIndexAlterClauses(existing map[string]bool) []string {
+	var clauses []string
+	for _, def := range m.indexDefs() {
+		if !existing[def.name] {
+			clauses = append(clauses, "ADD "+def.sql())
+		}
+	}
+	return clauses
+}
+
+// buildIndexVisibilityClauses 对线上已存在的本表索引，按WithInvisibleIndex配置与线上可见性(invisible)的差异
+// 生成 ALTER INDEX ... VISIBLE/INVISIBLE 子句；不在indexDefs中的索引（外部手工建的）不处理
+func (m *MessageTable) buildIndexVisibilityClauses(existing, invisible map[string]bool) []string {
+	var clauses []string
+	for _, def := range m.indexDefs() {
+		if !existing[def.name] || def.invisible == invisible[def.name] {
+			continue
+		}
+		visibility := "VISIBLE"
+		if def.invisible {
+			visibility = "INVISIBLE"
+		}
+		clauses = append(clauses, fmt.Sprintf("ALTER INDEX %s %s", escapeMySQLName(def.name), visibility))
+	}
+	return clauses
+}
+
+// Validate 校验表配置能否生成合法的DDL（如全文索引只能建在文本列上）。
+// 建表/同步结构前会自动调用；直接使用GetCreateTableSQL时可先调用它提前发现配置错误。
+func (m *MessageTable) Validate() error {
+	for _, col := range m.ignoredFields {
+		if m.Descriptor.Fields().ByName(protoreflect.Name(col)) == nil {
+			return fmt.Errorf("%w: ignored field %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if slices.Contains(m.primaryKey, col) || col == m.autoIncreaseKey {
+			return fmt.Errorf("%w: primary/auto-increment key %s in table %s cannot be ignored", ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	if err := m.validateAutoIncrement(); err != nil {
+		return err
+	}
+	if m.charset != "" {
+		if err := validateCharset(m.charset, m.collation); err != nil {
+			return fmt.Errorf("%w: table %s: %v", ErrInvalidTableOption, m.tableName, err)
+		}
+	}
+	for _, col := range []string{m.createdAtField, m.updatedAtField} {
+		if col == "" {
+			continue
+		}
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: timestamp column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.IsList() || field.Message() == nil || field.Message().FullName() != timestampFullName {
+			return fmt.Errorf("%w: timestamp column %s in table %s must be a google.protobuf.Timestamp field",
+				ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	if n := strings.Count(m.defaultWhere, "?"); n != len(m.defaultWhereArgs) {
+		return fmt.Errorf("%w: default where of table %s has %d placeholders but %d args",
+			ErrInvalidTableOption, m.tableName, n, len(m.defaultWhereArgs))
+	}
+	for _, cols := range m.invisibleIndexes {
+		if !m.hasIndexOn(cols) {
+			return fmt.Errorf("%w: invisible index (%s) does not match any index of table %s",
+				ErrInvalidTableOption, strings.Join(cols, ","), m.tableName)
+		}
+	}
+	if m.maxPlaceholders < 0 || m.maxPlaceholders > MaxPlaceholders {
+		return fmt.Errorf("%w: max placeholders of table %s must be in [1, %d], got %d",
+			ErrInvalidTableOption, m.tableName, MaxPlaceholders, m.maxPlaceholders)
+	}
+	orderSeen := make(map[string]bool, len(m.columnOrder))
+	for _, col := range m.columnOrder {
+		if m.Descriptor.Fields().ByName(protoreflect.Name(col)) == nil {
+			return fmt.Errorf("%w: column order field %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if orderSeen[col] {
+			return fmt.Errorf("%w: column order field %s in table %s is listed twice", ErrInvalidTableOption, col, m.tableName)
+		}
+		orderSeen[col] = true
+	}
+	for col := range m.unsignedOverride {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: signed/unsigned column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if !isIntegerKind(field.Kind()) || field.IsList() || field.IsMap() {
+			return fmt.Errorf("%w: signed/unsigned column %s in table %s must be an integer field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	for _, col := range m.zerofillFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: zerofill column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if !isIntegerKind(field.Kind()) || field.IsList() || field.IsMap() {
+			return fmt.Errorf("%w: zerofill column %s in table %s must be an integer field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+		if unsigned, ok := m.unsignedOverride[col]; ok && !unsigned {
+			return fmt.Errorf("%w: zerofill column %s in table %s cannot be signed", ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	for _, col := range m.bitFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: bit column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.BoolKind || field.IsList() {
+			return fmt.Errorf("%w: bit column %s in table %s must be a bool field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	for _, col := range m.hexFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: hex bytes column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.BytesKind || field.IsList() {
+			return fmt.Errorf("%w: hex bytes column %s in table %s must be a bytes field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	for _, col := range m.nullableMessageFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: nullable message column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.MessageKind || field.IsList() || field.IsMap() ||
+			field.Message().FullName() == timestampFullName || m.isZeroAsNullField(col) {
+			return fmt.Errorf("%w: nullable message column %s in table %s must be a singular non-Timestamp message field "+
+				"not listed in WithZeroValueAsNull", ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	for _, col := range m.zeroAsNullFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: zero-as-null column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.IsList() || field.IsMap() || slices.Contains(m.primaryKey, col) {
+			return fmt.Errorf("%w: zero-as-null column %s in table %s must be a singular non-primary-key field",
+				ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	for _, col := range m.nativeEnumFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: native enum column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.EnumKind || field.IsList() {
+			return fmt.Errorf("%w: native enum column %s in table %s must be an enum field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	if m.touchField != "" {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(m.touchField))
+		if field == nil {
+			return fmt.Errorf("%w: updated_at column %s not found in table %s", ErrInvalidTableOption, m.touchField, m.tableName)
+		}
+		if field.IsList() || field.Message() == nil || field.Message().FullName() != timestampFullName {
+			return fmt.Errorf("%w: updated_at column %s in table %s must be a google.protobuf.Timestamp field",
+				ErrInvalidTableOption, m.touchField, m.tableName)
+		}
+	}
+	for _, col := range m.epochFields {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: epoch timestamp column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.IsList() || field.Message() == nil || field.Message().FullName() != timestampFullName {
+			return fmt.Errorf("%w: epoch timestamp column %s in table %s must be a google.protobuf.Timestamp field",
+				ErrInvalidTableOption, col, m.tableName)
+		}
+		if m.isManagedTimestampField(col) {
+			return fmt.Errorf("%w: epoch timestamp column %s in table %s cannot also be a WithTimestamps column",
+				ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	for _, def := range m.namedIndexes {
+		if def.name == "" || len(def.name) > mysqlMaxIdentifierLen {
+			return fmt.Errorf("%w: index name %q in table %s must be 1-%d bytes",
+				ErrInvalidTableOption, def.name, m.tableName, mysqlMaxIdentifierLen)
+		}
+		if len(def.cols) == 0 {
+			return fmt.Errorf("%w: index %s in table %s has no columns", ErrInvalidTableOption, def.name, m.tableName)
+		}
+		for i, col := range def.cols {
+			field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+			if field == nil && !m.isGeneratedColumn(col) {
+				return fmt.Errorf("%w: index %s column %s not found in table %s", ErrInvalidTableOption, def.name, col, m.tableName)
+			}
+			if i >= len(def.lengths) || def.lengths[i] == 0 {
+				continue
+			}
+			if def.lengths[i] < 0 || field == nil || !isTextOrBlobType(m.getMySQLFieldType(field)) {
+				return fmt.Errorf("%w: index %s prefix length on column %s in table %s must be positive and only for text/blob columns, got %d",
+					ErrInvalidTableOption, def.name, col, m.tableName, def.lengths[i])
+			}
+		}
+	}
+	for _, col := range m.fullTextKeys {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: fulltext index column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.StringKind || field.IsList() || field.IsMap() {
+			return fmt.Errorf("%w: fulltext index column %s in table %s must be a string field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	for col, n := range m.prefixLengths {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: prefix index column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if n <= 0 || !isTextOrBlobType(m.getMySQLFieldType(field)) {
+			return fmt.Errorf("%w: prefix index column %s in table %s must be a text/blob column with a positive length, got %d",
+				ErrInvalidTableOption, col, m.tableName, n)
+		}
+	}
+	for col, collation := range m.collations {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: collation column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if field.Kind() != protoreflect.StringKind || field.IsList() || field.IsMap() || m.isNativeEnumField(col) {
+			return fmt.Errorf("%w: collation column %s in table %s must be a string field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+		if !collationMatchesCharset(collation, m.tableCharset()) {
+			return fmt.Errorf("%w: collation %q of column %s in table %s is not a %s collation",
+				ErrInvalidTableOption, collation, col, m.tableName, m.tableCharset())
+		}
+	}
+	for col := range m.fieldComments {
+		if _, ok := m.fieldNameToDesc[col]; !ok {
+			return fmt.Errorf("%w: comment column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+	}
+	for col, size := range m.textSizes {
+		field := m.Descriptor.Fields().ByName(protoreflect.Name(col))
+		if field == nil {
+			return fmt.Errorf("%w: text size column %s not found in table %s", ErrInvalidTableOption, col, m.tableName)
+		}
+		if size < TextSizeTiny || size > TextSizeLong {
+			return fmt.Errorf("%w: invalid text size %d for column %s in table %s", ErrInvalidTableOption, size, col, m.tableName)
+		}
+		if !isTextOrBlobType(m.getMySQLFieldType(field)) {
+			return fmt.Errorf("%w: text size column %s in table %s must be a string/bytes/message field, got %s",
+				ErrInvalidTableOption, col, m.tableName, field.Kind())
+		}
+	}
+	if err := m.validateColumnMapping(); err != nil {
+		return err
+	}
+	if err := m.validateGeneratedColumns(); err != nil {
+		return err
+	}
+	if err := m.validateSpatialPoints(); err != nil {
+		return err
+	}
+	if err := m.validateForeignKeys(); err != nil {
+		return err
+	}
+	if err := m.validateUTF8mb4Fields(); err != nil {
+		return err
+	}
+	if err := m.validateEncryptedColumns(); err != nil {
+		return err
+	}
+	if err := m.validateAuditTable(); err != nil {
+		return err
+	}
+	if err := m.validateActiveUniqueKeys(); err != nil {
+		return err
+	}
+	return m.validatePartition()
+}
+
+// validateColumnMapping 校验WithColumnMapping：字段存在、列名合法，且映射后不与其他列重名
+func (m *MessageTable) validateColumnMapping() error {
+	for field, column := range m.columnMapping {
+		if m.Descriptor.Fields().ByName(protoreflect.Name(field)) == nil {
+			return fmt.Errorf("%w: mapped field %s not found in table %s", ErrInvalidTableOption, field, m.tableName)
+		}
+		if column == "" || len(column) > mysqlMaxIdentifierLen {
+			return fmt.Errorf("%w: column name %q for field %s in table %s must be 1-%d bytes",
+				ErrInvalidTableOption, column, field, m.tableName, mysqlMaxIdentifierLen)
+		}
+	}
+	seen := make(map[string]string, len(m.columns))
+	for _, fieldDesc := range m.columns {
+		field := string(fieldDesc.Name())
+		column := strings.ToLower(m.columnName(field))
+		if other, dup := seen[column]; dup {
+			return fmt.Errorf("%w: fields %s and %s in table %s map to the same column %s",
+				ErrInvalidTableOption, other, field, m.tableName, m.columnName(field))
+		}
+		seen[column] = field
+	}
+	return nil
+}
+
+// mysqlMaxTableCommentLen MySQL表注释的最大长度（字节）
+const mysqlMaxTableCommentLen = 2048
+
+// escapeMySQLComment 转义MySQL注释字符串：先截断到表注释上限（不截断半个UTF-8字符），
+// 再转义反斜杠与单引号（否则结尾的反斜杠会把闭合引号转义掉），
+// NUL 转义为 \0，换行/回车/制表符替换为空格，其余控制字符直接去掉。
+func escapeMySQLComment(comment string) string {
+	comment = truncateUTF8(comment, mysqlMaxTableCommentLen)
+
+	var b strings.Builder
+	b.Grow(len(comment))
+	for _, r := range comment {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\'':
+			b.WriteString(`\'`)
+		case r == 0:
+			b.WriteString(`\0`)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20 || r == 0x7f:
+			// 其他控制字符无意义且可能破坏DDL，直接丢弃
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// columnCommentPrefix 列注释中记录 proto 字段号的前缀，形如 COMMENT 'pb:3'。
+// 迁移时据此按字段号识别列，从而支持字段改名（CHANGE COLUMN）并保留原有数据。
+const columnCommentPrefix = "pb:"
+
+// mysqlMaxColumnCommentLen MySQL列注释的最大长度（字节）
+const mysqlMaxColumnCommentLen = 1024
+
+// columnCommentText 列注释原文：pb:N，有字段说明（WithFieldComment）时为 "pb:N 说明"，截断到列注释上限。
+func columnCommentText(num protoreflect.FieldNumber, description string) string {
+	text := columnCommentPrefix + strconv.Itoa(int(num))
+	if description == "" {
+		return text
+	}
+	return truncateUTF8(text+" "+description, mysqlMaxColumnCommentLen)
+}
+
+// columnComment 生成带 proto 字段号的列注释片段（含前导空格），如 " COMMENT 'pb:3'" / " COMMENT 'pb:3 玩家等级'"。
+func columnComment(num protoreflect.FieldNumber, description string) string {
+	return " COMMENT '" + escapeMySQLComment(columnCommentText(num, description)) + "'"
+}
+
+// splitColumnComment 把列注释拆成 proto 字段号与其后的说明；无 pb:N 前缀或非法时返回 (0,"",false)。
+func splitColumnComment(comment string) (protoreflect.FieldNumber, string, bool) {
+	if !strings.HasPrefix(comment, columnCommentPrefix) {
+		return 0, "", false
+	}
+	numPart, description, _ := strings.Cut(strings.TrimPrefix(comment, columnCommentPrefix), " ")
+	n, err := strconv.Atoi(numPart)
+	if err != nil || n < int(protowire.MinValidNumber) || n > int(protowire.MaxValidNumber) {
+		return 0, "", false
+	}
+	return protoreflect.FieldNumber(n), description, true
+}
+
+// parseFieldNumFromComment 从列注释解析 proto 字段号；无 pb:N 前缀或非法时返回 (0,false)。
+func parseFieldNumFromComment(comment string) (protoreflect.FieldNumber, bool) {
+	num, _, ok := splitColumnComment(comment)
+	return num, ok
+}
+
+// columnMeta 线上单列的元信息：类型 + 从注释解析出的 proto 字段号（0 表示无字段号注释，
+// 通常是旧版本创建的表）与字段号之后的说明。
+type columnMeta struct {
+	colType     string
+	fieldNum    protoreflect.FieldNumber
+	description string
+}
+
+// getTableColumns 获取表当前字段结构信息
+func (p *DB) getTableColumns(tableName string) (map[string]string, error) {
+	table, ok := p.lookupTable(tableName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	table.columnsMu.RLock()
+	if table.cachedColumns != nil {
+		defer table.columnsMu.RUnlock()
+		return table.cachedColumns, nil
+	}
+	table.columnsMu.RUnlock()
+
+	query := `
+		SELECT COLUMN_NAME, COLUMN_TYPE 
+		FROM INFORMATION_SCHEMA.COLUMNS 
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+	`
+	rows, err := p.schemaDB().QueryContext(p.context(), query, p.tableSchema(table), table.tableName)
+	if err != nil {
+		return nil, fmt.Errorf("query columns for table %s: %w", table.tableName, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		var colName, colType string
+		if err := rows.Scan(&colName, &colType); err != nil {
+			return nil, fmt.Errorf("scan columns for table %s: %w", tableName, err)
+		}
+		columns[colName] = colType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error for table %s columns: %w", tableName, err)
+	}
+
+	table.columnsMu.Lock()
+	table.cachedColumns = columns
+	table.columnsMu.Unlock()
+
+	return columns, nil
 }
 
 // getTableColumnMeta 读取线上表每列的类型与 proto 字段号注释（COLUMN_COMMENT 中的 pb:N）。
 // 用于迁移时按字段号识别列以支持改名保留数据。不使用 cachedColumns（迁移不频繁，且需要
 // 注释信息），避免与 getTableColumns 的类型缓存混淆。
 func (p *DB) getTableColumnMeta(tableName string) (map[string]columnMeta, error) {
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
@@ -517,7 +1660,7 @@ func (p *DB) getTableColumnMeta(tableName string) (map[string]columnMeta, error)
 		FROM INFORMATION_SCHEMA.COLUMNS
 		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
 	`
-	rows, err := p.DB.QueryContext(p.context(), query, p.DBName, table.tableName)
+	rows, err := p.schemaDB().QueryContext(p.context(), query, p.tableSchema(table), table.tableName)
 	if err != nil {
 		return nil, fmt.Errorf("query column meta for table %s: %w", table.tableName, err)
 	}
@@ -530,8 +1673,9 @@ func (p *DB) getTableColumnMeta(tableName string) (map[string]columnMeta, error)
 			return nil, fmt.Errorf("scan column meta for table %s: %w", tableName, err)
 		}
 		meta := columnMeta{colType: colType}
-		if num, ok := parseFieldNumFromComment(colComment); ok {
+		if num, description, ok := splitColumnComment(colComment); ok {
 			meta.fieldNum = num
+			meta.description = description
 		}
 		metas[colName] = meta
 	}
@@ -542,11 +1686,102 @@ func (p *DB) getTableColumnMeta(tableName string) (map[string]columnMeta, error)
 	return metas, nil
 }
 
+// getTableIndexNames 读取线上表已有的索引名（含PRIMARY），迁移时据此补齐缺失的索引
+func (p *DB) getTableIndexNames(tableName string) (map[string]bool, error) {
+	table, ok := p.lookupTable(tableName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	query := `
+		SELECT DISTINCT INDEX_NAME
+		FROM INFORMATION_SCHEMA.STATISTICS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+	`
+	rows, err := p.schemaDB().QueryContext(p.context(), query, p.tableSchema(table), table.tableName)
+	if err != nil {
+		return nil, fmt.Errorf("query indexes for table %s: %w", table.tableName, err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan indexes for table %s: %w", tableName, err)
+		}
+		names[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error for table %s indexes: %w", tableName, err)
+	}
+	return names, nil
+}
+
+// getInvisibleIndexNames 读取线上表中不可见（IS_VISIBLE='NO'）的索引名；
+// MySQL 8.0以下没有IS_VISIBLE列（1054），此时视为全部可见
+func (p *DB) getInvisibleIndexNames(tableName string) (map[string]bool, error) {
+	table, ok := p.lookupTable(tableName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	query := `
+		SELECT DISTINCT INDEX_NAME
+		FROM INFORMATION_SCHEMA.STATISTICS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND IS_VISIBLE = 'NO'
+	`
+	rows, err := p.schemaDB().QueryContext(p.context(), query, p.tableSchema(table), table.tableName)
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1054 {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query invisible indexes for table %s: %w", table.tableName, err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan invisible indexes for table %s: %w", tableName, err)
+		}
+		names[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error for table %s invisible indexes: %w", tableName, err)
+	}
+	return names, nil
+}
+
+// indexAlterClauses 比对线上索引，生成补齐缺失索引与切换可见性的ALTER子句
+func (p *DB) indexAlterClauses(registryKey string, table *MessageTable) ([]string, error) {
+	indexNames, err := p.getTableIndexNames(registryKey)
+	if err != nil {
+		return nil, err
+	}
+	invisible, err := p.getInvisibleIndexNames(registryKey)
+	if err != nil {
+		return nil, err
+	}
+	return append(table.buildIndexAlterClauses(indexNames), table.buildIndexVisibilityClauses(indexNames, invisible)...), nil
+}
+
+// tableSchema 返回表所在的库：WithDatabase指定的库，未指定时为OpenDB绑定的DBName
+func (p *DB) tableSchema(table *MessageTable) string {
+	if table.database != "" {
+		return table.database
+	}
+	return p.DBName
+}
+
 // clearColumnCache 清除表字段缓存
 func (p *DB) clearColumnCache(tableName string) {
-	if table, ok := p.Tables[tableName]; ok {
+	if table, ok := p.lookupTable(tableName); ok {
 		table.columnsMu.Lock()
 		table.cachedColumns = nil
+		table.cachedCharsets = nil
 		table.columnsMu.Unlock()
 	}
 }
@@ -554,7 +1789,7 @@ func (p *DB) clearColumnCache(tableName string) {
 // CreateOrUpdateTable 创建表或同步已有表字段结构。
 func (p *DB) CreateOrUpdateTable(m proto.Message) error {
 	tableName := GetTableName(m)
-	if _, ok := p.Tables[tableName]; !ok {
+	if _, ok := p.lookupTable(tableName); !ok {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
 	return p.UpdateTableField(m)
@@ -580,9 +1815,8 @@ func (m *MessageTable) buildAlterClauses(currentCols map[string]columnMeta) []st
 	}
 
 	var alterSQLs []string
-	desc := m.Descriptor
-	for i := 0; i < desc.Fields().Len(); i++ {
-		fieldDesc := desc.Fields().Get(i)
+	prevCol := "" // 上一个持久化列的库列名，新增列用 AFTER 放到对应位置
+	for _, fieldDesc := range m.columns {
 		fieldName := string(fieldDesc.Name())
 
 		if keywordRegex.MatchString(strings.ToUpper(fieldName)) {
@@ -591,91 +1825,366 @@ func (m *MessageTable) buildAlterClauses(currentCols map[string]columnMeta) []st
 
 		fieldNum := fieldDesc.Number()
 		targetType := m.getMySQLFieldType(fieldDesc)
-		comment := columnComment(fieldNum)
+		description := m.fieldComments[fieldName]
+		comment := columnComment(fieldNum, description)
 
 		// 1) 列名精确匹配
-		if meta, exists := remaining[fieldName]; exists {
-			// 类型不兼容，或旧表该列尚无字段号注释时，MODIFY 顺带回填注释
-			if !isTypeMatch(meta.colType, targetType) || meta.fieldNum != fieldNum {
-				alterSQLs = append(alterSQLs, fmt.Sprintf("MODIFY COLUMN %s %s%s", escapeMySQLName(fieldName), targetType, comment))
+		colName := m.columnName(fieldName)
+		position := " FIRST"
+		if prevCol != "" {
+			position = " AFTER " + escapeMySQLName(prevCol)
+		}
+		prevCol = colName
+		if meta, exists := remaining[colName]; exists {
+			// 类型不兼容、旧表该列尚无字段号注释或字段说明变化时，MODIFY 顺带回填注释
+			if !isTypeMatch(meta.colType, targetType) || meta.fieldNum != fieldNum ||
+				!sameColumnDescription(meta.description, fieldNum, description) {
+				alterSQLs = append(alterSQLs, fmt.Sprintf("MODIFY COLUMN %s %s%s", escapeMySQLName(colName), targetType, comment))
 			}
-			delete(remaining, fieldName)
+			delete(remaining, colName)
 			continue
 		}
 
-		// 2) 字段号匹配（改名场景）：找到注释字段号一致但列名不同的现有列
-		if oldName, ok := byFieldNum[fieldNum]; ok {
-			if _, still := remaining[oldName]; still {
-				alterSQLs = append(alterSQLs, fmt.Sprintf("CHANGE COLUMN %s %s %s%s",
-					escapeMySQLName(oldName), escapeMySQLName(fieldName), targetType, comment))
-				delete(remaining, oldName)
-				continue
-			}
+		// 2) 字段号匹配（改名场景）：找到注释字段号一致但列名不同的现有列
+		if oldName, ok := byFieldNum[fieldNum]; ok {
+			if _, still := remaining[oldName]; still {
+				alterSQLs = append(alterSQLs, fmt.Sprintf("CHANGE COLUMN %s %s %s%s",
+					escapeMySQLName(oldName), escapeMySQLName(colName), targetType, comment))
+				delete(remaining, oldName)
+				continue
+			}
+		}
+
+		// 3) 全新字段：按列顺序放在上一列之后（首列用 FIRST），而不是追加到表尾
+		alterSQLs = append(alterSQLs, fmt.Sprintf("ADD COLUMN %s %s%s%s", escapeMySQLName(colName), targetType, comment, position))
+	}
+	// 4) 没有对应字段的生成列：缺失时补建
+	for _, gc := range m.standaloneGeneratedColumns() {
+		if _, exists := remaining[gc.name]; !exists {
+			alterSQLs = append(alterSQLs, fmt.Sprintf("ADD COLUMN %s %s", escapeMySQLName(gc.name), gc.columnType("")))
+		}
+	}
+	return alterSQLs
+}
+
+// sameColumnDescription 线上列注释中的说明与字段说明是否一致（按写入时的截断、转义规则规整后比较）
+func sameColumnDescription(current string, num protoreflect.FieldNumber, description string) bool {
+	_, want, _ := splitColumnComment(columnCommentText(num, description))
+	return escapeMySQLComment(current) == escapeMySQLComment(want)
+}
+
+// alterTableSQL 把子句拼成一条ALTER TABLE（不含分号），WithOnlineDDL时追加 ALGORITHM=INPLACE, LOCK=NONE
+func (m *MessageTable) alterTableSQL(clauses []string) string {
+	stmt := fmt.Sprintf("ALTER TABLE %s %s", m.sqlName(), strings.Join(clauses, ", "))
+	if m.onlineDDL {
+		stmt += ", ALGORITHM=INPLACE, LOCK=NONE"
+	}
+	return stmt
+}
+
+// UpdateTableFieldContext 与UpdateTableField相同，但读取表结构与执行CREATE/ALTER都用ctx，
+// ctx取消/超时后立即返回（MySQL端已开始的DDL不一定随之终止），用于限定迁移的等待时长
+func (p *DB) UpdateTableFieldContext(ctx context.Context, m proto.Message) error {
+	return p.WithContext(ctx).UpdateTableField(m)
+}
+
+// UpdateTableField 同步表字段（表不存在则创建，存在则对齐字段类型）
+func (p *DB) UpdateTableField(m proto.Message) error {
+	tableName := GetTableName(m)
+	table, ok := p.lookupTable(tableName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+	return p.syncTableSchema(tableName, table)
+}
+
+// AssertColumnOrder 启动自检：按INFORMATION_SCHEMA.COLUMNS的ORDINAL_POSITION读取线上表的列顺序，
+// 与proto字段顺序（含WithColumnOrder）比对，不一致时返回ErrColumnOrderMismatch并列出缺失与错位的列。
+// 库生成的SELECT显式列出列名，不受列序影响；但 SELECT * 配合按位置解析（pbconv.ParseFromString等）时，
+// .proto中字段重排而表未迁移会把旧数据读进错误的字段，部署时调用可提前失败。
+// 线上多出的列只有排在所有映射列之后才允许，夹在中间同样会使按位置解析错位。
+func (p *DB) AssertColumnOrder(m proto.Message) error {
+	table, err := p.tableForMessage(m)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		SELECT COLUMN_NAME
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`
+	rows, err := p.schemaDB().QueryContext(p.context(), query, p.tableSchema(table), table.tableName)
+	if err != nil {
+		return fmt.Errorf("query column order for table %s: %w", table.tableName, err)
+	}
+	defer rows.Close()
+
+	var live []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("scan column order for table %s: %w", table.tableName, err)
+		}
+		live = append(live, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error for table %s column order: %w", table.tableName, err)
+	}
+	return table.checkColumnOrder(live)
+}
+
+// checkColumnOrder 比对线上列顺序live与持久化字段的列顺序：报告线上缺失的列、
+// 两边都有的列中相对顺序不一致的位置，以及夹在映射列之间或之前的多余列（会使按位置解析错位）；
+// 排在所有映射列之后的多余列不影响按位置解析，忽略
+func (m *MessageTable) checkColumnOrder(live []string) error {
+	expected := make([]string, 0, len(m.columns))
+	for _, field := range m.columns {
+		expected = append(expected, m.columnName(string(field.Name())))
+	}
+	liveSet := make(map[string]bool, len(live))
+	for _, name := range live {
+		liveSet[name] = true
+	}
+
+	var problems, wantOrder []string
+	for _, name := range expected {
+		if liveSet[name] {
+			wantOrder = append(wantOrder, name)
+		} else {
+			problems = append(problems, "missing column "+name)
+		}
+	}
+	lastMapped := -1
+	for i, name := range live {
+		if slices.Contains(expected, name) {
+			lastMapped = i
+		}
+	}
+	for i, name := range live[:lastMapped+1] {
+		if !slices.Contains(expected, name) {
+			problems = append(problems, fmt.Sprintf("extra column #%d %s before mapped columns", i+1, name))
+		}
+	}
+	gotOrder := slices.DeleteFunc(slices.Clone(live), func(name string) bool { return !slices.Contains(expected, name) })
+	for i := range gotOrder {
+		if gotOrder[i] != wantOrder[i] {
+			problems = append(problems, fmt.Sprintf("column #%d is %s, want %s", i+1, gotOrder[i], wantOrder[i]))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: table %s: %s", ErrColumnOrderMismatch, m.tableName, strings.Join(problems, "; "))
+}
+
+// syncTableSchema 按 registryKey（proto full name）对应的 table 同步 MySQL 表结构：
+// 表不存在则创建，存在则对齐字段类型。
+func (p *DB) syncTableSchema(registryKey string, table *MessageTable) error {
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	if err := table.Validate(); err != nil {
+		return err
+	}
+	if err := p.createAuditTable(table); err != nil {
+		return err
+	}
+
+	exists, err := p.tableExistsIn(p.tableSchema(table), table.tableName)
+	if err != nil {
+		return fmt.Errorf("检查表 %s 存在性: %w", table.tableName, err)
+	}
+
+	// 如果表不存在，直接创建
+	if !exists {
+		return p.createTable(table)
+	}
+
+	// 表已存在，同步字段结构（读取列类型 + 字段号注释，支持按 Field id 改名保留数据）
+	currentCols, err := p.getTableColumnMeta(registryKey)
+	if err != nil {
+		return fmt.Errorf("获取表 %s 字段: %w", registryKey, err)
+	}
+	// 缓存认为存在但查不到任何列：表已被外部DROP，按不存在处理
+	if len(currentCols) == 0 {
+		p.clearColumnCache(registryKey)
+		return p.createTable(table)
+	}
+
+	alterSQLs := table.buildAlterClauses(currentCols)
+
+	// 补齐缺失的索引（按索引名比对），并按WithInvisibleIndex切换已有索引的可见性
+	indexClauses, err := p.indexAlterClauses(registryKey, table)
+	if err != nil {
+		return fmt.Errorf("获取表 %s 索引: %w", registryKey, err)
+	}
+	alterSQLs = append(alterSQLs, indexClauses...)
+
+	// 配置了WithTableComment且与线上表注释不同时同步表注释
+	commentClauses, err := p.tableCommentAlterClauses(table)
+	if err != nil {
+		return fmt.Errorf("获取表 %s 注释: %w", registryKey, err)
+	}
+	alterSQLs = append(alterSQLs, commentClauses...)
+
+	// 执行ALTER TABLE（如果有需要修改的内容）
+	if len(alterSQLs) > 0 {
+		alterSQL := table.alterTableSQL(alterSQLs)
+		_, err := p.DB.ExecContext(p.context(), alterSQL)
+		if err != nil {
+			return fmt.Errorf("更新表 %s 结构失败: %w, SQL: %s", table.tableName, err, alterSQL)
+		}
+		p.clearColumnCache(registryKey) // 清除缓存，下次查询时重新加载字段
+	}
+
+	return nil
+}
+
+// tableCommentAlterClauses 配置了WithTableComment时读取线上表注释（INFORMATION_SCHEMA.TABLES），
+// 不一致则生成 COMMENT='...' 子句；未配置时不查询也不修改（保留外部设置的注释）
+func (p *DB) tableCommentAlterClauses(table *MessageTable) ([]string, error) {
+	if table.tableComment == "" {
+		return nil, nil
+	}
+	query := `
+		SELECT TABLE_COMMENT
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+	`
+	var current string
+	if err := p.schemaDB().QueryRowContext(p.context(), query, p.tableSchema(table), table.tableName).Scan(&current); err != nil {
+		return nil, fmt.Errorf("query comment for table %s: %w", table.tableName, err)
+	}
+	want := escapeMySQLComment(table.tableComment)
+	if escapeMySQLComment(current) == want {
+		return nil, nil
+	}
+	return []string{"COMMENT='" + want + "'"}, nil
+}
+
+// createTable 执行建表并记录表存在缓存
+func (p *DB) createTable(table *MessageTable) error {
+	createSQL := table.GetCreateTableSQL()
+	if _, err := p.DB.ExecContext(p.context(), createSQL); err != nil {
+		return fmt.Errorf("创建表 %s 失败: %w, SQL: %s", table.tableName, err, createSQL)
+	}
+	p.updateTableExistsCache(p.tableSchema(table), table.tableName, true)
+	return nil
+}
+
+// DropTable 删除message对应的已注册表（DROP TABLE IF EXISTS），并失效表存在缓存与字段结构缓存。
+// 只读模式下返回ErrReadOnly。
+func (p *DB) DropTable(message proto.Message) error {
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	registryKey := GetTableName(message)
+	table, ok := p.lookupTable(registryKey)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, registryKey)
+	}
+
+	if _, err := p.DB.ExecContext(p.context(), "DROP TABLE IF EXISTS "+table.sqlName()); err != nil {
+		return fmt.Errorf("drop table %s: %w", table.tableName, err)
+	}
+	p.updateTableExistsCache(p.tableSchema(table), table.tableName, false)
+	p.clearColumnCache(registryKey)
+	return nil
+}
+
+// IsTableExists 检查表是否存在（在OpenDB绑定的库中查找）
+func (p *DB) IsTableExists(tableName string) (bool, error) {
+	return p.tableExistsIn(p.DBName, tableName)
+}
+
+// tableExistsEntry 表存在缓存项
+type tableExistsEntry struct {
+	exists    bool
+	checkedAt time.Time
+}
+
+// tableExistsKey tableExistsCache 的key（库+表）
+func tableExistsKey(schema, tableName string) string {
+	return escapeMySQLName(schema) + "." + escapeMySQLName(tableName)
+}
+
+// SetTableExistsTTL 设置表存在缓存的有效期，过期后IsTableExists/CreateOrUpdateTable重新查询
+// INFORMATION_SCHEMA，用于表可能被外部删除/重建的场景。默认0表示不过期（可用InvalidateTableCache手动失效）。
+func (p *DB) SetTableExistsTTL(ttl time.Duration) {
+	p.tableExistsTTL = ttl
+}
+
+// InvalidateTableCache 清除表名为tableName的表存在缓存与字段结构缓存（含WithDatabase指定其他库的已注册表），
+// 表被外部DROP/重建后调用，下次IsTableExists/CreateOrUpdateTable会重新查询
+func (p *DB) InvalidateTableCache(tableName string) {
+	keys := []string{tableExistsKey(p.DBName, tableName)}
+	for registryKey, table := range p.tablesSnapshot() {
+		if table.tableName == tableName {
+			keys = append(keys, tableExistsKey(p.tableSchema(table), tableName))
+			p.clearColumnCache(registryKey)
 		}
-
-		// 3) 全新字段
-		alterSQLs = append(alterSQLs, fmt.Sprintf("ADD COLUMN %s %s%s", escapeMySQLName(fieldName), targetType, comment))
 	}
-	return alterSQLs
+	p.tableExistsMu.Lock()
+	for _, key := range keys {
+		delete(p.tableExistsCache, key)
+	}
+	p.tableExistsMu.Unlock()
 }
 
-// UpdateTableField 同步表字段（表不存在则创建，存在则对齐字段类型）
-func (p *DB) UpdateTableField(m proto.Message) error {
-	tableName := GetTableName(m)
-	table, ok := p.Tables[tableName]
-	if !ok {
-		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+// invalidateAllTableCaches 清除全部表存在缓存与已注册表的字段结构缓存
+func (p *DB) invalidateAllTableCaches() {
+	for registryKey := range p.tablesSnapshot() {
+		p.clearColumnCache(registryKey)
 	}
-	return p.syncTableSchema(tableName, table)
+	p.tableExistsMu.Lock()
+	clear(p.tableExistsCache)
+	p.tableExistsMu.Unlock()
 }
 
-// syncTableSchema 按 registryKey（proto full name）对应的 table 同步 MySQL 表结构：
-// 表不存在则创建，存在则对齐字段类型。
-func (p *DB) syncTableSchema(registryKey string, table *MessageTable) error {
-	exists, err := p.IsTableExists(table.tableName)
-	if err != nil {
-		return fmt.Errorf("检查表 %s 存在性: %w", table.tableName, err)
+// ExecDDL 执行库不生成的自定义DDL（如特殊的ALTER），执行后清除全部表存在缓存与字段结构缓存
+// （DDL可能改动任意表）。只读模式下返回ErrReadOnly；DDL会隐式提交事务，RunInTransaction内调用直接报错。
+// 拼接标识符请用ExecDDLf，不要把外部输入直接拼进sql。
+func (p *DB) ExecDDL(sql string) error {
+	if p.readOnly {
+		return ErrReadOnly
 	}
-
-	// 如果表不存在，直接创建
-	if !exists {
-		createSQL := table.GetCreateTableSQL()
-		if _, err := p.DB.ExecContext(p.context(), createSQL); err != nil {
-			return fmt.Errorf("创建表 %s 失败: %w, SQL: %s", table.tableName, err, createSQL)
-		}
-		p.updateTableExistsCache(table.tableName, true)
-		return nil
+	if p.tx != nil {
+		return errors.New("exec DDL inside a transaction is not supported (DDL commits implicitly)")
 	}
-
-	// 表已存在，同步字段结构（读取列类型 + 字段号注释，支持按 Field id 改名保留数据）
-	currentCols, err := p.getTableColumnMeta(registryKey)
+	if strings.TrimSpace(sql) == "" {
+		return errors.New("empty DDL statement")
+	}
+	_, err := p.DB.ExecContext(p.context(), sql)
+	p.invalidateAllTableCaches()
 	if err != nil {
-		return fmt.Errorf("获取表 %s 字段: %w", registryKey, err)
+		return fmt.Errorf("exec DDL: %w, SQL: %s", wrapExecErr(err), sql)
 	}
+	return nil
+}
 
-	alterSQLs := table.buildAlterClauses(currentCols)
-
-	// 执行ALTER TABLE（如果有需要修改的内容）
-	if len(alterSQLs) > 0 {
-		alterSQL := fmt.Sprintf("ALTER TABLE %s %s", escapeMySQLName(table.tableName), strings.Join(alterSQLs, ", "))
-		_, err := p.DB.ExecContext(p.context(), alterSQL)
-		if err != nil {
-			return fmt.Errorf("更新表 %s 结构失败: %w, SQL: %s", table.tableName, err, alterSQL)
-		}
-		p.clearColumnCache(registryKey) // 清除缓存，下次查询时重新加载字段
+// ExecDDLf 按format拼接DDL后执行（同ExecDDL），identifiers依次替换format中的%s，
+// 每个都按MySQL标识符转义（反引号包裹，内部反引号加倍）：
+//
+//	pbDB.ExecDDLf("ALTER TABLE %s RENAME INDEX %s TO %s", "golang_test", "idx_old", "idx_new")
+func (p *DB) ExecDDLf(format string, identifiers ...string) error {
+	escaped := make([]interface{}, len(identifiers))
+	for i, id := range identifiers {
+		escaped[i] = escapeMySQLName(id)
 	}
-
-	return nil
+	return p.ExecDDL(fmt.Sprintf(format, escaped...))
 }
 
-// IsTableExists 检查表是否存在
-func (p *DB) IsTableExists(tableName string) (bool, error) {
+// tableExistsIn 检查指定库中表是否存在（结果缓存，SetTableExistsTTL设置了有效期时过期重查）
+func (p *DB) tableExistsIn(schema, tableName string) (bool, error) {
+	key := tableExistsKey(schema, tableName)
 	p.tableExistsMu.RLock()
-	if exists, ok := p.tableExistsCache[tableName]; ok {
-		p.tableExistsMu.RUnlock()
-		return exists, nil
-	}
+	entry, ok := p.tableExistsCache[key]
 	p.tableExistsMu.RUnlock()
+	if ok && (p.tableExistsTTL <= 0 || time.Since(entry.checkedAt) < p.tableExistsTTL) {
+		return entry.exists, nil
+	}
 
 	query := `
 		SELECT COUNT(*) 
@@ -683,23 +2192,23 @@ func (p *DB) IsTableExists(tableName string) (bool, error) {
 		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
 	`
 	var count int
-	err := p.DB.QueryRowContext(p.context(), query, p.DBName, tableName).Scan(&count)
+	err := p.schemaDB().QueryRowContext(p.context(), query, schema, tableName).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) && p.capture != nil {
+		err = nil // 捕获模式且没有真实连接：按表不存在处理
+	}
 	if err != nil {
 		return false, fmt.Errorf("query table %s exists: %w", tableName, err)
 	}
 	exists := count > 0
 
-	p.tableExistsMu.Lock()
-	p.tableExistsCache[tableName] = exists
-	p.tableExistsMu.Unlock()
-
+	p.updateTableExistsCache(schema, tableName, exists)
 	return exists, nil
 }
 
 // updateTableExistsCache 更新表存在缓存
-func (p *DB) updateTableExistsCache(tableName string, exists bool) {
+func (p *DB) updateTableExistsCache(schema, tableName string, exists bool) {
 	p.tableExistsMu.Lock()
-	p.tableExistsCache[tableName] = exists
+	p.tableExistsCache[tableExistsKey(schema, tableName)] = tableExistsEntry{exists: exists, checkedAt: time.Now()}
 	p.tableExistsMu.Unlock()
 }
 
@@ -709,25 +2218,89 @@ func (m *MessageTable) GetInsertSQLWithArgs(message proto.Message) (*SqlWithArgs
 		return nil, err
 	}
 
+	args, err := m.insertArgs(message)
+	if err != nil {
+		return nil, err
+	}
+	return &SqlWithArgs{Sql: m.insertSQLTemplate, Args: args}, nil
+}
+
+// insertArgs 按writeFields顺序序列化INSERT/REPLACE的参数（跳过MySQL维护的时间戳列）
+func (m *MessageTable) insertArgs(message proto.Message) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(m.writeFields))
+	for _, fieldDesc := range m.writeFields {
+		val, err := m.columnValue(message, fieldDesc)
+		if err != nil {
+			return nil, fmt.Errorf("serialize field %s: %w", fieldDesc.Name(), err)
+		}
+		args = append(args, val)
+	}
+	return args, nil
+}
+
+// GetInsertPresentSQLWithArgs 生成只包含已设置字段（reflection.Has）的INSERT语句，
+// 未设置的列不出现在列清单中，由MySQL按列DEFAULT填充。
+func (m *MessageTable) GetInsertPresentSQLWithArgs(message proto.Message) (*SqlWithArgs, error) {
+	if err := m.validateMessageDescriptor(message); err != nil {
+		return nil, err
+	}
+
+	reflection := message.ProtoReflect()
+	var names, placeholders []string
 	var args []interface{}
-	for i := 0; i < m.Descriptor.Fields().Len(); i++ {
-		fieldDesc := m.Descriptor.Fields().Get(i)
-		val, err := pbconv.SerializeFieldAsString(message, fieldDesc)
+	for _, fieldDesc := range m.writeFields {
+		// POINT列为NOT NULL且无默认值，总是由经纬度合成写入
+		_, spatial := m.spatialPointFor(string(fieldDesc.Name()))
+		if !spatial && !reflection.Has(fieldDesc) {
+			continue
+		}
+		val, err := m.columnValue(message, fieldDesc)
 		if err != nil {
 			return nil, fmt.Errorf("serialize field %s: %w", fieldDesc.Name(), err)
 		}
+		names = append(names, m.quotedColumn(string(fieldDesc.Name())))
+		placeholders = append(placeholders, m.columnPlaceholder(fieldDesc))
 		args = append(args, val)
 	}
-	return &SqlWithArgs{Sql: m.insertSQLTemplate, Args: args}, nil
+
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		m.sqlName(), strings.Join(names, ", "), strings.Join(placeholders, ", "))
+	return &SqlWithArgs{Sql: sql, Args: args}, nil
 }
 
-// GetBatchInsertSQLWithArgs 生成批量INSERT语句
+// GetBatchInsertSQLWithArgs 生成批量INSERT语句（最多BatchInsertMaxSize条）
 func (m *MessageTable) GetBatchInsertSQLWithArgs(messages []proto.Message) (*SqlWithArgs, error) {
+	return m.getBatchInsertSQLWithArgs(messages, BatchInsertMaxSize)
+}
+
+// placeholderLimit 当前生效的单条SQL占位符上限
+func (m *MessageTable) placeholderLimit() int {
+	if m.maxPlaceholders > 0 {
+		return m.maxPlaceholders
+	}
+	return MaxPlaceholders
+}
+
+// insertBatchSize 把批量写的每批行数收紧到 行数*每行参数数 <= 占位符上限（至少1行）
+func (m *MessageTable) insertBatchSize(size int) int {
+	if m.insertArgsPerRow == 0 {
+		return size
+	}
+	return max(1, min(size, m.placeholderLimit()/m.insertArgsPerRow))
+}
+
+// getBatchInsertSQLWithArgs 生成批量INSERT语句，条数上限由调用方（DB.batchLimit）决定，
+// 同时不超过占位符上限（见insertBatchSize）
+func (m *MessageTable) getBatchInsertSQLWithArgs(messages []proto.Message, maxSize int) (*SqlWithArgs, error) {
 	if len(messages) == 0 {
 		return nil, errors.New("no messages to insert")
 	}
-	if len(messages) > BatchInsertMaxSize {
-		return nil, ErrBatchSizeExceeded
+	if len(messages) > maxSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrBatchSizeExceeded, len(messages), maxSize)
+	}
+	if n := len(messages) * m.insertArgsPerRow; n > m.placeholderLimit() {
+		return nil, fmt.Errorf("%w: %d rows x %d columns = %d placeholders > %d (MySQL prepared statement limit), use at most %d rows per batch",
+			ErrBatchSizeExceeded, len(messages), m.insertArgsPerRow, n, m.placeholderLimit(), m.insertBatchSize(len(messages)))
 	}
 
 	for _, msg := range messages {
@@ -738,32 +2311,31 @@ func (m *MessageTable) GetBatchInsertSQLWithArgs(messages []proto.Message) (*Sql
 
 	var allArgs []interface{}
 	var valueGroups []string
-	fieldCount := m.Descriptor.Fields().Len()
 
 	for _, msg := range messages {
-		args := make([]interface{}, 0, fieldCount)
-		for i := 0; i < fieldCount; i++ {
-			fieldDesc := m.Descriptor.Fields().Get(i)
-			val, err := pbconv.SerializeFieldAsString(msg, fieldDesc)
-			if err != nil {
-				return nil, fmt.Errorf("serialize field %s: %w", fieldDesc.Name(), err)
-			}
-			args = append(args, val)
+		args, err := m.insertArgs(msg)
+		if err != nil {
+			return nil, err
 		}
 		allArgs = append(allArgs, args...)
-		valueGroups = append(valueGroups, buildPlaceholders(fieldCount))
+		valueGroups = append(valueGroups, m.insertPlaceholdersSQL)
 	}
 
 	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		escapeMySQLName(m.tableName),
-		m.fieldsListSQL,
+		m.sqlName(),
+		m.insertFieldsListSQL,
 		strings.Join(valueGroups, "), ("))
 	return &SqlWithArgs{Sql: sql, Args: allArgs}, nil
 }
 
-// GetBatchReplaceSQLWithArgs 生成批量REPLACE语句
+// GetBatchReplaceSQLWithArgs 生成批量REPLACE语句（最多BatchInsertMaxSize条）
 func (m *MessageTable) GetBatchReplaceSQLWithArgs(messages []proto.Message) (*SqlWithArgs, error) {
-	insertSQL, err := m.GetBatchInsertSQLWithArgs(messages)
+	return m.getBatchReplaceSQLWithArgs(messages, BatchInsertMaxSize)
+}
+
+// getBatchReplaceSQLWithArgs 生成批量REPLACE语句，条数上限由调用方决定
+func (m *MessageTable) getBatchReplaceSQLWithArgs(messages []proto.Message, maxSize int) (*SqlWithArgs, error) {
+	insertSQL, err := m.getBatchInsertSQLWithArgs(messages, maxSize)
 	if err != nil {
 		return nil, err
 	}
@@ -784,16 +2356,15 @@ func (m *MessageTable) GetInsertOnDupUpdateSQLWithArgs(message proto.Message) (*
 	var updateArgs []interface{}
 	reflection := message.ProtoReflect()
 
-	for i := 0; i < m.Descriptor.Fields().Len(); i++ {
-		fieldDesc := m.Descriptor.Fields().Get(i)
-		if !reflection.Has(fieldDesc) {
+	for _, fieldDesc := range m.columns {
+		if !m.hasColumnValue(reflection, fieldDesc) || m.isDBGeneratedField(string(fieldDesc.Name())) {
 			continue
 		}
-		val, err := pbconv.SerializeFieldAsString(message, fieldDesc)
+		val, err := m.columnValue(message, fieldDesc)
 		if err != nil {
 			return nil, fmt.Errorf("serialize update field %s: %w", fieldDesc.Name(), err)
 		}
-		updateClauses = append(updateClauses, fmt.Sprintf("%s = ?", escapeMySQLName(string(fieldDesc.Name()))))
+		updateClauses = append(updateClauses, m.setClauseSQL(fieldDesc))
 		updateArgs = append(updateArgs, val)
 	}
 
@@ -820,11 +2391,11 @@ func (m *MessageTable) GetInsertOnDupKeyForPrimaryKeyWithArgs(message proto.Mess
 	}
 
 	primaryKeyName := string(m.primaryKeyField.Name())
-	primaryKeyValue, err := pbconv.SerializeFieldAsString(message, m.primaryKeyField)
+	primaryKeyValue, err := pbconv.SerializeFieldWithOptions(message, m.primaryKeyField, m.fieldOptions(m.primaryKeyField))
 	if err != nil {
 		return nil, fmt.Errorf("serialize primary key: %w", err)
 	}
-	updateClause := fmt.Sprintf("%s = ?", escapeMySQLName(primaryKeyName))
+	updateClause := fmt.Sprintf("%s = ?", m.quotedColumn(primaryKeyName))
 	fullSQL := fmt.Sprintf("%s ON DUPLICATE KEY UPDATE %s", insertSQL.Sql, updateClause)
 	fullArgs := append(insertSQL.Args, primaryKeyValue)
 
@@ -834,10 +2405,13 @@ func (m *MessageTable) GetInsertOnDupKeyForPrimaryKeyWithArgs(message proto.Mess
 // Insert 执行参数化的INSERT操作（直接用DB，无Tx）
 func (p *DB) Insert(message proto.Message) error {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
+	if err := p.checkUTF8mb4(table, message); err != nil {
+		return err
+	}
 
 	sqlWithArgs, err := table.GetInsertSQLWithArgs(message)
 	if sqlWithArgs == nil || err != nil {
@@ -847,43 +2421,232 @@ func (p *DB) Insert(message proto.Message) error {
 	_, err = p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
 	if err != nil {
 		return fmt.Errorf("exec insert for table %s: sql=%s, args=%v, err=%w",
-			tableName, sqlWithArgs.Sql, sqlWithArgs.Args, wrapExecErr(err))
+			tableName, sqlWithArgs.Sql, sqlWithArgs.Args, err)
+	}
+	return nil
+}
+
+// InsertPresent 只插入已设置的字段，省略的列使用数据库的DEFAULT（而不是proto零值）。
+// 注意proto3非optional标量字段的零值视为未设置，同样会走DEFAULT。
+func (p *DB) InsertPresent(message proto.Message) error {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return err
+	}
+	if err := p.checkUTF8mb4(table, message); err != nil {
+		return err
+	}
+
+	sqlWithArgs, err := table.GetInsertPresentSQLWithArgs(message)
+	if err != nil {
+		return fmt.Errorf("generate insert present SQL for table %s: %w", table.tableName, err)
+	}
+
+	if _, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...); err != nil {
+		return fmt.Errorf("exec insert present for table %s: sql=%s, args=%v, err=%w",
+			table.tableName, sqlWithArgs.Sql, sqlWithArgs.Args, err)
 	}
 	return nil
 }
 
 // BatchInsert 执行批量INSERT操作（直接用DB，无Tx）
 func (p *DB) BatchInsert(messages []proto.Message) error {
+	_, err := p.BatchInsertPartial(messages)
+	return err
+}
+
+// BatchInsertPartial 与BatchInsert相同，但额外返回失败前已成功写入的行数succeeded：
+// 按批大小分批执行，某批失败时立即返回，messages[:succeeded]已写入，重试可从messages[succeeded:]继续。
+// 在RunInTransaction内调用时，succeeded是已执行的行数，事务回滚后这些行同样不会保留。
+func (p *DB) BatchInsertPartial(messages []proto.Message) (succeeded int, err error) {
 	if len(messages) == 0 {
-		return errors.New("no messages to insert")
+		return 0, errors.New("no messages to insert")
+	}
+
+	table, err := p.tableForMessage(messages[0])
+	if err != nil {
+		return 0, err
+	}
+	tableName := table.tableName
+	if err := p.checkUTF8mb4(table, messages...); err != nil {
+		return 0, err
 	}
 
-	// 分批处理大批量数据
-	for i := 0; i < len(messages); i += BatchInsertMaxSize {
-		end := i + BatchInsertMaxSize
+	// 分批处理大批量数据，宽表按占位符上限自动缩小每批行数
+	batchSize := table.insertBatchSize(p.batchLimit())
+	for i := 0; i < len(messages); i += batchSize {
+		end := i + batchSize
 		if end > len(messages) {
 			end = len(messages)
 		}
 		batch := messages[i:end]
 
-		tableName := GetTableName(batch[0])
-		table, ok := p.Tables[tableName]
-		if !ok {
-			return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
-		}
-
-		sqlWithArgs, err := table.GetBatchInsertSQLWithArgs(batch)
+		sqlWithArgs, err := table.getBatchInsertSQLWithArgs(batch, batchSize)
 		if sqlWithArgs == nil || err != nil {
-			return fmt.Errorf("generate batch insert SQL for table %s: %w", tableName, err)
+			return succeeded, fmt.Errorf("generate batch insert SQL for table %s: %w", tableName, err)
 		}
 
 		_, err = p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
 		if err != nil {
-			return fmt.Errorf("exec batch insert for table %s: sql=%s, args len=%d, err=%w",
-				tableName, sqlWithArgs.Sql, len(sqlWithArgs.Args), wrapExecErr(err))
+			return succeeded, fmt.Errorf("exec batch insert for table %s: sql=%s, args len=%d, err=%w",
+				tableName, sqlWithArgs.Sql, len(sqlWithArgs.Args), err)
+		}
+		succeeded = end
+	}
+
+	return succeeded, nil
+}
+
+// BatchInsertContext 可取消的批量INSERT：每批用ctx执行（ExecContext），并在批与批之间检查ctx，
+// ctx被取消/超时后不再执行剩余批次。返回已成功执行的批数committedChunks，
+// 即messages[:committedChunks*批大小]已写入（批大小见SetBatchSize，宽表按占位符上限自动缩小，与BatchInsertPartial一致），
+// 可据此续传；出错时错误信息中带有已写入的行数。
+func (p *DB) BatchInsertContext(ctx context.Context, messages []proto.Message) (committedChunks int, err error) {
+	if len(messages) == 0 {
+		return 0, errors.New("no messages to insert")
+	}
+	table, err := p.tableForMessage(messages[0])
+	if err != nil {
+		return 0, err
+	}
+
+	db := p.WithContext(ctx)
+	batchSize := table.insertBatchSize(db.batchLimit())
+	for i := 0; i < len(messages); i += batchSize {
+		if err := ctx.Err(); err != nil {
+			return committedChunks, fmt.Errorf("batch insert canceled after %d chunks (%d rows written): %w", committedChunks, i, err)
+		}
+		end := min(i+batchSize, len(messages))
+		succeeded, err := db.BatchInsertPartial(messages[i:end])
+		if err != nil {
+			return committedChunks, fmt.Errorf("batch insert failed after %d chunks (%d rows written): %w", committedChunks, i+succeeded, err)
+		}
+		committedChunks++
+	}
+	return committedChunks, nil
+}
+
+// ReplaceAllByKey 整体替换同一父键下的全部行（如玩家背包）：在事务内先
+// DELETE WHERE keyField = keyValue，再批量插入messages。所有消息的keyField必须等于keyValue。
+// keyField为proto字段名，WithColumnMapping改过列名时同样传字段名。
+// 已在RunInTransaction内时直接复用当前事务。messages不能为空（只想清空请用DeleteByKV）。
+// 开启缓存时先加锁读出被删除旧行的主键，提交后连同新行一起失效缓存。
+func (p *DB) ReplaceAllByKey(keyField string, keyValue interface{}, messages []proto.Message) error {
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	if len(messages) == 0 {
+		return errors.New("no messages to replace, use DeleteByKV to clear rows")
+	}
+	table, err := p.tableForMessage(messages[0])
+	if err != nil {
+		return err
+	}
+	keyDesc, ok := table.fieldNameToDesc[keyField]
+	if !ok {
+		return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, keyField, table.tableName)
+	}
+	if table.isEncryptedField(keyField) {
+		return fmt.Errorf("replace all for table %s: key field %s is encrypted", table.tableName, keyField)
+	}
+	// 按字段的存储格式比较与绑定（bool、enum、bytes及字段选项格式化的列）
+	want, err := table.keyColumnValue(messages[0], keyDesc, keyValue)
+	if err != nil {
+		return fmt.Errorf("serialize key value of %s: %w", keyField, err)
+	}
+	for i, msg := range messages {
+		if err := table.validateMessageDescriptor(msg); err != nil {
+			return err
+		}
+		got, err := pbconv.SerializeFieldWithOptions(msg, keyDesc, table.fieldOptions(keyDesc))
+		if err != nil {
+			return fmt.Errorf("serialize key field %s: %w", keyField, err)
 		}
+		if got != want {
+			return fmt.Errorf("message %d has %s = %s, expected %s", i, keyField, got, want)
+		}
+	}
+
+	replace := func(tx *DB) error {
+		keyWhere := table.quotedColumn(keyField) + " = ?"
+		if err := tx.invalidateRowsWhere(table, keyWhere, []interface{}{want}); err != nil {
+			return err
+		}
+		if err := tx.DeleteByKV(messages[0], keyField, want); err != nil {
+			return err
+		}
+		if err := tx.BatchInsert(messages); err != nil {
+			return err
+		}
+		tx.invalidateMessages(table, messages...)
+		return nil
+	}
+	if p.tx != nil {
+		return replace(p)
+	}
+	return p.RunInTransaction(replace)
+}
+
+// keyColumnValue 把调用方传入的键值写入template类型的空消息再按字段选项序列化，
+// 结果与对消息SerializeFieldWithOptions的结果可直接比较，也可作为WHERE参数
+func (m *MessageTable) keyColumnValue(template proto.Message, field protoreflect.FieldDescriptor, value interface{}) (string, error) {
+	probe := template.ProtoReflect().New()
+	switch v := value.(type) {
+	case protoreflect.Enum:
+		probe.Set(field, protoreflect.ValueOfEnum(v.Number()))
+	case []byte:
+		if field.Kind() == protoreflect.BytesKind {
+			probe.Set(field, protoreflect.ValueOfBytes(v))
+		} else if err := pbconv.ParseFieldFromBytesWithOptions(probe.Interface(), field, v, m.fieldOptions(field)); err != nil {
+			return "", err
+		}
+	default:
+		if err := pbconv.ParseFieldFromBytesWithOptions(probe.Interface(), field, []byte(fmt.Sprint(value)), m.fieldOptions(field)); err != nil {
+			return "", err
+		}
+	}
+	return pbconv.SerializeFieldWithOptions(probe.Interface(), field, m.fieldOptions(field))
+}
+
+// invalidateRowsWhere 按条件加锁读出（FOR UPDATE）命中行的主键并失效其缓存，供按条件删除前调用；
+// 未开启缓存或表无主键时不查询
+func (p *DB) invalidateRowsWhere(table *MessageTable, whereClause string, whereArgs []interface{}) error {
+	if !p.cacheEnabled() || len(table.primaryKey) == 0 {
+		return nil
+	}
+	pkNames := make([]string, len(table.primaryKey))
+	for i, primaryKey := range table.primaryKey {
+		pkNames[i] = table.quotedColumn(primaryKey)
 	}
+	whereClause, whereArgs = table.scopeWhere(whereClause, whereArgs)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s FOR UPDATE",
+		strings.Join(pkNames, ", "), table.sqlName(), whereClause)
+	rows, release, err := p.conn().Query(query, whereArgs...)
+	if err != nil {
+		return fmt.Errorf("lock rows of table %s: %w", table.tableName, err)
+	}
+	defer release()
 
+	var keys []string
+	for rows.Next() {
+		values := make([]string, len(pkNames))
+		dest := make([]interface{}, len(pkNames))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scan primary key of table %s: %w", table.tableName, err)
+		}
+		pkValues := make([]interface{}, len(values))
+		for i, v := range values {
+			pkValues[i] = v
+		}
+		keys = append(keys, cacheKeyForValues(table, pkValues))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("lock rows of table %s: %w", table.tableName, err)
+	}
+	p.invalidateKeys(keys)
 	return nil
 }
 
@@ -926,15 +2689,98 @@ func (p *DB) InsertReturningID(message proto.Message) (int64, error) {
 
 	result, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
 	if err != nil {
-		return 0, fmt.Errorf("exec insert for table %s: %w", table.tableName, wrapExecErr(err))
+		return 0, fmt.Errorf("exec insert for table %s: %w", table.tableName, err)
 	}
 	return result.LastInsertId()
 }
 
+// BatchInsertAndGetIDs 批量插入自增主键表，并把MySQL分配的自增ID按顺序回填到每条消息的自增字段，
+// 同时返回这些ID。每批（SetBatchSize条，默认BatchInsertMaxSize）按 LAST_INSERT_ID() 起连续分配计算：
+// 第j条的ID = LastInsertId + j，并校验 RowsAffected 等于该批条数。
+//
+// 注意：连续分配的前提是 innodb_autoinc_lock_mode 不为 2（interleaved，MySQL 8 默认值！）
+// 且 auto_increment_increment = 1；interleaved 模式下并发批量插入可能拿到不连续的ID，
+// 此时请改用逐条 InsertReturningID。消息的自增字段必须未设置（零值），显式指定ID会破坏连续性。
+func (p *DB) BatchInsertAndGetIDs(messages []proto.Message) ([]int64, error) {
+	if len(messages) == 0 {
+		return nil, errors.New("no messages to insert")
+	}
+	table, err := p.tableForMessage(messages[0])
+	if err != nil {
+		return nil, err
+	}
+	autoField, ok := table.fieldNameToDesc[table.autoIncreaseKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: auto-increment key of table %s", ErrFieldNotFound, table.tableName)
+	}
+	for _, msg := range messages {
+		if err := table.validateMessageDescriptor(msg); err != nil {
+			return nil, err
+		}
+		if msg.ProtoReflect().Has(autoField) {
+			return nil, fmt.Errorf("auto-increment field %s must be unset for BatchInsertAndGetIDs in table %s",
+				autoField.Name(), table.tableName)
+		}
+	}
+
+	ids := make([]int64, 0, len(messages))
+	batchSize := table.insertBatchSize(p.batchLimit())
+	for i := 0; i < len(messages); i += batchSize {
+		end := min(i+batchSize, len(messages))
+		batch := messages[i:end]
+
+		sqlWithArgs, err := table.getBatchInsertSQLWithArgs(batch, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("generate batch insert SQL for table %s: %w", table.tableName, err)
+		}
+		result, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
+		if err != nil {
+			return nil, fmt.Errorf("exec batch insert for table %s: args len=%d, err=%w",
+				table.tableName, len(sqlWithArgs.Args), err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected != int64(len(batch)) {
+			return nil, fmt.Errorf("batch insert for table %s affected %d rows, expected %d", table.tableName, affected, len(batch))
+		}
+		firstID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		for j, msg := range batch {
+			id := firstID + int64(j)
+			if err := setIntegerField(msg.ProtoReflect(), autoField, id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// setIntegerField 把自增ID写回整数类型字段
+func setIntegerField(reflection protoreflect.Message, field protoreflect.FieldDescriptor, v int64) error {
+	switch field.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		reflection.Set(field, protoreflect.ValueOfInt32(int32(v)))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		reflection.Set(field, protoreflect.ValueOfInt64(v))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		reflection.Set(field, protoreflect.ValueOfUint32(uint32(v)))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		reflection.Set(field, protoreflect.ValueOfUint64(uint64(v)))
+	default:
+		return fmt.Errorf("auto-increment field %s has non-integer kind %s", field.Name(), field.Kind())
+	}
+	return nil
+}
+
 // InsertOnDupUpdate 执行参数化的INSERT...ON DUPLICATE KEY UPDATE操作（直接用DB，无Tx）
 func (p *DB) InsertOnDupUpdate(message proto.Message) error {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
@@ -958,12 +2804,14 @@ func (m *MessageTable) GetSelectSQLByKVWithArgs(whereKey, whereVal string) (*Sql
 	if _, ok := m.fieldNameToDesc[whereKey]; !ok {
 		return nil, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, whereKey, m.tableName)
 	}
-	sql := fmt.Sprintf("%s WHERE %s = ?;", m.selectFieldsSQL, escapeMySQLName(whereKey))
-	return &SqlWithArgs{Sql: sql, Args: []interface{}{whereVal}}, nil
+	whereClause, whereArgs := m.scopeWhere(m.quotedColumn(whereKey)+" = ?", []interface{}{whereVal})
+	sql := fmt.Sprintf("%s WHERE %s;", m.selectFieldsSQL, whereClause)
+	return &SqlWithArgs{Sql: sql, Args: whereArgs}, nil
 }
 
 // GetSelectSQLByWhereWithArgs 生成参数化的自定义WHERE查询语句
 func (m *MessageTable) GetSelectSQLByWhereWithArgs(whereClause string, whereArgs []interface{}) *SqlWithArgs {
+	whereClause, whereArgs = m.scopeWhere(whereClause, whereArgs)
 	sql := fmt.Sprintf("%s WHERE %s;", m.selectFieldsSQL, whereClause)
 	return &SqlWithArgs{Sql: sql, Args: whereArgs}
 }
@@ -978,26 +2826,27 @@ func (m *MessageTable) GetSelectSQL(includeSemicolon bool) string {
 
 // GetDeleteSQLWithArgs 生成参数化的按主键删除语句
 func (m *MessageTable) GetDeleteSQLWithArgs(message proto.Message) (*SqlWithArgs, error) {
-	whereClause, whereArgs, err := m.primaryKeyWhere(message)
+	whereClause, whereArgs, err := m.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return nil, err
 	}
 	return &SqlWithArgs{
-		Sql:  fmt.Sprintf("DELETE FROM %s WHERE %s", escapeMySQLName(m.tableName), whereClause),
+		Sql:  fmt.Sprintf("DELETE FROM %s WHERE %s", m.sqlName(), whereClause),
 		Args: whereArgs,
 	}, nil
 }
 
 // GetDeleteSQLByWhereWithArgs 生成参数化的自定义WHERE删除语句
 func (m *MessageTable) GetDeleteSQLByWhereWithArgs(whereClause string, whereArgs []interface{}) *SqlWithArgs {
-	sql := fmt.Sprintf("DELETE FROM %s WHERE %s", escapeMySQLName(m.tableName), whereClause)
+	whereClause, whereArgs = m.scopeWhere(whereClause, whereArgs)
+	sql := fmt.Sprintf("DELETE FROM %s WHERE %s", m.sqlName(), whereClause)
 	return &SqlWithArgs{Sql: sql, Args: whereArgs}
 }
 
 // Delete 执行参数化的按主键删除操作（直接用DB，无Tx）
 func (p *DB) Delete(message proto.Message) error {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
@@ -1007,32 +2856,67 @@ func (p *DB) Delete(message proto.Message) error {
 		return fmt.Errorf("generate delete SQL for table %s: %w", tableName, err)
 	}
 
-	_, err = p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	return p.audited(table, AuditOpDelete, []proto.Message{message}, nil, func(db *DB) error {
+		if _, err := db.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...); err != nil {
+			return fmt.Errorf("exec delete for table %s: sql=%s, args=%v, err=%w",
+				tableName, sqlWithArgs.Sql, sqlWithArgs.Args, err)
+		}
+		db.invalidateMessages(table, message)
+		return nil
+	})
+}
+
+// DeleteByWhereWithArgs 执行参数化的自定义WHERE删除操作
+func (p *DB) DeleteByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) error {
+	table, err := p.tableForMessage(message)
 	if err != nil {
-		return fmt.Errorf("exec delete for table %s: sql=%s, args=%v, err=%w",
-			tableName, sqlWithArgs.Sql, sqlWithArgs.Args, err)
+		return err
+	}
+
+	sqlWithArgs := table.GetDeleteSQLByWhereWithArgs(whereClause, whereArgs)
+	if _, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...); err != nil {
+		return fmt.Errorf("exec delete by where for table %s: %w", table.tableName, err)
 	}
-	p.invalidateMessages(table, message)
 	return nil
 }
 
-// DeleteByWhereWithArgs 执行参数化的自定义WHERE删除操作
-func (p *DB) DeleteByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) error {
+// DeleteByWhere 删除满足whereClause的所有行，返回影响行数。
+// whereClause不能为空（防止误删全表），确需清表请用DeleteAll。按条件删除无法定位主键，不会失效缓存
+func (p *DB) DeleteByWhere(message proto.Message, whereClause string, whereArgs []interface{}) (int64, error) {
+	whereClause = stripWherePrefix(whereClause)
+	if strings.TrimSpace(whereClause) == "" {
+		return 0, fmt.Errorf("%w: use DeleteAll to delete every row", ErrEmptyWhereClause)
+	}
+	return p.deleteMany(message, whereClause, whereArgs)
+}
+
+// DeleteAll 删除全表数据（DELETE而非TRUNCATE，可在事务内回滚），返回影响行数
+func (p *DB) DeleteAll(message proto.Message) (int64, error) {
+	return p.deleteMany(message, "1=1", nil)
+}
+
+// deleteMany 执行DELETE ... WHERE whereClause
+func (p *DB) deleteMany(message proto.Message, whereClause string, whereArgs []interface{}) (int64, error) {
 	table, err := p.tableForMessage(message)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	sqlWithArgs := table.GetDeleteSQLByWhereWithArgs(whereClause, whereArgs)
-	if _, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...); err != nil {
-		return fmt.Errorf("exec delete by where for table %s: %w", table.tableName, err)
+	result, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	if err != nil {
+		return 0, fmt.Errorf("exec delete many for table %s: %w", table.tableName, err)
 	}
-	return nil
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected for table %s: %w", table.tableName, err)
+	}
+	return affected, nil
 }
 
 // DeleteByKV 按单个字段等值条件删除
 func (p *DB) DeleteByKV(message proto.Message, key string, value interface{}) error {
-	return p.DeleteByWhereWithArgs(message, escapeMySQLName(key)+" = ?", []interface{}{value})
+	return p.DeleteByWhereWithArgs(message, p.columnOf(message, key)+" = ?", []interface{}{value})
 }
 
 // BatchDelete 按主键批量删除（DELETE ... WHERE pk IN (...)，自动分批）
@@ -1056,34 +2940,37 @@ func (p *DB) BatchDelete(messages []proto.Message) error {
 
 	pkNames := make([]string, len(table.primaryKey))
 	for i, primaryKey := range table.primaryKey {
-		pkNames[i] = escapeMySQLName(primaryKey)
+		pkNames[i] = table.quotedColumn(primaryKey)
 	}
 
-	for i := 0; i < len(messages); i += BatchInsertMaxSize {
-		end := i + BatchInsertMaxSize
-		if end > len(messages) {
-			end = len(messages)
-		}
-		batch := messages[i:end]
+	batchSize := p.batchLimit()
+	return p.audited(table, AuditOpDelete, messages, nil, func(db *DB) error {
+		for i := 0; i < len(messages); i += batchSize {
+			end := i + batchSize
+			if end > len(messages) {
+				end = len(messages)
+			}
+			batch := messages[i:end]
+
+			var args []interface{}
+			tuples := make([]string, 0, len(batch))
+			for _, msg := range batch {
+				values, err := table.primaryKeyValues(msg)
+				if err != nil {
+					return err
+				}
+				args = append(args, values...)
+				tuples = append(tuples, "("+buildPlaceholders(len(table.primaryKey))+")")
+			}
 
-		var args []interface{}
-		tuples := make([]string, 0, len(batch))
-		for _, msg := range batch {
-			values, err := table.primaryKeyValues(msg)
-			if err != nil {
+			where := fmt.Sprintf("(%s) IN (%s)", strings.Join(pkNames, ", "), strings.Join(tuples, ", "))
+			if err := db.DeleteByWhereWithArgs(messages[0], where, args); err != nil {
 				return err
 			}
-			args = append(args, values...)
-			tuples = append(tuples, "("+buildPlaceholders(len(table.primaryKey))+")")
 		}
-
-		where := fmt.Sprintf("(%s) IN (%s)", strings.Join(pkNames, ", "), strings.Join(tuples, ", "))
-		if err := p.DeleteByWhereWithArgs(messages[0], where, args); err != nil {
-			return err
-		}
-	}
-	p.invalidateMessages(table, messages...)
-	return nil
+		db.invalidateMessages(table, messages...)
+		return nil
+	})
 }
 
 // Update 按主键更新消息中已设置的字段（UPDATE ... WHERE pk = ?）
@@ -1097,11 +2984,13 @@ func (p *DB) Update(message proto.Message) error {
 	if err != nil {
 		return fmt.Errorf("generate update SQL for table %s: %w", table.tableName, err)
 	}
-	if _, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...); err != nil {
-		return fmt.Errorf("exec update for table %s: %w", table.tableName, err)
-	}
-	p.invalidateMessages(table, message)
-	return nil
+	return p.audited(table, AuditOpUpdate, []proto.Message{message}, nil, func(db *DB) error {
+		if _, err := db.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...); err != nil {
+			return fmt.Errorf("exec update for table %s: %w", table.tableName, err)
+		}
+		db.invalidateMessages(table, message)
+		return nil
+	})
 }
 
 // UpdateByWhereWithArgs 按自定义WHERE条件更新消息中已设置的字段
@@ -1121,8 +3010,46 @@ func (p *DB) UpdateByWhereWithArgs(message proto.Message, whereClause string, wh
 	return nil
 }
 
+// UpdateManyByWhere 以message中已设置的字段为模板，批量更新满足whereClause的所有行，返回影响行数。
+// whereClause不能为空（防止误更新全表），确需全表更新请用UpdateAll。按条件更新无法定位主键，不会失效缓存
+func (p *DB) UpdateManyByWhere(message proto.Message, whereClause string, whereArgs []interface{}) (int64, error) {
+	whereClause = stripWherePrefix(whereClause)
+	if strings.TrimSpace(whereClause) == "" {
+		return 0, fmt.Errorf("%w: use UpdateAll to update every row", ErrEmptyWhereClause)
+	}
+	return p.updateMany(message, whereClause, whereArgs)
+}
+
+// UpdateAll 以message中已设置的字段为模板更新全表，返回影响行数
+func (p *DB) UpdateAll(message proto.Message) (int64, error) {
+	return p.updateMany(message, "1=1", nil)
+}
+
+// updateMany 执行UPDATE ... SET 已设置字段 WHERE whereClause
+func (p *DB) updateMany(message proto.Message, whereClause string, whereArgs []interface{}) (int64, error) {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return 0, err
+	}
+
+	sqlWithArgs, err := table.GetUpdateSQLByWhereWithArgs(message, whereClause, whereArgs)
+	if err != nil {
+		return 0, fmt.Errorf("generate update SQL for table %s: %w", table.tableName, err)
+	}
+	result, err := p.conn().Exec(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	if err != nil {
+		return 0, fmt.Errorf("exec update many for table %s: %w", table.tableName, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected for table %s: %w", table.tableName, err)
+	}
+	return affected, nil
+}
+
 // UpdateFieldsByPK 按主键只更新指定字段（部分更新），避免Update全字段覆盖
 // 冲掉其他地方的并发写入（如改名操作把别处刚加的金币覆盖回去）
+// 由MySQL维护的WithTimestamps时间戳列与生成列不能指定，返回ErrInvalidTableOption
 func (p *DB) UpdateFieldsByPK(message proto.Message, fields ...string) error {
 	if len(fields) == 0 {
 		return errors.New("no fields to update")
@@ -1132,33 +3059,39 @@ func (p *DB) UpdateFieldsByPK(message proto.Message, fields ...string) error {
 		return err
 	}
 
-	clauses := make([]string, 0, len(fields))
+	clauses := make([]string, 0, len(fields)+1)
 	args := make([]interface{}, 0, len(fields))
 	for _, field := range fields {
-		desc, ok := table.fieldNameToDesc[field]
-		if !ok {
-			return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
+		desc, err := table.updatableField(field)
+		if err != nil {
+			return err
+		}
+		if field == table.touchField {
+			continue // 由withTouch统一设为当前时间
 		}
-		val, err := pbconv.SerializeFieldAsString(message, desc)
+		val, err := table.columnValue(message, desc)
 		if err != nil {
 			return fmt.Errorf("serialize update field %s: %w", field, err)
 		}
-		clauses = append(clauses, escapeMySQLName(field)+" = ?")
+		clauses = append(clauses, table.setClauseSQL(desc))
 		args = append(args, val)
 	}
+	clauses = table.withTouch(clauses)
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return err
 	}
 
 	sqlStmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
-		escapeMySQLName(table.tableName), strings.Join(clauses, ", "), whereClause)
-	if _, err := p.conn().Exec(sqlStmt, append(args, whereArgs...)...); err != nil {
-		return fmt.Errorf("exec update fields for table %s: %w", table.tableName, err)
-	}
-	p.invalidateMessages(table, message)
-	return nil
+		table.sqlName(), strings.Join(clauses, ", "), whereClause)
+	return p.audited(table, AuditOpUpdate, []proto.Message{message}, nil, func(db *DB) error {
+		if _, err := db.conn().Exec(sqlStmt, append(args, whereArgs...)...); err != nil {
+			return fmt.Errorf("exec update fields for table %s: %w", table.tableName, err)
+		}
+		db.invalidateMessages(table, message)
+		return nil
+	})
 }
 
 // UpdateKVByPK 按主键设置单个字段的值（如改状态、封号）
@@ -1167,22 +3100,30 @@ func (p *DB) UpdateKVByPK(message proto.Message, field string, value interface{}
 	if err != nil {
 		return err
 	}
-	if _, ok := table.fieldNameToDesc[field]; !ok {
-		return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
+	if _, err := table.updatableField(field); err != nil {
+		return err
+	}
+	if table.isEncryptedField(field) {
+		return fmt.Errorf("update kv for table %s: field %s is encrypted, use UpdateFieldsByPK", table.tableName, field)
 	}
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return err
 	}
 
-	sqlStmt := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s",
-		escapeMySQLName(table.tableName), escapeMySQLName(field), whereClause)
-	if _, err := p.conn().Exec(sqlStmt, append([]interface{}{value}, whereArgs...)...); err != nil {
-		return fmt.Errorf("exec update kv for table %s: %w", table.tableName, err)
+	setClause := table.quotedColumn(field) + " = ?"
+	if field != table.touchField {
+		setClause = strings.Join(table.withTouch([]string{setClause}), ", ")
 	}
-	p.invalidateMessages(table, message)
-	return nil
+	sqlStmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table.sqlName(), setClause, whereClause)
+	return p.audited(table, AuditOpUpdate, []proto.Message{message}, nil, func(db *DB) error {
+		if _, err := db.conn().Exec(sqlStmt, append([]interface{}{value}, whereArgs...)...); err != nil {
+			return fmt.Errorf("exec update kv for table %s: %w", table.tableName, err)
+		}
+		db.invalidateMessages(table, message)
+		return nil
+	})
 }
 
 // UpdateIfVersion 乐观锁CAS更新：按主键更新消息中已设置的字段（versionField自动+1），
@@ -1198,7 +3139,7 @@ func (p *DB) UpdateIfVersion(message proto.Message, versionField string) (bool,
 		return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, versionField, table.tableName)
 	}
 
-	curVersion, err := pbconv.SerializeFieldAsString(message, versionDesc)
+	curVersion, err := pbconv.SerializeFieldWithOptions(message, versionDesc, table.fieldOptions(versionDesc))
 	if err != nil {
 		return false, fmt.Errorf("serialize version field %s: %w", versionField, err)
 	}
@@ -1211,48 +3152,52 @@ func (p *DB) UpdateIfVersion(message proto.Message, versionField string) (bool,
 	reflection := message.ProtoReflect()
 	var clauses []string
 	var args []interface{}
-	for i := 0; i < table.Descriptor.Fields().Len(); i++ {
-		field := table.Descriptor.Fields().Get(i)
+	for _, field := range table.columns {
 		name := string(field.Name())
-		if name == versionField || pkSet[name] || !reflection.Has(field) {
+		if name == versionField || pkSet[name] || !table.hasColumnValue(reflection, field) || table.isDBGeneratedField(name) ||
+			name == table.touchField {
 			continue
 		}
-		val, err := pbconv.SerializeFieldAsString(message, field)
+		val, err := table.columnValue(message, field)
 		if err != nil {
 			return false, fmt.Errorf("serialize update field %s: %w", name, err)
 		}
-		clauses = append(clauses, escapeMySQLName(name)+" = ?")
+		clauses = append(clauses, table.setClauseSQL(field))
 		args = append(args, val)
 	}
+	clauses = table.withTouch(clauses)
 	if len(clauses) == 0 {
 		return false, errors.New("no fields to update")
 	}
 
-	escapedVersion := escapeMySQLName(versionField)
+	escapedVersion := table.quotedColumn(versionField)
 	clauses = append(clauses, fmt.Sprintf("%s = %s + 1", escapedVersion, escapedVersion))
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return false, err
 	}
 
 	sqlStmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s AND %s = ?",
-		escapeMySQLName(table.tableName), strings.Join(clauses, ", "), whereClause, escapedVersion)
+		table.sqlName(), strings.Join(clauses, ", "), whereClause, escapedVersion)
 	args = append(args, whereArgs...)
 	args = append(args, curVersion)
 
-	result, err := p.conn().Exec(sqlStmt, args...)
-	if err != nil {
-		return false, fmt.Errorf("exec update if version for table %s: %w", table.tableName, err)
-	}
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-	if affected > 0 {
-		p.invalidateMessages(table, message)
-	}
-	return affected > 0, nil
+	var affected int64
+	err = p.audited(table, AuditOpUpdate, []proto.Message{message}, table.versionMatches(versionDesc, curVersion), func(db *DB) error {
+		result, err := db.conn().Exec(sqlStmt, args...)
+		if err != nil {
+			return fmt.Errorf("exec update if version for table %s: %w", table.tableName, err)
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if affected > 0 {
+			db.invalidateMessages(table, message)
+		}
+		return nil
+	})
+	return affected > 0, err
 }
 
 // UpdateFieldsIfVersion 乐观锁CAS+显式字段列表：
@@ -1274,92 +3219,89 @@ func (p *DB) UpdateFieldsIfVersion(message proto.Message, versionField string, f
 	if !ok {
 		return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, versionField, table.tableName)
 	}
-	curVersion, err := pbconv.SerializeFieldAsString(message, versionDesc)
+	curVersion, err := pbconv.SerializeFieldWithOptions(message, versionDesc, table.fieldOptions(versionDesc))
 	if err != nil {
 		return false, fmt.Errorf("serialize version field %s: %w", versionField, err)
 	}
 
-	clauses := make([]string, 0, len(fields)+1)
+	clauses := make([]string, 0, len(fields)+2)
 	args := make([]interface{}, 0, len(fields)+2)
 	for _, name := range fields {
-		if name == versionField {
-			continue // version 由下面统一 +1
+		if name == versionField || name == table.touchField {
+			continue // version 由下面统一 +1，touch列由withTouch设为当前时间
 		}
-		desc, ok := table.fieldNameToDesc[name]
-		if !ok {
-			return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, name, table.tableName)
+		desc, err := table.updatableField(name)
+		if err != nil {
+			return false, err
 		}
-		val, err := pbconv.SerializeFieldAsString(message, desc)
+		val, err := table.columnValue(message, desc)
 		if err != nil {
 			return false, fmt.Errorf("serialize update field %s: %w", name, err)
 		}
-		clauses = append(clauses, escapeMySQLName(name)+" = ?")
+		clauses = append(clauses, table.setClauseSQL(desc))
 		args = append(args, val)
 	}
-	escapedVersion := escapeMySQLName(versionField)
+	clauses = table.withTouch(clauses)
+	escapedVersion := table.quotedColumn(versionField)
 	clauses = append(clauses, fmt.Sprintf("%s = %s + 1", escapedVersion, escapedVersion))
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return false, err
 	}
 	sqlStmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s AND %s = ?",
-		escapeMySQLName(table.tableName), strings.Join(clauses, ", "), whereClause, escapedVersion)
+		table.sqlName(), strings.Join(clauses, ", "), whereClause, escapedVersion)
 	args = append(args, whereArgs...)
 	args = append(args, curVersion)
 
-	result, err := p.conn().Exec(sqlStmt, args...)
-	if err != nil {
-		return false, fmt.Errorf("exec update fields if version for table %s: %w", table.tableName, err)
-	}
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-	if affected > 0 {
-		p.invalidateMessages(table, message)
-	}
-	return affected > 0, nil
+	var affected int64
+	err = p.audited(table, AuditOpUpdate, []proto.Message{message}, table.versionMatches(versionDesc, curVersion), func(db *DB) error {
+		result, err := db.conn().Exec(sqlStmt, args...)
+		if err != nil {
+			return fmt.Errorf("exec update fields if version for table %s: %w", table.tableName, err)
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if affected > 0 {
+			db.invalidateMessages(table, message)
+		}
+		return nil
+	})
+	return affected > 0, err
 }
 
 // GetReplaceSQLWithArgs 生成参数化的REPLACE语句
 func (m *MessageTable) GetReplaceSQLWithArgs(message proto.Message) (*SqlWithArgs, error) {
-	var args []interface{}
-	for i := 0; i < m.Descriptor.Fields().Len(); i++ {
-		fieldDesc := m.Descriptor.Fields().Get(i)
-		val, err := pbconv.SerializeFieldAsString(message, fieldDesc)
-		if err != nil {
-			return nil, fmt.Errorf("serialize field %s: %w", fieldDesc.Name(), err)
-		}
-		args = append(args, val)
+	args, err := m.insertArgs(message)
+	if err != nil {
+		return nil, err
 	}
 
-	placeholders := buildPlaceholders(len(args))
-	sqlStmt := fmt.Sprintf("%s%s)", m.replaceSQLPrefix, placeholders)
-
-	return &SqlWithArgs{Sql: sqlStmt, Args: args}, nil
+	return &SqlWithArgs{Sql: m.replaceSQLTemplate, Args: args}, nil
 }
 
-// GetUpdateSetWithArgs 生成参数化的SET子句和参数（仅包含已设置的字段）
+// GetUpdateSetWithArgs 生成参数化的SET子句和参数（仅包含已设置的字段，不含MySQL维护的时间戳列）
 func (m *MessageTable) GetUpdateSetWithArgs(message proto.Message) (string, []interface{}, error) {
 	reflection := message.ProtoReflect()
 	var clauses []string
 	var args []interface{}
 
-	for i := 0; i < m.Descriptor.Fields().Len(); i++ {
-		field := m.Descriptor.Fields().Get(i)
-		if !reflection.Has(field) {
+	for _, field := range m.columns {
+		if !m.hasColumnValue(reflection, field) || m.isDBGeneratedField(string(field.Name())) ||
+			string(field.Name()) == m.touchField {
 			continue
 		}
 
-		val, err := pbconv.SerializeFieldAsString(message, field)
+		val, err := m.columnValue(message, field)
 		if err != nil {
 			return "", nil, fmt.Errorf("serialize update field %s: %w", field.Name(), err)
 		}
 
-		clauses = append(clauses, escapeMySQLName(string(field.Name()))+" = ?")
+		clauses = append(clauses, m.setClauseSQL(field))
 		args = append(args, val)
 	}
+	clauses = m.withTouch(clauses)
 
 	return strings.Join(clauses, ", "), args, nil
 }
@@ -1374,12 +3316,12 @@ func (m *MessageTable) GetUpdateSQLWithArgs(message proto.Message) (*SqlWithArgs
 		return nil, errors.New("no fields to update")
 	}
 
-	whereClause, whereArgs, err := m.primaryKeyWhere(message)
+	whereClause, whereArgs, err := m.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return nil, err
 	}
 
-	fullSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", escapeMySQLName(m.tableName), setClause, whereClause)
+	fullSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", m.sqlName(), setClause, whereClause)
 	return &SqlWithArgs{Sql: fullSQL, Args: append(setArgs, whereArgs...)}, nil
 }
 
@@ -1393,7 +3335,8 @@ func (m *MessageTable) GetUpdateSQLByWhereWithArgs(message proto.Message, whereC
 		return nil, errors.New("no fields to update")
 	}
 
-	fullSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", escapeMySQLName(m.tableName), setClause, whereClause)
+	whereClause, whereArgs = m.scopeWhere(whereClause, whereArgs)
+	fullSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", m.sqlName(), setClause, whereClause)
 	fullArgs := append(setArgs, whereArgs...)
 
 	return &SqlWithArgs{Sql: fullSQL, Args: fullArgs}, nil
@@ -1405,34 +3348,122 @@ func (m *MessageTable) Init() {
 	fieldCount := desc.Fields().Len()
 
 	m.fieldNameToDesc = make(map[string]protoreflect.FieldDescriptor, fieldCount)
+	m.columnToField = make(map[string]string, len(m.columnMapping))
+	for field, column := range m.columnMapping {
+		m.columnToField[column] = field
+	}
+	m.columns = make([]protoreflect.FieldDescriptor, 0, fieldCount)
+	m.writeFields = make([]protoreflect.FieldDescriptor, 0, fieldCount)
 	names := make([]string, 0, fieldCount)
-	for i := 0; i < fieldCount; i++ {
-		field := desc.Fields().Get(i)
+	writeNames := make([]string, 0, fieldCount)
+	writePlaceholders := make([]string, 0, fieldCount)
+	for _, field := range m.orderedFields() {
 		fieldName := string(field.Name())
+		if m.isIgnoredField(fieldName) {
+			continue
+		}
 		m.fieldNameToDesc[fieldName] = field
-		names = append(names, escapeMySQLName(fieldName))
+		m.columns = append(m.columns, field)
+		names = append(names, m.selectColumnSQL(field))
+		if !m.isDBGeneratedField(fieldName) {
+			m.writeFields = append(m.writeFields, field)
+			writeNames = append(writeNames, m.quotedColumn(fieldName))
+			writePlaceholders = append(writePlaceholders, m.columnPlaceholder(field))
+		}
 	}
 	m.fieldsListSQL = strings.Join(names, ", ")
+	m.insertFieldsListSQL = strings.Join(writeNames, ", ")
+	m.insertPlaceholdersSQL = strings.Join(writePlaceholders, ", ")
+	m.insertArgsPerRow = strings.Count(m.insertPlaceholdersSQL, "?")
 
-	escapedTable := escapeMySQLName(m.tableName)
+	escapedTable := m.sqlName()
 	m.selectFieldsSQL = "SELECT " + m.fieldsListSQL + " FROM " + escapedTable
 	m.selectAllSQLWithSemicolon = m.selectFieldsSQL + ";"
 	m.selectAllSQLWithoutSemicolon = m.selectFieldsSQL + " "
 	m.insertSQLTemplate = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-		escapedTable, m.fieldsListSQL, buildPlaceholders(fieldCount))
-	m.replaceSQLPrefix = "REPLACE INTO " + escapedTable + " (" + m.fieldsListSQL + ") VALUES ("
+		escapedTable, m.insertFieldsListSQL, m.insertPlaceholdersSQL)
+	m.replaceSQLTemplate = fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)",
+		escapedTable, m.insertFieldsListSQL, m.insertPlaceholdersSQL)
 
+	m.primaryKeyField = nil
 	if len(m.primaryKey) > 0 {
 		m.primaryKeyField = desc.Fields().ByName(protoreflect.Name(m.primaryKey[0]))
 	}
 }
 
+// Reinit 按当前表配置重新生成预构建的SQL片段，并清空线上表结构缓存。
+// 注册后直接对表应用TableOption（如 proto2mysql.WithNullableFields("age")(table)）修改配置时，
+// 必须随后调用Reinit，否则INSERT/SELECT模板仍是旧配置。
+// 注意：Reinit不是并发安全的，请在没有并发读写该表时调用。
+func (m *MessageTable) Reinit() {
+	m.Init()
+	m.columnsMu.Lock()
+	m.cachedColumns = nil
+	m.cachedCharsets = nil
+	m.columnsMu.Unlock()
+}
+
 // NewDB 创建新的数据库实例
 func NewDB() *DB {
 	return &DB{
 		Tables:           make(map[string]*MessageTable),
-		tableExistsCache: make(map[string]bool),
+		tablesMu:         new(sync.RWMutex),
+		tableExistsCache: make(map[string]tableExistsEntry),
+	}
+}
+
+// fallbackTablesMu 未经NewDB构造（tablesMu为nil）的DB共用的表注册锁
+var fallbackTablesMu sync.RWMutex
+
+// tablesLock 返回保护Tables的锁：NewDB/clone设置的共享锁，字面量构造的实例退回fallbackTablesMu
+func (p *DB) tablesLock() *sync.RWMutex {
+	if p.tablesMu != nil {
+		return p.tablesMu
 	}
+	return &fallbackTablesMu
+}
+
+// lookupTable 按注册键（proto full name）查找表（读锁）
+func (p *DB) lookupTable(registryKey string) (*MessageTable, bool) {
+	p.tablesLock().RLock()
+	defer p.tablesLock().RUnlock()
+	table, ok := p.Tables[registryKey]
+	return table, ok
+}
+
+// storeTable 注册或替换表（写锁）
+func (p *DB) storeTable(registryKey string, table *MessageTable) {
+	p.tablesLock().Lock()
+	defer p.tablesLock().Unlock()
+	p.Tables[registryKey] = table
+}
+
+// tablesSnapshot 返回已注册表的副本，供遍历时调用可能再次查表的方法（不持锁）
+func (p *DB) tablesSnapshot() map[string]*MessageTable {
+	p.tablesLock().RLock()
+	defer p.tablesLock().RUnlock()
+	return maps.Clone(p.Tables)
+}
+
+// anyTable 同resolveAnyTable（读锁）
+func (p *DB) anyTable(message proto.Message) (*MessageTable, error) {
+	p.tablesLock().RLock()
+	defer p.tablesLock().RUnlock()
+	return resolveAnyTable(p.Tables, message)
+}
+
+// listTable 同resolveListTable（读锁）
+func (p *DB) listTable(list proto.Message) (*MessageTable, protoreflect.FieldDescriptor, error) {
+	p.tablesLock().RLock()
+	defer p.tablesLock().RUnlock()
+	return resolveListTable(p.Tables, list)
+}
+
+// columnOf 同quotedColumnOf（读锁）
+func (p *DB) columnOf(message proto.Message, fieldName string) string {
+	p.tablesLock().RLock()
+	defer p.tablesLock().RUnlock()
+	return quotedColumnOf(p.Tables, message, fieldName)
 }
 
 // GetTableName 获取Protobuf对应的表名
@@ -1448,7 +3479,7 @@ func GetDescriptor(m proto.Message) protoreflect.MessageDescriptor {
 // GetCreateTableSQL 获取创建表的SQL（对外接口）
 func (p *DB) GetCreateTableSQL(message proto.Message) string {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return ""
 	}
@@ -1458,7 +3489,7 @@ func (p *DB) GetCreateTableSQL(message proto.Message) string {
 // Save 执行参数化的REPLACE操作（直接用DB，无Tx）
 func (p *DB) Save(message proto.Message) error {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
@@ -1493,13 +3524,14 @@ func (p *DB) BatchSave(messages []proto.Message) error {
 		}
 	}
 
-	for i := 0; i < len(messages); i += BatchInsertMaxSize {
-		end := i + BatchInsertMaxSize
+	batchSize := table.insertBatchSize(p.batchLimit())
+	for i := 0; i < len(messages); i += batchSize {
+		end := i + batchSize
 		if end > len(messages) {
 			end = len(messages)
 		}
 
-		sqlWithArgs, err := table.GetBatchReplaceSQLWithArgs(messages[i:end])
+		sqlWithArgs, err := table.getBatchReplaceSQLWithArgs(messages[i:end], batchSize)
 		if err != nil {
 			return fmt.Errorf("generate batch replace SQL for table %s: %w", table.tableName, err)
 		}
@@ -1521,7 +3553,8 @@ func (p *DB) FindOneByPK(message proto.Message) error {
 	}
 
 	// 事务内不走缓存（需要读到事务内未提交的最新值）
-	useCache := p.cacheEnabled() && p.tx == nil
+	// 有默认条件（WithDefaultWhere）的表不走缓存：缓存键只含主键，无法区分默认条件
+	useCache := p.cacheEnabled() && p.tx == nil && table.defaultWhere == ""
 	if useCache && p.cacheGetProto(table, message) {
 		return nil
 	}
@@ -1540,6 +3573,28 @@ func (p *DB) FindOneByPK(message proto.Message) error {
 	return nil
 }
 
+// FindByPrimaryKey 按主键值查询单条数据，无需先把主键填进message、也无需拼列名或转字符串：
+//
+//	pbDB.FindByPrimaryKey(user, 123)
+//	pbDB.FindByPrimaryKey(item, playerID, slot) // 复合主键：`player_id` = ? AND `slot` = ?
+//
+// pkValues按WithPrimaryKey的列顺序传入，个数须与主键列数一致；表无主键返回ErrPrimaryKeyNotFound。
+// 不经过缓存（需要走缓存请填好主键后用FindOneByPK）。
+func (p *DB) FindByPrimaryKey(message proto.Message, pkValues ...interface{}) error {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return err
+	}
+	if len(table.primaryKey) == 0 {
+		return fmt.Errorf("%w: table %s", ErrPrimaryKeyNotFound, table.tableName)
+	}
+	if len(pkValues) != len(table.primaryKey) {
+		return fmt.Errorf("table %s primary key (%s) has %d columns, got %d values",
+			table.tableName, strings.Join(table.primaryKey, ", "), len(table.primaryKey), len(pkValues))
+	}
+	return p.FindOneByWhereWithArgs(message, table.primaryKeyCondition(), pkValues)
+}
+
 // FindOneByPKForUpdate 按主键查询并加行锁（SELECT ... FOR UPDATE），
 // 仅在RunInTransaction内有意义，用于防止并发修改同一玩家数据
 func (p *DB) FindOneByPKForUpdate(message proto.Message) error {
@@ -1552,24 +3607,62 @@ func (p *DB) FindOneByPKForUpdate(message proto.Message) error {
 		return err
 	}
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return err
 	}
 
 	sqlStmt := fmt.Sprintf("%s WHERE %s FOR UPDATE;", table.selectFieldsSQL, whereClause)
-	rows, err := p.conn().Query(sqlStmt, whereArgs...)
+	rows, release, err := p.conn().Query(sqlStmt, whereArgs...)
 	if err != nil {
 		return fmt.Errorf("exec select for update for table %s: %w", table.tableName, err)
 	}
-	defer rows.Close()
+	defer release()
 
-	if err := scanOneProtoRow(rows, message); err != nil {
+	if err := scanOneProtoRow(table, rows, message); err != nil {
 		return fmt.Errorf("table %s: %w", table.tableName, err)
 	}
 	return nil
 }
 
+// Upsert 按主键“存在则原地UPDATE、不存在则INSERT”，在一个事务中完成（已在RunInTransaction内时直接复用该事务）：
+// 先 SELECT ... FOR UPDATE 锁住主键再决定写法。与Save的区别：Save用REPLACE，行已存在时是先删后插，
+// 会触发外键ON DELETE CASCADE删掉子表数据、重置自增id、丢失未映射的列；Upsert保留原行，只改写消息中的字段。
+// 与InsertOnDupUpdate的区别：后者只更新已设置的字段，Upsert按Update写全部字段。
+// 并发对同一个不存在的主键Upsert时，其中一个可能因死锁或ErrDuplicateKey失败，需重试。
+func (p *DB) Upsert(message proto.Message) error {
+	if p.tx != nil {
+		return p.upsert(message)
+	}
+	return p.RunInTransaction(func(tx *DB) error {
+		return tx.upsert(message)
+	})
+}
+
+// upsert 在当前事务内按主键加锁判断存在性，再路由到Insert或Update
+func (p *DB) upsert(message proto.Message) error {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return err
+	}
+	// 存在性判断须带默认条件（WithDefaultWhere）：其他租户的同主键行不能走到带条件的Update而静默影响0行
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
+	if err != nil {
+		return err
+	}
+
+	sqlStmt := fmt.Sprintf("SELECT 1 FROM %s WHERE %s FOR UPDATE;", table.sqlName(), whereClause)
+	var one int
+	err = p.conn().QueryRowScan(sqlStmt, whereArgs, &one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p.Insert(message)
+	}
+	if err != nil {
+		return fmt.Errorf("lock primary key for upsert in table %s: %w", table.tableName, err)
+	}
+	return p.Update(message)
+}
+
 // FindOrCreate 按主键查询，不存在则用message当前值插入（玩家首次登录常用）。
 // 返回created表示是否新建了记录。
 func (p *DB) FindOrCreate(message proto.Message) (created bool, err error) {
@@ -1590,7 +3683,7 @@ func (p *DB) FindOrCreate(message proto.Message) (created bool, err error) {
 // FindAllByPKIn 按主键批量查询，返回列表（类似Redis MGET：给一批主键，返回命中的行，
 // 不存在的主键自动跳过）
 func (p *DB) FindAllByPKIn(list proto.Message, pkValues []interface{}) error {
-	table, listField, err := resolveListTable(p.Tables, list)
+	table, listField, err := p.listTable(list)
 	if err != nil {
 		return err
 	}
@@ -1603,7 +3696,7 @@ func (p *DB) FindAllByPKIn(list proto.Message, pkValues []interface{}) error {
 		return ErrPrimaryKeyNotFound
 	}
 
-	pkName := escapeMySQLName(string(table.primaryKeyField.Name()))
+	pkName := table.quotedColumn(string(table.primaryKeyField.Name()))
 	where := fmt.Sprintf("%s IN (%s)", pkName, buildPlaceholders(len(pkValues)))
 	return p.FindAllByWhereWithArgs(list, where, pkValues)
 }
@@ -1619,19 +3712,21 @@ func (p *DB) IncrByPK(message proto.Message, field string, delta int64) error {
 		return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
 	}
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return err
 	}
 
-	escapedField := escapeMySQLName(field)
+	escapedField := table.quotedColumn(field)
 	sqlStmt := fmt.Sprintf("UPDATE %s SET %s = %s + ? WHERE %s",
-		escapeMySQLName(table.tableName), escapedField, escapedField, whereClause)
-	if _, err := p.conn().Exec(sqlStmt, append([]interface{}{delta}, whereArgs...)...); err != nil {
-		return fmt.Errorf("exec incr for table %s: %w", table.tableName, err)
-	}
-	p.invalidateMessages(table, message)
-	return nil
+		table.sqlName(), escapedField, escapedField, whereClause)
+	return p.audited(table, AuditOpUpdate, []proto.Message{message}, nil, func(db *DB) error {
+		if _, err := db.conn().Exec(sqlStmt, append([]interface{}{delta}, whereArgs...)...); err != nil {
+			return fmt.Errorf("exec incr for table %s: %w", table.tableName, err)
+		}
+		db.invalidateMessages(table, message)
+		return nil
+	})
 }
 
 // DecrByPKIfEnough 按主键原子扣减数值字段，余额不足时不扣并返回false
@@ -1645,62 +3740,123 @@ func (p *DB) DecrByPKIfEnough(message proto.Message, field string, delta int64)
 	if err != nil {
 		return false, err
 	}
-	if _, ok := table.fieldNameToDesc[field]; !ok {
+	desc, ok := table.fieldNameToDesc[field]
+	if !ok {
 		return false, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
 	}
 
-	whereClause, whereArgs, err := table.primaryKeyWhere(message)
+	whereClause, whereArgs, err := table.scopedPrimaryKeyWhere(message)
 	if err != nil {
 		return false, err
 	}
 
-	escapedField := escapeMySQLName(field)
+	escapedField := table.quotedColumn(field)
 	sqlStmt := fmt.Sprintf("UPDATE %s SET %s = %s - ? WHERE %s AND %s >= ?",
-		escapeMySQLName(table.tableName), escapedField, escapedField, whereClause, escapedField)
+		table.sqlName(), escapedField, escapedField, whereClause, escapedField)
 	args := append([]interface{}{delta}, whereArgs...)
 	args = append(args, delta)
 
-	result, err := p.conn().Exec(sqlStmt, args...)
-	if err != nil {
-		return false, fmt.Errorf("exec decr for table %s: %w", table.tableName, err)
-	}
-	affected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
-	}
-	if affected > 0 {
-		p.invalidateMessages(table, message)
-	}
-	return affected > 0, nil
+	var affected int64
+	err = p.audited(table, AuditOpUpdate, []proto.Message{message}, atLeast(desc, delta), func(db *DB) error {
+		result, err := db.conn().Exec(sqlStmt, args...)
+		if err != nil {
+			return fmt.Errorf("exec decr for table %s: %w", table.tableName, err)
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if affected > 0 {
+			db.invalidateMessages(table, message)
+		}
+		return nil
+	})
+	return affected > 0, err
 }
 
 // FindOneByKV 按单个字段等值条件查询单条数据
 func (p *DB) FindOneByKV(message proto.Message, whereKey string, whereVal string) error {
-	return p.FindOneByWhereWithArgs(message, escapeMySQLName(whereKey)+" = ?", []interface{}{whereVal})
+	return p.FindOneByWhereWithArgs(message, p.columnOf(message, whereKey)+" = ?", []interface{}{whereVal})
 }
 
 // FindOneByWhereWithArgs 执行参数化的自定义WHERE查询（单条数据）
 func (p *DB) FindOneByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) error {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
 
-	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(whereClause, whereArgs)
-	rows, err := p.conn().Query(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	// 最多取两行即可判断是否唯一，不必读完全部匹配行；调用方自带LIMIT时沿用
+	whereClause, whereArgs = table.scopeWhere(whereClause, whereArgs)
+	sqlStmt := fmt.Sprintf("%s WHERE %s;", table.selectFieldsSQL, limitWhere(whereClause, 2))
+	rows, release, err := p.conn().Query(sqlStmt, whereArgs...)
 	if err != nil {
 		return fmt.Errorf("exec select for table %s: %w", tableName, err)
 	}
-	defer rows.Close()
+	defer release()
 
-	if err := scanOneProtoRow(rows, message); err != nil {
+	if err := scanOneProtoRow(table, rows, message); err != nil {
 		return fmt.Errorf("table %s: %w", tableName, err)
 	}
 	return nil
 }
 
-// FindOneByWhereClause 按条件查询单条数据（whereClause为纯条件，无需带WHERE；空串查全表）
+// StreamChan 流式查询（ETL管道）：后台goroutine逐行读取结果集，每行解析到与message同类型的新实例后
+// 发送到返回的行channel，消费方可边读边处理。结果读完后先关闭行channel，再向错误channel发送
+// 终止错误（nil表示正常结束）并关闭它。取消使用WithContext绑定的ctx：ctx取消后goroutine
+// 立即退出并发送ctx.Err()。消费方中途放弃读取时必须取消ctx，否则goroutine会阻塞在发送上并占用连接。
+// 结果集逐行从连接读取（go-sql-driver/mysql本身按需读包，无需useCursorFetch之类的DSN参数），
+// 内存占用与行数无关，适合千万行级导出；消费过慢超过服务端net_write_timeout时MySQL会断开连接，需相应调大。
+//
+//	rowsCh, errCh := pbDB.WithContext(ctx).StreamChan(&pb.Player{}, "level > ?", []interface{}{10})
+//	for row := range rowsCh { ... }
+//	if err := <-errCh; err != nil { ... }
+func (p *DB) StreamChan(message proto.Message, where string, args []interface{}) (<-chan proto.Message, <-chan error) {
+	rowsCh := make(chan proto.Message)
+	errCh := make(chan error, 1)
+	go func() {
+		err := p.streamRows(message, where, args, rowsCh)
+		close(rowsCh)
+		errCh <- err
+		close(errCh)
+	}()
+	return rowsCh, errCh
+}
+
+// streamRows 执行查询并把每行发送到out，ctx取消时停止
+func (p *DB) streamRows(message proto.Message, where string, args []interface{}, out chan<- proto.Message) error {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return err
+	}
+
+	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(normalizeWhereClause(where), args)
+	rows, release, err := p.conn().Query(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	if err != nil {
+		return fmt.Errorf("exec select for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	ctx := p.context()
+	for rows.Next() {
+		row, err := scanRowBytes(rows)
+		if err != nil {
+			return fmt.Errorf("table %s: %w", table.tableName, err)
+		}
+		element := message.ProtoReflect().New().Interface()
+		if err := table.parseRow(element, row); err != nil {
+			return fmt.Errorf("table %s: %w", table.tableName, err)
+		}
+		select {
+		case out <- element:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return rows.Err()
+}
+
+// FindOneByWhereClause 按条件查询单条数据（whereClause为纯条件，无需带WHERE，带上也会被去掉；空串查全表）
 func (p *DB) FindOneByWhereClause(message proto.Message, whereClause string) error {
 	return p.FindOneByWhereWithArgs(message, normalizeWhereClause(whereClause), nil)
 }
@@ -1712,44 +3868,128 @@ func (p *DB) FindAll(message proto.Message) error {
 
 // FindAllByWhereWithArgs 执行参数化的自定义WHERE查询（批量数据）
 func (p *DB) FindAllByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) error {
-	table, listField, err := resolveListTable(p.Tables, message)
+	table, listField, err := p.listTable(message)
 	if err != nil {
 		return err
 	}
 
 	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(whereClause, whereArgs)
-	rows, err := p.conn().Query(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	rows, release, err := p.conn().Query(sqlWithArgs.Sql, sqlWithArgs.Args...)
 	if err != nil {
 		return fmt.Errorf("exec select all for table %s: %w", table.tableName, err)
 	}
-	defer rows.Close()
+	defer release()
 
 	listValue := message.ProtoReflect().Mutable(listField).List()
-	if err := scanProtoRowsToList(rows, listValue); err != nil {
+	if err := scanProtoRowsToList(table, rows, listValue); err != nil {
 		return fmt.Errorf("table %s: %w", table.tableName, err)
 	}
 	return nil
 }
 
-// FindAllByWhereClause 按条件查询批量数据（whereClause为纯条件，无需带WHERE；空串查全表）
+// FindAllByWhereClause 按条件查询批量数据（whereClause为纯条件，无需带WHERE，带上也会被去掉；空串查全表）
 func (p *DB) FindAllByWhereClause(message proto.Message, whereClause string) error {
 	return p.FindAllByWhereWithArgs(message, normalizeWhereClause(whereClause), nil)
 }
 
-// FindMultiByWhereWithArgs 与FindAllByWhereWithArgs等价，保留以兼容旧接口
-func (p *DB) FindMultiByWhereWithArgs(list proto.Message, whereClause string, args []interface{}) error {
-	return p.FindAllByWhereWithArgs(list, whereClause, args)
+// FindMultiByWhereWithArgs 与FindAllByWhereWithArgs等价，保留以兼容旧接口
+func (p *DB) FindMultiByWhereWithArgs(list proto.Message, whereClause string, args []interface{}) error {
+	return p.FindAllByWhereWithArgs(list, whereClause, args)
+}
+
+// FindInto 按条件查询多行并追加到dest指向的切片，dest须为*[]*T（*T为已注册的proto消息，如*[]*pb.Player），
+// 表按元素类型解析，无需为查询列表单独定义只含一个repeated字段的列表消息。
+// where为纯条件（可带WHERE前缀，空串查全表），dest原有元素保留。
+//
+//	var players []*pb.Player
+//	err := pbDB.FindInto(&players, "level > ?", 10)
+func (p *DB) FindInto(dest interface{}, where string, args ...interface{}) error {
+	slicePtr := reflect.ValueOf(dest)
+	if slicePtr.Kind() != reflect.Pointer || slicePtr.IsNil() || slicePtr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("FindInto dest must be a non-nil pointer to a slice of proto messages, got %T", dest)
+	}
+	slice := slicePtr.Elem()
+	elemType := slice.Type().Elem()
+	if elemType.Kind() != reflect.Pointer || !elemType.Implements(reflect.TypeFor[proto.Message]()) {
+		return fmt.Errorf("FindInto dest element must be a proto message pointer, got %s", elemType)
+	}
+	if elemType == reflect.TypeFor[*dynamicpb.Message]() {
+		return errors.New("FindInto cannot create dynamicpb messages without a descriptor, use a list message instead")
+	}
+	sample := reflect.New(elemType.Elem()).Interface().(proto.Message)
+	table, err := p.tableForMessage(sample)
+	if err != nil {
+		return err
+	}
+
+	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(normalizeWhereClause(where), args)
+	rows, release, err := p.conn().Query(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	if err != nil {
+		return fmt.Errorf("exec select all for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	for rows.Next() {
+		row, err := scanRowBytes(rows)
+		if err != nil {
+			return fmt.Errorf("table %s: %w", table.tableName, err)
+		}
+		elem := reflect.New(elemType.Elem())
+		if err := table.parseRow(elem.Interface().(proto.Message), row); err != nil {
+			return fmt.Errorf("table %s: %w", table.tableName, err)
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("table %s: %w", table.tableName, err)
+	}
+	return nil
+}
+
+// BatchDeleteByKeys 按单个字段的IN条件批量删除（DELETE ... WHERE keyColumn IN (?,?,...)），
+// values超过批量上限（SetBatchSize）时自动分批，返回各批影响行数之和；values为空时不执行SQL直接返回0。
+// keyColumn为单列主键时同时失效这些主键的缓存。
+//
+//	n, err := pbDB.BatchDeleteByKeys(&pb.Mail{}, "id", []interface{}{1, 2, 3})
+func (p *DB) BatchDeleteByKeys(message proto.Message, keyColumn string, values []interface{}) (int64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := table.fieldNameToDesc[keyColumn]; !ok {
+		return 0, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, keyColumn, table.tableName)
+	}
+
+	var total int64
+	batchSize := p.batchLimit()
+	for i := 0; i < len(values); i += batchSize {
+		end := min(i+batchSize, len(values))
+		batch := values[i:end]
+		where := fmt.Sprintf("%s IN (%s)", table.quotedColumn(keyColumn), buildPlaceholders(len(batch)))
+		affected, err := p.deleteMany(message, where, batch)
+		total += affected
+		if err != nil {
+			return total, err
+		}
+		if len(table.primaryKey) == 1 && table.primaryKey[0] == keyColumn {
+			p.invalidatePrimaryKeys(table, batch)
+		}
+	}
+	return total, nil
 }
 
 // FindMultiByKV 按单个字段等值条件查询批量数据
 func (p *DB) FindMultiByKV(list proto.Message, key string, value interface{}) error {
-	return p.FindAllByWhereWithArgs(list, escapeMySQLName(key)+" = ?", []interface{}{value})
+	return p.FindAllByWhereWithArgs(list, p.columnOf(list, key)+" = ?", []interface{}{value})
 }
 
 // FindAllByKVIn 按单个字段的IN条件查询批量数据（WHERE key IN (...)）
 func (p *DB) FindAllByKVIn(list proto.Message, key string, values []interface{}) error {
 	if len(values) == 0 {
-		_, listField, err := resolveListTable(p.Tables, list)
+		_, listField, err := p.listTable(list)
 		if err != nil {
 			return err
 		}
@@ -1757,10 +3997,72 @@ func (p *DB) FindAllByKVIn(list proto.Message, key string, values []interface{})
 		return nil
 	}
 
-	where := fmt.Sprintf("%s IN (%s)", escapeMySQLName(key), buildPlaceholders(len(values)))
+	where := fmt.Sprintf("%s IN (%s)", p.columnOf(list, key), buildPlaceholders(len(values)))
 	return p.FindAllByWhereWithArgs(list, where, values)
 }
 
+// FindManyByCompositeKeys 按多列组合键批量查询（WHERE (a, b) IN ((?, ?), (?, ?), ...)），结果填入list。
+// tuples每项按columns顺序给出一组键值；组数超过批量上限（SetBatchSize）或占位符上限时自动分批查询并合并结果，
+// tuples为空时清空list且不下发SQL。
+//
+//	err := pbDB.FindManyByCompositeKeys(list, []string{"player_id", "item_id"}, [][]interface{}{{1, 100}, {1, 101}})
+func (p *DB) FindManyByCompositeKeys(list proto.Message, columns []string, tuples [][]interface{}) error {
+	table, listField, err := p.listTable(list)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("composite key of table %s has no columns", table.tableName)
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		if _, ok := table.fieldNameToDesc[column]; !ok {
+			return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, column, table.tableName)
+		}
+		quoted[i] = table.quotedColumn(column)
+	}
+	for i, tuple := range tuples {
+		if len(tuple) != len(columns) {
+			return fmt.Errorf("composite key tuple %d of table %s has %d values, expected %d",
+				i, table.tableName, len(tuple), len(columns))
+		}
+	}
+
+	listValue := list.ProtoReflect().Mutable(listField).List()
+	listValue.Truncate(0)
+	tuplePlaceholder := "(" + buildPlaceholders(len(columns)) + ")"
+	batchSize := max(min(p.batchLimit(), table.placeholderLimit()/len(columns)), 1)
+	for i := 0; i < len(tuples); i += batchSize {
+		batch := tuples[i:min(i+batchSize, len(tuples))]
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*len(columns))
+		for j, tuple := range batch {
+			placeholders[j] = tuplePlaceholder
+			args = append(args, tuple...)
+		}
+		where := fmt.Sprintf("(%s) IN (%s)", strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+		if err := p.appendRowsByWhere(table, listValue, where, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendRowsByWhere 按条件查询并把结果追加到listValue
+func (p *DB) appendRowsByWhere(table *MessageTable, listValue protoreflect.List, whereClause string, whereArgs []interface{}) error {
+	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(whereClause, whereArgs)
+	rows, release, err := p.conn().Query(sqlWithArgs.Sql, sqlWithArgs.Args...)
+	if err != nil {
+		return fmt.Errorf("exec select all for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	if err := appendProtoRowsToList(table, rows, listValue); err != nil {
+		return fmt.Errorf("table %s: %w", table.tableName, err)
+	}
+	return nil
+}
+
 // FindMultiByWhereClause 与FindAllByWhereClause等价，保留以兼容旧接口
 func (p *DB) FindMultiByWhereClause(message proto.Message, whereClause string) error {
 	return p.FindAllByWhereClause(message, whereClause)
@@ -1793,20 +4095,21 @@ func (o QueryOptions) sqlSuffix() string {
 
 // FindAllWithOptions 按条件查询批量数据，支持ORDER BY / LIMIT / OFFSET
 func (p *DB) FindAllWithOptions(list proto.Message, whereClause string, whereArgs []interface{}, opts QueryOptions) error {
-	table, listField, err := resolveListTable(p.Tables, list)
+	table, listField, err := p.listTable(list)
 	if err != nil {
 		return err
 	}
 
-	sqlStmt := fmt.Sprintf("%s WHERE %s%s;", table.selectFieldsSQL, normalizeWhereClause(whereClause), opts.sqlSuffix())
-	rows, err := p.conn().Query(sqlStmt, whereArgs...)
+	whereClause, whereArgs = table.scopeWhere(normalizeWhereClause(whereClause), whereArgs)
+	sqlStmt := fmt.Sprintf("%s WHERE %s%s;", table.selectFieldsSQL, whereClause, opts.sqlSuffix())
+	rows, release, err := p.conn().Query(sqlStmt, whereArgs...)
 	if err != nil {
 		return fmt.Errorf("exec select for table %s: %w", table.tableName, err)
 	}
-	defer rows.Close()
+	defer release()
 
 	listValue := list.ProtoReflect().Mutable(listField).List()
-	if err := scanProtoRowsToList(rows, listValue); err != nil {
+	if err := scanProtoRowsToList(table, rows, listValue); err != nil {
 		return fmt.Errorf("table %s: %w", table.tableName, err)
 	}
 	return nil
@@ -1823,6 +4126,56 @@ func (p *DB) FindPage(list proto.Message, whereClause string, whereArgs []interf
 	})
 }
 
+// FindRandom 按条件随机取至多n行（ORDER BY RAND() LIMIT n），用于压测取样、抽查数据。
+// MySQL需为每个匹配行生成随机数并整体排序，代价与匹配行数成正比，大表请用whereClause缩小范围
+// （如按主键区间 id BETWEEN ? AND ?），不要在线上热路径对全表调用。whereClause中不要再写ORDER BY/LIMIT。
+func (p *DB) FindRandom(list proto.Message, n int, whereClause string, whereArgs []interface{}) error {
+	if n < 1 {
+		return fmt.Errorf("invalid random sample size: %d", n)
+	}
+	return p.FindAllWithOptions(list, whereClause, whereArgs, QueryOptions{OrderBy: "RAND()", Limit: n})
+}
+
+// FindPageWithTotal 分页查询并返回满足条件的总行数，供分页UI一次取到当前页与总数。
+// 在同一事务内先 SELECT COUNT(*) 再 SELECT ... LIMIT/OFFSET（已在事务中时直接复用），
+// InnoDB默认的REPEATABLE READ下两者读同一快照，总数与页数据一致。
+// 未使用 SQL_CALC_FOUND_ROWS/FOUND_ROWS()：MySQL 8.0.17起已废弃，且通常比单独COUNT(*)更慢。
+// 需要稳定排序时把 ORDER BY 写在where末尾（不影响COUNT结果）。
+func (p *DB) FindPageWithTotal(list proto.Message, where string, args []interface{}, limit, offset int) (total int64, err error) {
+	if limit < 1 || offset < 0 {
+		return 0, fmt.Errorf("invalid page params: limit=%d, offset=%d", limit, offset)
+	}
+	if p.tx != nil {
+		return p.findPageWithTotal(list, where, args, limit, offset)
+	}
+	err = p.RunInTransaction(func(tx *DB) error {
+		total, err = tx.findPageWithTotal(list, where, args, limit, offset)
+		return err
+	})
+	return total, err
+}
+
+// findPageWithTotal 在当前连接/事务内依次统计总数与查询当前页，总数不超过offset时不再查询页数据
+func (p *DB) findPageWithTotal(list proto.Message, where string, args []interface{}, limit, offset int) (int64, error) {
+	total, err := p.CountByWhereWithArgs(list, where, args)
+	if err != nil {
+		return 0, err
+	}
+	if total <= int64(offset) {
+		// 没有当前页：清空列表，复用的list不能留着上一页的行
+		_, listField, err := p.listTable(list)
+		if err != nil {
+			return 0, err
+		}
+		list.ProtoReflect().Mutable(listField).List().Truncate(0)
+		return total, nil
+	}
+	if err := p.FindAllWithOptions(list, where, args, QueryOptions{Limit: limit, Offset: offset}); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 // FindOneWithOptions 按条件+排序取一条数据（如排行第一名、最新一条记录）。
 // 自动追加LIMIT 1，多行匹配时取排序后的第一条
 func (p *DB) FindOneWithOptions(message proto.Message, whereClause string, whereArgs []interface{}, opts QueryOptions) error {
@@ -1833,19 +4186,44 @@ func (p *DB) FindOneWithOptions(message proto.Message, whereClause string, where
 
 	opts.Limit = 1
 	opts.Offset = 0
-	sqlStmt := fmt.Sprintf("%s WHERE %s%s;", table.selectFieldsSQL, normalizeWhereClause(whereClause), opts.sqlSuffix())
-	rows, err := p.conn().Query(sqlStmt, whereArgs...)
+	whereClause, whereArgs = table.scopeWhere(normalizeWhereClause(whereClause), whereArgs)
+	sqlStmt := fmt.Sprintf("%s WHERE %s%s;", table.selectFieldsSQL, whereClause, opts.sqlSuffix())
+	rows, release, err := p.conn().Query(sqlStmt, whereArgs...)
 	if err != nil {
 		return fmt.Errorf("exec select one for table %s: %w", table.tableName, err)
 	}
-	defer rows.Close()
+	defer release()
 
-	if err := scanOneProtoRow(rows, message); err != nil {
+	if err := scanOneProtoRow(table, rows, message); err != nil {
 		return fmt.Errorf("table %s: %w", table.tableName, err)
 	}
 	return nil
 }
 
+// FindFirst 按orderColumn升序取满足条件的第一条（ORDER BY orderColumn ASC LIMIT 1），如最早的一条记录；
+// orderColumn须为表的字段，无匹配行时返回ErrNoRowsFound
+func (p *DB) FindFirst(message proto.Message, orderColumn string, whereClause string, args []interface{}) error {
+	return p.findByOrder(message, orderColumn, "ASC", whereClause, args)
+}
+
+// FindLast 按orderColumn降序取满足条件的第一条（ORDER BY orderColumn DESC LIMIT 1），如最近的一条记录；
+// orderColumn须为表的字段，无匹配行时返回ErrNoRowsFound
+func (p *DB) FindLast(message proto.Message, orderColumn string, whereClause string, args []interface{}) error {
+	return p.findByOrder(message, orderColumn, "DESC", whereClause, args)
+}
+
+// findByOrder 校验排序字段后按direction排序取一条
+func (p *DB) findByOrder(message proto.Message, orderColumn, direction, whereClause string, args []interface{}) error {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return err
+	}
+	if _, ok := table.fieldNameToDesc[orderColumn]; !ok {
+		return fmt.Errorf("%w: order column %s in table %s", ErrFieldNotFound, orderColumn, table.tableName)
+	}
+	return p.FindOneWithOptions(message, whereClause, args, QueryOptions{OrderBy: table.quotedColumn(orderColumn) + " " + direction})
+}
+
 // FindPageByCursor 游标分页（keyset pagination）：按cursorField升序返回cursorVal之后的pageSize条，
 // 深分页时性能远好于OFFSET，适合流水/邮件列表。首页传cursorVal=nil，
 // 下一页传上一页最后一条的cursorField值。cursorField应有索引且唯一（如自增id）。
@@ -1853,7 +4231,7 @@ func (p *DB) FindPageByCursor(list proto.Message, whereClause string, whereArgs
 	if pageSize < 1 {
 		return fmt.Errorf("invalid pageSize: %d", pageSize)
 	}
-	table, _, err := resolveListTable(p.Tables, list)
+	table, _, err := p.listTable(list)
 	if err != nil {
 		return err
 	}
@@ -1864,16 +4242,98 @@ func (p *DB) FindPageByCursor(list proto.Message, whereClause string, whereArgs
 	where := normalizeWhereClause(whereClause)
 	args := append([]interface{}{}, whereArgs...)
 	if cursorVal != nil {
-		where = fmt.Sprintf("(%s) AND %s > ?", where, escapeMySQLName(cursorField))
+		where = fmt.Sprintf("(%s) AND %s > ?", where, table.quotedColumn(cursorField))
 		args = append(args, cursorVal)
 	}
 
 	return p.FindAllWithOptions(list, where, args, QueryOptions{
-		OrderBy: escapeMySQLName(cursorField) + " ASC",
+		OrderBy: table.quotedColumn(cursorField) + " ASC",
 		Limit:   pageSize,
 	})
 }
 
+// FindAfter 键集分页（keyset pagination）的简化形式：返回orderColumn > afterValue的前limit行，
+// 按orderColumn升序追加到list。首页传afterValue=nil，之后传上一页最后一行的orderColumn值；
+// 适合无限滚动等深分页场景。需要额外条件时用FindPageByCursor。
+//
+//	err := pbDB.FindAfter(list, "id", lastID, 50)
+func (p *DB) FindAfter(list proto.Message, orderColumn string, afterValue interface{}, limit int) error {
+	return p.FindPageByCursor(list, "", nil, orderColumn, afterValue, limit)
+}
+
+// FindBetween 按时间范围查询：column BETWEEN from AND to（闭区间，两端都包含），结果追加到list。
+// column须为google.protobuf.Timestamp字段；边界按写入时相同的格式绑定为参数
+// （DATETIME列用pbconv.DateTimeLayout的UTC时间，WithTimestampAsEpoch列用Unix秒）。
+// 需要半开区间 [from, to) 时请用FindAllByWhereWithArgs自行拼条件。
+func (p *DB) FindBetween(list proto.Message, column string, from, to time.Time) error {
+	table, _, err := p.listTable(list)
+	if err != nil {
+		return err
+	}
+	field, ok := table.fieldNameToDesc[column]
+	if !ok {
+		return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, column, table.tableName)
+	}
+	if field.IsList() || field.Message() == nil || field.Message().FullName() != timestampFullName {
+		return fmt.Errorf("column %s in table %s is not a google.protobuf.Timestamp field", column, table.tableName)
+	}
+	if from.After(to) {
+		return fmt.Errorf("invalid time range for %s: from %v is after to %v", column, from, to)
+	}
+
+	var args []interface{}
+	if table.isEpochTimestampField(column) {
+		args = []interface{}{from.Unix(), to.Unix()}
+	} else {
+		layout := pbconv.DateTimeLayout()
+		args = []interface{}{from.UTC().Format(layout), to.UTC().Format(layout)}
+	}
+	return p.FindAllByWhereWithArgs(list, table.quotedColumn(column)+" BETWEEN ? AND ?", args)
+}
+
+// FindDescendants 查询以parentColumn指向idColumn构成的树（组织架构、评论楼层等）中rootID的全部后代（不含rootID自身），
+// 结果填入list。用MySQL 8.0+的递归CTE（WITH RECURSIVE）实现，需MySQL 8.0及以上；
+// maxDepth限制层数（1为直接子节点），<=0不限层数（仍受cte_max_recursion_depth约束，默认1000层）。
+// 数据中存在环时请务必限制maxDepth。
+//
+//	err := pbDB.FindDescendants(deptList, "id", "parent_id", rootID, 0)
+func (p *DB) FindDescendants(list proto.Message, idColumn, parentColumn string, rootID interface{}, maxDepth int) error {
+	table, listField, err := p.listTable(list)
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{idColumn, parentColumn} {
+		if _, ok := table.fieldNameToDesc[column]; !ok {
+			return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, column, table.tableName)
+		}
+	}
+
+	id, parent := table.quotedColumn(idColumn), table.quotedColumn(parentColumn)
+	cteArgs := []interface{}{rootID}
+	depthLimit := ""
+	if maxDepth > 0 {
+		depthLimit = " WHERE d.`depth` < ?"
+		cteArgs = append(cteArgs, maxDepth)
+	}
+	cte := fmt.Sprintf("WITH RECURSIVE `descendants` (`node_id`, `depth`) AS ("+
+		"SELECT %[1]s, 1 FROM %[3]s WHERE %[2]s = ? "+
+		"UNION ALL SELECT c.%[1]s, d.`depth` + 1 FROM %[3]s AS c JOIN `descendants` AS d ON c.%[2]s = d.`node_id`%[4]s) ",
+		id, parent, table.sqlName(), depthLimit)
+	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(id+" IN (SELECT `node_id` FROM `descendants`)", nil)
+
+	rows, release, err := p.conn().Query(cte+sqlWithArgs.Sql, append(cteArgs, sqlWithArgs.Args...)...)
+	if err != nil {
+		return fmt.Errorf("exec select descendants for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	listValue := list.ProtoReflect().Mutable(listField).List()
+	if err := scanProtoRowsToList(table, rows, listValue); err != nil {
+		return fmt.Errorf("table %s: %w", table.tableName, err)
+	}
+	return nil
+}
+
 // Count 统计全表行数（message可为行消息或列表消息）
 func (p *DB) Count(message proto.Message) (int64, error) {
 	return p.CountByWhereWithArgs(message, "", nil)
@@ -1881,31 +4341,150 @@ func (p *DB) Count(message proto.Message) (int64, error) {
 
 // CountByWhereWithArgs 按条件统计行数（SELECT COUNT(*)），message可为行消息或列表消息
 func (p *DB) CountByWhereWithArgs(message proto.Message, whereClause string, whereArgs []interface{}) (int64, error) {
-	table, err := resolveAnyTable(p.Tables, message)
+	table, err := p.anyTable(message)
 	if err != nil {
 		return 0, err
 	}
 
-	sqlStmt := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s;",
-		escapeMySQLName(table.tableName), normalizeWhereClause(whereClause))
+	whereClause, whereArgs = table.scopeWhere(normalizeWhereClause(whereClause), whereArgs)
+	sqlStmt := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s;", table.sqlName(), whereClause)
 	var count int64
-	if err := p.conn().QueryRow(sqlStmt, whereArgs...).Scan(&count); err != nil {
+	if err := p.conn().QueryRowScan(sqlStmt, whereArgs, &count); err != nil {
 		return 0, fmt.Errorf("count table %s: %w", table.tableName, err)
 	}
 	return count, nil
 }
 
+// SumColumn 按条件对数值列求和（SELECT SUM(col)），无匹配行时返回0
+func (p *DB) SumColumn(message proto.Message, column, whereClause string, args []interface{}) (float64, error) {
+	return p.aggregateColumn("SUM", message, column, whereClause, args)
+}
+
+// AvgColumn 按条件求数值列平均值（SELECT AVG(col)），无匹配行时返回0
+func (p *DB) AvgColumn(message proto.Message, column, whereClause string, args []interface{}) (float64, error) {
+	return p.aggregateColumn("AVG", message, column, whereClause, args)
+}
+
+// MaxColumn 按条件求数值列最大值（SELECT MAX(col)），无匹配行时返回0
+func (p *DB) MaxColumn(message proto.Message, column, whereClause string, args []interface{}) (float64, error) {
+	return p.aggregateColumn("MAX", message, column, whereClause, args)
+}
+
+// MinColumn 按条件求数值列最小值（SELECT MIN(col)），无匹配行时返回0
+func (p *DB) MinColumn(message proto.Message, column, whereClause string, args []interface{}) (float64, error) {
+	return p.aggregateColumn("MIN", message, column, whereClause, args)
+}
+
+// aggregateColumn 执行单列聚合（fn为SUM/AVG/MAX/MIN），message可为行消息或列表消息。
+// 列必须是数值类型的非repeated字段；结果为NULL（无匹配行）时返回0。
+func (p *DB) aggregateColumn(fn string, message proto.Message, column, whereClause string, args []interface{}) (float64, error) {
+	table, err := p.anyTable(message)
+	if err != nil {
+		return 0, err
+	}
+	field, ok := table.fieldNameToDesc[column]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, column, table.tableName)
+	}
+	if !isNumericField(field) {
+		return 0, fmt.Errorf("column %s in table %s is not numeric (%s)", column, table.tableName, field.Kind())
+	}
+
+	whereClause, args = table.scopeWhere(normalizeWhereClause(whereClause), args)
+	sqlStmt := fmt.Sprintf("SELECT %s(%s) FROM %s WHERE %s;",
+		fn, table.quotedColumn(column), table.sqlName(), whereClause)
+	var result sql.NullFloat64
+	if err := p.conn().QueryRowScan(sqlStmt, args, &result); err != nil {
+		return 0, fmt.Errorf("%s %s for table %s: %w", strings.ToLower(fn), column, table.tableName, err)
+	}
+	return result.Float64, nil
+}
+
+// FindAggregate 一条查询计算多个聚合值并写入message（如统计面板）：selectExprs为proto字段名→SQL表达式，
+// 生成 SELECT expr AS `field`, ... FROM 表 WHERE ...，按结果列名解析唯一的一行。message须是已注册表的行消息，
+// 未出现在selectExprs中的字段保持不变；表达式结果为NULL（如无匹配行时的MAX）时字段置零值。
+// 表达式原样拼入SQL，不要拼接外部输入，值请用?占位符放在whereClause中；结果须能按字段类型解析
+// （整数字段上的AVG请用 CAST(AVG(x) AS SIGNED) 等）。
+//
+//	err := pbDB.FindAggregate(stats, map[string]string{"id": "COUNT(*)", "player_id": "MAX(`player_id`)"}, "port > ?", []interface{}{0})
+func (p *DB) FindAggregate(message proto.Message, selectExprs map[string]string, whereClause string, args []interface{}) error {
+	table, err := p.tableForMessage(message)
+	if err != nil {
+		return err
+	}
+	if len(selectExprs) == 0 {
+		return fmt.Errorf("no select expressions for table %s", table.tableName)
+	}
+
+	fields := slices.Sorted(maps.Keys(selectExprs))
+	selects := make([]string, len(fields))
+	for i, field := range fields {
+		if _, ok := table.fieldNameToDesc[field]; !ok {
+			return fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, field, table.tableName)
+		}
+		if strings.TrimSpace(selectExprs[field]) == "" {
+			return fmt.Errorf("empty select expression for field %s in table %s", field, table.tableName)
+		}
+		selects[i] = fmt.Sprintf("%s AS %s", selectExprs[field], escapeMySQLName(field))
+	}
+
+	whereClause, args = table.scopeWhere(normalizeWhereClause(whereClause), args)
+	sqlStmt := fmt.Sprintf("SELECT %s FROM %s WHERE %s;", strings.Join(selects, ", "), table.sqlName(), whereClause)
+	rows, release, err := p.conn().Query(sqlStmt, args...)
+	if err != nil {
+		return fmt.Errorf("exec aggregate for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("aggregate for table %s: %w", table.tableName, err)
+		}
+		return fmt.Errorf("aggregate for table %s: %w", table.tableName, ErrNoRowsFound)
+	}
+	row, err := scanRowStrings(rows)
+	if err != nil {
+		return fmt.Errorf("scan aggregate for table %s: %w", table.tableName, err)
+	}
+	if rows.Next() {
+		return fmt.Errorf("aggregate for table %s: %w", table.tableName, ErrMultipleRowsFound)
+	}
+	if err := table.decryptNamedRow(fields, row); err != nil {
+		return fmt.Errorf("aggregate for table %s: %w", table.tableName, err)
+	}
+	if err := pbconv.ParseFromStringByNameWithOptions(message, fields, row, table.fieldOptions); err != nil {
+		return fmt.Errorf("parse aggregate for table %s: %w", table.tableName, err)
+	}
+	return rows.Err()
+}
+
+// isNumericField 判断字段是否为可参与SUM/AVG等聚合的数值标量
+func isNumericField(field protoreflect.FieldDescriptor) bool {
+	if field.IsList() || field.IsMap() {
+		return false
+	}
+	switch field.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return true
+	}
+	return false
+}
+
 // Exists 判断是否存在满足条件的行（SELECT 1 ... LIMIT 1），message可为行消息或列表消息
 func (p *DB) Exists(message proto.Message, whereClause string, whereArgs []interface{}) (bool, error) {
-	table, err := resolveAnyTable(p.Tables, message)
+	table, err := p.anyTable(message)
 	if err != nil {
 		return false, err
 	}
 
-	sqlStmt := fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1;",
-		escapeMySQLName(table.tableName), normalizeWhereClause(whereClause))
+	whereClause, whereArgs = table.scopeWhere(normalizeWhereClause(whereClause), whereArgs)
+	sqlStmt := fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1;", table.sqlName(), whereClause)
 	var one int
-	err = p.conn().QueryRow(sqlStmt, whereArgs...).Scan(&one)
+	err = p.conn().QueryRowScan(sqlStmt, whereArgs, &one)
 	if errors.Is(err, sql.ErrNoRows) {
 		return false, nil
 	}
@@ -1928,6 +4507,97 @@ func (p *DB) ExistsByPK(message proto.Message) (bool, error) {
 	return p.Exists(message, whereClause, whereArgs)
 }
 
+// QueryIntoList 原生SQL逃生口：原样执行rawSQL（JOIN/聚合等辅助方法覆盖不到的查询），
+// 按结果列名映射到list唯一repeated字段的元素类型，每行追加一个元素（不清空已有元素）。
+// 元素类型中不存在的列被忽略；元素类型无需注册为表。rawSQL中的值请用?占位符传args，不要拼接。
+func (p *DB) QueryIntoList(list proto.Message, rawSQL string, args ...interface{}) error {
+	listField, err := getSingleRepeatedField(list)
+	if err != nil {
+		return err
+	}
+
+	rows, release, err := p.conn().Query(rawSQL, args...)
+	if err != nil {
+		return fmt.Errorf("exec raw query: %w", err)
+	}
+	defer release()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	// 元素类型已注册时按表配置解析：WithColumnMapping的库列名映射回字段名，WithTimestampAsEpoch按Unix秒解析，
+	// WithEncryptedColumn的列先解密
+	var optionsFor func(protoreflect.FieldDescriptor) pbconv.FieldOptions
+	table, _, err := p.listTable(list)
+	if err == nil {
+		for i, col := range columns {
+			columns[i] = table.fieldNameForColumn(col)
+		}
+		optionsFor = table.fieldOptions
+	}
+	listValue := list.ProtoReflect().Mutable(listField).List()
+	for rows.Next() {
+		row, err := scanRowStrings(rows)
+		if err != nil {
+			return err
+		}
+		if table != nil {
+			if err := table.decryptNamedRow(columns, row); err != nil {
+				return err
+			}
+		}
+		element := listValue.NewElement()
+		if err := pbconv.ParseFromStringByNameWithOptions(element.Message().Interface(), columns, row, optionsFor); err != nil {
+			return err
+		}
+		if table != nil {
+			if err := table.runRowHooks(element.Message().Interface()); err != nil {
+				return err
+			}
+		}
+		listValue.Append(element)
+	}
+	return rows.Err()
+}
+
+// ExplainWhere 对按条件查询的SELECT执行EXPLAIN，返回执行计划的每一行（列名→值，NULL为空串），
+// 用于诊断慢查询。message可为行消息或列表消息，生成的SELECT与FindAllByWhereWithArgs一致。
+func (p *DB) ExplainWhere(message proto.Message, whereClause string, whereArgs []interface{}) ([]map[string]string, error) {
+	table, err := p.anyTable(message)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlWithArgs := table.GetSelectSQLByWhereWithArgs(normalizeWhereClause(whereClause), whereArgs)
+	rows, release, err := p.conn().Query("EXPLAIN "+sqlWithArgs.Sql, sqlWithArgs.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("exec explain for table %s: %w", table.tableName, err)
+	}
+	defer release()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var plan []map[string]string
+	for rows.Next() {
+		values, err := scanRowStrings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan explain for table %s: %w", table.tableName, err)
+		}
+		row := make(map[string]string, len(columns))
+		for i, col := range columns {
+			row[col] = values[i]
+		}
+		plan = append(plan, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("explain rows for table %s: %w", table.tableName, err)
+	}
+	return plan, nil
+}
+
 // Transaction 在事务中执行fn：fn返回错误时回滚，否则提交（需要原生*sql.Tx时使用，
 // 否则推荐RunInTransaction）
 func (p *DB) Transaction(fn func(tx *sql.Tx) error) error {
@@ -1947,10 +4617,40 @@ func (p *DB) Transaction(fn func(tx *sql.Tx) error) error {
 	return tx.Commit()
 }
 
+// IsNull 返回 `col` IS NULL 条件（无占位符），可直接作为whereClause或用AND与其他条件拼接：
+//
+//	where, err := pbDB.IsNull(&pb.UserList{}, "nickname")
+//	err = pbDB.FindAllByWhereWithArgs(list, where+" AND level > ?", []interface{}{10})
+//
+// message可为行消息或列表消息；column须为WithNullableFields声明的可空字段（col = ? 传nil匹配不到NULL）
+func (p *DB) IsNull(message proto.Message, column string) (string, error) {
+	return p.nullCondition(message, column, "IS NULL")
+}
+
+// IsNotNull 返回 `col` IS NOT NULL 条件，用法与校验同IsNull
+func (p *DB) IsNotNull(message proto.Message, column string) (string, error) {
+	return p.nullCondition(message, column, "IS NOT NULL")
+}
+
+// nullCondition 校验column为表中的可空字段后生成 `col` IS [NOT] NULL
+func (p *DB) nullCondition(message proto.Message, column, op string) (string, error) {
+	table, err := p.anyTable(message)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := table.fieldNameToDesc[column]; !ok {
+		return "", fmt.Errorf("%w: %s in table %s", ErrFieldNotFound, column, table.tableName)
+	}
+	if !table.isNullableField(column) {
+		return "", fmt.Errorf("column %s in table %s is not nullable (see WithNullableFields)", column, table.tableName)
+	}
+	return table.quotedColumn(column) + " " + op, nil
+}
+
 // tableForMessage 解析行消息对应的已注册表
 func (p *DB) tableForMessage(message proto.Message) (*MessageTable, error) {
 	tableName := GetTableName(message)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
@@ -1963,18 +4663,124 @@ func resolveAnyTable(tables map[string]*MessageTable, message proto.Message) (*M
 	if table, ok := tables[tableName]; ok {
 		return table, nil
 	}
-	if table, _, err := resolveListTable(tables, message); err == nil {
-		return table, nil
+	if table, _, err := resolveListTable(tables, message); err == nil {
+		return table, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+}
+
+// normalizeWhereClause 去掉调用方多写的WHERE前缀；空条件时返回恒真条件，兼容无条件查询
+func normalizeWhereClause(whereClause string) string {
+	whereClause = stripWherePrefix(whereClause)
+	if whereClause == "" {
+		return "1=1"
+	}
+	return whereClause
+}
+
+// stripWherePrefix 条件以WHERE关键字开头时（忽略大小写与首尾空白，如 " WHERE id=1"）去掉该关键字，
+// 避免拼出 WHERE WHERE；where_flag = 1 这类以where开头的列名不受影响
+func stripWherePrefix(whereClause string) string {
+	trimmed := strings.TrimSpace(whereClause)
+	const keyword = "WHERE"
+	if len(trimmed) < len(keyword) || !strings.EqualFold(trimmed[:len(keyword)], keyword) {
+		return whereClause
+	}
+	rest := trimmed[len(keyword):]
+	if rest != "" && isIdentByte(rest[0]) {
+		return whereClause
+	}
+	return strings.TrimSpace(rest)
+}
+
+// scopeWhere 把WithDefaultWhere的默认条件AND到whereClause上，默认条件的参数排在whereArgs之前：
+// (默认条件) AND (调用方条件) [调用方条件末尾的ORDER BY/LIMIT等子句]。未设置默认条件时原样返回
+func (m *MessageTable) scopeWhere(whereClause string, whereArgs []interface{}) (string, []interface{}) {
+	if strings.TrimSpace(m.defaultWhere) == "" {
+		return whereClause, whereArgs
+	}
+	args := make([]interface{}, 0, len(m.defaultWhereArgs)+len(whereArgs))
+	args = append(append(args, m.defaultWhereArgs...), whereArgs...)
+
+	cond, tail := splitWhereTail(stripWherePrefix(whereClause))
+	if cond = strings.TrimSpace(cond); cond == "" || cond == "1=1" {
+		return "(" + m.defaultWhere + ")" + tail, args
+	}
+	return "(" + m.defaultWhere + ") AND (" + cond + ")" + tail, args
+}
+
+// scopedPrimaryKeyWhere 带默认条件的主键条件（直接拼进SQL的按主键读写使用）
+func (m *MessageTable) scopedPrimaryKeyWhere(message proto.Message) (string, []interface{}, error) {
+	whereClause, whereArgs, err := m.primaryKeyWhere(message)
+	if err != nil {
+		return "", nil, err
+	}
+	whereClause, whereArgs = m.scopeWhere(whereClause, whereArgs)
+	return whereClause, whereArgs, nil
+}
+
+// whereTailKeywords 条件后可能跟随的子句关键字（不能被括进条件的括号里）
+var whereTailKeywords = []string{"GROUP BY", "HAVING", "ORDER BY", "LIMIT", "FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE"}
+
+// splitWhereTail 在最外层（括号与引号之外）第一个ORDER BY/LIMIT等子句处把whereClause拆成条件与尾部子句，
+// 如 "group_id = ? ORDER BY id" -> ("group_id = ? ", "ORDER BY id")，尾部保留前导空格
+func splitWhereTail(whereClause string) (string, string) {
+	if i := indexTopLevelKeyword(whereClause, whereTailKeywords); i >= 0 {
+		return whereClause[:i], " " + whereClause[i:]
+	}
+	return whereClause, ""
+}
+
+// whereLockKeywords 锁定读子句，LIMIT须写在它们之前
+var whereLockKeywords = []string{"FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE"}
+
+// limitWhere 给whereClause追加 LIMIT n：插在FOR UPDATE等锁定读子句之前，尾部已有LIMIT时原样返回
+func limitWhere(whereClause string, n int) string {
+	head, lock := whereClause, ""
+	if i := indexTopLevelKeyword(whereClause, whereLockKeywords); i >= 0 {
+		head, lock = whereClause[:i], " "+whereClause[i:]
+	}
+	if indexTopLevelKeyword(head, []string{"LIMIT"}) >= 0 {
+		return whereClause
 	}
-	return nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	return fmt.Sprintf("%s LIMIT %d%s", strings.TrimRight(head, " "), n, strings.TrimRight(lock, " "))
 }
 
-// normalizeWhereClause 空条件时返回恒真条件，兼容无条件查询
-func normalizeWhereClause(whereClause string) string {
-	if whereClause == "" {
-		return "1=1"
+// indexTopLevelKeyword 返回最外层（括号与引号之外）第一个keywords关键字（不区分大小写、整词匹配）的位置，没有时返回-1
+func indexTopLevelKeyword(clause string, keywords []string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(clause); i++ {
+		c := clause[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (i == 0 || !isIdentByte(clause[i-1])):
+			for _, keyword := range keywords {
+				end := i + len(keyword)
+				if end <= len(clause) && strings.EqualFold(clause[i:end], keyword) &&
+					(end == len(clause) || !isIdentByte(clause[end])) {
+					return i
+				}
+			}
+		}
 	}
-	return whereClause
+	return -1
+}
+
+// isIdentByte 判断是否为MySQL未转义标识符可用的ASCII字符
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
 }
 
 // resolveListTable 从包含单个repeated字段的列表消息中解析出已注册的表和该字段
@@ -1992,18 +4798,22 @@ func resolveListTable(tables map[string]*MessageTable, list proto.Message) (*Mes
 	return table, listField, nil
 }
 
-// scanProtoRowsToList 把结果集逐行反序列化并追加到repeated字段（先清空旧数据）
-func scanProtoRowsToList(rows *sql.Rows, listValue protoreflect.List) error {
+// scanProtoRowsToList 把结果集逐行按table的列反序列化并追加到repeated字段（先清空旧数据）
+func scanProtoRowsToList(table *MessageTable, rows *sql.Rows, listValue protoreflect.List) error {
 	listValue.Truncate(0)
+	return appendProtoRowsToList(table, rows, listValue)
+}
 
+// appendProtoRowsToList 逐行解析结果集并追加到listValue（不清空已有元素），用于分批查询合并结果
+func appendProtoRowsToList(table *MessageTable, rows *sql.Rows, listValue protoreflect.List) error {
 	for rows.Next() {
-		row, err := scanRowStrings(rows)
+		row, err := scanRowBytes(rows)
 		if err != nil {
 			return err
 		}
 
 		element := listValue.NewElement()
-		if err := pbconv.ParseFromString(element.Message().Interface(), row); err != nil {
+		if err := table.parseRow(element.Message().Interface(), row); err != nil {
 			return err
 		}
 		listValue.Append(element)
@@ -2011,6 +4821,7 @@ func scanProtoRowsToList(rows *sql.Rows, listValue protoreflect.List) error {
 	return rows.Err()
 }
 
+// getSingleRepeatedField 返回列表消息唯一的repeated字段，且元素须为消息类型
 func getSingleRepeatedField(list proto.Message) (protoreflect.FieldDescriptor, error) {
 	if list == nil {
 		return nil, errors.New("list message cannot be nil")
@@ -2034,8 +4845,10 @@ func getSingleRepeatedField(list proto.Message) (protoreflect.FieldDescriptor, e
 		return nil, ErrNoRepeatedField
 	}
 
+	// repeated int64/string 等标量列表无法映射为表行，Message()为nil
 	if repeatedField.Message() == nil {
-		return nil, fmt.Errorf("repeated field %s is not a message type", repeatedField.Name())
+		return nil, fmt.Errorf("%w: %s.%s is repeated %s",
+			ErrRepeatedNotMessage, list.ProtoReflect().Descriptor().FullName(), repeatedField.Name(), repeatedField.Kind())
 	}
 
 	return repeatedField, nil
@@ -2060,34 +4873,78 @@ type MultiQuery struct {
 
 // FindMultiByWhereClauses 一次查询多张无关表，每张表返回一条结果（依赖MultiStatements）
 func (p *DB) FindMultiByWhereClauses(queries []MultiQuery) error {
+	rows, release, tables, err := p.queryMulti(queries)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// 依次处理每个结果集（与queries顺序一致）
+	for idx, q := range queries {
+		if err := scanOneProtoRow(tables[idx], rows, q.Message); err != nil {
+			return fmt.Errorf("%w: %s", err, GetTableName(q.Message))
+		}
+		if idx < len(queries)-1 && !rows.NextResultSet() {
+			return fmt.Errorf("missing result set for table %s", GetTableName(queries[idx+1].Message))
+		}
+	}
+	return nil
+}
+
+// FindMultiSequential 与FindMultiByWhereClauses相同（每条查询取一条结果填入对应Message），但在同一事务内
+// 逐条执行，不拼多语句SQL，DSN无需开启multiStatements；代价是每条查询一次往返。
+// 每条查询的错误语义同FindOneByWhereWithArgs：无结果返回ErrNoRowsFound，多行返回ErrMultipleRowsFound，
+// 出错时停止并在错误中带上出错查询的下标，此前的Message已填充、出错的Message保持不变。已在RunInTransaction内调用时复用该事务。
+func (p *DB) FindMultiSequential(queries []MultiQuery) error {
 	if len(queries) == 0 {
 		return errors.New("no queries provided")
 	}
-
-	// 收集每张表的查询SQL（分号分隔）与参数
-	sqlParts := make([]string, 0, len(queries))
-	var allArgs []interface{}
 	for _, q := range queries {
-		tableName := GetTableName(q.Message)
-		table, ok := p.Tables[tableName]
-		if !ok {
-			return fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		if _, err := p.tableForMessage(q.Message); err != nil {
+			return err
 		}
-		sqlParts = append(sqlParts, table.GetSelectSQL(false)+" WHERE "+q.WhereClause)
-		allArgs = append(allArgs, q.WhereArgs...)
 	}
 
-	sqlStmt := strings.Join(sqlParts, "; ")
-	rows, err := p.DB.QueryContext(p.context(), sqlStmt, allArgs...)
+	findAll := func(db *DB) error {
+		for i, q := range queries {
+			if err := db.FindOneByWhereWithArgs(q.Message, q.WhereClause, q.WhereArgs); err != nil {
+				return fmt.Errorf("query %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	if p.tx != nil {
+		return findAll(p)
+	}
+	return p.RunInTransaction(findAll)
+}
+
+// StreamMultiByWhereClauses 一次查询多张表并逐行回调（依赖MultiStatements）：
+// 每个结果集可以有任意多行，每行解析到一个与queries[idx].Message同类型的新实例后调用fn(idx, row)。
+// fn返回错误时立即停止并返回该错误。适合报表等多表大结果集的流式读取。
+func (p *DB) StreamMultiByWhereClauses(queries []MultiQuery, fn func(idx int, row proto.Message) error) error {
+	rows, release, tables, err := p.queryMulti(queries)
 	if err != nil {
-		return fmt.Errorf("exec multi select: %w, SQL: %s, args: %v", err, sqlStmt, allArgs)
+		return err
 	}
-	defer rows.Close()
+	defer release()
 
-	// 依次处理每个结果集（与queries顺序一致）
 	for idx, q := range queries {
-		if err := scanOneProtoRow(rows, q.Message); err != nil {
-			return fmt.Errorf("%w: %s", err, GetTableName(q.Message))
+		for rows.Next() {
+			row, err := scanRowBytes(rows)
+			if err != nil {
+				return fmt.Errorf("%w: %s", err, tables[idx].tableName)
+			}
+			message := q.Message.ProtoReflect().New().Interface()
+			if err := tables[idx].parseRow(message, row); err != nil {
+				return fmt.Errorf("%w: %s", err, tables[idx].tableName)
+			}
+			if err := fn(idx, message); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("%w: %s", err, tables[idx].tableName)
 		}
 		if idx < len(queries)-1 && !rows.NextResultSet() {
 			return fmt.Errorf("missing result set for table %s", GetTableName(queries[idx+1].Message))
@@ -2096,6 +4953,37 @@ func (p *DB) FindMultiByWhereClauses(queries []MultiQuery) error {
 	return nil
 }
 
+// queryMulti 把多条查询用分号拼成一条多语句SQL经conn()执行（事务内走tx、受默认超时约束），
+// 返回结果集、用完后须调用的release及与queries一一对应的表
+func (p *DB) queryMulti(queries []MultiQuery) (*sql.Rows, func(), []*MessageTable, error) {
+	if len(queries) == 0 {
+		return nil, nil, nil, errors.New("no queries provided")
+	}
+
+	// 收集每张表的查询SQL（分号分隔）与参数
+	sqlParts := make([]string, 0, len(queries))
+	tables := make([]*MessageTable, 0, len(queries))
+	var allArgs []interface{}
+	for _, q := range queries {
+		tableName := GetTableName(q.Message)
+		table, ok := p.lookupTable(tableName)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+		}
+		tables = append(tables, table)
+		whereClause, whereArgs := table.scopeWhere(q.WhereClause, q.WhereArgs)
+		sqlParts = append(sqlParts, table.GetSelectSQL(false)+" WHERE "+whereClause)
+		allArgs = append(allArgs, whereArgs...)
+	}
+
+	sqlStmt := strings.Join(sqlParts, "; ")
+	rows, release, err := p.conn().Query(sqlStmt, allArgs...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("exec multi select: %w, SQL: %s, args: %v", err, sqlStmt, allArgs)
+	}
+	return rows, release, tables, nil
+}
+
 // newMessageTable 构建消息-表映射并预生成SQL片段。
 // 先应用proto描述符里声明的表选项（message/field option，见options.go），
 // 再应用代码传入的opts（优先级更高，可覆盖proto声明）。
@@ -2119,10 +5007,43 @@ func newMessageTable(m proto.Message, opts ...TableOption) *MessageTable {
 // field option中读取（见proto/proto2mysql_option.proto），调用方通常无需传任何TableOption；
 // 显式传入的opts可覆盖proto里的声明。
 // 注册键固定为proto full name（查找路径统一按消息FullName解析）；
-// table.tableName仅决定生成SQL中的表名。
+// table.tableName仅决定生成SQL中的表名。SetCharset/SetKindType的设置作为默认值，可被WithCharset/WithKindType覆盖。
 func (p *DB) RegisterTable(m proto.Message, opts ...TableOption) {
-	table := newMessageTable(m, opts...)
-	p.Tables[GetTableName(m)] = table
+	table := newMessageTable(m, p.withInstanceDefaults(opts)...)
+	p.storeTable(GetTableName(m), table)
+}
+
+// withInstanceDefaults 在opts前加上实例级默认配置（SetCharset、SetKindType），表自己的选项在后、优先生效
+func (p *DB) withInstanceDefaults(opts []TableOption) []TableOption {
+	if p.charset != "" {
+		opts = append([]TableOption{WithCharset(p.charset, p.collation)}, opts...)
+	}
+	if len(p.kindTypes) > 0 {
+		opts = append([]TableOption{withKindTypes(p.kindTypes)}, opts...)
+	}
+	return opts
+}
+
+// RegisterTableByDescriptor 按消息描述符注册表，用于插件/动态消息等只有描述符、没有生成代码的场景：
+// 以dynamicpb.NewMessage(md)作为实例调用RegisterTable，表配置与默认值规则相同。
+// 之后可直接用dynamicpb消息（或同一描述符的生成代码消息）读写该表。
+func (p *DB) RegisterTableByDescriptor(md protoreflect.MessageDescriptor, opts ...TableOption) {
+	p.RegisterTable(dynamicpb.NewMessage(md), opts...)
+}
+
+// RefreshTable 对已注册的表追加应用opts并重建SQL缓存（见MessageTable.Reinit），
+// 无需重新注册即可动态调整表配置（如新增可空字段、索引）。
+// 只修改内存中的映射，线上表结构需再调用UpdateTableField同步。
+func (p *DB) RefreshTable(m proto.Message, opts ...TableOption) error {
+	table, err := p.tableForMessage(m)
+	if err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(table)
+	}
+	table.Reinit()
+	return nil
 }
 
 // RegisterAllTables 扫描全局 proto 注册表（protoregistry.GlobalFiles），
@@ -2165,18 +5086,18 @@ func (p *DB) registerTableFromDescriptor(md protoreflect.MessageDescriptor) {
 		tableName:  string(md.FullName()),
 		Descriptor: md,
 	}
-	for _, opt := range TableOptionsFromDescriptor(md) {
+	for _, opt := range p.withInstanceDefaults(TableOptionsFromDescriptor(md)) {
 		opt(table)
 	}
 	table.Init()
-	p.Tables[string(md.FullName())] = table
+	p.storeTable(string(md.FullName()), table)
 }
 
 // SyncAllTables 对当前已注册的所有表执行建表/字段对齐：
 // 表不存在则创建，存在则对齐字段类型（等价于对每张表调用 UpdateTableField）。
 // 常与 RegisterAllTables 搭配：先自动注册，再一次性建/更新全部 MySQL 表。
 func (p *DB) SyncAllTables() error {
-	for key, table := range p.Tables {
+	for key, table := range p.tablesSnapshot() {
 		if err := p.syncTableSchema(key, table); err != nil {
 			return err
 		}
@@ -2184,7 +5105,8 @@ func (p *DB) SyncAllTables() error {
 	return nil
 }
 
-// TableOption 表选项函数
+// TableOption 表选项函数。通常在RegisterTable时传入；
+// 注册后若直接对表应用选项，需随后调用MessageTable.Reinit（或改用DB.RefreshTable）使其生效。
 type TableOption func(*MessageTable)
 
 // WithTableName 自定义SQL表名（默认=proto full name）。
@@ -2194,6 +5116,12 @@ func WithTableName(name string) TableOption {
 	return func(t *MessageTable) { t.tableName = name }
 }
 
+// WithDatabase 指定表所在的库（同一MySQL实例上的其他schema，如 game / log）。
+// 设置后建表、结构同步与所有增删改查都以 `库`.`表` 引用该表，连接池仍用OpenDB绑定的那一个。
+func WithDatabase(name string) TableOption {
+	return func(t *MessageTable) { t.database = name }
+}
+
 // WithPrimaryKey 设置主键
 func WithPrimaryKey(keys ...string) TableOption {
 	return func(t *MessageTable) {
@@ -2208,6 +5136,228 @@ func WithIndexes(indexes ...string) TableOption {
 	}
 }
 
+// WithNamedIndex 添加一个显式命名的普通索引（可多次使用），适用于自动生成的
+// idx_<表名>_<序号> 过长或需要对接已有索引名的场景。名称须为1-64字节，列须存在，否则返回ErrInvalidTableOption。
+func WithNamedIndex(name string, cols ...string) TableOption {
+	return func(t *MessageTable) {
+		t.namedIndexes = append(t.namedIndexes, indexDef{kind: "INDEX", name: name, cols: cols})
+	}
+}
+
+// IndexPart 复合索引（WithCompositeIndex）中的一列：Length为前缀长度（仅文本/二进制列，0表示默认），
+// Desc为降序（MySQL 8.0+才真正按降序存储，低版本解析后忽略）
+type IndexPart struct {
+	Column string
+	Length int
+	Desc   bool
+}
+
+// WithCompositeIndex 添加一个显式命名、可逐列指定前缀长度与排序方向的普通索引（可多次使用），
+// 生成如 INDEX `name` (`col1`(20) ASC,`col2` DESC)。与WithNamedIndex一样按索引名补齐到线上表；
+// 列须存在、前缀长度只能用于文本/二进制列，否则返回ErrInvalidTableOption。
+//
+//	WithCompositeIndex("idx_rank", []IndexPart{{Column: "group_id"}, {Column: "score", Desc: true}})
+func WithCompositeIndex(name string, parts []IndexPart) TableOption {
+	return func(t *MessageTable) {
+		def := indexDef{kind: "INDEX", name: name}
+		for _, part := range parts {
+			def.cols = append(def.cols, part.Column)
+			def.lengths = append(def.lengths, part.Length)
+			def.desc = append(def.desc, part.Desc)
+		}
+		t.namedIndexes = append(t.namedIndexes, def)
+	}
+}
+
+// WithDefaultWhere 设置表的默认条件（如多租户的 tenant_id = ?），自动以AND加到本库生成的
+// 所有SELECT/UPDATE/DELETE的WHERE上（含按主键的读写、Count/Exists/聚合），与调用方条件同时生效。
+// 不影响INSERT/REPLACE写入的值，也不作用于QueryIntoList等原生SQL；设置后FindOneByPK不走缓存。
+//
+//	WithDefaultWhere("`tenant_id` = ?", tenantID)
+func WithDefaultWhere(clause string, args ...interface{}) TableOption {
+	return func(t *MessageTable) {
+		t.defaultWhere = stripWherePrefix(clause)
+		t.defaultWhereArgs = args
+	}
+}
+
+// WithMaxPlaceholders 收紧批量写（BatchInsert/BatchSave/BatchInsertAndGetIDs）单条SQL的占位符上限，
+// 默认MaxPlaceholders（MySQL上限65535）；中间件/代理限制更低时使用。超过上限时每批行数自动缩小。
+func WithMaxPlaceholders(n int) TableOption {
+	return func(t *MessageTable) {
+		t.maxPlaceholders = n
+	}
+}
+
+// WithColumnOrder 指定建表时的列顺序：fields按给定顺序排在最前，其余字段按proto声明顺序随后。
+// 同时决定SELECT列顺序，以及UpdateTableField新增列时 ADD COLUMN ... AFTER 的位置。
+//
+//	WithColumnOrder("id", "player_id")
+func WithColumnOrder(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.columnOrder = fields
+	}
+}
+
+// orderedFields 按WithColumnOrder排序后的全部字段（含被忽略的字段）
+func (m *MessageTable) orderedFields() []protoreflect.FieldDescriptor {
+	fields := m.Descriptor.Fields()
+	ordered := make([]protoreflect.FieldDescriptor, 0, fields.Len())
+	placed := make(map[string]bool, len(m.columnOrder))
+	for _, name := range m.columnOrder {
+		field := fields.ByName(protoreflect.Name(name))
+		if field == nil || placed[name] {
+			continue // 由Validate报错
+		}
+		placed[name] = true
+		ordered = append(ordered, field)
+	}
+	for i := 0; i < fields.Len(); i++ {
+		if field := fields.Get(i); !placed[string(field.Name())] {
+			ordered = append(ordered, field)
+		}
+	}
+	return ordered
+}
+
+// WithTableComment 设置表注释（未设置时为表名），建表生成 COMMENT='...'；
+// 同步结构时与INFORMATION_SCHEMA中的表注释比对，不一致则 ALTER TABLE ... COMMENT='...'。超过2048字节截断
+func WithTableComment(comment string) TableOption {
+	return func(t *MessageTable) {
+		t.tableComment = comment
+	}
+}
+
+// WithFieldComment 设置字段说明，写在列注释的字段号之后（如 COMMENT 'pb:3 玩家等级'，迁移仍按pb:N识别列）；
+// 同步结构时说明变化会 MODIFY COLUMN 更新注释。整段列注释超过1024字节截断
+func WithFieldComment(field, comment string) TableOption {
+	return func(t *MessageTable) {
+		if t.fieldComments == nil {
+			t.fieldComments = make(map[string]string)
+		}
+		t.fieldComments[field] = comment
+	}
+}
+
+// WithOnlineDDL 让UpdateTableField/SyncAllTables/GenerateMigrationSQL生成的ALTER TABLE追加
+// ALGORITHM=INPLACE, LOCK=NONE：要求在线DDL、不阻塞读写，MySQL无法满足时（如修改列类型）直接报错而不是锁表执行
+func WithOnlineDDL() TableOption {
+	return func(t *MessageTable) {
+		t.onlineDDL = true
+	}
+}
+
+// WithInvisibleIndex 把字段列表恰为cols的索引（WithIndexes/WithNamedIndex/WithUniqueKey等配置的）建为不可见索引：
+// 优化器不再使用但写入时照常维护，用于删除索引前先观察影响。需MySQL 8.0+（建表语句中写作
+// /*!80000 INVISIBLE */，低版本忽略）。已存在的索引在UpdateTableField/SyncAllTables时按配置
+// ALTER INDEX ... INVISIBLE / VISIBLE 切换，去掉该选项即恢复可见。多个索引多次调用。
+//
+//	WithIndexes("player_id", "group_id,port"), WithInvisibleIndex("group_id", "port")
+func WithInvisibleIndex(cols ...string) TableOption {
+	return func(t *MessageTable) {
+		t.invisibleIndexes = append(t.invisibleIndexes, splitOptionCSV(strings.Join(cols, ",")))
+	}
+}
+
+// WithPrefixIndex 指定文本/二进制列（string/bytes等，建为MEDIUMTEXT/MEDIUMBLOB）出现在普通索引/唯一键中时的前缀长度，
+// 生成如 INDEX `idx_t_0` (`name`(64))。未指定时默认取191（utf8mb4）。注意唯一键只约束前缀部分。
+func WithPrefixIndex(col string, length int) TableOption {
+	return func(t *MessageTable) {
+		if t.prefixLengths == nil {
+			t.prefixLengths = make(map[string]int)
+		}
+		t.prefixLengths[col] = length
+	}
+}
+
+// WithKindType 覆盖本表中proto类型kind映射的列类型（默认见MySQLFieldTypes），可空/自增等字段级配置照常叠加：
+//
+//	WithKindType(protoreflect.StringKind, "VARCHAR(255) NOT NULL DEFAULT ''")
+func WithKindType(kind protoreflect.Kind, sqlType string) TableOption {
+	return func(t *MessageTable) {
+		t.kindTypes = maps.Clone(t.kindTypes)
+		if t.kindTypes == nil {
+			t.kindTypes = make(map[protoreflect.Kind]string)
+		}
+		t.kindTypes[kind] = sqlType
+	}
+}
+
+// withKindTypes 批量应用类型覆盖（RegisterTable注入SetKindType的设置）
+func withKindTypes(kindTypes map[protoreflect.Kind]string) TableOption {
+	return func(t *MessageTable) {
+		for kind, sqlType := range kindTypes {
+			WithKindType(kind, sqlType)(t)
+		}
+	}
+}
+
+// kindType 本表中proto类型kind映射的列类型：WithKindType覆盖优先，其次MySQLFieldTypes，都没有时为TEXT
+func (m *MessageTable) kindType(kind protoreflect.Kind) string {
+	if sqlType, ok := m.kindTypes[kind]; ok && sqlType != "" {
+		return sqlType
+	}
+	if sqlType, ok := MySQLFieldTypes[kind]; ok {
+		return sqlType
+	}
+	return "TEXT" // 默认类型
+}
+
+// WithColumnCollation 为string字段（MEDIUMTEXT列）单独指定排序规则，建表/MODIFY COLUMN时生成 COLLATE <collation>，
+// 如 WithColumnCollation("name", "utf8mb4_bin") 让name区分大小写（唯一键按字节比较）。
+// collation须属于表字符集（默认utf8mb4，即utf8mb4_*，见WithCharset）。注意迁移按列类型比对，已有列仅改排序规则不会自动MODIFY，需手工ALTER。
+func WithColumnCollation(field, collation string) TableOption {
+	return func(t *MessageTable) {
+		if t.collations == nil {
+			t.collations = make(map[string]string)
+		}
+		t.collations[field] = collation
+	}
+}
+
+// TextSize TEXT/BLOB列的容量档位（WithTextSize）
+type TextSize int
+
+const (
+	TextSizeTiny    TextSize = iota + 1 // TINYTEXT/TINYBLOB，最大255字节
+	TextSizeRegular                     // TEXT/BLOB，最大64KB
+	TextSizeMedium                      // MEDIUMTEXT/MEDIUMBLOB，最大16MB（string/bytes/消息字段的默认）
+	TextSizeLong                        // LONGTEXT/LONGBLOB，最大4GB
+)
+
+// columnType 该档位的列类型，family为 "TEXT" 或 "BLOB"
+func (s TextSize) columnType(family string) string {
+	switch s {
+	case TextSizeTiny:
+		return "TINY" + family
+	case TextSizeRegular:
+		return family
+	case TextSizeLong:
+		return "LONG" + family
+	}
+	return "MEDIUM" + family
+}
+
+// WithTextSize 指定TEXT/BLOB列的容量档位：string字段（及WithBytesAsHex字段）建为 TINYTEXT/TEXT/MEDIUMTEXT/LONGTEXT，
+// bytes、消息、repeated/map字段建为对应的BLOB，如短IP用TextSizeTiny、大日志用TextSizeLong。
+// 迁移按档位比对列类型，修改档位会MODIFY COLUMN；写入超过容量的值时MySQL报错（严格模式）或截断。
+func WithTextSize(field string, size TextSize) TableOption {
+	return func(t *MessageTable) {
+		if t.textSizes == nil {
+			t.textSizes = make(map[string]TextSize)
+		}
+		t.textSizes[field] = size
+	}
+}
+
+// WithFullTextIndex 设置全文索引（FULLTEXT INDEX ft_<表名>，多列即联合全文索引）。
+// 列必须是string字段（MEDIUMTEXT），否则建表/同步时返回ErrInvalidTableOption。
+func WithFullTextIndex(cols ...string) TableOption {
+	return func(t *MessageTable) {
+		t.fullTextKeys = cols
+	}
+}
+
 // WithUniqueKey 设置唯一键
 func WithUniqueKey(uniqueKey string) TableOption {
 	return func(t *MessageTable) {
@@ -2215,13 +5365,147 @@ func WithUniqueKey(uniqueKey string) TableOption {
 	}
 }
 
-// WithAutoIncrementKey 设置自增字段
+// WithAutoIncrementKey 设置自增字段，须为主键或某个普通/唯一索引的首列（Validate校验）
 func WithAutoIncrementKey(key string) TableOption {
 	return func(t *MessageTable) {
 		t.autoIncreaseKey = key
 	}
 }
 
+// WithColumnMapping 指定proto字段名到库列名的映射（字段名→列名），用于对接列名与字段名不一致的旧表，
+// 如 WithColumnMapping(map[string]string{"group_id": "grp"})。建表/迁移/增删改/按字段名的条件
+// （FindOneByKV、UpdateFieldsByPK等）都使用映射后的列名；SELECT以字段名作别名，结果照常解析。
+// 注意：手写的whereClause是原生SQL，需直接使用库列名。
+func WithColumnMapping(mapping map[string]string) TableOption {
+	return func(t *MessageTable) {
+		t.columnMapping = maps.Clone(mapping)
+	}
+}
+
+// WithAutoIncrementStart 设置自增起始值，建表时生成 AUTO_INCREMENT=n（需同时有自增字段，n为0时不生效）。
+// 只影响CREATE TABLE，已存在的表不会被修改。
+func WithAutoIncrementStart(n uint64) TableOption {
+	return func(t *MessageTable) {
+		t.autoIncrement = n
+	}
+}
+
+// WithTimestamps 指定由MySQL自动维护的创建/更新时间列（须为google.protobuf.Timestamp字段，传空串表示不启用）：
+// createdCol 建为 DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP，
+// updatedCol 额外带 ON UPDATE CURRENT_TIMESTAMP。
+// 这两列不出现在INSERT/REPLACE/UPDATE的参数中，由MySQL填充；查询时照常读回到proto字段。
+func WithTimestamps(createdCol, updatedCol string) TableOption {
+	return func(t *MessageTable) {
+		t.createdAtField = createdCol
+		t.updatedAtField = updatedCol
+	}
+}
+
+// WithUpdatedAtColumn 指定每次UPDATE都设为当前时间的Timestamp字段（须为google.protobuf.Timestamp字段）：
+// Update/UpdateByWhereWithArgs/UpdateFieldsByPK/UpdateKVByPK/UpdateIfVersion/UpdateFieldsIfVersion（及GormDB的对应方法）
+// 生成的SET总带上该列（传入的值被忽略），即使其余字段都未变化也会刷新，且不再报"no fields to update"。
+// 可与WithTimestamps的更新列为同一字段，用于弥补ON UPDATE CURRENT_TIMESTAMP在行未变化时不触发的问题。
+func WithUpdatedAtColumn(col string) TableOption {
+	return func(t *MessageTable) {
+		t.touchField = col
+	}
+}
+
+// WithUnsignedColumns 把整数字段建为unsigned列（与proto类型无关，如恒为正的int64 id），同步结构时按此比对类型。
+// 与WithSignedColumns对同一字段以后调用的为准。注意proto字段为有符号类型时，读取超过其上限的值会解析失败。
+func WithUnsignedColumns(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.setUnsignedOverride(fields, true)
+	}
+}
+
+// WithSignedColumns 把整数字段建为有符号列（如uint32/uint64字段存到旧表的有符号列），同步结构时按此比对类型
+func WithSignedColumns(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.setUnsignedOverride(fields, false)
+	}
+}
+
+// setUnsignedOverride 记录字段的unsigned属性覆盖
+func (m *MessageTable) setUnsignedOverride(fields []string, unsigned bool) {
+	if m.unsignedOverride == nil {
+		m.unsignedOverride = make(map[string]bool, len(fields))
+	}
+	for _, field := range fields {
+		m.unsignedOverride[field] = unsigned
+	}
+}
+
+// WithTimestampAsEpoch 指定按Unix秒存储的Timestamp字段：建为 bigint NOT NULL DEFAULT 0（与时区无关，便于比较），
+// 写入 ts.AsTime().Unix()，读取时按 time.Unix 还原（秒级，未设置的字段写0，读到0保持未设置）。
+// 不能与WithTimestamps的列同时使用。按条件查询时直接用Unix秒比较，如 WHERE `expire_at` < ?。
+// 注意：已有DATETIME列改用本选项时，自动同步的MODIFY不会换算数据，需先手工用UNIX_TIMESTAMP迁移。
+func WithTimestampAsEpoch(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.epochFields = fields
+	}
+}
+
+// WithBytesAsHex 指定按小写十六进制文本存储的bytes字段（如MD5/SHA摘要，便于其他系统直接按hex读取）：
+// 建为MEDIUMTEXT，写入 hex.EncodeToString，读取时按十六进制解码（大小写均可），替代默认的base64。
+// 按条件查询时参数同样传十六进制串，如 WHERE `digest` = ?。
+func WithBytesAsHex(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.hexFields = fields
+	}
+}
+
+// WithZerofill 把整数字段建为带显示宽度的补零列，如 int(10) unsigned zerofill（对接旧库的定长编号），
+// 显示宽度取该类型的MySQL默认值；同步结构时补零属性与宽度都参与比对，不会与已有的同类列来回MODIFY。
+// 补零隐含unsigned，不能与WithSignedColumns同时用于一个字段。MySQL 8.0.17起ZEROFILL与显示宽度已不推荐使用，
+// 新表请勿使用；补零只影响mysql客户端的显示，本库读回的仍是数值。
+func WithZerofill(field string) TableOption {
+	return func(t *MessageTable) {
+		t.zerofillFields = append(t.zerofillFields, field)
+	}
+}
+
+// isZerofillField 判断整数字段是否建为补零列（WithZerofill）
+func (m *MessageTable) isZerofillField(fieldName string) bool {
+	return slices.Contains(m.zerofillFields, fieldName)
+}
+
+// WithBitColumn 指定建为 BIT(1) NOT NULL DEFAULT b'0' 的bool字段（默认为tinyint(1)），可多次调用追加。
+// 写入单字节0x00/0x01，读取时解析MySQL返回的单字节；按条件查询时参数传Go的bool或0/1，如 WHERE `online` = ?。
+func WithBitColumn(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.bitFields = append(t.bitFields, fields...)
+	}
+}
+
+// WithNativeEnum 指定建为MySQL原生ENUM列的enum字段：列类型为 ENUM('值名1','值名2',...) NOT NULL
+// （按proto声明顺序），写入值名、读取时按值名映射回枚举值。proto新增枚举值后UpdateTableField会MODIFY COLUMN。
+// 按条件查询时参数同样传值名，如 WHERE `state` = 'ONLINE'。已有int列改为ENUM列需先手工迁移数据
+// （MySQL按下标而不是枚举值转换）。
+func WithNativeEnum(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.nativeEnumFields = fields
+	}
+}
+
+// nativeEnumType 由enum的值名生成ENUM列类型，如 ENUM('OFFLINE','ONLINE') NOT NULL
+func nativeEnumType(enum protoreflect.EnumDescriptor) string {
+	values := enum.Values()
+	names := make([]string, values.Len())
+	for i := range names {
+		names[i] = "'" + escapeMySQLComment(string(values.Get(i).Name())) + "'"
+	}
+	return "ENUM(" + strings.Join(names, ",") + ") NOT NULL"
+}
+
+// WithIgnoredFields 指定不持久化的字段（如计算出的展示名等内存态字段）：
+// 不建列，不出现在INSERT/UPDATE/REPLACE/SELECT中，查询时也不会写这些字段。
+func WithIgnoredFields(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.ignoredFields = fields
+	}
+}
+
 // WithNullableFields 设置允许为NULL的字段
 func WithNullableFields(fields ...string) TableOption {
 	return func(t *MessageTable) {
@@ -2229,6 +5513,45 @@ func WithNullableFields(fields ...string) TableOption {
 	}
 }
 
+// WithZeroValueAsNull 指定字段未设置或为零值（0、""、false、空bytes、未设置的子消息/Timestamp）时写入SQL NULL，
+// 而不是0或空串，使 IS NULL 查询与COUNT/AVG等聚合忽略这些值；列同时建为可空（无需再列入WithNullableFields）。
+// 读到NULL时清空该字段（optional字段Has为false）。只支持单值字段，主键不能使用。
+func WithZeroValueAsNull(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.zeroAsNullFields = fields
+	}
+}
+
+// WithNullableMessage 为子消息字段记录是否设置：未设置时写入SQL NULL，已设置时照常写入序列化结果
+// （所有字段都是默认值的子消息序列化为空，也写空值而不是NULL）；读到NULL时清空字段，读到空值时设为空子消息，
+// 从而区分"未设置"与"已设置但为空"。只支持单值、非Timestamp的子消息字段（列本身可空，无需再列入WithNullableFields）。
+func WithNullableMessage(fields ...string) TableOption {
+	return func(t *MessageTable) {
+		t.nullableMessageFields = append(t.nullableMessageFields, fields...)
+	}
+}
+
+// WithRowHook 注册查询时每行解析完成后、加入结果前调用的钩子（可多次使用，按注册顺序调用），
+// 用于字段解密、计算派生字段等；钩子返回错误时本次查询失败。对本表的所有查询生效
+// （单行/列表/流式查询、FindInto，以及元素类型已注册的原生SQL列表查询）。
+//
+//	WithRowHook(func(m proto.Message) error { return decryptPhone(m.(*pb.User)) })
+func WithRowHook(hook func(proto.Message) error) TableOption {
+	return func(t *MessageTable) {
+		t.rowHooks = append(t.rowHooks, hook)
+	}
+}
+
+// runRowHooks 依次调用WithRowHook注册的钩子
+func (m *MessageTable) runRowHooks(message proto.Message) error {
+	for _, hook := range m.rowHooks {
+		if err := hook(message); err != nil {
+			return fmt.Errorf("row hook for table %s: %w", m.tableName, err)
+		}
+	}
+	return nil
+}
+
 // Close 关闭数据库连接
 func (p *DB) Close() error {
 	if p.DB == nil {
@@ -1,44 +1,44 @@
 package proto2mysql
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/luyuancpp/proto2mysql/internal/testdyn"
 	testpb "github.com/luyuancpp/proto2mysql/internal/testpb"
+	"github.com/luyuancpp/proto2mysql/pbconv"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const integrationEnv = "PROTO2MYSQL_INTEGRATION"
 
 // GetMysqlConfig 读取testdata/db.json中的测试数据库连接配置
 func GetMysqlConfig() *mysql.Config {
-	file, err := os.Open("testdata/db.json")
-	defer func(file *os.File) {
-		if file != nil {
-			if err := file.Close(); err != nil {
-				fmt.Printf("关闭testdata/db.json失败: %v\n", err)
-			}
-		}
-	}(file)
+	jsonConfig, err := ReadJsonConfig("testdata/db.json")
 	if err != nil {
-		fmt.Printf("打开testdata/db.json失败: %v\n", err)
-		return nil
-	}
-	decoder := json.NewDecoder(file)
-	jsonConfig := JsonConfig{}
-	if err := decoder.Decode(&jsonConfig); err != nil {
-		log.Printf("解析testdata/db.json失败: %v", err)
+		log.Printf("读取testdata/db.json失败: %v", err)
 		return nil
 	}
 	return NewMysqlConfig(jsonConfig)
@@ -60,21 +60,15 @@ func mustOpenTestDB(t *testing.T, pdb *DB) *sql.DB {
 		t.Fatal("获取MySQL配置失败，请检查testdata/db.json文件")
 	}
 
-	conn, err := mysql.NewConnector(mysqlConfig)
-	if err != nil {
-		t.Fatalf("创建MySQL连接器失败: %v", err)
+	if err := EnsureDatabase(mysqlConfig); err != nil {
+		t.Fatalf("创建测试库失败: %v", err)
 	}
-
-	db := sql.OpenDB(conn)
-	if err := db.Ping(); err != nil {
+	opened, err := Open(mysqlConfig)
+	if err != nil {
 		t.Fatalf("数据库连接失败: %v", err)
 	}
-
-	if err := pdb.OpenDB(db, mysqlConfig.DBName); err != nil {
-		t.Fatalf("切换数据库失败: %v", err)
-	}
-
-	return db
+	pdb.DB, pdb.DBName = opened.DB, opened.DBName
+	return opened.DB
 }
 
 func closeTestDB(t *testing.T, db *sql.DB) {
@@ -99,7 +93,7 @@ func recreateTestTable(t *testing.T, db *sql.DB, pdb *DB, m proto.Message) {
 	if err != nil {
 		t.Fatalf("解析注册表失败: %v", err)
 	}
-	if _, err := db.Exec("DROP TABLE IF EXISTS " + escapeMySQLName(table.tableName)); err != nil {
+	if _, err := db.Exec("DROP TABLE IF EXISTS " + table.sqlName()); err != nil {
 		t.Fatalf("重建前清理表失败: %v", err)
 	}
 	if _, err := db.Exec(table.GetCreateTableSQL()); err != nil {
@@ -291,15 +285,38 @@ func TestLoadByWhereCase(t *testing.T) {
 		t.Fatalf("保存数据失败: %v", err)
 	}
 
-	// 按条件查询（WHERE子句无需加"where"前缀）
-	pbLoad := &testpb.GolangTest{}
-	if err := pdb.FindOneByWhereClause(pbLoad, "id=1"); err != nil {
-		t.Fatalf("执行FindOneByWhereClause失败: %v", err)
+	// 按条件查询（WHERE子句无需加"where"前缀，带上也兼容）
+	for _, where := range []string{"id=1", " WHERE id=1"} {
+		pbLoad := &testpb.GolangTest{}
+		if err := pdb.FindOneByWhereClause(pbLoad, where); err != nil {
+			t.Fatalf("执行FindOneByWhereClause(%q)失败: %v", where, err)
+		}
+		if !proto.Equal(pbSave, pbLoad) {
+			t.Errorf("按条件%q查询后数据不一致", where)
+			t.Logf("预期: %s", pbSave.String())
+			t.Logf("实际: %s", pbLoad.String())
+		}
 	}
-	if !proto.Equal(pbSave, pbLoad) {
-		t.Error("按条件查询后数据不一致")
-		t.Logf("预期: %s", pbSave.String())
-		t.Logf("实际: %s", pbLoad.String())
+}
+
+// TestNormalizeWhereClause 单元测试：开头多写的WHERE被去掉，以where开头的列名不受影响
+func TestNormalizeWhereClause(t *testing.T) {
+	cases := map[string]string{
+		"":                   "1=1",
+		"id=1":               "id=1",
+		" WHERE id=1":        "id=1",
+		"where id = ?":       "id = ?",
+		"\tWhere\n(a=1)":     "(a=1)",
+		"WHERE(a=1)":         "(a=1)",
+		"WHERE":              "1=1",
+		"where_flag = 1":     "where_flag = 1",
+		"whereabouts = ?":    "whereabouts = ?",
+		"id=1 AND WHERE_x=2": "id=1 AND WHERE_x=2",
+	}
+	for in, want := range cases {
+		if got := normalizeWhereClause(in); got != want {
+			t.Errorf("normalizeWhereClause(%q) = %q, 期望 %q", in, got, want)
+		}
 	}
 }
 
@@ -986,7 +1003,7 @@ func TestUpdateFieldType(t *testing.T) {
 	// 确保测试表干净（先删除表）
 	_, _ = db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", escapeMySQLName(tableName)))
 	// 清除表存在缓存（关键：避免缓存影响判断）
-	pdb.updateTableExistsCache(tableName, false)
+	pdb.updateTableExistsCache(pdb.DBName, tableName, false)
 	// 清除字段缓存
 	pdb.clearColumnCache(tableName)
 
@@ -1020,12 +1037,10 @@ func TestUpdateFieldType(t *testing.T) {
 		t.Errorf("初始字段类型错误，mediumtext，实际为: %s", initialType)
 	}
 
-	// 3. 修改字段类型映射并更新表结构
-	oldType := MySQLFieldTypes[protoreflect.StringKind]
-	MySQLFieldTypes[protoreflect.StringKind] = "MEDIUMTEXT NOT NULL"
-	defer func() {
-		MySQLFieldTypes[protoreflect.StringKind] = oldType // 恢复原类型
-	}()
+	// 3. 修改本表的字段类型映射（只影响这张表，不改全局MySQLFieldTypes）并更新表结构
+	if err := pdb.RefreshTable(testTable, WithKindType(protoreflect.StringKind, "MEDIUMTEXT NOT NULL")); err != nil {
+		t.Fatalf("调整类型映射失败: %v", err)
+	}
 
 	// 执行更新字段操作
 	if err := pdb.UpdateTableField(testTable); err != nil {
@@ -1416,7 +1431,7 @@ func TestMySQLIdentifierEscaping(t *testing.T) {
 	for _, want := range []string{
 		"CREATE TABLE IF NOT EXISTS `" + tableName + "`",
 		"INDEX `idx_" + tableName + "_0` (`player_id`,`group_id`)",
-		"UNIQUE KEY `uk_" + tableName + "` (`ip`)",
+		"UNIQUE KEY `uk_" + tableName + "` (`ip`(191))",
 	} {
 		if !strings.Contains(createSQL, want) {
 			t.Fatalf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
@@ -2017,6 +2032,32 @@ func TestExtendedCRUDInterfaces(t *testing.T) {
 		}
 	})
 
+	// 2.1 BatchInsertAndGetIDs：批量插入后按顺序回填连续的自增ID
+	t.Run("BatchInsertAndGetIDs", func(t *testing.T) {
+		rows := []proto.Message{
+			&testpb.GolangTest{PlayerId: 9900, Ip: "10.9.1.1"},
+			&testpb.GolangTest{PlayerId: 9900, Ip: "10.9.1.2"},
+			&testpb.GolangTest{PlayerId: 9900, Ip: "10.9.1.3"},
+		}
+		ids, err := pdb.BatchInsertAndGetIDs(rows)
+		if err != nil {
+			t.Fatalf("BatchInsertAndGetIDs失败: %v", err)
+		}
+		if len(ids) != len(rows) {
+			t.Fatalf("预期返回%d个ID，实际%v", len(rows), ids)
+		}
+		for i, row := range rows {
+			got := row.(*testpb.GolangTest)
+			if int64(got.Id) != ids[i] || (i > 0 && ids[i] != ids[i-1]+1) {
+				t.Errorf("第%d条自增ID回填错误: id=%d, ids=%v", i, got.Id, ids)
+			}
+			back := &testpb.GolangTest{Id: got.Id}
+			if err := pdb.FindOneByPK(back); err != nil || back.Ip != got.Ip {
+				t.Errorf("按回填ID查询不一致: ip=%q, want %q, err=%v", back.Ip, got.Ip, err)
+			}
+		}
+	})
+
 	// 3. UpdateFieldsByPK：部分更新，不动其他字段
 	t.Run("UpdateFieldsByPK", func(t *testing.T) {
 		row := &testpb.GolangTest{Id: 9901, Ip: "10.9.9.9", Port: 777}
@@ -2234,6 +2275,13 @@ func TestWrapExecErr(t *testing.T) {
 	if errors.Is(wrapExecErr(other), ErrDuplicateKey) {
 		t.Error("非1062不应包装为ErrDuplicateKey")
 	}
+	for _, number := range []uint16{1451, 1452} {
+		fk := &mysql.MySQLError{Number: number, Message: "Cannot add or update a child row: a foreign key constraint fails"}
+		wrapped := wrapExecErr(fk)
+		if !errors.Is(wrapped, ErrForeignKeyViolation) || errors.Is(wrapped, ErrDuplicateKey) {
+			t.Errorf("%d应包装为ErrForeignKeyViolation: %v", number, wrapped)
+		}
+	}
 	plain := errors.New("plain")
 	if wrapExecErr(plain) != plain {
 		t.Error("普通错误应原样透传")
@@ -2243,6 +2291,96 @@ func TestWrapExecErr(t *testing.T) {
 	}
 }
 
+// TestWriteErrorSentinels 单元测试：各写路径的MySQL错误统一经执行器包装，且不会重复包装
+func TestWriteErrorSentinels(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	fake.execErr = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+	err := pdb.Insert(&testpb.GolangTest{Id: 1})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Insert重复主键应返回ErrDuplicateKey，实际: %v", err)
+	}
+	if strings.Count(err.Error(), ErrDuplicateKey.Error()) != 1 {
+		t.Errorf("错误不应重复包装: %v", err)
+	}
+
+	fake.execErr = &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}
+	if err := pdb.Update(&testpb.GolangTest{Id: 1, GroupId: 9}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("Update外键冲突应返回ErrForeignKeyViolation，实际: %v", err)
+	}
+	fake.execErr = &mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"}
+	if err := pdb.Delete(&testpb.GolangTest{Id: 1}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("Delete外键冲突应返回ErrForeignKeyViolation，实际: %v", err)
+	}
+	var me *mysql.MySQLError
+	if err := pdb.Delete(&testpb.GolangTest{Id: 1}); !errors.As(err, &me) || me.Number != 1451 {
+		t.Errorf("应保留原始MySQLError: %v", err)
+	}
+}
+
+// TestGormWriteErrorSentinels 单元测试：GormDB的Insert/BatchInsert/Update等写路径同样把MySQL错误包装为哨兵错误
+func TestGormWriteErrorSentinels(t *testing.T) {
+	gdb, fake, err := newFakeGormDB()
+	if err != nil {
+		t.Fatalf("打开gorm失败: %v", err)
+	}
+	gormDB := NewGormDB(gdb, "")
+	gormDB.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	fake.execErr = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+	err = gormDB.Insert(&testpb.GolangTest{Id: 1})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("GormDB.Insert重复主键应返回ErrDuplicateKey，实际: %v", err)
+	}
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) || me.Number != 1062 {
+		t.Errorf("应保留原始MySQLError: %v", err)
+	}
+	if execs := fake.recorded(); len(execs) != 1 || !strings.HasPrefix(execs[0].query, "INSERT INTO `golang_test`") {
+		t.Errorf("应下发一条INSERT，实际: %+v", execs)
+	}
+	if err := gormDB.BatchInsert([]proto.Message{&testpb.GolangTest{Id: 1}, &testpb.GolangTest{Id: 2}}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("GormDB.BatchInsert重复主键应返回ErrDuplicateKey，实际: %v", err)
+	}
+
+	fake.execErr = &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}
+	if err := gormDB.Update(&testpb.GolangTest{Id: 1, GroupId: 9}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("GormDB.Update外键冲突应返回ErrForeignKeyViolation，实际: %v", err)
+	}
+	fake.execErr = &mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"}
+	if err := gormDB.Delete(&testpb.GolangTest{Id: 1}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("GormDB.Delete外键冲突应返回ErrForeignKeyViolation，实际: %v", err)
+	}
+}
+
+// TestBatchInsertAndGetIDsValidation 单元测试：无自增字段或已显式设置自增ID时拒绝执行
+func TestBatchInsertAndGetIDsValidation(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey(""))
+	if _, err := pdb.BatchInsertAndGetIDs([]proto.Message{&testpb.GolangTest{}}); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("无自增字段应返回ErrFieldNotFound，实际: %v", err)
+	}
+
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("id"))
+	if _, err := pdb.BatchInsertAndGetIDs([]proto.Message{&testpb.GolangTest{}, &testpb.GolangTest{Id: 5}}); err == nil {
+		t.Error("已设置自增ID时应报错")
+	}
+	if _, err := pdb.BatchInsertAndGetIDs(nil); err == nil {
+		t.Error("空列表应报错")
+	}
+
+	msg := &testpb.GolangTest{}
+	field := msg.ProtoReflect().Descriptor().Fields().ByName("id")
+	if err := setIntegerField(msg.ProtoReflect(), field, 42); err != nil || msg.Id != 42 {
+		t.Errorf("回填自增ID失败: id=%d, err=%v", msg.Id, err)
+	}
+}
+
 // TestUpdateFieldsIfVersionValidation 单元测试：显式字段CAS的参数校验（无需数据库）
 func TestUpdateFieldsIfVersionValidation(t *testing.T) {
 	pdb := NewDB()
@@ -2391,8 +2529,28 @@ func TestRegisterAllTables(t *testing.T) {
 	}
 }
 
+// TestRegisterAllTablesInstanceDefaults 单元测试：自动注册的表与RegisterTable一样应用实例级默认配置（SetCharset、SetKindType）
+func TestRegisterAllTablesInstanceDefaults(t *testing.T) {
+	pdb := NewDB()
+	if err := pdb.SetCharset("latin1", ""); err != nil {
+		t.Fatalf("SetCharset失败: %v", err)
+	}
+	pdb.SetKindType(protoreflect.StringKind, "VARCHAR(255) NOT NULL DEFAULT ''")
+	pdb.RegisterAllTables()
+	table, ok := pdb.lookupTable("golang_test")
+	if !ok {
+		t.Fatal("golang_test应被自动注册")
+	}
+	if createSQL := table.GetCreateTableSQL(); !strings.Contains(createSQL, " DEFAULT CHARSET=latin1") {
+		t.Errorf("自动注册的表应使用实例字符集: %s", createSQL)
+	}
+	if got, err := table.ColumnType("ip"); err != nil || got != "VARCHAR(255) NOT NULL DEFAULT ''" {
+		t.Errorf("自动注册的表应使用SetKindType的列类型: %q %v", got, err)
+	}
+}
+
 func TestColumnFieldNumberMetadata(t *testing.T) {
-	if got, want := columnComment(3), " COMMENT 'pb:3'"; got != want {
+	if got, want := columnComment(3, ""), " COMMENT 'pb:3'"; got != want {
 		t.Fatalf("columnComment() = %q, want %q", got, want)
 	}
 
@@ -2473,3 +2631,5212 @@ func TestBuildAlterClausesRenameByFieldNumber(t *testing.T) {
 		t.Errorf("ip 已按字段号改名，不应再 ADD: %s", joined)
 	}
 }
+
+// TestBuildAlterClausesColumnPosition 单元测试：中间缺失的字段新增时用 AFTER 落在proto声明位置，
+// WithColumnOrder 同时决定建表列顺序与新增列位置
+func TestBuildAlterClausesColumnPosition(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{})
+	current := map[string]columnMeta{
+		"id":        {colType: "int unsigned", fieldNum: 1},
+		"ip":        {colType: "mediumtext", fieldNum: 2},
+		"group_id":  {colType: "int unsigned", fieldNum: 4},
+		"player":    {colType: "mediumblob", fieldNum: 5},
+		"player_id": {colType: "bigint unsigned", fieldNum: 6},
+	}
+	joined := strings.Join(table.buildAlterClauses(current), " | ")
+	if !strings.Contains(joined, "ADD COLUMN `port` int unsigned NOT NULL DEFAULT 0 COMMENT 'pb:3' AFTER `ip`") {
+		t.Errorf("中间字段 port 应 AFTER `ip` 新增: %s", joined)
+	}
+
+	delete(current, "id")
+	joined = strings.Join(table.buildAlterClauses(current), " | ")
+	if !strings.Contains(joined, "ADD COLUMN `id` int unsigned NOT NULL AUTO_INCREMENT COMMENT 'pb:1' FIRST") {
+		t.Errorf("首个字段 id 应 FIRST 新增: %s", joined)
+	}
+
+	ordered := newMessageTable(&testpb.GolangTest{}, WithColumnOrder("id", "player_id"))
+	if err := ordered.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !strings.HasPrefix(ordered.fieldsListSQL, "`id`, `player_id`, `ip`") {
+		t.Errorf("WithColumnOrder 列顺序错误: %s", ordered.fieldsListSQL)
+	}
+	createSQL := ordered.GetCreateTableSQL()
+	if strings.Index(createSQL, "`player_id`") > strings.Index(createSQL, "`ip`") {
+		t.Errorf("建表语句中 player_id 应排在 ip 之前: %s", createSQL)
+	}
+	current = map[string]columnMeta{
+		"id":       {colType: "int unsigned", fieldNum: 1},
+		"ip":       {colType: "mediumtext", fieldNum: 2},
+		"port":     {colType: "int unsigned", fieldNum: 3},
+		"group_id": {colType: "int unsigned", fieldNum: 4},
+		"player":   {colType: "mediumblob", fieldNum: 5},
+	}
+	joined = strings.Join(ordered.buildAlterClauses(current), " | ")
+	if !strings.Contains(joined, "ADD COLUMN `player_id` bigint unsigned NOT NULL DEFAULT 0 COMMENT 'pb:6' AFTER `id`") {
+		t.Errorf("WithColumnOrder 下 player_id 应 AFTER `id` 新增: %s", joined)
+	}
+
+	for _, opt := range []TableOption{WithColumnOrder("nope"), WithColumnOrder("id", "id")} {
+		if err := newMessageTable(&testpb.GolangTest{}, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法 WithColumnOrder 应返回 ErrInvalidTableOption, got %v", err)
+		}
+	}
+}
+
+// TestRefreshTable 单元测试：注册后修改表配置，RefreshTable/Reinit重建预生成SQL并清空结构缓存
+func TestRefreshTable(t *testing.T) {
+	pdb := NewDB()
+	msg := &testpb.GolangTest{}
+	pdb.RegisterTable(msg)
+	table := pdb.Tables[GetTableName(msg)]
+	table.cachedColumns = map[string]string{"id": "int"}
+
+	if err := pdb.RefreshTable(msg, WithTableName("player_data"), WithPrimaryKey("group_id")); err != nil {
+		t.Fatalf("RefreshTable失败: %v", err)
+	}
+	if !strings.Contains(table.insertSQLTemplate, "`player_data`") {
+		t.Errorf("INSERT模板应使用新表名: %s", table.insertSQLTemplate)
+	}
+	if !strings.HasPrefix(table.replaceSQLTemplate, "REPLACE INTO `player_data` (") {
+		t.Errorf("REPLACE模板应使用新表名: %s", table.replaceSQLTemplate)
+	}
+	if !strings.Contains(table.selectFieldsSQL, "`player_data`") {
+		t.Errorf("SELECT模板应使用新表名: %s", table.selectFieldsSQL)
+	}
+	if table.primaryKeyField == nil || table.primaryKeyField.Name() != "group_id" {
+		t.Errorf("主键字段应随配置更新: %v", table.primaryKeyField)
+	}
+	if table.cachedColumns != nil {
+		t.Error("Reinit应清空表结构缓存")
+	}
+
+	// 直接应用选项后调用Reinit
+	WithNullableFields("port")(table)
+	table.Reinit()
+	if !strings.Contains(table.GetCreateTableSQL(), "`port` int unsigned DEFAULT 0") {
+		t.Errorf("可空字段配置应生效: %s", table.GetCreateTableSQL())
+	}
+
+	if err := pdb.RefreshTable(&testpb.GolangTest1{}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("未注册的表应返回ErrTableNotFound，实际: %v", err)
+	}
+}
+
+// TestExplainWhere 集成测试：EXPLAIN返回执行计划行（列名→值）
+func TestExplainWhere(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable)
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	plan, err := pdb.ExplainWhere(&testpb.GolangTestList{}, "id = ?", []interface{}{1})
+	if err != nil {
+		t.Fatalf("ExplainWhere失败: %v", err)
+	}
+	if len(plan) == 0 {
+		t.Fatal("执行计划不应为空")
+	}
+	if _, ok := plan[0]["table"]; !ok {
+		t.Errorf("执行计划应包含table列: %v", plan[0])
+	}
+}
+
+// TestFullTextIndex 单元测试：全文索引出现在建表SQL中，迁移时补齐缺失索引，非文本列校验失败
+func TestFullTextIndex(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithIndexes("player_id"), WithFullTextIndex("ip"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("文本列全文索引应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	if want := "FULLTEXT INDEX `ft_golang_test` (`ip`)"; !strings.Contains(createSQL, want) {
+		t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+	}
+
+	clauses := table.buildIndexAlterClauses(map[string]bool{"PRIMARY": true, "idx_golang_test_0": true})
+	if len(clauses) != 1 || clauses[0] != "ADD FULLTEXT INDEX `ft_golang_test` (`ip`)" {
+		t.Errorf("应只补齐缺失的全文索引，实际: %v", clauses)
+	}
+
+	bad := newMessageTable(&testpb.GolangTest{}, WithFullTextIndex("port"))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("非文本列全文索引应返回ErrInvalidTableOption，实际: %v", err)
+	}
+	missing := newMessageTable(&testpb.GolangTest{}, WithFullTextIndex("no_such_field"))
+	if err := missing.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("不存在的列应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestInvisibleIndex 单元测试：WithInvisibleIndex建表时带INVISIBLE，已有索引按配置与线上可见性差异切换，
+// 未匹配任何索引的配置校验失败
+func TestInvisibleIndex(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{},
+		WithIndexes("player_id", "group_id,port"),
+		WithInvisibleIndex("group_id", "port"),
+		WithColumnMapping(map[string]string{"port": "listen_port"}))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("不可见索引配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	if want := "INDEX `idx_golang_test_1` (`group_id`,`listen_port`) /*!80000 INVISIBLE */"; !strings.Contains(createSQL, want) {
+		t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+	}
+	if strings.Contains(createSQL, "INDEX `idx_golang_test_0` (`player_id`) /*") {
+		t.Errorf("未配置的索引不应为不可见\nSQL: %s", createSQL)
+	}
+
+	existing := map[string]bool{"PRIMARY": true, "idx_golang_test_0": true, "idx_golang_test_1": true}
+	clauses := table.buildIndexVisibilityClauses(existing, map[string]bool{"idx_golang_test_0": true, "manual_idx": true})
+	want := []string{"ALTER INDEX `idx_golang_test_0` VISIBLE", "ALTER INDEX `idx_golang_test_1` INVISIBLE"}
+	if !slices.Equal(clauses, want) {
+		t.Errorf("可见性切换子句不符\n期望: %v\n实际: %v", want, clauses)
+	}
+	if clauses := table.buildIndexVisibilityClauses(existing, map[string]bool{"idx_golang_test_1": true}); len(clauses) != 0 {
+		t.Errorf("线上可见性与配置一致时不应生成子句，实际: %v", clauses)
+	}
+	if clauses := table.buildIndexVisibilityClauses(map[string]bool{"PRIMARY": true}, nil); len(clauses) != 0 {
+		t.Errorf("尚未创建的索引不应切换可见性（由ADD补齐），实际: %v", clauses)
+	}
+
+	bad := newMessageTable(&testpb.GolangTest{}, WithIndexes("player_id"), WithInvisibleIndex("port"))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("未匹配任何索引应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestIndexNameLength 单元测试：超长表名下自动生成的索引名不超过64字节，显式命名索引原样使用
+func TestIndexNameLength(t *testing.T) {
+	longName := "com.example.very.long.package.qualified.name.for.game.server.PlayerInventorySnapshot"
+	table := newMessageTable(&testpb.GolangTest{},
+		WithTableName(longName),
+		WithIndexes("player_id", "group_id"),
+		WithUniqueKey("ip"),
+		WithFullTextIndex("ip"),
+		WithNamedIndex("idx_player_port", "player_id", "port"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, def := range table.indexDefs() {
+		if len(def.name) > mysqlMaxIdentifierLen {
+			t.Errorf("索引名超过64字节(%d): %s", len(def.name), def.name)
+		}
+		if seen[def.name] {
+			t.Errorf("索引名重复: %s", def.name)
+		}
+		seen[def.name] = true
+	}
+	if !seen["idx_player_port"] {
+		t.Errorf("缺少显式命名索引，实际: %v", seen)
+	}
+	if got := autoIndexName("uk_" + longName); got != autoIndexName("uk_"+longName) {
+		t.Errorf("同一输入的缩短结果应稳定: %s", got)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	if want := "INDEX `idx_player_port` (`player_id`,`port`)"; !strings.Contains(createSQL, want) {
+		t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+	}
+
+	short := newMessageTable(&testpb.GolangTest{}, WithIndexes("player_id"))
+	if got := short.indexDefs()[0].name; got != "idx_golang_test_0" {
+		t.Errorf("短表名的索引名不应改变，实际 %s", got)
+	}
+
+	for _, opt := range []TableOption{
+		WithNamedIndex(strings.Repeat("x", 65), "ip"),
+		WithNamedIndex("idx_empty"),
+		WithNamedIndex("idx_missing", "no_such_field"),
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法命名索引应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestPrefixIndex 单元测试：普通索引/唯一键中的MEDIUMTEXT/MEDIUMBLOB列自动带前缀长度，可用WithPrefixIndex覆盖
+func TestPrefixIndex(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{},
+		WithIndexes("ip", "player_id, player"),
+		WithUniqueKey("ip, group_id"),
+		WithFullTextIndex("ip"),
+		WithPrefixIndex("player", 32))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"INDEX `idx_golang_test_0` (`ip`(191))",
+		"INDEX `idx_golang_test_1` (`player_id`,`player`(32))",
+		"UNIQUE KEY `uk_golang_test` (`ip`(191),`group_id`)",
+		"FULLTEXT INDEX `ft_golang_test` (`ip`)",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	for _, opt := range []TableOption{
+		WithPrefixIndex("no_such_field", 10),
+		WithPrefixIndex("port", 10),
+		WithPrefixIndex("ip", 0),
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法前缀索引应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// newTimedTestMessage 构造一个带created_at/updated_at（google.protobuf.Timestamp）字段的动态消息，
+// testpb中没有时间戳字段，需要时间戳列的单元测试用它代替
+func newTimedTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	return testdyn.NewMessage(t, "timed_item_test.proto", "TimedItem",
+		testdyn.Field("id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+		testdyn.Field("name", descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		testdyn.Field("created_at", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, testdyn.Timestamp),
+		testdyn.Field("updated_at", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, testdyn.Timestamp))
+}
+
+// TestWithTimestamps 单元测试：时间戳列由MySQL维护（建表带DEFAULT/ON UPDATE），
+// 不出现在INSERT/UPDATE参数中，查询结果仍能读回proto Timestamp字段
+func TestWithTimestamps(t *testing.T) {
+	msg := newTimedTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfUint64(7))
+	msg.Set(fields.ByName("name"), protoreflect.ValueOfString("sword"))
+	msg.Set(fields.ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.Now().ProtoReflect()))
+
+	table := newMessageTable(msg, WithPrimaryKey("id"), WithTimestamps("created_at", "updated_at"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("时间戳配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"`created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT",
+		"`updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	insertSQL, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	if strings.Contains(insertSQL.Sql, "created_at") || strings.Contains(insertSQL.Sql, "updated_at") || len(insertSQL.Args) != 2 {
+		t.Errorf("INSERT不应包含时间戳列: sql=%s args=%v", insertSQL.Sql, insertSQL.Args)
+	}
+	batchSQL, err := table.GetBatchInsertSQLWithArgs([]proto.Message{msg, msg})
+	if err != nil {
+		t.Fatalf("生成批量INSERT失败: %v", err)
+	}
+	if strings.Contains(batchSQL.Sql, "created_at") || len(batchSQL.Args) != 4 {
+		t.Errorf("批量INSERT不应包含时间戳列: sql=%s args=%v", batchSQL.Sql, batchSQL.Args)
+	}
+
+	updateSQL, err := table.GetUpdateSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成UPDATE失败: %v", err)
+	}
+	if strings.Contains(updateSQL.Sql, "created_at") {
+		t.Errorf("UPDATE不应写时间戳列: %s", updateSQL.Sql)
+	}
+
+	if !strings.Contains(table.GetSelectSQL(false), "`created_at`, `updated_at`") {
+		t.Errorf("SELECT应仍读取时间戳列: %s", table.GetSelectSQL(false))
+	}
+	read := dynamicpb.NewMessage(msg.Descriptor())
+	if err := pbconv.ParseFromString(read, []string{"7", "sword", "2024-05-06 07:08:09", "2024-05-06 08:00:00"}); err != nil {
+		t.Fatalf("解析查询结果失败: %v", err)
+	}
+	got := read.Get(fields.ByName("updated_at")).Message().Interface().(*timestamppb.Timestamp)
+	if got.AsTime().Format("2006-01-02 15:04:05") != "2024-05-06 08:00:00" {
+		t.Errorf("updated_at应读回proto Timestamp，实际 %v", got.AsTime())
+	}
+
+	bad := newMessageTable(msg, WithTimestamps("name", ""))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("非Timestamp字段应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestUpdateFieldsRejectsDBGeneratedFields 单元测试：按字段名显式更新WithTimestamps时间戳列或与字段同名的生成列时
+// 返回ErrInvalidTableOption且不下发SQL，非字段的生成列返回ErrFieldNotFound；DB与GormDB一致
+func TestUpdateFieldsRejectsDBGeneratedFields(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	msg := newTimedTestMessage(t)
+	msg.Set(msg.Descriptor().Fields().ByName("id"), protoreflect.ValueOfUint64(7))
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(msg, WithPrimaryKey("id"), WithTimestamps("created_at", "updated_at"))
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"),
+		WithGeneratedColumn("full_addr", "CONCAT(`ip`, ':', `port`)", "STORED"),
+		WithGeneratedColumn("group_id", "`port` + 1", "VIRTUAL"))
+	gormDB := NewGormDB(nil, "")
+	gormDB.Tables = pdb.Tables
+
+	row := &testpb.GolangTest{Id: 1, GroupId: 2}
+	for _, field := range []string{"created_at", "updated_at"} {
+		if err := pdb.UpdateFieldsByPK(msg, "name", field); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("UpdateFieldsByPK更新时间戳列%s应返回ErrInvalidTableOption，实际: %v", field, err)
+		}
+		if err := pdb.UpdateKVByPK(msg, field, "2024-05-06 07:08:09"); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("UpdateKVByPK更新时间戳列%s应返回ErrInvalidTableOption，实际: %v", field, err)
+		}
+		if err := gormDB.UpdateFieldsByPK(msg, field); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("GormDB.UpdateFieldsByPK更新时间戳列%s应返回ErrInvalidTableOption，实际: %v", field, err)
+		}
+	}
+	if err := pdb.UpdateFieldsByPK(row, "group_id"); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("UpdateFieldsByPK更新生成列应返回ErrInvalidTableOption，实际: %v", err)
+	}
+	if _, err := pdb.UpdateFieldsIfVersion(row, "port", "group_id"); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("UpdateFieldsIfVersion更新生成列应返回ErrInvalidTableOption，实际: %v", err)
+	}
+	if err := gormDB.UpdateKVByPK(row, "group_id", 3); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("GormDB.UpdateKVByPK更新生成列应返回ErrInvalidTableOption，实际: %v", err)
+	}
+	if err := pdb.UpdateFieldsByPK(row, "full_addr"); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("非字段的生成列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if execs := fake.recorded(); len(execs) != 0 {
+		t.Errorf("被拒绝的更新不应下发SQL，实际: %+v", execs)
+	}
+}
+
+// TestReplaceAllByKeyValidation 单元测试：父键不一致/字段不存在/空列表时不访问数据库直接报错
+func TestReplaceAllByKeyValidation(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	rows := []proto.Message{
+		&testpb.GolangTest{Id: 1, PlayerId: 100},
+		&testpb.GolangTest{Id: 2, PlayerId: 101},
+	}
+	if err := pdb.ReplaceAllByKey("player_id", 100, rows); err == nil || !strings.Contains(err.Error(), "player_id") {
+		t.Errorf("父键不一致应报错，实际: %v", err)
+	}
+	if err := pdb.ReplaceAllByKey("no_such_field", 100, rows[:1]); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("字段不存在应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if err := pdb.ReplaceAllByKey("player_id", 100, nil); err == nil {
+		t.Error("空列表应报错")
+	}
+}
+
+// TestReplaceAllByKeyStoredForm 单元测试：键值按列的存储格式比较与绑定（原生ENUM列用值名）
+func TestReplaceAllByKeyStoredForm(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	msg := newPresenceTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(msg, WithPrimaryKey("id"), WithNativeEnum("state"))
+
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfUint64(7))
+	msg.Set(fields.ByName("state"), protoreflect.ValueOfEnum(1))
+	if err := pdb.ReplaceAllByKey("state", 1, []proto.Message{msg}); err != nil {
+		t.Fatalf("键值与消息一致时不应报错: %v", err)
+	}
+	if del := fake.recorded()[0]; !strings.HasPrefix(del.query, "DELETE FROM ") || fmt.Sprint(del.values()) != "[ONLINE]" {
+		t.Errorf("DELETE应按ENUM值名绑定: %s %v", del.query, del.values())
+	}
+	if err := pdb.ReplaceAllByKey("state", "AWAY", []proto.Message{msg}); err == nil || !strings.Contains(err.Error(), "state") {
+		t.Errorf("键值与消息不一致应报错，实际: %v", err)
+	}
+}
+
+// TestReplaceAllByKey 集成测试：按父键整体替换，旧行删除、新行写入，其他父键的数据不受影响
+func TestReplaceAllByKey(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+
+	recreateTestTable(t, db, pdb, testTable)
+	old := []proto.Message{
+		&testpb.GolangTest{Id: 8001, PlayerId: 8000, Port: 1},
+		&testpb.GolangTest{Id: 8002, PlayerId: 8000, Port: 2},
+		&testpb.GolangTest{Id: 8101, PlayerId: 8100, Port: 3},
+	}
+	if err := pdb.BatchInsert(old); err != nil {
+		t.Fatalf("准备数据失败: %v", err)
+	}
+
+	fresh := []proto.Message{
+		&testpb.GolangTest{Id: 8002, PlayerId: 8000, Port: 20},
+		&testpb.GolangTest{Id: 8003, PlayerId: 8000, Port: 30},
+	}
+	if err := pdb.ReplaceAllByKey("player_id", uint64(8000), fresh); err != nil {
+		t.Fatalf("ReplaceAllByKey失败: %v", err)
+	}
+
+	if ok, err := pdb.ExistsByPK(&testpb.GolangTest{Id: 8001}); err != nil || ok {
+		t.Errorf("旧行应被删除: ok=%v, err=%v", ok, err)
+	}
+	got := &testpb.GolangTest{Id: 8002}
+	if err := pdb.FindOneByPK(got); err != nil || got.Port != 20 {
+		t.Errorf("同主键行应替换为新数据: port=%d, err=%v", got.Port, err)
+	}
+	if n, err := pdb.CountByWhereWithArgs(testTable, "player_id = ?", []interface{}{8000}); err != nil || n != 2 {
+		t.Errorf("父键下应只剩2行新数据: n=%d, err=%v", n, err)
+	}
+	if ok, err := pdb.ExistsByPK(&testpb.GolangTest{Id: 8101}); err != nil || !ok {
+		t.Errorf("其他父键的数据不应受影响: ok=%v, err=%v", ok, err)
+	}
+}
+
+// TestEscapeMySQLComment 单元测试：反斜杠先于单引号转义（结尾反斜杠不会吃掉闭合引号），
+// 控制字符被转义/去掉，超长注释截断到2048字节以内且不截断半个字符
+func TestEscapeMySQLComment(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`trailing\`, `trailing\\`},
+		{`it's`, `it\'s`},
+		{`a\'b`, `a\\\'b`},
+		{"nul\x00end", `nul\0end`},
+		{"line1\nline2\r\tx", "line1 line2  x"},
+		{"bell\x07del\x7f", "belldel"},
+		{"中文注释", "中文注释"},
+	}
+	for _, c := range cases {
+		if got := escapeMySQLComment(c.in); got != c.want {
+			t.Errorf("escapeMySQLComment(%q) = %q, 期望 %q", c.in, got, c.want)
+		}
+	}
+
+	long := escapeMySQLComment(strings.Repeat("表", 1000))
+	if len(long) > mysqlMaxTableCommentLen || !utf8.ValidString(long) {
+		t.Errorf("超长注释应截断为合法UTF-8且不超过%d字节，实际%d字节", mysqlMaxTableCommentLen, len(long))
+	}
+
+	createSQL := newMessageTable(&testpb.GolangTest{}, WithTableName(`t\`)).GetCreateTableSQL()
+	if !strings.HasSuffix(createSQL, `COMMENT='t\\';`) {
+		t.Errorf("表名结尾的反斜杠应被转义，实际: %s", createSQL)
+	}
+}
+
+// TestQueryIntoList 集成测试：原生SQL按列名解析到列表元素（列顺序与字段声明不同、带额外列），追加而不清空
+func TestQueryIntoList(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	if err := pdb.BatchInsert([]proto.Message{
+		&testpb.GolangTest{Id: 9701, GroupId: 97, Ip: "10.97.0.1", Port: 1},
+		&testpb.GolangTest{Id: 9702, GroupId: 97, Ip: "10.97.0.2", Port: 2},
+	}); err != nil {
+		t.Fatalf("准备数据失败: %v", err)
+	}
+
+	list := &testpb.GolangTestList{TestList: []*testpb.GolangTest{{Id: 1}}}
+	rawSQL := "SELECT port, ip, id, COUNT(*) OVER () AS total FROM " + testTableSQLName(testTable) +
+		" WHERE group_id = ? ORDER BY id"
+	if err := pdb.QueryIntoList(list, rawSQL, 97); err != nil {
+		t.Fatalf("QueryIntoList失败: %v", err)
+	}
+	if len(list.TestList) != 3 {
+		t.Fatalf("应在已有元素后追加2行，实际%d个元素", len(list.TestList))
+	}
+	got := list.TestList[2]
+	if got.Id != 9702 || got.Ip != "10.97.0.2" || got.Port != 2 {
+		t.Errorf("按列名解析结果不符: %v", got)
+	}
+}
+
+// TestInsertPresentSQL 单元测试：只有已设置的字段进入INSERT列清单，未设置的列交给DEFAULT
+func TestInsertPresentSQL(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	sqlWithArgs, err := table.GetInsertPresentSQLWithArgs(&testpb.GolangTest{Id: 3, Ip: "10.0.0.3"})
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	want := "INSERT INTO `golang_test` (`id`, `ip`) VALUES (?, ?)"
+	if sqlWithArgs.Sql != want {
+		t.Errorf("SQL不符:\n实际: %s\n期望: %s", sqlWithArgs.Sql, want)
+	}
+	if len(sqlWithArgs.Args) != 2 || sqlWithArgs.Args[0] != "3" || sqlWithArgs.Args[1] != "10.0.0.3" {
+		t.Errorf("参数不符: %v", sqlWithArgs.Args)
+	}
+
+	empty, err := table.GetInsertPresentSQLWithArgs(&testpb.GolangTest{})
+	if err != nil {
+		t.Fatalf("生成空INSERT失败: %v", err)
+	}
+	if empty.Sql != "INSERT INTO `golang_test` () VALUES ()" || len(empty.Args) != 0 {
+		t.Errorf("全部未设置时应全部走DEFAULT: sql=%s args=%v", empty.Sql, empty.Args)
+	}
+}
+
+// TestGetUpdateSQLWithArgs 单元测试：按主键更新只写已设置字段，值全部走占位符参数；无可更新字段时报错
+func TestGetUpdateSQLWithArgs(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	sqlWithArgs, err := table.GetUpdateSQLWithArgs(&testpb.GolangTest{Id: 5, Ip: "10.0.0.5", Port: 80})
+	if err != nil {
+		t.Fatalf("生成UPDATE失败: %v", err)
+	}
+	want := "UPDATE `golang_test` SET `id` = ?, `ip` = ?, `port` = ? WHERE `id` = ?"
+	if sqlWithArgs.Sql != want {
+		t.Errorf("SQL不符:\n实际: %s\n期望: %s", sqlWithArgs.Sql, want)
+	}
+	wantArgs := []interface{}{"5", "10.0.0.5", "80", "5"}
+	if fmt.Sprint(sqlWithArgs.Args) != fmt.Sprint(wantArgs) {
+		t.Errorf("参数不符: 实际%v, 期望%v", sqlWithArgs.Args, wantArgs)
+	}
+
+	if _, err := table.GetUpdateSQLWithArgs(&testpb.GolangTest{}); err == nil {
+		t.Error("没有已设置字段时应报错")
+	}
+}
+
+// TestInjectionValueStaysInArgs 单元测试：带引号/注释的恶意字符串只出现在参数中，不进入SQL文本
+func TestInjectionValueStaysInArgs(t *testing.T) {
+	const evil = "x'); DROP TABLE golang_test; -- \\'"
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	msg := &testpb.GolangTest{Id: 1, Ip: evil}
+
+	insertSQL, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	replaceSQL, err := table.GetReplaceSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成REPLACE失败: %v", err)
+	}
+	updateSQL, err := table.GetUpdateSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成UPDATE失败: %v", err)
+	}
+	for _, stmt := range []*SqlWithArgs{insertSQL, replaceSQL, updateSQL} {
+		if strings.Contains(stmt.Sql, "DROP") {
+			t.Errorf("恶意值被拼进了SQL: %s", stmt.Sql)
+		}
+		found := false
+		for _, arg := range stmt.Args {
+			if arg == evil {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("恶意值应原样作为参数传递: sql=%s args=%v", stmt.Sql, stmt.Args)
+		}
+	}
+}
+
+// TestInjectionValueStoredLiterally 集成测试：恶意字符串按字面量存储并原样读回，表不受影响
+func TestInjectionValueStoredLiterally(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	const evil = "x'); DROP TABLE golang_test; -- \\'"
+	if err := pdb.Insert(&testpb.GolangTest{Id: 6021, Ip: evil}); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	if err := pdb.Update(&testpb.GolangTest{Id: 6021, Ip: evil + evil}); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	got := &testpb.GolangTest{Id: 6021}
+	if err := pdb.FindOneByPK(got); err != nil {
+		t.Fatalf("回查失败（表可能被删）: %v", err)
+	}
+	if got.Ip != evil+evil {
+		t.Errorf("恶意值应按字面量存储: 实际%q", got.Ip)
+	}
+}
+
+// TestWithIgnoredFields 单元测试：被忽略的字段不建列、不进入读写SQL，解析查询结果时保持内存值不变
+func TestWithIgnoredFields(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithIgnoredFields("player"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	if createSQL := table.GetCreateTableSQL(); strings.Contains(createSQL, "`player`") {
+		t.Errorf("被忽略字段不应建列: %s", createSQL)
+	}
+	if selectSQL := table.GetSelectSQL(false); strings.Contains(selectSQL, "`player`") {
+		t.Errorf("SELECT不应包含被忽略字段: %s", selectSQL)
+	}
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "10.0.0.1", Player: &testpb.Player{PlayerId: 9}}
+	insertSQL, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	if strings.Contains(insertSQL.Sql, "`player`") || len(insertSQL.Args) != len(table.columns) {
+		t.Errorf("INSERT不应包含被忽略字段: sql=%s args=%d", insertSQL.Sql, len(insertSQL.Args))
+	}
+	updateSQL, err := table.GetUpdateSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成UPDATE失败: %v", err)
+	}
+	if strings.Contains(updateSQL.Sql, "`player`") {
+		t.Errorf("UPDATE不应包含被忽略字段: %s", updateSQL.Sql)
+	}
+	if _, ok := table.fieldNameToDesc["player"]; ok {
+		t.Error("被忽略字段不应可按列名查找（如UpdateFieldsByPK）")
+	}
+
+	// 模拟一行查询结果：列与table.columns一一对应
+	row := make([][]byte, len(table.columns))
+	for i, fd := range table.columns {
+		if fd.Name() == "port" {
+			row[i] = []byte("8080")
+		}
+	}
+	if err := table.parseRow(msg, row); err != nil {
+		t.Fatalf("解析查询结果失败: %v", err)
+	}
+	if msg.Port != 8080 || msg.Player.GetPlayerId() != 9 {
+		t.Errorf("应只解析持久化列，被忽略字段保持内存值: port=%d player=%v", msg.Port, msg.Player)
+	}
+
+	if err := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithIgnoredFields("id")).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("忽略主键应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestWithDatabaseSQL 单元测试：两张表分属两个库，生成的DDL/DML都以 `库`.`表` 引用
+func TestWithDatabaseSQL(t *testing.T) {
+	pdb := NewDB()
+	pdb.DBName = "main"
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithDatabase("game"))
+	pdb.RegisterTable(&testpb.GolangTest1{}, WithPrimaryKey("id"), WithDatabase("log"))
+	game := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+	logTable := pdb.Tables[GetTableName(&testpb.GolangTest1{})]
+
+	if got := pdb.tableSchema(game); got != "game" {
+		t.Errorf("game表应查询game库的information_schema，实际%s", got)
+	}
+	if got := pdb.tableSchema(logTable); got != "log" {
+		t.Errorf("log表应查询log库的information_schema，实际%s", got)
+	}
+	if !strings.HasPrefix(game.GetCreateTableSQL(), "CREATE TABLE IF NOT EXISTS `game`.`golang_test` (") {
+		t.Errorf("建表SQL应带库名: %s", game.GetCreateTableSQL())
+	}
+	if !strings.Contains(logTable.GetSelectSQL(false), " FROM `log`.`golang_test1`") {
+		t.Errorf("SELECT应带库名: %s", logTable.GetSelectSQL(false))
+	}
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "10.0.0.1"}
+	insertSQL, err := game.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	updateSQL, err := game.GetUpdateSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成UPDATE失败: %v", err)
+	}
+	deleteSQL, err := game.GetDeleteSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成DELETE失败: %v", err)
+	}
+	for _, stmt := range []string{insertSQL.Sql, updateSQL.Sql, deleteSQL.Sql} {
+		if !strings.Contains(stmt, "`game`.`golang_test`") {
+			t.Errorf("DML应带库名: %s", stmt)
+		}
+	}
+
+	plain := newMessageTable(&testpb.GolangTest{})
+	if plain.sqlName() != "`golang_test`" || pdb.tableSchema(plain) != "main" {
+		t.Errorf("未指定库时应沿用DBName: sqlName=%s schema=%s", plain.sqlName(), pdb.tableSchema(plain))
+	}
+}
+
+// TestWithDatabaseIntegration 集成测试：同一连接池读写另一个库中的表
+func TestWithDatabaseIntegration(t *testing.T) {
+	pdb := NewDB()
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+
+	logSchema := pdb.DBName + "_log"
+	if _, err := db.Exec("CREATE DATABASE IF NOT EXISTS " + escapeMySQLName(logSchema)); err != nil {
+		t.Skipf("无权限创建第二个库，跳过: %v", err)
+	}
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	pdb.RegisterTable(&testpb.GolangTest1{}, WithPrimaryKey("id"), WithDatabase(logSchema))
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+	recreateTestTable(t, db, pdb, &testpb.GolangTest1{})
+
+	if err := pdb.UpdateTableField(&testpb.GolangTest1{}); err != nil {
+		t.Fatalf("同步另一个库中的表结构失败: %v", err)
+	}
+	if err := pdb.Insert(&testpb.GolangTest1{Id: 6041, Ip: "10.60.4.1"}); err != nil {
+		t.Fatalf("写入另一个库失败: %v", err)
+	}
+	got := &testpb.GolangTest1{Id: 6041}
+	if err := pdb.FindOneByPK(got); err != nil || got.Ip != "10.60.4.1" {
+		t.Errorf("读取另一个库失败: ip=%q, err=%v", got.Ip, err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + escapeMySQLName(logSchema) + ".`golang_test1` WHERE id = 6041").Scan(&count); err != nil || count != 1 {
+		t.Errorf("数据应写入%s库: count=%d, err=%v", logSchema, count, err)
+	}
+}
+
+// TestStreamMultiByWhereClauses 集成测试：多表多行结果集逐行回调，每行都是新实例
+func TestStreamMultiByWhereClauses(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	pdb.RegisterTable(&testpb.GolangTest1{}, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+	recreateTestTable(t, db, pdb, &testpb.GolangTest1{})
+
+	if err := pdb.BatchInsert([]proto.Message{
+		&testpb.GolangTest{Id: 6051, GroupId: 605},
+		&testpb.GolangTest{Id: 6052, GroupId: 605},
+		&testpb.GolangTest{Id: 6053, GroupId: 605},
+	}); err != nil {
+		t.Fatalf("准备golang_test数据失败: %v", err)
+	}
+	if err := pdb.Insert(&testpb.GolangTest1{Id: 6054, GroupId: 605, ExtraInfo: "log"}); err != nil {
+		t.Fatalf("准备golang_test1数据失败: %v", err)
+	}
+
+	var ids [2][]uint32
+	err := pdb.StreamMultiByWhereClauses([]MultiQuery{
+		{Message: &testpb.GolangTest{}, WhereClause: "group_id = ? ORDER BY id", WhereArgs: []interface{}{605}},
+		{Message: &testpb.GolangTest1{}, WhereClause: "group_id = ?", WhereArgs: []interface{}{605}},
+	}, func(idx int, row proto.Message) error {
+		switch msg := row.(type) {
+		case *testpb.GolangTest:
+			ids[idx] = append(ids[idx], msg.Id)
+		case *testpb.GolangTest1:
+			if msg.ExtraInfo != "log" {
+				t.Errorf("golang_test1行解析错误: %v", msg)
+			}
+			ids[idx] = append(ids[idx], msg.Id)
+		default:
+			t.Errorf("回调收到未知类型 %T", row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamMultiByWhereClauses失败: %v", err)
+	}
+	if fmt.Sprint(ids[0]) != "[6051 6052 6053]" || fmt.Sprint(ids[1]) != "[6054]" {
+		t.Errorf("各结果集的行不符: %v", ids)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = pdb.StreamMultiByWhereClauses([]MultiQuery{
+		{Message: &testpb.GolangTest{}, WhereClause: "group_id = ?", WhereArgs: []interface{}{605}},
+	}, func(int, proto.Message) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("回调返回错误时应立即停止: calls=%d, err=%v", calls, err)
+	}
+}
+
+// TestSetBatchSize 单元测试：自定义批量大小3写7行应拆成3/3/1三条INSERT；非法批量大小报错
+func TestSetBatchSize(t *testing.T) {
+	sqlDB, driver := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	if err := pdb.SetBatchSize(0); err == nil {
+		t.Error("批量大小为0应报错")
+	}
+	if err := pdb.SetBatchSize(3); err != nil {
+		t.Fatalf("SetBatchSize失败: %v", err)
+	}
+
+	rows := make([]proto.Message, 7)
+	for i := range rows {
+		rows[i] = &testpb.GolangTest{Id: uint32(i + 1)}
+	}
+	if err := pdb.BatchInsert(rows); err != nil {
+		t.Fatalf("BatchInsert失败: %v", err)
+	}
+
+	execs := driver.recorded()
+	if len(execs) != 3 {
+		t.Fatalf("7行按3条一批应执行3次，实际%d次", len(execs))
+	}
+	fieldCount := len(pdb.Tables[GetTableName(&testpb.GolangTest{})].writeFields)
+	for i, want := range []int{3, 3, 1} {
+		if got := len(execs[i].args) / fieldCount; got != want {
+			t.Errorf("第%d批应有%d行，实际%d行", i+1, want, got)
+		}
+	}
+
+	// 派生实例（WithContext）沿用批量大小
+	if got := pdb.WithContext(context.Background()).batchLimit(); got != 3 {
+		t.Errorf("WithContext派生实例应沿用批量大小3，实际%d", got)
+	}
+
+	table := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+	if _, err := table.getBatchInsertSQLWithArgs(rows, 3); !errors.Is(err, ErrBatchSizeExceeded) {
+		t.Errorf("超过上限应返回ErrBatchSizeExceeded，实际: %v", err)
+	}
+}
+
+// TestAggregateColumnValidation 单元测试：聚合列不存在或非数值时不访问数据库直接报错
+func TestAggregateColumnValidation(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	if _, err := pdb.SumColumn(&testpb.GolangTest{}, "no_such_field", "", nil); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("不存在的列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	for _, column := range []string{"ip", "player"} {
+		if _, err := pdb.AvgColumn(&testpb.GolangTestList{}, column, "", nil); err == nil || !strings.Contains(err.Error(), "not numeric") {
+			t.Errorf("非数值列%s应报错，实际: %v", column, err)
+		}
+	}
+}
+
+// TestAggregateColumns 集成测试：SUM/AVG/MAX/MIN按条件聚合，无匹配行时返回0
+func TestAggregateColumns(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	if err := pdb.BatchInsert([]proto.Message{
+		&testpb.GolangTest{Id: 6071, GroupId: 607, Port: 10},
+		&testpb.GolangTest{Id: 6072, GroupId: 607, Port: 20},
+		&testpb.GolangTest{Id: 6073, GroupId: 607, Port: 60},
+	}); err != nil {
+		t.Fatalf("准备数据失败: %v", err)
+	}
+
+	where, args := "group_id = ?", []interface{}{607}
+	cases := []struct {
+		name string
+		fn   func(proto.Message, string, string, []interface{}) (float64, error)
+		want float64
+	}{
+		{"SUM", pdb.SumColumn, 90},
+		{"AVG", pdb.AvgColumn, 30},
+		{"MAX", pdb.MaxColumn, 60},
+		{"MIN", pdb.MinColumn, 10},
+	}
+	for _, c := range cases {
+		got, err := c.fn(testTable, "port", where, args)
+		if err != nil || got != c.want {
+			t.Errorf("%s(port) = %v, err=%v, 期望%v", c.name, got, err, c.want)
+		}
+	}
+
+	if got, err := pdb.SumColumn(testTable, "port", "group_id = ?", []interface{}{-1}); err != nil || got != 0 {
+		t.Errorf("无匹配行时应返回0: got=%v, err=%v", got, err)
+	}
+}
+
+// TestWithAutoIncrementStart 单元测试：配置自增起始值后建表语句带 AUTO_INCREMENT=n，无自增字段时不生成
+func TestWithAutoIncrementStart(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("id"), WithAutoIncrementStart(100000))
+	if stmt := table.GetCreateTableSQL(); !strings.Contains(stmt, ") ENGINE=InnoDB AUTO_INCREMENT=100000 DEFAULT CHARSET=") {
+		t.Errorf("建表语句应包含 AUTO_INCREMENT=100000: %s", stmt)
+	}
+
+	table = newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey(""), WithAutoIncrementStart(100000))
+	if stmt := table.GetCreateTableSQL(); strings.Contains(stmt, "AUTO_INCREMENT") {
+		t.Errorf("无自增字段时不应生成 AUTO_INCREMENT: %s", stmt)
+	}
+
+	table = newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("id"))
+	if stmt := table.GetCreateTableSQL(); strings.Contains(stmt, "AUTO_INCREMENT=") {
+		t.Errorf("未设置起始值时不应生成 AUTO_INCREMENT=: %s", stmt)
+	}
+}
+
+// TestBatchInsertPartial 单元测试：第3批失败时返回前两批已写入的行数，重试可从该位置继续
+func TestBatchInsertPartial(t *testing.T) {
+	sqlDB, driver := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	if err := pdb.SetBatchSize(2); err != nil {
+		t.Fatalf("SetBatchSize失败: %v", err)
+	}
+
+	rows := make([]proto.Message, 7)
+	for i := range rows {
+		rows[i] = &testpb.GolangTest{Id: uint32(i + 1)}
+	}
+
+	driver.execErr = errors.New("Lock wait timeout exceeded")
+	driver.execErrAfter = 2
+	succeeded, err := pdb.BatchInsertPartial(rows)
+	if err == nil || !strings.Contains(err.Error(), "Lock wait timeout") {
+		t.Fatalf("第3批应失败，实际: %v", err)
+	}
+	if succeeded != 4 {
+		t.Errorf("前两批共4行已写入，实际succeeded=%d", succeeded)
+	}
+	if got := len(driver.recorded()); got != 3 {
+		t.Errorf("失败后不应继续执行后续批次，实际执行%d次", got)
+	}
+
+	// 从失败边界续传
+	driver.execErr = nil
+	n, err := pdb.BatchInsertPartial(rows[succeeded:])
+	if err != nil || n != 3 {
+		t.Errorf("续传剩余3行应全部成功: n=%d, err=%v", n, err)
+	}
+
+	if n, err := pdb.BatchInsertPartial(nil); err == nil || n != 0 {
+		t.Errorf("空消息应报错且succeeded为0: n=%d, err=%v", n, err)
+	}
+}
+
+// newPositionTestMessage 构造带经纬度与POINT字段的动态消息（testdyn.Position）
+func newPositionTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	return testdyn.NewMessage(t, "position_test.proto", "Position",
+		testdyn.Field("player_id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+		testdyn.Field("lat", descriptorpb.FieldDescriptorProto_TYPE_DOUBLE),
+		testdyn.Field("lng", descriptorpb.FieldDescriptorProto_TYPE_DOUBLE),
+		testdyn.Field("location", descriptorpb.FieldDescriptorProto_TYPE_STRING))
+}
+
+// TestWithSpatialPoint 单元测试：POINT列建表/索引、写入时由经纬度合成WKT、查询以ST_AsText读回
+func TestWithSpatialPoint(t *testing.T) {
+	msg := newPositionTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	msg.Set(fields.ByName("player_id"), protoreflect.ValueOfUint64(1))
+	msg.Set(fields.ByName("lat"), protoreflect.ValueOfFloat64(31.2304))
+	msg.Set(fields.ByName("lng"), protoreflect.ValueOfFloat64(121.4737))
+
+	table := newMessageTable(msg, WithPrimaryKey("player_id"), WithSpatialPoint("location", "lat", "lng"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("POINT配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"`location` POINT NOT NULL SRID 4326 COMMENT",
+		"SPATIAL INDEX `sp_testdyn.Position_location` (`location`)",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	insertSQL, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	if !strings.HasSuffix(insertSQL.Sql, "VALUES (?, ?, ?, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))") {
+		t.Errorf("POINT列应使用ST_GeomFromText占位: %s", insertSQL.Sql)
+	}
+	if got := insertSQL.Args[3]; got != "POINT(121.4737 31.2304)" {
+		t.Errorf("POINT参数应为 POINT(lng lat)，实际: %v", got)
+	}
+
+	updateSQL, err := table.GetUpdateSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成UPDATE失败: %v", err)
+	}
+	if !strings.Contains(updateSQL.Sql, "`location` = ST_GeomFromText(?, 4326, 'axis-order=long-lat')") {
+		t.Errorf("设置了经纬度时UPDATE应同步POINT列: %s", updateSQL.Sql)
+	}
+
+	// 只改纬度：不能按经度0重写POINT列
+	partial := dynamicpb.NewMessage(msg.Descriptor())
+	partial.Set(fields.ByName("player_id"), protoreflect.ValueOfUint64(1))
+	partial.Set(fields.ByName("lat"), protoreflect.ValueOfFloat64(30.5))
+	partialSQL, err := table.GetUpdateSQLWithArgs(partial)
+	if err != nil {
+		t.Fatalf("生成部分UPDATE失败: %v", err)
+	}
+	if strings.Contains(partialSQL.Sql, "`location`") || !strings.Contains(partialSQL.Sql, "`lat` = ?") {
+		t.Errorf("只设置一个坐标时不应改POINT列: %s", partialSQL.Sql)
+	}
+
+	if !strings.Contains(table.selectFieldsSQL, "ST_AsText(`location`, 'axis-order=long-lat') AS `location`") {
+		t.Errorf("SELECT应以ST_AsText读回POINT列: %s", table.selectFieldsSQL)
+	}
+
+	for _, opt := range []TableOption{
+		WithSpatialPoint("lat", "lat", "lng"),
+		WithSpatialPoint("location", "player_id", "lng"),
+		WithSpatialPoint("location", "lat", "no_such_field"),
+	} {
+		bad := newMessageTable(msg, WithPrimaryKey("player_id"), opt)
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法POINT配置应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestDiffColumns 单元测试：线上多一列、少一列、一列类型不兼容时，SchemaDiff分别列出
+func TestDiffColumns(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	current := make(map[string]string, len(table.columns))
+	for _, fd := range table.columns {
+		current[string(fd.Name())] = table.getMySQLFieldType(fd)
+	}
+	if diff := table.diffColumns(current); !diff.Empty() {
+		t.Fatalf("结构一致时差异应为空: %+v", diff)
+	}
+
+	delete(current, "ip")
+	current["port"] = "varchar(32)"
+	current["legacy_flag"] = "tinyint(1)"
+
+	diff := table.diffColumns(current)
+	if !slices.Equal(diff.MissingColumns, []string{"ip"}) {
+		t.Errorf("MissingColumns应为[ip]，实际: %v", diff.MissingColumns)
+	}
+	if !slices.Equal(diff.ExtraColumns, []string{"legacy_flag"}) {
+		t.Errorf("ExtraColumns应为[legacy_flag]，实际: %v", diff.ExtraColumns)
+	}
+	if len(diff.TypeMismatches) != 1 || diff.TypeMismatches[0].Name != "port" ||
+		diff.TypeMismatches[0].Current != "varchar(32)" || diff.TypeMismatches[0].Expected == "" {
+		t.Errorf("TypeMismatches应只包含port，实际: %+v", diff.TypeMismatches)
+	}
+	if diff.Empty() {
+		t.Error("有差异时Empty应为false")
+	}
+}
+
+// TestDiffSchemaIgnoresColumnCache 单元测试：DiffSchema直接读INFORMATION_SCHEMA，不使用可能过期的列缓存
+func TestDiffSchemaIgnoresColumnCache(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	table := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+	live := [][]driver.Value{{"legacy_flag", "tinyint", ""}}
+	stale := map[string]string{"legacy_flag": "tinyint"}
+	for _, field := range table.columns {
+		name := string(field.Name())
+		live = append(live, []driver.Value{name, table.getMySQLFieldType(field), ""})
+		stale[name] = table.getMySQLFieldType(field)
+	}
+	table.cachedColumns = stale // 缓存中还有已被表外DROP的legacy_flag
+	fake.queryRows = live[1:]
+
+	diff, err := pdb.DiffSchema(&testpb.GolangTest{})
+	if err != nil {
+		t.Fatalf("DiffSchema失败: %v", err)
+	}
+	if !diff.Empty() {
+		t.Errorf("应按线上表结构比对而不是列缓存: %+v", diff)
+	}
+	if queries := fake.recordedQueries(); len(queries) != 1 || !strings.Contains(queries[0].query, "INFORMATION_SCHEMA.COLUMNS") {
+		t.Errorf("应查询INFORMATION_SCHEMA: %+v", queries)
+	}
+}
+
+// TestDiffSchema 集成测试：给线上表加一列、改一列类型后DiffSchema能识别
+func TestDiffSchema(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	// 先读一次表结构（填充列缓存），之后表外的ALTER仍应被发现
+	if _, err := pdb.getTableColumns(GetTableName(testTable)); err != nil {
+		t.Fatalf("读取表结构失败: %v", err)
+	}
+	tableName := testTableSQLName(testTable)
+	for _, stmt := range []string{
+		"ALTER TABLE " + tableName + " ADD COLUMN `legacy_flag` TINYINT NOT NULL DEFAULT 0",
+		"ALTER TABLE " + tableName + " MODIFY COLUMN `port` VARCHAR(32) NOT NULL DEFAULT ''",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("修改表结构失败: %v", err)
+		}
+	}
+
+	diff, err := pdb.DiffSchema(testTable)
+	if err != nil {
+		t.Fatalf("DiffSchema失败: %v", err)
+	}
+	if !slices.Equal(diff.ExtraColumns, []string{"legacy_flag"}) || len(diff.MissingColumns) != 0 {
+		t.Errorf("应只多出legacy_flag列: %+v", diff)
+	}
+	if len(diff.TypeMismatches) != 1 || diff.TypeMismatches[0].Name != "port" {
+		t.Errorf("port列类型应不一致: %+v", diff.TypeMismatches)
+	}
+}
+
+// TestReadOnly 单元测试：只读模式下所有写操作/建表改表返回ErrReadOnly且不下发任何SQL，查询不受影响
+func TestReadOnly(t *testing.T) {
+	sqlDB, driver := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey(""))
+	pdb.SetReadOnly(true)
+	if !pdb.IsReadOnly() || !pdb.WithContext(context.Background()).IsReadOnly() {
+		t.Error("开启只读后IsReadOnly应为true，派生实例沿用")
+	}
+
+	row := func() *testpb.GolangTest { return &testpb.GolangTest{Id: 1, GroupId: 2, Port: 3} }
+	rows := []proto.Message{row(), &testpb.GolangTest{Id: 2, GroupId: 2}}
+	writes := map[string]func() error{
+		"Insert":              func() error { return pdb.Insert(row()) },
+		"InsertPresent":       func() error { return pdb.InsertPresent(row()) },
+		"BatchInsert":         func() error { return pdb.BatchInsert(rows) },
+		"ReplaceAllByKey":     func() error { return pdb.ReplaceAllByKey("group_id", 2, rows) },
+		"InsertIgnore":        func() error { _, err := pdb.InsertIgnore(row()); return err },
+		"InsertReturningID":   func() error { _, err := pdb.InsertReturningID(row()); return err },
+		"InsertOnDupUpdate":   func() error { return pdb.InsertOnDupUpdate(row()) },
+		"Delete":              func() error { return pdb.Delete(row()) },
+		"DeleteByKV":          func() error { return pdb.DeleteByKV(row(), "group_id", 2) },
+		"DeleteByWhere":       func() error { _, err := pdb.DeleteByWhere(row(), "group_id = ?", []interface{}{2}); return err },
+		"DeleteAll":           func() error { _, err := pdb.DeleteAll(row()); return err },
+		"BatchDelete":         func() error { return pdb.BatchDelete(rows) },
+		"BatchDeleteByKeys":   func() error { _, err := pdb.BatchDeleteByKeys(row(), "id", []interface{}{1}); return err },
+		"Update":              func() error { return pdb.Update(row()) },
+		"UpdateFieldsByPK":    func() error { return pdb.UpdateFieldsByPK(row(), "port") },
+		"UpdateKVByPK":        func() error { return pdb.UpdateKVByPK(row(), "port", 4) },
+		"UpdateManyByWhere":   func() error { _, err := pdb.UpdateManyByWhere(row(), "group_id = ?", []interface{}{2}); return err },
+		"UpdateAll":           func() error { _, err := pdb.UpdateAll(row()); return err },
+		"UpdateIfVersion":     func() error { _, err := pdb.UpdateIfVersion(row(), "group_id"); return err },
+		"Save":                func() error { return pdb.Save(row()) },
+		"BatchSave":           func() error { return pdb.BatchSave(rows) },
+		"IncrByPK":            func() error { return pdb.IncrByPK(row(), "port", 1) },
+		"DecrByPKIfEnough":    func() error { _, err := pdb.DecrByPKIfEnough(row(), "port", 1); return err },
+		"CreateOrUpdateTable": func() error { return pdb.CreateOrUpdateTable(&testpb.GolangTest{}) },
+		"UpdateTableField":    func() error { return pdb.UpdateTableField(&testpb.GolangTest{}) },
+		"SyncAllTables":       func() error { return pdb.SyncAllTables() },
+		"DropTable":           func() error { return pdb.DropTable(&testpb.GolangTest{}) },
+		"ExecDDL":             func() error { return pdb.ExecDDL("ALTER TABLE `golang_test` ENGINE=InnoDB") },
+		"WithContext.Insert":  func() error { return pdb.WithContext(context.Background()).Insert(row()) },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s 在只读模式下应返回ErrReadOnly，实际: %v", name, err)
+		}
+	}
+	if execs := driver.recorded(); len(execs) != 0 {
+		t.Errorf("只读模式下不应下发任何写SQL，实际: %v", execs)
+	}
+
+	list := &testpb.GolangTestList{}
+	if err := pdb.FindAll(list); err != nil {
+		t.Errorf("只读模式下查询应正常执行，实际: %v", err)
+	}
+
+	pdb.SetReadOnly(false)
+	if pdb.IsReadOnly() {
+		t.Error("关闭只读后IsReadOnly应为false")
+	}
+	if err := pdb.Insert(row()); err != nil {
+		t.Errorf("关闭只读后写入应恢复，实际: %v", err)
+	}
+}
+
+// TestBatchInsertContext 单元测试：第2批执行后取消ctx，剩余批次不再执行并返回已提交批数
+func TestBatchInsertContext(t *testing.T) {
+	sqlDB, driver := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	if err := pdb.SetBatchSize(2); err != nil {
+		t.Fatalf("SetBatchSize失败: %v", err)
+	}
+
+	rows := make([]proto.Message, 9)
+	for i := range rows {
+		rows[i] = &testpb.GolangTest{Id: uint32(i + 1)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	driver.onExec = func(n int) {
+		if n == 2 {
+			cancel()
+		}
+	}
+
+	chunks, err := pdb.BatchInsertContext(ctx, rows)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后应返回context.Canceled，实际: %v", err)
+	}
+	if chunks != 2 {
+		t.Errorf("应已提交2批，实际%d批", chunks)
+	}
+	if got := len(driver.recorded()); got != 2 {
+		t.Errorf("取消后不应继续执行剩余批次，实际执行%d次", got)
+	}
+
+	driver.onExec = nil
+	chunks, err = pdb.BatchInsertContext(context.Background(), rows)
+	if err != nil || chunks != 5 {
+		t.Errorf("9行按2条一批应提交5批: chunks=%d, err=%v", chunks, err)
+	}
+
+	// 宽表按占位符上限缩小的批大小与BatchInsertPartial一致；失败时错误中带已写入行数
+	narrow := NewDB()
+	narrow.DB = sqlDB
+	narrow.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithMaxPlaceholders(12))
+	before := len(driver.recorded())
+	driver.execErr, driver.execErrAfter = errors.New("boom"), before+1
+	chunks, err = narrow.BatchInsertContext(context.Background(), rows)
+	if chunks != 1 || err == nil || !strings.Contains(err.Error(), "(2 rows written)") {
+		t.Errorf("每批2行时第2批失败应返回1批且已写入2行: chunks=%d, err=%v", chunks, err)
+	}
+	if got := len(driver.recorded()) - before; got != 2 {
+		t.Errorf("每个chunk应只执行一条INSERT，实际%d条", got)
+	}
+}
+
+// TestStreamChan 单元测试：逐行发送到channel后关闭，错误channel返回nil；ctx取消后goroutine退出并返回ctx错误
+func TestStreamChan(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	// 列顺序：id, ip, port, group_id, player, player_id
+	for i := 1; i <= 3; i++ {
+		id := []byte(strconv.Itoa(i))
+		fake.queryRows = append(fake.queryRows, []driver.Value{id, []byte("10.0.0.1"), []byte("80"), []byte("7"), []byte(""), []byte("0")})
+	}
+
+	rowsCh, errCh := pdb.StreamChan(&testpb.GolangTest{}, "group_id = ?", []interface{}{7})
+	var ids []uint32
+	for row := range rowsCh {
+		msg := row.(*testpb.GolangTest)
+		if msg.GroupId != 7 || msg.Ip != "10.0.0.1" {
+			t.Errorf("行解析错误: %v", msg)
+		}
+		ids = append(ids, msg.Id)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("正常结束时错误channel应为nil，实际: %v", err)
+	}
+	if !slices.Equal(ids, []uint32{1, 2, 3}) {
+		t.Errorf("应按顺序收到3行，实际: %v", ids)
+	}
+
+	// 只读一行后取消，goroutine应退出而不是阻塞
+	ctx, cancel := context.WithCancel(context.Background())
+	rowsCh, errCh = pdb.WithContext(ctx).StreamChan(&testpb.GolangTest{}, "", nil)
+	<-rowsCh
+	cancel()
+	for range rowsCh {
+	}
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应返回context.Canceled，实际: %v", err)
+	}
+
+	_, errCh = pdb.StreamChan(&testpb.GolangTestList{}, "", nil)
+	if err := <-errCh; !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("未注册的消息应返回ErrTableNotFound，实际: %v", err)
+	}
+}
+
+// TestWithColumnMapping 单元测试：字段group_id映射到旧表列grp，DDL/写入/按字段名条件（含ReplaceAllByKey）都使用grp，
+// SELECT以字段名作别名，查询结果仍解析回group_id
+func TestWithColumnMapping(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithIndexes("group_id"),
+		WithColumnMapping(map[string]string{"group_id": "grp"}))
+	table := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+	if err := table.Validate(); err != nil {
+		t.Fatalf("列映射应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	if !strings.Contains(createSQL, "`grp` int unsigned") || strings.Contains(createSQL, "`group_id`") {
+		t.Errorf("建表应使用库列名grp: %s", createSQL)
+	}
+	if !strings.Contains(createSQL, "(`grp`)") {
+		t.Errorf("索引应建在库列名grp上: %s", createSQL)
+	}
+
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1, GroupId: 7}); err != nil {
+		t.Fatalf("Insert失败: %v", err)
+	}
+	if err := pdb.UpdateFieldsByPK(&testpb.GolangTest{Id: 1, GroupId: 8}, "group_id"); err != nil {
+		t.Fatalf("UpdateFieldsByPK失败: %v", err)
+	}
+	execs := fake.recorded()
+	if !strings.Contains(execs[0].query, "`grp`") || !strings.Contains(execs[1].query, "SET `grp` = ?") {
+		t.Errorf("写入应使用库列名grp: %v", execs)
+	}
+
+	// 列顺序：id, ip, port, grp AS group_id, player, player_id
+	fake.queryRows = [][]driver.Value{{[]byte("1"), []byte(""), []byte("0"), []byte("7"), []byte(""), []byte("0")}}
+	loaded := &testpb.GolangTest{}
+	if err := pdb.FindOneByKV(loaded, "group_id", "7"); err != nil {
+		t.Fatalf("FindOneByKV失败: %v", err)
+	}
+	if loaded.GroupId != 7 {
+		t.Errorf("grp列应解析回group_id，实际: %v", loaded)
+	}
+	query := fake.recordedQueries()[0].query
+	if !strings.Contains(query, "`grp` AS `group_id`") || !strings.Contains(query, "WHERE `grp` = ?") {
+		t.Errorf("SELECT应以字段名作别名并按库列名过滤: %s", query)
+	}
+
+	// ReplaceAllByKey按字段名指定父键，DELETE条件使用库列名；传库列名则找不到字段
+	if err := pdb.ReplaceAllByKey("group_id", 7, []proto.Message{&testpb.GolangTest{Id: 2, GroupId: 7}}); err != nil {
+		t.Fatalf("ReplaceAllByKey失败: %v", err)
+	}
+	if execs := fake.recorded(); !strings.Contains(execs[2].query, "WHERE `grp` = ?") {
+		t.Errorf("ReplaceAllByKey应按库列名grp删除: %v", execs[2])
+	}
+	if err := pdb.ReplaceAllByKey("grp", 7, []proto.Message{&testpb.GolangTest{Id: 2, GroupId: 7}}); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("ReplaceAllByKey传库列名应返回ErrFieldNotFound，实际: %v", err)
+	}
+
+	bad := newMessageTable(&testpb.GolangTest{}, WithColumnMapping(map[string]string{"group_id": "port"}))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("映射到已有列名应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestColumnMappingRoundTrip 集成测试：字段名与列名不一致的旧表可以正常读写，原生SQL按列名解析也能映射回字段
+func TestColumnMappingRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"), WithAutoIncrementKey(""),
+		WithColumnMapping(map[string]string{"group_id": "grp"}))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	saved := &testpb.GolangTest{Id: 617, GroupId: 42, Ip: "10.0.0.1"}
+	if err := pdb.Insert(saved); err != nil {
+		t.Fatalf("Insert失败: %v", err)
+	}
+	loaded := &testpb.GolangTest{}
+	if err := pdb.FindOneByKV(loaded, "group_id", "42"); err != nil {
+		t.Fatalf("FindOneByKV失败: %v", err)
+	}
+	if !proto.Equal(saved, loaded) {
+		t.Errorf("读写不一致: 期望%v, 实际%v", saved, loaded)
+	}
+
+	list := &testpb.GolangTestList{}
+	if err := pdb.QueryIntoList(list, "SELECT id, grp FROM "+testTableSQLName(testTable)+" WHERE grp = ?", 42); err != nil {
+		t.Fatalf("QueryIntoList失败: %v", err)
+	}
+	if len(list.TestList) != 1 || list.TestList[0].GroupId != 42 {
+		t.Errorf("原生SQL的grp列应映射回group_id: %v", list)
+	}
+}
+
+func TestUpdateManyByWhere(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey(""))
+
+	for _, where := range []string{"", "  ", " WHERE "} {
+		if _, err := pdb.UpdateManyByWhere(&testpb.GolangTest{Port: 9}, where, nil); !errors.Is(err, ErrEmptyWhereClause) {
+			t.Errorf("空条件 %q 应返回ErrEmptyWhereClause，实际: %v", where, err)
+		}
+	}
+	if execs := fake.recorded(); len(execs) != 0 {
+		t.Fatalf("空条件不应下发SQL，实际: %v", execs)
+	}
+
+	affected, err := pdb.UpdateManyByWhere(&testpb.GolangTest{Port: 9}, "WHERE group_id = ?", []interface{}{2})
+	if err != nil {
+		t.Fatalf("UpdateManyByWhere失败: %v", err)
+	}
+	if affected != 1 {
+		t.Errorf("应返回RowsAffected=1，实际: %d", affected)
+	}
+	if _, err := pdb.UpdateAll(&testpb.GolangTest{Port: 10}); err != nil {
+		t.Fatalf("UpdateAll失败: %v", err)
+	}
+
+	execs := fake.recorded()
+	if len(execs) != 2 {
+		t.Fatalf("应下发2条UPDATE，实际: %d", len(execs))
+	}
+	if want := "UPDATE `golang_test` SET `port` = ? WHERE group_id = ?"; execs[0].query != want {
+		t.Errorf("UpdateManyByWhere SQL不符\n期望: %s\n实际: %s", want, execs[0].query)
+	}
+	if len(execs[0].args) != 2 || execs[0].args[1].Value != int64(2) {
+		t.Errorf("参数应为SET值加WHERE参数，实际: %v", execs[0].args)
+	}
+	if want := "UPDATE `golang_test` SET `port` = ? WHERE 1=1"; execs[1].query != want {
+		t.Errorf("UpdateAll SQL不符\n期望: %s\n实际: %s", want, execs[1].query)
+	}
+
+	if _, err := pdb.UpdateManyByWhere(&testpb.GolangTest{}, "group_id = ?", []interface{}{2}); err == nil {
+		t.Error("无已设置字段时应返回错误")
+	}
+}
+
+func TestDeleteByWhere(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey(""))
+
+	for _, where := range []string{"", "\t", "where"} {
+		if _, err := pdb.DeleteByWhere(&testpb.GolangTest{}, where, nil); !errors.Is(err, ErrEmptyWhereClause) {
+			t.Errorf("空条件 %q 应返回ErrEmptyWhereClause，实际: %v", where, err)
+		}
+	}
+	if execs := fake.recorded(); len(execs) != 0 {
+		t.Fatalf("空条件不应下发SQL，实际: %v", execs)
+	}
+
+	affected, err := pdb.DeleteByWhere(&testpb.GolangTest{}, "group_id = ?", []interface{}{2})
+	if err != nil {
+		t.Fatalf("DeleteByWhere失败: %v", err)
+	}
+	if affected != 1 {
+		t.Errorf("应返回RowsAffected=1，实际: %d", affected)
+	}
+	if _, err := pdb.DeleteAll(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("DeleteAll失败: %v", err)
+	}
+
+	execs := fake.recorded()
+	if len(execs) != 2 {
+		t.Fatalf("应下发2条DELETE，实际: %d", len(execs))
+	}
+	if want := "DELETE FROM `golang_test` WHERE group_id = ?"; execs[0].query != want {
+		t.Errorf("DeleteByWhere SQL不符\n期望: %s\n实际: %s", want, execs[0].query)
+	}
+	if want := "DELETE FROM `golang_test` WHERE 1=1"; execs[1].query != want {
+		t.Errorf("DeleteAll SQL不符\n期望: %s\n实际: %s", want, execs[1].query)
+	}
+}
+
+// TestBatchDeleteByKeys 单元测试：按字段IN条件分批删除并累加影响行数，空切片不下发SQL，按主键删除时失效缓存
+func TestBatchDeleteByKeys(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(newFakeCache())
+	pdb.DB = sqlDB
+	cache := pdb.cache.(*fakeCache)
+	if err := pdb.SetBatchSize(2); err != nil {
+		t.Fatalf("SetBatchSize失败: %v", err)
+	}
+
+	if n, err := pdb.BatchDeleteByKeys(&testpb.GolangTest{}, "id", nil); err != nil || n != 0 {
+		t.Errorf("空切片应直接返回0: n=%d err=%v", n, err)
+	}
+	if _, err := pdb.BatchDeleteByKeys(&testpb.GolangTest{}, "nope", []interface{}{1}); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if execs := fake.recorded(); len(execs) != 0 {
+		t.Fatalf("空切片/未知列不应下发SQL，实际: %v", execs)
+	}
+
+	n, err := pdb.BatchDeleteByKeys(&testpb.GolangTest{}, "id", []interface{}{1, 2, 3})
+	if err != nil {
+		t.Fatalf("BatchDeleteByKeys失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 2 {
+		t.Fatalf("3个值按批量2应分2批，实际: %d", len(execs))
+	}
+	if want := "DELETE FROM `golang_test` WHERE `id` IN (?, ?)"; execs[0].query != want {
+		t.Errorf("第1批SQL不符\n期望: %s\n实际: %s", want, execs[0].query)
+	}
+	if want := "DELETE FROM `golang_test` WHERE `id` IN (?)"; execs[1].query != want {
+		t.Errorf("第2批SQL不符\n期望: %s\n实际: %s", want, execs[1].query)
+	}
+	if n != 2 { // fake驱动每条DELETE报告影响1行
+		t.Errorf("应返回各批影响行数之和2，实际: %d", n)
+	}
+	if want := []string{"pb:golang_test:1", "pb:golang_test:2", "pb:golang_test:3"}; !slices.Equal(cache.deleted, want) {
+		t.Errorf("按主键删除应失效缓存 %v，实际: %v", want, cache.deleted)
+	}
+
+	cache.deleted = nil
+	if _, err := pdb.BatchDeleteByKeys(&testpb.GolangTest{}, "group_id", []interface{}{7}); err != nil {
+		t.Fatalf("按非主键删除失败: %v", err)
+	}
+	if len(cache.deleted) != 0 {
+		t.Errorf("非主键列无法定位缓存key，不应删除缓存: %v", cache.deleted)
+	}
+}
+
+// TestSetAutoCreate 单元测试：开启后写入遇到1146按错误中的表名建表并重试一次，其他错误或未开启时照常返回
+func TestSetAutoCreate(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB, pdb.DBName = sqlDB, "game"
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	missing := &mysql.MySQLError{Number: 1146, Message: "Table 'game.golang_test' doesn't exist"}
+
+	fake.execErr = missing
+	err := pdb.Save(&testpb.GolangTest{Id: 1})
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) || me.Number != 1146 {
+		t.Errorf("未开启自动建表应返回1146，实际: %v", err)
+	}
+	if got := len(fake.recorded()); got != 1 {
+		t.Fatalf("未开启自动建表不应重试，实际执行%d次", got)
+	}
+
+	pdb.SetAutoCreate(true)
+	fake.execs = nil
+	fake.queryRows = [][]driver.Value{{int64(0)}} // INFORMATION_SCHEMA查询：表不存在
+	fake.onExec = func(n int) {
+		if n == 2 {
+			fake.execErr = nil // 首次写入失败后，建表与重试成功
+		}
+	}
+	if err := pdb.Save(&testpb.GolangTest{Id: 1}); err != nil {
+		t.Fatalf("开启自动建表后Save应成功: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 3 || !strings.HasPrefix(execs[1].query, "CREATE TABLE IF NOT EXISTS `golang_test`") ||
+		execs[2].query != execs[0].query {
+		t.Fatalf("应依次执行 写入→建表→重试写入，实际: %+v", execs)
+	}
+
+	fake.execs, fake.onExec = nil, nil
+	fake.execErr = &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("非1146错误应照常返回，实际: %v", err)
+	}
+	fake.execErr = &mysql.MySQLError{Number: 1146, Message: "Table 'game.unknown' doesn't exist"}
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1}); err == nil {
+		t.Error("未注册的表不应自动建表")
+	}
+	if got := len(fake.recorded()); got != 2 {
+		t.Errorf("不满足条件时不应建表或重试，实际执行%d次", got)
+	}
+}
+
+// TestAutoCreateRoundTrip 集成测试：表被删除后，开启自动建表的Save会建表并写入成功
+func TestAutoCreateRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"), WithAutoIncrementKey(""))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	if err := pdb.DropTable(testTable); err != nil {
+		t.Fatalf("DropTable失败: %v", err)
+	}
+	pdb.SetAutoCreate(true)
+	if err := pdb.Save(&testpb.GolangTest{Id: 637, Ip: "10.6.3.7"}); err != nil {
+		t.Fatalf("自动建表后Save应成功: %v", err)
+	}
+	got := &testpb.GolangTest{Id: 637}
+	if err := pdb.FindOneByPK(got); err != nil || got.Ip != "10.6.3.7" {
+		t.Errorf("应读回自动建表后写入的行: %v, err=%v", got, err)
+	}
+}
+
+// TestConcurrentRegisterTable 单元测试（配合 go test -race）：一个goroutine持续注册表，另一个同时查询/写入，不应有数据竞争
+func TestConcurrentRegisterTable(t *testing.T) {
+	sqlDB, _ := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			pdb.RegisterTable(&testpb.GolangTest1{}, WithPrimaryKey("id"))
+			pdb.WithContext(context.Background()).RegisterTable(&testpb.GolangTestList{})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		if err := pdb.Insert(&testpb.GolangTest{Id: uint32(i)}); err != nil {
+			t.Fatalf("Insert失败: %v", err)
+		}
+		if err := pdb.FindOneByKV(&testpb.GolangTest{}, "id", "1"); err != nil && !errors.Is(err, ErrNoRowsFound) {
+			t.Fatalf("FindOneByKV失败: %v", err)
+		}
+	}
+	<-done
+
+	if _, ok := pdb.lookupTable(GetTableName(&testpb.GolangTest1{})); !ok {
+		t.Error("并发注册的表应可查到")
+	}
+}
+
+// TestRegisterTableOnLiteralDB 单元测试：未经NewDB、以结构体字面量构造的DB也能注册与查表（退回共用锁，不panic）
+func TestRegisterTableOnLiteralDB(t *testing.T) {
+	pdb := &DB{Tables: make(map[string]*MessageTable)}
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	if _, err := pdb.tableForMessage(&testpb.GolangTest{}); err != nil {
+		t.Errorf("字面量构造的DB注册后应可查到表: %v", err)
+	}
+}
+
+// TestWithGeneratedColumn 单元测试：生成列的建表/补列DDL，且不出现在写入参数中
+func TestWithGeneratedColumn(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{},
+		WithPrimaryKey("id"),
+		WithGeneratedColumn("full_addr", "CONCAT(`ip`, ':', `port`)", "STORED"),
+		WithGeneratedColumn("group_id", "`port` + 1", "virtual"),
+		WithIndexes("full_addr"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"`full_addr` VARCHAR(255) GENERATED ALWAYS AS (CONCAT(`ip`, ':', `port`)) STORED",
+		"`group_id` int unsigned GENERATED ALWAYS AS (`port` + 1) VIRTUAL COMMENT 'pb:4'",
+		"INDEX `idx_golang_test_0` (`full_addr`)",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "127.0.0.1", Port: 80, GroupId: 81}
+	insertSQL, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成插入SQL失败: %v", err)
+	}
+	updateSQL, err := table.GetUpdateSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成更新SQL失败: %v", err)
+	}
+	for _, sqlText := range []string{insertSQL.Sql, updateSQL.Sql} {
+		if strings.Contains(sqlText, "group_id") || strings.Contains(sqlText, "full_addr") {
+			t.Errorf("写入SQL不应包含生成列: %s", sqlText)
+		}
+	}
+	if !strings.Contains(table.selectFieldsSQL, "`group_id`") {
+		t.Errorf("查询应读回与字段同名的生成列: %s", table.selectFieldsSQL)
+	}
+
+	alters := table.buildAlterClauses(map[string]columnMeta{"id": {colType: "int unsigned", fieldNum: 1}})
+	want := "ADD COLUMN `full_addr` VARCHAR(255) GENERATED ALWAYS AS (CONCAT(`ip`, ':', `port`)) STORED"
+	if !slices.Contains(alters, want) {
+		t.Errorf("同步结构应补建生成列 %q，实际: %v", want, alters)
+	}
+
+	for _, opt := range []TableOption{
+		WithGeneratedColumn("full_addr", "CONCAT(`ip`)", "PERSISTENT"),
+		WithGeneratedColumn("full_addr", " ", "STORED"),
+		WithGeneratedColumn("PORT", "`id` + 1", "STORED"),
+		WithGeneratedColumn("player", "`id`", "STORED"),
+		WithGeneratedColumn("id", "1", "STORED"),
+	} {
+		opts := []TableOption{WithPrimaryKey("id"), opt}
+		if err := newMessageTable(&testpb.GolangTest{}, opts...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法生成列应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestScalarRepeatedList 单元测试：repeated字段为标量（如FieldMask的repeated string paths）时返回错误而不是panic
+func TestScalarRepeatedList(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	calls := map[string]func(list proto.Message) error{
+		"FindAll":                func(list proto.Message) error { return pdb.FindAll(list) },
+		"FindAllByWhereWithArgs": func(list proto.Message) error { return pdb.FindAllByWhereWithArgs(list, "id > ?", []interface{}{0}) },
+		"QueryIntoList":          func(list proto.Message) error { return pdb.QueryIntoList(list, "SELECT 1") },
+		"GetElementTableName":    func(list proto.Message) error { _, err := GetElementTableName(list); return err },
+	}
+	for name, call := range calls {
+		if err := call(&fieldmaskpb.FieldMask{}); !errors.Is(err, ErrRepeatedNotMessage) {
+			t.Errorf("%s 传入repeated string列表应返回ErrRepeatedNotMessage，实际: %v", name, err)
+		}
+		if err := call(&testpb.GolangTest{}); !errors.Is(err, ErrNoRepeatedField) {
+			t.Errorf("%s 传入无repeated字段的消息应返回ErrNoRepeatedField，实际: %v", name, err)
+		}
+	}
+	if queries := fake.recordedQueries(); len(queries) != 0 {
+		t.Errorf("列表消息非法时不应下发查询，实际: %v", queries)
+	}
+}
+
+// TestWithTimestampAsEpoch 单元测试：Unix秒BIGINT列与DATETIME列的建表类型、写入参数不同，读回的Timestamp一致
+func TestWithTimestampAsEpoch(t *testing.T) {
+	msg := newTimedTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfUint64(7))
+	msg.Set(fields.ByName("name"), protoreflect.ValueOfString("sword"))
+	msg.Set(fields.ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.New(when).ProtoReflect()))
+
+	epoch := newMessageTable(msg, WithPrimaryKey("id"), WithTimestampAsEpoch("created_at", "updated_at"))
+	datetime := newMessageTable(msg, WithPrimaryKey("id"))
+	if err := epoch.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+	if createSQL := epoch.GetCreateTableSQL(); !strings.Contains(createSQL, "`created_at` bigint NOT NULL DEFAULT 0 COMMENT") {
+		t.Errorf("epoch列应建为bigint\nSQL: %s", createSQL)
+	}
+	if createSQL := datetime.GetCreateTableSQL(); !strings.Contains(createSQL, "`created_at` DATETIME NOT NULL COMMENT") {
+		t.Errorf("默认应建为DATETIME\nSQL: %s", createSQL)
+	}
+
+	// 两张表各自写入再按行读回，Timestamp应与原值一致；epoch表未设置的updated_at写0、读回仍未设置
+	for name, tc := range map[string]struct {
+		table          *MessageTable
+		createdArg     string
+		updatedArg     string
+		rawUpdatedRead string
+	}{
+		"epoch":    {epoch, strconv.FormatInt(when.Unix(), 10), "0", "0"},
+		"datetime": {datetime, "2024-05-06 07:08:09", "", ""},
+	} {
+		insertSQL, err := tc.table.GetInsertSQLWithArgs(msg)
+		if err != nil {
+			t.Fatalf("%s: 生成INSERT失败: %v", name, err)
+		}
+		if insertSQL.Args[2] != tc.createdArg || insertSQL.Args[3] != tc.updatedArg {
+			t.Errorf("%s: 时间参数应为 %q/%q，实际 %v", name, tc.createdArg, tc.updatedArg, insertSQL.Args)
+		}
+
+		read := dynamicpb.NewMessage(msg.Descriptor())
+		row := [][]byte{[]byte("7"), []byte("sword"), []byte(tc.createdArg), []byte(tc.rawUpdatedRead)}
+		if err := tc.table.parseRow(read, row); err != nil {
+			t.Fatalf("%s: 解析查询结果失败: %v", name, err)
+		}
+		if !proto.Equal(msg, read) {
+			t.Errorf("%s: 往返不一致\n期望: %v\n实际: %v", name, msg, read)
+		}
+	}
+
+	for _, opt := range []TableOption{
+		WithTimestampAsEpoch("name"),
+		WithTimestampAsEpoch("no_such_field"),
+	} {
+		if err := newMessageTable(msg, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法epoch字段应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+	both := newMessageTable(msg, WithTimestamps("created_at", ""), WithTimestampAsEpoch("created_at"))
+	if err := both.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("epoch字段不能同时由WithTimestamps维护，实际: %v", err)
+	}
+}
+
+// TestTableExistsCacheInvalidation 单元测试：表被外部删除后可通过InvalidateTableCache/TTL刷新存在缓存，
+// DropTable自动失效缓存，CreateOrUpdateTable发现缓存过期（查不到列）时重新建表
+func TestTableExistsCacheInvalidation(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.DBName = "game"
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	tableName := GetTableName(&testpb.GolangTest{})
+
+	fake.queryRows = [][]driver.Value{{int64(1)}}
+	if exists, err := pdb.IsTableExists(tableName); err != nil || !exists {
+		t.Fatalf("表应存在: exists=%v err=%v", exists, err)
+	}
+
+	// 表被外部DROP：缓存仍返回存在，失效后重新查询
+	fake.queryRows = [][]driver.Value{{int64(0)}}
+	if exists, _ := pdb.IsTableExists(tableName); !exists {
+		t.Fatal("未失效前应命中缓存")
+	}
+	pdb.InvalidateTableCache(tableName)
+	if exists, err := pdb.IsTableExists(tableName); err != nil || exists {
+		t.Fatalf("失效缓存后应查到表不存在: exists=%v err=%v", exists, err)
+	}
+
+	// TTL过期后自动重查
+	pdb.SetTableExistsTTL(time.Millisecond)
+	fake.queryRows = [][]driver.Value{{int64(1)}}
+	time.Sleep(2 * time.Millisecond)
+	if exists, err := pdb.IsTableExists(tableName); err != nil || !exists {
+		t.Fatalf("TTL过期后应重新查询: exists=%v err=%v", exists, err)
+	}
+	pdb.SetTableExistsTTL(0)
+
+	// 缓存认为存在但表已无任何列：CreateOrUpdateTable应重新建表而不是ALTER
+	fake.queryRows = nil
+	if err := pdb.CreateOrUpdateTable(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("CreateOrUpdateTable失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 1 || !strings.HasPrefix(execs[0].query, "CREATE TABLE IF NOT EXISTS") {
+		t.Fatalf("外部删除后应重新建表，实际: %v", execs)
+	}
+
+	if err := pdb.DropTable(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("DropTable失败: %v", err)
+	}
+	execs = fake.recorded()
+	if want := "DROP TABLE IF EXISTS `" + tableName + "`"; execs[len(execs)-1].query != want {
+		t.Errorf("DropTable SQL不符\n期望: %s\n实际: %s", want, execs[len(execs)-1].query)
+	}
+	queries := len(fake.recordedQueries())
+	if exists, err := pdb.IsTableExists(tableName); err != nil || exists {
+		t.Errorf("DropTable后应缓存为不存在: exists=%v err=%v", exists, err)
+	}
+	if len(fake.recordedQueries()) != queries {
+		t.Error("DropTable后应直接命中缓存，不再查询")
+	}
+}
+
+// TestCreateDatabaseIfNotExists 单元测试：建库SQL转义库名，非法库名与只读模式不下发SQL
+func TestCreateDatabaseIfNotExists(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	if err := pdb.CreateDatabaseIfNotExists("game`db"); err != nil {
+		t.Fatalf("CreateDatabaseIfNotExists失败: %v", err)
+	}
+	execs := fake.recorded()
+	want := "CREATE DATABASE IF NOT EXISTS `game``db` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci"
+	if len(execs) != 1 || execs[0].query != want {
+		t.Fatalf("建库SQL错误: %+v", execs)
+	}
+
+	for _, name := range []string{"", strings.Repeat("a", 65), "a/b", "a.b", "db "} {
+		if err := pdb.CreateDatabaseIfNotExists(name); err == nil {
+			t.Errorf("非法库名 %q 应返回错误", name)
+		}
+	}
+	if err := EnsureDatabase(NewMysqlConfig(JsonConfig{Net: "tcp", Addr: "127.0.0.1:1"})); err == nil {
+		t.Error("EnsureDatabase未指定DBName应返回错误")
+	}
+
+	pdb.SetReadOnly(true)
+	if err := pdb.CreateDatabaseIfNotExists("game"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("只读模式应返回ErrReadOnly，实际: %v", err)
+	}
+	if got := len(fake.recorded()); got != 1 {
+		t.Errorf("非法库名/只读模式不应下发SQL，实际执行%d次", got)
+	}
+}
+
+// TestOpenErrors 单元测试：Open/OpenWithJSON 在配置缺失、非法或连不上时返回错误
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(nil); err == nil {
+		t.Error("nil配置应返回错误")
+	}
+	if _, err := Open(NewMysqlConfig(JsonConfig{Net: "tcp", Addr: "127.0.0.1:1"})); err == nil {
+		t.Error("未指定DBName应返回错误")
+	}
+
+	cfg := NewMysqlConfig(JsonConfig{Net: "tcp", Addr: "127.0.0.1:1", User: "root", DBName: "game"})
+	cfg.Timeout = time.Second
+	if pdb, err := Open(cfg); err == nil {
+		pdb.Close()
+		t.Error("连不上MySQL时应返回错误")
+	}
+
+	if _, err := OpenWithJSON(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("配置文件不存在应返回os.ErrNotExist，实际: %v", err)
+	}
+	bad := filepath.Join(t.TempDir(), "db.json")
+	if err := os.WriteFile(bad, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithJSON(bad); err == nil {
+		t.Error("非法JSON应返回错误")
+	}
+
+	jsonConfig, err := ReadJsonConfig("testdata/db.json")
+	if err != nil {
+		t.Fatalf("读取testdata/db.json失败: %v", err)
+	}
+	if jsonConfig.DBName == "" {
+		t.Error("testdata/db.json应包含DBName")
+	}
+}
+
+// TestNullConditions 单元测试：IsNull/IsNotNull 生成无占位符的条件，并校验列存在且可空
+func TestNullConditions(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithNullableFields("ip"),
+		WithColumnMapping(map[string]string{"ip": "addr"}))
+
+	isNull, err := pdb.IsNull(&testpb.GolangTestList{}, "ip")
+	if err != nil || isNull != "`addr` IS NULL" {
+		t.Fatalf("IsNull应返回映射后的列条件，实际: %q, %v", isNull, err)
+	}
+	if notNull, err := pdb.IsNotNull(&testpb.GolangTest{}, "ip"); err != nil || notNull != "`addr` IS NOT NULL" {
+		t.Errorf("IsNotNull条件不符，实际: %q, %v", notNull, err)
+	}
+
+	if err := pdb.FindAllByWhereWithArgs(&testpb.GolangTestList{}, isNull+" AND port > ?", []interface{}{0}); err != nil {
+		t.Fatalf("FindAllByWhereWithArgs失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.HasSuffix(queries[0].query, "WHERE `addr` IS NULL AND port > ?;") || len(queries[0].args) != 1 {
+		t.Errorf("IS NULL条件不应带占位符参数，实际: %v", queries)
+	}
+
+	if _, err := pdb.IsNull(&testpb.GolangTest{}, "no_such_field"); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("不存在的列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if _, err := pdb.IsNull(&testpb.GolangTest{}, "port"); err == nil {
+		t.Error("非可空列应返回错误")
+	}
+}
+
+// TestNullConditionsRoundTrip 集成测试：InsertPresent不写可空的ip列（落库为NULL），IsNull能查到该行
+func TestNullConditionsRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"), WithAutoIncrementKey(""), WithNullableFields("ip"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	if err := pdb.InsertPresent(&testpb.GolangTest{Id: 1, Port: 80}); err != nil {
+		t.Fatalf("InsertPresent失败: %v", err)
+	}
+	if err := pdb.Insert(&testpb.GolangTest{Id: 2, Ip: "10.0.0.2", Port: 80}); err != nil {
+		t.Fatalf("Insert失败: %v", err)
+	}
+
+	for _, tc := range []struct {
+		cond   func(proto.Message, string) (string, error)
+		wantID uint32
+	}{
+		{pdb.IsNull, 1},
+		{pdb.IsNotNull, 2},
+	} {
+		where, err := tc.cond(&testpb.GolangTestList{}, "ip")
+		if err != nil {
+			t.Fatalf("生成条件失败: %v", err)
+		}
+		list := &testpb.GolangTestList{}
+		if err := pdb.FindAllByWhereWithArgs(list, where, nil); err != nil {
+			t.Fatalf("按 %s 查询失败: %v", where, err)
+		}
+		if len(list.TestList) != 1 || list.TestList[0].Id != tc.wantID {
+			t.Errorf("按 %s 应只查到id=%d，实际: %v", where, tc.wantID, list)
+		}
+	}
+}
+
+// TestDefaultWhere 单元测试：WithDefaultWhere的默认条件AND到各类查询/更新/删除，参数排在调用方参数之前
+func TestDefaultWhere(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithDefaultWhere("`group_id` = ?", 634))
+	table := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+	selectSQL := table.selectFieldsSQL
+
+	if err := pdb.FindAll(&testpb.GolangTestList{}); err != nil {
+		t.Fatalf("FindAll失败: %v", err)
+	}
+	if err := pdb.FindAllByWhereWithArgs(&testpb.GolangTestList{}, "id > ? OR port = ? ORDER BY id LIMIT ?", []interface{}{1, 80, 10}); err != nil {
+		t.Fatalf("FindAllByWhereWithArgs失败: %v", err)
+	}
+	if _, err := pdb.Exists(&testpb.GolangTest{}, "", nil); err != nil {
+		t.Fatalf("Exists失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	wants := []struct {
+		query string
+		args  []interface{}
+	}{
+		{selectSQL + " WHERE (`group_id` = ?);", []interface{}{int64(634)}},
+		{selectSQL + " WHERE (`group_id` = ?) AND (id > ? OR port = ?) ORDER BY id LIMIT ?;", []interface{}{int64(634), int64(1), int64(80), int64(10)}},
+		{"SELECT 1 FROM `golang_test` WHERE (`group_id` = ?) LIMIT 1;", []interface{}{int64(634)}},
+	}
+	if len(queries) != len(wants) {
+		t.Fatalf("应执行%d条查询，实际: %+v", len(wants), queries)
+	}
+	for i, want := range wants {
+		if got := queries[i].values(); queries[i].query != want.query || fmt.Sprint(got) != fmt.Sprint(want.args) {
+			t.Errorf("第%d条查询错误:\n got: %s %v\nwant: %s %v", i, queries[i].query, got, want.query, want.args)
+		}
+	}
+
+	if err := pdb.Update(&testpb.GolangTest{Id: 5, Port: 8080}); err != nil {
+		t.Fatalf("Update失败: %v", err)
+	}
+	if _, err := pdb.DeleteAll(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("DeleteAll失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 2 {
+		t.Fatalf("应执行2条写语句，实际: %+v", execs)
+	}
+	if !strings.HasSuffix(execs[0].query, " WHERE (`group_id` = ?) AND (`id` = ?)") ||
+		fmt.Sprint(execs[0].values()[len(execs[0].args)-2:]) != "[634 5]" {
+		t.Errorf("按主键更新应带默认条件: %s %v", execs[0].query, execs[0].args)
+	}
+	if execs[1].query != "DELETE FROM `golang_test` WHERE (`group_id` = ?)" {
+		t.Errorf("DeleteAll应只删除默认条件内的行: %s", execs[1].query)
+	}
+
+	bad := newMessageTable(&testpb.GolangTest{}, WithDefaultWhere("`group_id` = ? AND `port` = ?", 1))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("占位符与参数个数不符应返回ErrInvalidTableOption, got %v", err)
+	}
+}
+
+// TestSplitWhereTail 单元测试：只在括号与引号之外拆出ORDER BY/LIMIT等尾部子句
+func TestSplitWhereTail(t *testing.T) {
+	tests := []struct {
+		in, cond, tail string
+	}{
+		{"id = 1", "id = 1", ""},
+		{"id = 1 ORDER BY id", "id = 1 ", " ORDER BY id"},
+		{"id = 1 limit 10", "id = 1 ", " limit 10"},
+		{"name = 'a order by b' AND id IN (SELECT id FROM t LIMIT 1)", "name = 'a order by b' AND id IN (SELECT id FROM t LIMIT 1)", ""},
+		{"`limit` = 1", "`limit` = 1", ""},
+		{"order_id = 1", "order_id = 1", ""},
+	}
+	for _, tt := range tests {
+		cond, tail := splitWhereTail(tt.in)
+		if cond != tt.cond || tail != tt.tail {
+			t.Errorf("splitWhereTail(%q) = (%q, %q), want (%q, %q)", tt.in, cond, tail, tt.cond, tt.tail)
+		}
+	}
+}
+
+// TestDefaultWhereRoundTrip 集成测试：不写租户条件的查询/统计/删除也只作用于默认条件内的行
+func TestDefaultWhereRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	testTable := &testpb.GolangTest{}
+	pdb.RegisterTable(testTable, WithPrimaryKey("id"), WithAutoIncrementKey(""), WithDefaultWhere("`group_id` = ?", 634))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, testTable)
+
+	if err := pdb.BatchInsert([]proto.Message{
+		&testpb.GolangTest{Id: 1, GroupId: 634},
+		&testpb.GolangTest{Id: 2, GroupId: 634},
+		&testpb.GolangTest{Id: 3, GroupId: 635},
+	}); err != nil {
+		t.Fatalf("准备数据失败: %v", err)
+	}
+
+	list := &testpb.GolangTestList{}
+	if err := pdb.FindAll(list); err != nil {
+		t.Fatalf("FindAll失败: %v", err)
+	}
+	if len(list.TestList) != 2 {
+		t.Errorf("FindAll应只返回group_id=634的2行，实际: %v", list)
+	}
+	other := &testpb.GolangTest{Id: 3}
+	if err := pdb.FindOneByPK(other); !errors.Is(err, ErrNoRowsFound) {
+		t.Errorf("按主键也不应查到其他租户的行，实际: %v", err)
+	}
+	if n, err := pdb.DeleteAll(&testpb.GolangTest{}); err != nil || n != 2 {
+		t.Errorf("DeleteAll应只删除2行: n=%d err=%v", n, err)
+	}
+	var remaining int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + testTableSQLName(testTable)).Scan(&remaining); err != nil || remaining != 1 {
+		t.Errorf("其他租户的行应保留: remaining=%d err=%v", remaining, err)
+	}
+}
+
+// TestWithBytesAsHex 单元测试：WithBytesAsHex的bytes字段建为文本列，16字节摘要按32个十六进制字符写入并读回
+func TestWithBytesAsHex(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	msg := &wrapperspb.BytesValue{}
+	pdb.RegisterTable(msg, WithBytesAsHex("value"))
+	table := pdb.Tables[GetTableName(msg)]
+	if err := table.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := table.getMySQLFieldType(msg.ProtoReflect().Descriptor().Fields().ByName("value")); got != "MEDIUMTEXT" {
+		t.Errorf("十六进制bytes列类型应为MEDIUMTEXT，实际: %s", got)
+	}
+
+	digest := wrapperspb.Bytes([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	if err := pdb.Insert(digest); err != nil {
+		t.Fatalf("Insert失败: %v", err)
+	}
+	const hexText = "00112233445566778899aabbccddeeff"
+	execs := fake.recorded()
+	if len(execs) != 1 || len(execs[0].args) != 1 || execs[0].args[0].Value != hexText {
+		t.Fatalf("应写入32个十六进制字符，实际: %+v", execs)
+	}
+
+	fake.queryRows = [][]driver.Value{{[]byte(hexText)}}
+	got := &wrapperspb.BytesValue{}
+	if err := pdb.FindOneByWhereWithArgs(got, "1=1", nil); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if !proto.Equal(got, digest) {
+		t.Errorf("读回的摘要不一致: got %x, want %x", got.Value, digest.Value)
+	}
+
+	if err := newMessageTable(&testpb.GolangTest{}, WithBytesAsHex("ip")).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("非bytes字段应返回ErrInvalidTableOption, got %v", err)
+	}
+}
+
+// TestFindByPrimaryKey 单元测试：按主键值（含复合主键）查询，校验值个数与无主键表
+func TestFindByPrimaryKey(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	fake.queryRows = [][]driver.Value{{int64(7), "10.0.0.7", int64(80), int64(2), "", int64(9)}}
+
+	got := &testpb.GolangTest{}
+	if err := pdb.FindByPrimaryKey(got, 7); err != nil {
+		t.Fatalf("FindByPrimaryKey失败: %v", err)
+	}
+	want := &testpb.GolangTest{Id: 7, Ip: "10.0.0.7", Port: 80, GroupId: 2, PlayerId: 9}
+	if !proto.Equal(got, want) {
+		t.Errorf("查询结果不符: 期望%v, 实际%v", want, got)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.HasSuffix(queries[0].query, "WHERE `id` = ? LIMIT 2;") ||
+		len(queries[0].args) != 1 || queries[0].args[0].Value != int64(7) {
+		t.Errorf("主键条件不符，实际: %v", queries)
+	}
+
+	if err := pdb.FindByPrimaryKey(&testpb.GolangTest{}, 7, 8); err == nil {
+		t.Error("主键值个数不符应返回错误")
+	}
+
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("group_id", "player_id"))
+	if err := pdb.FindByPrimaryKey(&testpb.GolangTest{}, 2, 9); err != nil {
+		t.Fatalf("复合主键查询失败: %v", err)
+	}
+	queries = fake.recordedQueries()
+	if last := queries[len(queries)-1]; !strings.HasSuffix(last.query, "WHERE `group_id` = ? AND `player_id` = ? LIMIT 2;") || len(last.args) != 2 {
+		t.Errorf("复合主键条件不符，实际: %v", last)
+	}
+
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey())
+	if err := pdb.FindByPrimaryKey(&testpb.GolangTest{}, 7); !errors.Is(err, ErrPrimaryKeyNotFound) {
+		t.Errorf("无主键表应返回ErrPrimaryKeyNotFound，实际: %v", err)
+	}
+}
+
+// newSignedTestMessage 构造含有符号int64/int32与uint32字段的动态消息（testpb中没有有符号整数字段）
+func newSignedTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	return testdyn.NewMessage(t, "signed_test.proto", "Account",
+		testdyn.Field("account_id", descriptorpb.FieldDescriptorProto_TYPE_INT64),
+		testdyn.Field("score", descriptorpb.FieldDescriptorProto_TYPE_INT32),
+		testdyn.Field("level", descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+		testdyn.Field("name", descriptorpb.FieldDescriptorProto_TYPE_STRING))
+}
+
+// TestSignedUnsignedColumns 单元测试：有符号int64字段建为unsigned列、uint32字段建为有符号列，
+// 线上列与覆盖后的类型一致时同步结构不产生MODIFY
+func TestSignedUnsignedColumns(t *testing.T) {
+	msg := newSignedTestMessage(t)
+	table := newMessageTable(msg, WithPrimaryKey("account_id"), WithAutoIncrementKey("account_id"),
+		WithUnsignedColumns("account_id", "score"), WithSignedColumns("level"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"`account_id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'pb:1'",
+		"`score` int unsigned NOT NULL DEFAULT 0 COMMENT 'pb:2'",
+		"`level` int NOT NULL DEFAULT 0 COMMENT 'pb:3'",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	current := map[string]columnMeta{
+		"account_id": {colType: "bigint unsigned", fieldNum: 1},
+		"score":      {colType: "int unsigned", fieldNum: 2},
+		"level":      {colType: "int", fieldNum: 3},
+		"name":       {colType: "mediumtext", fieldNum: 4},
+	}
+	if alters := table.buildAlterClauses(current); len(alters) != 0 {
+		t.Errorf("线上类型与覆盖一致时不应修改列，实际: %v", alters)
+	}
+	current["account_id"] = columnMeta{colType: "bigint", fieldNum: 1}
+	alters := table.buildAlterClauses(current)
+	if len(alters) != 1 || !strings.HasPrefix(alters[0], "MODIFY COLUMN `account_id` bigint unsigned") {
+		t.Errorf("有符号的线上列应改为unsigned，实际: %v", alters)
+	}
+
+	for _, opt := range []TableOption{
+		WithUnsignedColumns("name"),
+		WithSignedColumns("no_such_field"),
+	} {
+		if err := newMessageTable(msg, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非整数或不存在的字段应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"bigint NOT NULL DEFAULT 0":            "bigint unsigned NOT NULL DEFAULT 0",
+		"int unsigned NOT NULL DEFAULT 0":      "int unsigned NOT NULL DEFAULT 0",
+		"int UNSIGNED NOT NULL AUTO_INCREMENT": "int unsigned NOT NULL AUTO_INCREMENT",
+	} {
+		if got := setUnsigned(in, true); got != want {
+			t.Errorf("setUnsigned(%q, true) = %q, 期望 %q", in, got, want)
+		}
+	}
+	if got := setUnsigned("int unsigned NOT NULL DEFAULT 0", false); got != "int NOT NULL DEFAULT 0" {
+		t.Errorf("setUnsigned去掉unsigned失败: %q", got)
+	}
+}
+
+// newWideTestMessage 构造columns列（c0..c<columns-1>，均为uint64）的宽表动态消息，c0为主键
+func newWideTestMessage(t *testing.T, columns int) *dynamicpb.Message {
+	t.Helper()
+	fields := make([]*descriptorpb.FieldDescriptorProto, columns)
+	for i := range fields {
+		fields[i] = testdyn.Field(fmt.Sprintf("c%d", i), descriptorpb.FieldDescriptorProto_TYPE_UINT64)
+	}
+	return testdyn.NewMessage(t, fmt.Sprintf("wide%d_test.proto", columns), fmt.Sprintf("Wide%d", columns), fields...)
+}
+
+// TestBatchInsertPlaceholderLimit 单元测试：40列宽表批量插入2000行时，按65535占位符上限自动缩小每批行数，
+// 而不是把超限的SQL交给驱动报错；直接生成超限SQL时返回ErrBatchSizeExceeded
+func TestBatchInsertPlaceholderLimit(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	wide := newWideTestMessage(t, 40)
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	if err := pdb.SetBatchSize(2000); err != nil {
+		t.Fatalf("SetBatchSize失败: %v", err)
+	}
+	pdb.RegisterTable(wide, WithPrimaryKey("c0"))
+	table, ok := pdb.lookupTable(GetTableName(wide))
+	if !ok {
+		t.Fatal("宽表应已注册")
+	}
+	if table.insertArgsPerRow != 40 {
+		t.Fatalf("每行参数数应为40，实际: %d", table.insertArgsPerRow)
+	}
+
+	messages := make([]proto.Message, 2000)
+	c0 := wide.Descriptor().Fields().ByName("c0")
+	for i := range messages {
+		msg := dynamicpb.NewMessage(wide.Descriptor())
+		msg.Set(c0, protoreflect.ValueOfUint64(uint64(i+1)))
+		messages[i] = msg
+	}
+
+	if _, err := table.getBatchInsertSQLWithArgs(messages, len(messages)); !errors.Is(err, ErrBatchSizeExceeded) ||
+		!strings.Contains(err.Error(), "65535") {
+		t.Errorf("超过占位符上限应返回ErrBatchSizeExceeded并提示上限，实际: %v", err)
+	}
+
+	n, err := pdb.BatchInsertPartial(messages)
+	if err != nil || n != len(messages) {
+		t.Fatalf("宽表批量插入应自动分批成功: n=%d err=%v", n, err)
+	}
+	execs := fake.recorded()
+	perBatch := MaxPlaceholders / 40 // 1638行
+	if len(execs) != 2 {
+		t.Fatalf("2000行应按每批%d行分2批，实际: %d", perBatch, len(execs))
+	}
+	if got := len(execs[0].args); got != perBatch*40 {
+		t.Errorf("第1批占位符数应为%d，实际: %d", perBatch*40, got)
+	}
+	if got := len(execs[1].args); got != (2000-perBatch)*40 {
+		t.Errorf("第2批占位符数应为%d，实际: %d", (2000-perBatch)*40, got)
+	}
+	for i, e := range execs {
+		if len(e.args) > MaxPlaceholders {
+			t.Errorf("第%d批超过占位符上限: %d", i+1, len(e.args))
+		}
+	}
+
+	pdb.RegisterTable(wide, WithPrimaryKey("c0"), WithMaxPlaceholders(400))
+	before := len(fake.recorded())
+	if err := pdb.BatchSave(messages[:25]); err != nil {
+		t.Fatalf("BatchSave失败: %v", err)
+	}
+	if got := len(fake.recorded()) - before; got != 3 {
+		t.Errorf("上限400、每行40参数应每批10行，25行分3批，实际: %d", got)
+	}
+
+	if err := newMessageTable(wide, WithMaxPlaceholders(MaxPlaceholders+1)).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("超过65535的上限应校验失败，实际: %v", err)
+	}
+}
+
+// TestFindAggregate 单元测试：多个聚合表达式一次查询，按别名（字段名）写入消息；未知字段/空表达式报错
+func TestFindAggregate(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+
+	msg := &testpb.GolangTest{Ip: "保持不变"}
+	if err := pdb.FindAggregate(msg, map[string]string{"nope": "COUNT(*)"}, "", nil); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知字段应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if err := pdb.FindAggregate(msg, nil, "", nil); err == nil {
+		t.Error("空表达式集合应报错")
+	}
+	if queries := fake.recordedQueries(); len(queries) != 0 {
+		t.Fatalf("参数错误时不应下发SQL，实际: %v", queries)
+	}
+
+	fake.queryRows = [][]driver.Value{{int64(42), nil, int64(9001)}}
+	err := pdb.FindAggregate(msg, map[string]string{
+		"player_id": "MAX(`player_id`)",
+		"id":        "COUNT(*)",
+		"port":      "MIN(`port`)",
+	}, "group_id = ?", []interface{}{7})
+	if err != nil {
+		t.Fatalf("FindAggregate失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 {
+		t.Fatalf("应只下发1条查询，实际: %d", len(queries))
+	}
+	want := "SELECT COUNT(*) AS `id`, MAX(`player_id`) AS `player_id`, MIN(`port`) AS `port` FROM `golang_test` WHERE group_id = ?;"
+	if queries[0].query != want {
+		t.Errorf("聚合SQL不符\n期望: %s\n实际: %s", want, queries[0].query)
+	}
+	if msg.Id != 42 || msg.PlayerId != 0 || msg.Port != 9001 || msg.Ip != "保持不变" {
+		t.Errorf("聚合结果写入不符（NULL应为零值，未选字段保持不变）: %v", msg)
+	}
+}
+
+// TestUpdateTableFieldContext 单元测试：迁移的ALTER用ctx执行，慢DDL在ctx超时后立即返回；
+// WithOnlineDDL的表ALTER末尾追加 ALGORITHM=INPLACE, LOCK=NONE
+func TestUpdateTableFieldContext(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB, pdb.DBName = sqlDB, "game"
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithOnlineDDL())
+
+	// 线上表已存在且只有id列，需要ALTER补齐其余列
+	fake.queryFor = func(query string, _ []driver.NamedValue) [][]driver.Value {
+		switch {
+		case strings.Contains(query, "INFORMATION_SCHEMA.TABLES"):
+			return [][]driver.Value{{int64(1)}}
+		case strings.Contains(query, "INFORMATION_SCHEMA.COLUMNS"):
+			return [][]driver.Value{{"id", "bigint unsigned", "pb:1"}}
+		}
+		return nil
+	}
+	fake.execDelay = 10 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := pdb.UpdateTableFieldContext(ctx, &testpb.GolangTest{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ctx超时应返回DeadlineExceeded，实际: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ctx超时后应及时返回，实际耗时: %v", elapsed)
+	}
+
+	execs := fake.recorded()
+	if len(execs) != 1 || !strings.HasPrefix(execs[0].query, "ALTER TABLE `golang_test` ") {
+		t.Fatalf("应执行1条ALTER TABLE，实际: %+v", execs)
+	}
+	if !strings.HasSuffix(execs[0].query, ", ALGORITHM=INPLACE, LOCK=NONE") {
+		t.Errorf("WithOnlineDDL的ALTER应追加ALGORITHM=INPLACE, LOCK=NONE，实际: %s", execs[0].query)
+	}
+}
+
+// newEventListTestMessage 构造带created_at（google.protobuf.Timestamp）的行消息testdyn.Event与其列表消息
+// testdyn.EventList（repeated Event items），按时间范围查询的测试用它代替testpb
+func newEventListTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	fd := testdyn.NewFile(t, "event_list_test.proto",
+		testdyn.Message("Event",
+			testdyn.Field("id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			testdyn.Field("created_at", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, testdyn.Timestamp)),
+		testdyn.Message("EventList",
+			testdyn.Repeated(testdyn.Field("items", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".testdyn.Event"))))
+	return dynamicpb.NewMessage(fd.Messages().ByName("EventList"))
+}
+
+// newEvent 构造一条testdyn.Event行消息
+func newEvent(list *dynamicpb.Message, id uint64, createdAt time.Time) proto.Message {
+	desc := list.Descriptor().Fields().ByName("items").Message()
+	event := dynamicpb.NewMessage(desc)
+	event.Set(desc.Fields().ByName("id"), protoreflect.ValueOfUint64(id))
+	event.Set(desc.Fields().ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.New(createdAt).ProtoReflect()))
+	return event
+}
+
+// TestFindBetween 单元测试：按时间范围查询生成闭区间BETWEEN，边界按DATETIME格式（UTC）或Unix秒绑定；
+// 非Timestamp列、from晚于to时报错且不下发SQL
+func TestFindBetween(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	list := newEventListTestMessage(t)
+	event := newEvent(list, 1, time.Now())
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(event, WithPrimaryKey("id"))
+
+	from := time.Date(2024, 3, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	to := from.Add(7 * 24 * time.Hour)
+	if err := pdb.FindBetween(list, "id", from, to); err == nil {
+		t.Error("非Timestamp列应报错")
+	}
+	if err := pdb.FindBetween(list, "nope", from, to); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if err := pdb.FindBetween(list, "created_at", to, from); err == nil {
+		t.Error("from晚于to应报错")
+	}
+	if queries := fake.recordedQueries(); len(queries) != 0 {
+		t.Fatalf("参数错误时不应下发SQL，实际: %v", queries)
+	}
+
+	if err := pdb.FindBetween(list, "created_at", from, to); err != nil {
+		t.Fatalf("FindBetween失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.Contains(queries[0].query, "WHERE `created_at` BETWEEN ? AND ?") {
+		t.Fatalf("应生成闭区间BETWEEN查询，实际: %+v", queries)
+	}
+	if got := queries[0].values(); !slices.Equal(got, []interface{}{"2024-03-01 00:00:00", "2024-03-08 00:00:00"}) {
+		t.Errorf("DATETIME边界应按UTC格式化，实际: %v", got)
+	}
+
+	pdb.RegisterTable(event, WithPrimaryKey("id"), WithTimestampAsEpoch("created_at"))
+	if err := pdb.FindBetween(list, "created_at", from, to); err != nil {
+		t.Fatalf("FindBetween失败: %v", err)
+	}
+	queries = fake.recordedQueries()
+	if got := queries[1].values(); !slices.Equal(got, []interface{}{from.Unix(), to.Unix()}) {
+		t.Errorf("Unix秒列边界应绑定秒数，实际: %v", got)
+	}
+}
+
+// TestFindBetweenRoundTrip 集成测试：写入连续一周每天一行，按闭区间查询包含两端边界
+func TestFindBetweenRoundTrip(t *testing.T) {
+	list := newEventListTestMessage(t)
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	pdb := NewDB()
+	pdb.RegisterTable(newEvent(list, 0, start), WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, newEvent(list, 0, start))
+
+	week := make([]proto.Message, 7)
+	for i := range week {
+		week[i] = newEvent(list, uint64(i+1), start.Add(time.Duration(i)*24*time.Hour))
+	}
+	if err := pdb.BatchInsert(week); err != nil {
+		t.Fatalf("写入一周数据失败: %v", err)
+	}
+
+	// 第2天到第4天（含两端）
+	if err := pdb.FindBetween(list, "created_at", start.Add(24*time.Hour), start.Add(3*24*time.Hour)); err != nil {
+		t.Fatalf("FindBetween失败: %v", err)
+	}
+	items := list.Get(list.Descriptor().Fields().ByName("items")).List()
+	if items.Len() != 3 {
+		t.Fatalf("闭区间应返回3行，实际: %d", items.Len())
+	}
+	idField := items.Get(0).Message().Descriptor().Fields().ByName("id")
+	for i := 0; i < items.Len(); i++ {
+		if got := items.Get(i).Message().Get(idField).Uint(); got < 2 || got > 4 {
+			t.Errorf("返回了范围外的行: id=%d", got)
+		}
+	}
+}
+
+// TestPartitioning 单元测试：RANGE/HASH分区子句追加在建表语句末尾，Timestamp列用RANGE COLUMNS；
+// 分区列不在主键/唯一键中、HASH非整数列、分区名重复等配置校验失败
+func TestPartitioning(t *testing.T) {
+	hash := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id", "group_id"), WithHashPartition("group_id", 8))
+	if err := hash.Validate(); err != nil {
+		t.Fatalf("HASH分区配置应校验通过: %v", err)
+	}
+	if want := "COMMENT='golang_test' PARTITION BY HASH (`group_id`) PARTITIONS 8;"; !strings.HasSuffix(hash.GetCreateTableSQL(), want) {
+		t.Errorf("建表SQL应以 %q 结尾\nSQL: %s", want, hash.GetCreateTableSQL())
+	}
+
+	rangeTable := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"),
+		WithRangePartition("id", []Partition{{Name: "p0", LessThan: "1000"}, {Name: "pmax", LessThan: "MAXVALUE"}}))
+	if err := rangeTable.Validate(); err != nil {
+		t.Fatalf("RANGE分区配置应校验通过: %v", err)
+	}
+	want := " PARTITION BY RANGE (`id`) (PARTITION `p0` VALUES LESS THAN (1000), PARTITION `pmax` VALUES LESS THAN MAXVALUE);"
+	if !strings.HasSuffix(rangeTable.GetCreateTableSQL(), want) {
+		t.Errorf("建表SQL应以 %q 结尾\nSQL: %s", want, rangeTable.GetCreateTableSQL())
+	}
+
+	list := newEventListTestMessage(t)
+	event := newEvent(list, 1, time.Now())
+	monthly := newMessageTable(event, WithPrimaryKey("id", "created_at"), WithRangePartition("created_at", []Partition{
+		{Name: "p202401", LessThan: "'2024-02-01'"},
+		{Name: "p202402", LessThan: "'2024-03-01'"},
+	}))
+	if err := monthly.Validate(); err != nil {
+		t.Fatalf("按月分区配置应校验通过: %v", err)
+	}
+	want = " PARTITION BY RANGE COLUMNS(`created_at`) (PARTITION `p202401` VALUES LESS THAN ('2024-02-01'), " +
+		"PARTITION `p202402` VALUES LESS THAN ('2024-03-01'));"
+	if !strings.HasSuffix(monthly.GetCreateTableSQL(), want) {
+		t.Errorf("建表SQL应以 %q 结尾\nSQL: %s", want, monthly.GetCreateTableSQL())
+	}
+
+	for name, opts := range map[string][]TableOption{
+		"分区列不在主键中":  {WithPrimaryKey("id"), WithHashPartition("group_id", 4)},
+		"分区列不在唯一键中": {WithPrimaryKey("id", "group_id"), WithUniqueKey("id,port"), WithHashPartition("group_id", 4)},
+		"HASH非整数列":  {WithPrimaryKey("id", "ip"), WithHashPartition("ip", 4)},
+		"HASH分区数为0": {WithPrimaryKey("id"), WithHashPartition("id", 0)},
+		"RANGE没有分区": {WithPrimaryKey("id"), WithRangePartition("id", nil)},
+		"分区名重复": {WithPrimaryKey("id"), WithRangePartition("id", []Partition{
+			{Name: "p0", LessThan: "10"}, {Name: "P0", LessThan: "20"}})},
+		"分区列不存在": {WithPrimaryKey("id"), WithHashPartition("nope", 4)},
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opts...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("%s: 应返回ErrInvalidTableOption，实际: %v", name, err)
+		}
+	}
+}
+
+// TestExecDDL 单元测试：自定义DDL按原样执行，ExecDDLf转义标识符；执行后清除全部表存在/字段结构缓存；
+// 事务内与空语句直接报错不下发SQL
+func TestExecDDL(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB, pdb.DBName = sqlDB, "game"
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	table, _ := pdb.lookupTable(GetTableName(&testpb.GolangTest{}))
+	pdb.updateTableExistsCache("game", "golang_test", true)
+	pdb.updateTableExistsCache("game", "other", false)
+	table.cachedColumns = map[string]string{"id": "int"}
+
+	if err := pdb.ExecDDLf("ALTER TABLE %s RENAME INDEX %s TO %s", "golang_test", "idx`old", "idx_new"); err != nil {
+		t.Fatalf("ExecDDLf失败: %v", err)
+	}
+	execs := fake.recorded()
+	if want := "ALTER TABLE `golang_test` RENAME INDEX `idx``old` TO `idx_new`"; len(execs) != 1 || execs[0].query != want {
+		t.Fatalf("DDL不符\n期望: %s\n实际: %+v", want, execs)
+	}
+	if len(pdb.tableExistsCache) != 0 || table.cachedColumns != nil {
+		t.Errorf("执行DDL后应清除全部表缓存: exists=%v columns=%v", pdb.tableExistsCache, table.cachedColumns)
+	}
+
+	fake.execErr = &mysql.MySQLError{Number: 1064, Message: "syntax error"}
+	if err := pdb.ExecDDL("ALTER TABLE"); err == nil || !strings.Contains(err.Error(), "ALTER TABLE") {
+		t.Errorf("DDL失败应返回带SQL的错误，实际: %v", err)
+	}
+	fake.execErr = nil
+
+	fake.execs = nil
+	if err := pdb.ExecDDL("  "); err == nil {
+		t.Error("空语句应报错")
+	}
+	err := pdb.RunInTransaction(func(tx *DB) error {
+		return tx.ExecDDL("ALTER TABLE `golang_test` ENGINE=InnoDB")
+	})
+	if err == nil {
+		t.Error("事务内执行DDL应报错")
+	}
+	if execs := fake.recorded(); len(execs) != 0 {
+		t.Errorf("报错时不应下发DDL，实际: %+v", execs)
+	}
+}
+
+// newPresenceTestMessage 构造带enum字段的动态消息testdyn.PlayerPresence（state为testdyn.Presence枚举）
+func newPresenceTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	fd := testdyn.NewFile(t, "presence_test.proto",
+		testdyn.Enum("Presence", "OFFLINE", "ONLINE", "AWAY"),
+		testdyn.Message("PlayerPresence",
+			testdyn.Field("id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			testdyn.Field("state", descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".testdyn.Presence")))
+	return dynamicpb.NewMessage(fd.Messages().ByName("PlayerPresence"))
+}
+
+// TestWithNativeEnum 单元测试：enum字段建为ENUM('值名',...)列，写入值名、读取映射回枚举值；
+// 线上ENUM值列表与proto不一致时MODIFY COLUMN，一致时不改
+func TestWithNativeEnum(t *testing.T) {
+	msg := newPresenceTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfUint64(7))
+	msg.Set(fields.ByName("state"), protoreflect.ValueOfEnum(1))
+
+	table := newMessageTable(msg, WithPrimaryKey("id"), WithNativeEnum("state"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("原生ENUM配置应校验通过: %v", err)
+	}
+	enumType := "ENUM('OFFLINE','ONLINE','AWAY') NOT NULL"
+	if want := "`state` " + enumType + " COMMENT 'pb:2'"; !strings.Contains(table.GetCreateTableSQL(), want) {
+		t.Errorf("建表SQL缺少 %q\nSQL: %s", want, table.GetCreateTableSQL())
+	}
+
+	insertSQL, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	if fmt.Sprint(insertSQL.Args) != "[7 ONLINE]" {
+		t.Errorf("ENUM列应写入值名，实际参数: %v", insertSQL.Args)
+	}
+
+	parsed := dynamicpb.NewMessage(msg.Descriptor())
+	if err := table.parseRow(parsed, [][]byte{[]byte("8"), []byte("AWAY")}); err != nil {
+		t.Fatalf("解析ENUM列失败: %v", err)
+	}
+	if got := parsed.Get(fields.ByName("state")).Enum(); got != 2 {
+		t.Errorf("值名AWAY应解析为2，实际: %d", got)
+	}
+
+	idType := table.getMySQLFieldType(fields.ByName("id"))
+	stale := map[string]columnMeta{
+		"id":    {colType: idType, fieldNum: 1},
+		"state": {colType: "enum('OFFLINE','ONLINE')", fieldNum: 2},
+	}
+	if clauses := table.buildAlterClauses(stale); len(clauses) != 1 || clauses[0] != "MODIFY COLUMN `state` "+enumType+" COMMENT 'pb:2'" {
+		t.Errorf("新增枚举值应MODIFY COLUMN，实际: %v", clauses)
+	}
+	current := map[string]columnMeta{
+		"id":    {colType: idType, fieldNum: 1},
+		"state": {colType: "enum('OFFLINE','ONLINE','AWAY')", fieldNum: 2},
+	}
+	if clauses := table.buildAlterClauses(current); len(clauses) != 0 {
+		t.Errorf("值列表一致时不应改列，实际: %v", clauses)
+	}
+
+	// 主键中的ENUM列按值名匹配，否则按主键读写永远命中不了行
+	composite := newMessageTable(msg, WithPrimaryKey("id", "state"), WithNativeEnum("state"))
+	if where, args, err := composite.primaryKeyWhere(msg); err != nil || fmt.Sprint(args) != "[7 ONLINE]" {
+		t.Errorf("主键ENUM列应按值名绑定，实际: %s %v %v", where, args, err)
+	}
+
+	if err := newMessageTable(msg, WithNativeEnum("id")).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("非enum字段应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestFindAfter 单元测试：键集分页从首页逐页向后翻，每页 WHERE id > 上一页最后的id ORDER BY id ASC LIMIT n，
+// 直到返回空页；结果连续且不重复
+func TestFindAfter(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+
+	// 模拟按id排好序的7行数据，按游标参数与LIMIT返回下一页
+	const total, pageSize = 7, 3
+	fake.queryFor = func(query string, args []driver.NamedValue) [][]driver.Value {
+		after := int64(0)
+		if len(args) > 0 {
+			after = args[len(args)-1].Value.(int64)
+		}
+		var rows [][]driver.Value
+		for id := after + 1; id <= total && len(rows) < pageSize; id++ {
+			rows = append(rows, []driver.Value{id, "", int64(0), int64(0), "", int64(0)})
+		}
+		return rows
+	}
+
+	if err := pdb.FindAfter(&testpb.GolangTestList{}, "nope", nil, pageSize); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知排序列应返回ErrFieldNotFound，实际: %v", err)
+	}
+
+	var seen []uint32
+	var after interface{}
+	for page := 0; page < 10; page++ {
+		list := &testpb.GolangTestList{}
+		if err := pdb.FindAfter(list, "id", after, pageSize); err != nil {
+			t.Fatalf("第%d页FindAfter失败: %v", page+1, err)
+		}
+		if len(list.TestList) == 0 {
+			break
+		}
+		for _, row := range list.TestList {
+			seen = append(seen, row.Id)
+		}
+		after = int64(list.TestList[len(list.TestList)-1].Id)
+	}
+	if fmt.Sprint(seen) != "[1 2 3 4 5 6 7]" {
+		t.Errorf("逐页翻完应得到连续不重复的id，实际: %v", seen)
+	}
+
+	queries := fake.recordedQueries()
+	if len(queries) != 4 {
+		t.Fatalf("7行按每页3行应查询3页加1次空页，实际: %d", len(queries))
+	}
+	if !strings.HasSuffix(queries[0].query, " ORDER BY `id` ASC LIMIT 3;") || len(queries[0].args) != 0 {
+		t.Errorf("首页不应带游标条件: %s %v", queries[0].query, queries[0].values())
+	}
+	if !strings.Contains(queries[1].query, "`id` > ? ORDER BY `id` ASC LIMIT 3;") || fmt.Sprint(queries[1].values()) != "[3]" {
+		t.Errorf("后续页应按上一页最后的id过滤: %s %v", queries[1].query, queries[1].values())
+	}
+}
+
+// TestAutoIncrementKeyValidation 单元测试：自增字段须为主键或普通/唯一索引的首列，否则Validate报错而不是让MySQL建表报1075
+func TestAutoIncrementKeyValidation(t *testing.T) {
+	valid := []*MessageTable{
+		newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("id")),
+		newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("player_id"), WithIndexes("player_id")),
+		newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("player_id"), WithUniqueKey("player_id,group_id")),
+	}
+	for i, table := range valid {
+		if err := table.Validate(); err != nil {
+			t.Errorf("第%d个合法自增配置不应报错: %v", i, err)
+		}
+	}
+
+	invalid := map[string]*MessageTable{
+		"未建索引":  newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("player_id")),
+		"非索引首列": newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("player_id"), WithIndexes("group_id,player_id")),
+		"非主键首列": newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("group_id", "id"), WithAutoIncrementKey("id")),
+		"字段不存在": newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("seq")),
+		"非整数字段": newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("ip"), WithAutoIncrementKey("ip")),
+	}
+	for name, table := range invalid {
+		err := table.Validate()
+		if !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("%s: 应返回ErrInvalidTableOption，实际: %v", name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), "auto-increment column "+table.autoIncreaseKey) {
+			t.Errorf("%s: 错误信息应指明自增列: %v", name, err)
+		}
+	}
+
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("player_id"))
+	if err := pdb.WriteCreateTableSQL(&strings.Builder{}); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("导出非法自增配置的建表语句应报错，实际: %v", err)
+	}
+}
+
+// TestFindInto 单元测试：按元素类型解析表，查询结果追加到调用方切片，无需列表消息
+func TestFindInto(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	fake.queryRows = [][]driver.Value{
+		{int64(2), []byte("10.0.0.2"), int64(80), int64(7), []byte(""), int64(0)},
+		{int64(3), []byte("10.0.0.3"), int64(81), int64(7), []byte(""), int64(0)},
+	}
+
+	rows := []*testpb.GolangTest{{Id: 1}}
+	if err := pdb.FindInto(&rows, "WHERE group_id = ?", 7); err != nil {
+		t.Fatalf("FindInto失败: %v", err)
+	}
+	if len(rows) != 3 || rows[0].Id != 1 || rows[1].Id != 2 || rows[2].Ip != "10.0.0.3" || rows[2].Port != 81 {
+		t.Fatalf("查询结果应追加在原有元素之后: %v", rows)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.HasSuffix(queries[0].query, " FROM `golang_test` WHERE group_id = ?;") ||
+		fmt.Sprint(queries[0].values()) != "[7]" {
+		t.Fatalf("SQL应按元素类型查golang_test表: %+v", queries)
+	}
+
+	var all []*testpb.GolangTest
+	if err := pdb.FindInto(&all, ""); err != nil || len(all) != 2 {
+		t.Fatalf("空条件应查全表: %v %v", all, err)
+	}
+	if q := fake.recordedQueries()[1].query; !strings.HasSuffix(q, " WHERE 1=1;") {
+		t.Errorf("空条件应生成 WHERE 1=1: %s", q)
+	}
+
+	var unregistered []*testpb.GolangTestList
+	if err := pdb.FindInto(&unregistered, ""); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("未注册的元素类型应返回ErrTableNotFound，实际: %v", err)
+	}
+	for _, dest := range []interface{}{rows, &[]testpb.GolangTest{}, &[]string{}, (*[]*testpb.GolangTest)(nil)} {
+		if err := pdb.FindInto(dest, ""); err == nil {
+			t.Errorf("非法dest %T 应返回错误", dest)
+		}
+	}
+}
+
+// TestWithColumnCollation 单元测试：只在指定的文本列上生成COLLATE，排序规则须与utf8mb4兼容
+func TestWithColumnCollation(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithColumnCollation("ip", "utf8mb4_bin"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	createSQL := table.GetCreateTableSQL()
+	if !strings.Contains(createSQL, "`ip` MEDIUMTEXT COLLATE utf8mb4_bin COMMENT 'pb:2'") {
+		t.Errorf("ip列应带COLLATE utf8mb4_bin: %s", createSQL)
+	}
+	if n := strings.Count(createSQL, "COLLATE utf8mb4_bin"); n != 1 {
+		t.Errorf("COLLATE只应出现在ip列上，实际%d次: %s", n, createSQL)
+	}
+	if !isTypeMatch("mediumtext", table.getMySQLFieldType(table.fieldNameToDesc["ip"])) {
+		t.Error("COLLATE不应影响列类型比对")
+	}
+
+	nullable := newMessageTable(&testpb.GolangTest{}, WithNullableFields("ip"), WithColumnCollation("ip", "utf8mb4_0900_as_cs"))
+	if got := nullable.getMySQLFieldType(nullable.fieldNameToDesc["ip"]); got != "MEDIUMTEXT COLLATE utf8mb4_0900_as_cs" {
+		t.Errorf("可空列的排序规则: %s", got)
+	}
+
+	for name, opt := range map[string]TableOption{
+		"字符集不兼容": WithColumnCollation("ip", "latin1_bin"),
+		"非法名称":   WithColumnCollation("ip", "utf8mb4_bin; DROP TABLE x"),
+		"非文本列":   WithColumnCollation("port", "utf8mb4_bin"),
+		"字段不存在":  WithColumnCollation("nope", "utf8mb4_bin"),
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("%s: 应返回ErrInvalidTableOption，实际: %v", name, err)
+		}
+	}
+}
+
+// newNodeListTestMessage 构造动态消息testdyn.NodeList（repeated Node items），Node{id, parent_id, name}为以parent_id自关联的树节点
+func newNodeListTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	fd := testdyn.NewFile(t, "node_list_test.proto",
+		testdyn.Message("Node",
+			testdyn.Field("id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			testdyn.Field("parent_id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			testdyn.Field("name", descriptorpb.FieldDescriptorProto_TYPE_STRING)),
+		testdyn.Message("NodeList",
+			testdyn.Repeated(testdyn.Field("items", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".testdyn.Node"))))
+	return dynamicpb.NewMessage(fd.Messages().ByName("NodeList"))
+}
+
+// newNode 构造一条testdyn.Node行消息
+func newNode(list *dynamicpb.Message, id, parentID uint64, name string) proto.Message {
+	desc := list.Descriptor().Fields().ByName("items").Message()
+	node := dynamicpb.NewMessage(desc)
+	node.Set(desc.Fields().ByName("id"), protoreflect.ValueOfUint64(id))
+	node.Set(desc.Fields().ByName("parent_id"), protoreflect.ValueOfUint64(parentID))
+	node.Set(desc.Fields().ByName("name"), protoreflect.ValueOfString(name))
+	return node
+}
+
+// nodeListIDs 返回NodeList中各节点的id（按id升序）
+func nodeListIDs(list *dynamicpb.Message) []uint64 {
+	items := list.Get(list.Descriptor().Fields().ByName("items")).List()
+	ids := make([]uint64, items.Len())
+	for i := range ids {
+		node := items.Get(i).Message()
+		ids[i] = node.Get(node.Descriptor().Fields().ByName("id")).Uint()
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// TestFindDescendants 单元测试：递归CTE从根节点出发查三层树的后代，maxDepth限制层数，未知列报错
+func TestFindDescendants(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	list := newNodeListTestMessage(t)
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(newNode(list, 0, 0, ""), WithPrimaryKey("id"))
+
+	// 1 → 2,3；2 → 4,5；4 → 6。fake按CTE的参数（根、层数上限）模拟递归
+	parents := map[uint64]uint64{2: 1, 3: 1, 4: 2, 5: 2, 6: 4}
+	fake.queryFor = func(query string, args []driver.NamedValue) [][]driver.Value {
+		root := args[0].Value.(int64)
+		maxDepth := int64(1 << 30)
+		if len(args) > 1 {
+			maxDepth = args[1].Value.(int64)
+		}
+		var rows [][]driver.Value
+		for id := uint64(1); id <= 6; id++ {
+			depth := int64(0) // id到root的层数，0表示不是root的后代
+			for p, steps := id, int64(1); parents[p] != 0; p, steps = parents[p], steps+1 {
+				if int64(parents[p]) == root {
+					depth = steps
+					break
+				}
+			}
+			if depth > 0 && depth <= maxDepth {
+				rows = append(rows, []driver.Value{int64(id), int64(parents[id]), []byte(fmt.Sprintf("n%d", id))})
+			}
+		}
+		return rows
+	}
+
+	if err := pdb.FindDescendants(list, "id", "parent_id", 1, 0); err != nil {
+		t.Fatalf("FindDescendants失败: %v", err)
+	}
+	if got := nodeListIDs(list); fmt.Sprint(got) != "[2 3 4 5 6]" {
+		t.Errorf("根节点的后代应为三层共5个节点，实际: %v", got)
+	}
+	queries := fake.recordedQueries()
+	wantSQL := "WITH RECURSIVE `descendants` (`node_id`, `depth`) AS (" +
+		"SELECT `id`, 1 FROM `testdyn.Node` WHERE `parent_id` = ? " +
+		"UNION ALL SELECT c.`id`, d.`depth` + 1 FROM `testdyn.Node` AS c JOIN `descendants` AS d ON c.`parent_id` = d.`node_id`) " +
+		"SELECT `id`, `parent_id`, `name` FROM `testdyn.Node` WHERE `id` IN (SELECT `node_id` FROM `descendants`);"
+	if queries[0].query != wantSQL || fmt.Sprint(queries[0].values()) != "[1]" {
+		t.Errorf("递归CTE不符合预期:\n got: %s %v\nwant: %s", queries[0].query, queries[0].values(), wantSQL)
+	}
+
+	if err := pdb.FindDescendants(list, "id", "parent_id", 1, 2); err != nil {
+		t.Fatalf("FindDescendants失败: %v", err)
+	}
+	if got := nodeListIDs(list); fmt.Sprint(got) != "[2 3 4 5]" {
+		t.Errorf("maxDepth=2只应返回两层后代，实际: %v", got)
+	}
+	if q := fake.recordedQueries()[1]; !strings.Contains(q.query, "= d.`node_id` WHERE d.`depth` < ?)") || fmt.Sprint(q.values()) != "[1 2]" {
+		t.Errorf("maxDepth应作为递归部分的层数条件: %s %v", q.query, q.values())
+	}
+
+	if err := pdb.FindDescendants(list, "id", "nope", 1, 0); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知列应返回ErrFieldNotFound，实际: %v", err)
+	}
+}
+
+// TestFindDescendantsRoundTrip 集成测试：在MySQL 8.0上写入三层树，从根节点查全部后代
+func TestFindDescendantsRoundTrip(t *testing.T) {
+	list := newNodeListTestMessage(t)
+	pdb := NewDB()
+	pdb.RegisterTable(newNode(list, 0, 0, ""), WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, newNode(list, 0, 0, ""))
+
+	nodes := []proto.Message{
+		newNode(list, 1, 0, "root"),
+		newNode(list, 2, 1, "a"), newNode(list, 3, 1, "b"),
+		newNode(list, 4, 2, "a1"), newNode(list, 5, 2, "a2"),
+		newNode(list, 6, 4, "a1x"),
+		newNode(list, 7, 0, "other"),
+	}
+	if err := pdb.BatchInsert(nodes); err != nil {
+		t.Fatalf("写入树失败: %v", err)
+	}
+
+	if err := pdb.FindDescendants(list, "id", "parent_id", uint64(1), 0); err != nil {
+		t.Fatalf("FindDescendants失败: %v", err)
+	}
+	if got := nodeListIDs(list); fmt.Sprint(got) != "[2 3 4 5 6]" {
+		t.Errorf("根节点的后代应为[2 3 4 5 6]，实际: %v", got)
+	}
+	if err := pdb.FindDescendants(list, "id", "parent_id", uint64(2), 1); err != nil {
+		t.Fatalf("FindDescendants失败: %v", err)
+	}
+	if got := nodeListIDs(list); fmt.Sprint(got) != "[4 5]" {
+		t.Errorf("maxDepth=1只应返回直接子节点，实际: %v", got)
+	}
+}
+
+// TestLatin1Charset 单元测试：连接与建表字符集可配置（默认utf8mb4），SetCharset作为注册表的默认值、
+// 建库语句同步使用；列排序规则须属于表字符集
+func TestLatin1Charset(t *testing.T) {
+	if got := NewMysqlConfig(JsonConfig{}).Params["charset"]; got != DefaultCharset {
+		t.Errorf("默认连接字符集应为utf8mb4，实际: %s", got)
+	}
+	cfg := NewMysqlConfig(JsonConfig{Charset: "latin1"})
+	if got := cfg.Params["charset"]; got != "latin1" {
+		t.Errorf("连接字符集应取JsonConfig.Charset，实际: %s", got)
+	}
+	if createSQL := GenerateCreateTableSQL(&testpb.GolangTest{}); !strings.Contains(createSQL, " DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT=") {
+		t.Errorf("默认建表字符集应为utf8mb4: %s", createSQL)
+	}
+
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	if err := pdb.setCharsetFromParams(cfg.Params); err != nil {
+		t.Fatalf("按DSN设置字符集失败: %v", err)
+	}
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithColumnCollation("ip", "latin1_bin"))
+	table, _ := pdb.lookupTable(GetTableName(&testpb.GolangTest{}))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("latin1表配置应校验通过: %v", err)
+	}
+	createSQL := table.GetCreateTableSQL()
+	if !strings.Contains(createSQL, ") ENGINE=InnoDB DEFAULT CHARSET=latin1 COMMENT=") || strings.Contains(createSQL, "utf8mb4") {
+		t.Errorf("应生成latin1表: %s", createSQL)
+	}
+	if !strings.Contains(createSQL, "`ip` MEDIUMTEXT COLLATE latin1_bin") {
+		t.Errorf("列排序规则应为latin1_bin: %s", createSQL)
+	}
+	if err := pdb.CreateDatabaseIfNotExists("legacy"); err != nil {
+		t.Fatalf("CreateDatabaseIfNotExists失败: %v", err)
+	}
+	if got := fake.recorded()[0].query; got != "CREATE DATABASE IF NOT EXISTS `legacy` CHARACTER SET latin1" {
+		t.Errorf("建库字符集应与SetCharset一致: %s", got)
+	}
+
+	swedish := newMessageTable(&testpb.GolangTest{}, WithCharset("latin1", "latin1_swedish_ci"))
+	if createSQL := swedish.GetCreateTableSQL(); !strings.Contains(createSQL, " DEFAULT CHARSET=latin1 COLLATE=latin1_swedish_ci COMMENT=") {
+		t.Errorf("WithCharset应指定表排序规则: %s", createSQL)
+	}
+	for name, table := range map[string]*MessageTable{
+		"排序规则不属于字符集": newMessageTable(&testpb.GolangTest{}, WithCharset("latin1", "utf8mb4_bin")),
+		"非法字符集名":     newMessageTable(&testpb.GolangTest{}, WithCharset("latin1; DROP", "")),
+		"列排序规则与表不符":  newMessageTable(&testpb.GolangTest{}, WithCharset("latin1", ""), WithColumnCollation("ip", "utf8mb4_bin")),
+	} {
+		if err := table.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("%s: 应返回ErrInvalidTableOption，实际: %v", name, err)
+		}
+	}
+	if err := pdb.SetCharset("utf8mb4", "latin1_bin"); err == nil {
+		t.Error("SetCharset应校验排序规则属于字符集")
+	}
+}
+
+// TestColumnType 单元测试：ColumnType返回含表配置覆盖的列类型，未知/忽略字段返回ErrFieldNotFound
+func TestColumnType(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAutoIncrementKey("id"),
+		WithNullableFields("ip"), WithSignedColumns("player_id"), WithIgnoredFields("player"))
+	for field, want := range map[string]string{
+		"id":        "int unsigned NOT NULL AUTO_INCREMENT",
+		"ip":        "MEDIUMTEXT",
+		"port":      "int unsigned NOT NULL DEFAULT 0",
+		"player_id": "bigint NOT NULL DEFAULT 0",
+	} {
+		got, err := table.ColumnType(field)
+		if err != nil || got != want {
+			t.Errorf("ColumnType(%s) = %q, %v，期望 %q", field, got, err, want)
+		}
+	}
+	for _, field := range []string{"nope", "player"} {
+		if _, err := table.ColumnType(field); !errors.Is(err, ErrFieldNotFound) {
+			t.Errorf("ColumnType(%s)应返回ErrFieldNotFound，实际: %v", field, err)
+		}
+	}
+}
+
+// streamTestRow 按需生成的第i行GolangTest数据（6列）
+func streamTestRow(i int) []driver.Value {
+	return []driver.Value{int64(i + 1), []byte("10.0.0.1"), int64(80), int64(i % 16), []byte(""), int64(i)}
+}
+
+// TestStreamChanRowByRow 单元测试：StreamChan逐行从驱动拉取并发送，不在库内缓冲整个结果集——
+// 驱动生成的行数始终只比消费方已收到的多常数行，消费方处理得慢时读取也随之暂停
+func TestStreamChanRowByRow(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+
+	const total = 100000
+	var produced atomic.Int64
+	fake.queryStream = func(i int) []driver.Value {
+		if i >= total {
+			return nil
+		}
+		produced.Add(1)
+		return streamTestRow(i)
+	}
+
+	rowsCh, errCh := pdb.StreamChan(&testpb.GolangTest{}, "", nil)
+	consumed := int64(0)
+	for row := range rowsCh {
+		consumed++
+		if row.(*testpb.GolangTest).Id != uint32(consumed) {
+			t.Fatalf("第%d行id错误: %v", consumed, row)
+		}
+		if ahead := produced.Load() - consumed; ahead > 2 {
+			t.Fatalf("驱动已生成%d行而只消费了%d行，结果集被预先缓冲", produced.Load(), consumed)
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("StreamChan失败: %v", err)
+	}
+	if consumed != total {
+		t.Errorf("应读到%d行，实际: %d", total, consumed)
+	}
+}
+
+// BenchmarkStreamChan 每行的内存分配为常数（与结果集大小无关），b.N即结果集行数
+func BenchmarkStreamChan(b *testing.B) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	fake.queryStream = func(i int) []driver.Value {
+		if i >= b.N {
+			return nil
+		}
+		return streamTestRow(i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	rowsCh, errCh := pdb.StreamChan(&testpb.GolangTest{}, "", nil)
+	for range rowsCh {
+	}
+	if err := <-errCh; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkSave 高频Save：REPLACE语句使用Init时缓存的模板，每次只序列化参数
+func BenchmarkSave(b *testing.B) {
+	sqlDB, _ := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	msg := &testpb.GolangTest{Id: 1, Ip: "10.0.0.1", Port: 80, GroupId: 7}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg.Port = uint32(i)
+		if err := pdb.Save(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestUpsert 单元测试：先按主键 SELECT ... FOR UPDATE，行存在时UPDATE、不存在时INSERT，不会下发REPLACE
+func TestUpsert(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+
+	exists := false
+	fake.queryFor = func(string, []driver.NamedValue) [][]driver.Value {
+		if exists {
+			return [][]driver.Value{{int64(1)}}
+		}
+		return nil
+	}
+
+	msg := &testpb.GolangTest{Id: 9, Ip: "10.0.0.9", Port: 80}
+	if err := pdb.Upsert(msg); err != nil {
+		t.Fatalf("Upsert（插入）失败: %v", err)
+	}
+	exists = true
+	if err := pdb.Upsert(msg); err != nil {
+		t.Fatalf("Upsert（更新）失败: %v", err)
+	}
+
+	queries := fake.recordedQueries()
+	if len(queries) != 2 || queries[0].query != "SELECT 1 FROM `golang_test` WHERE `id` = ? FOR UPDATE;" ||
+		fmt.Sprint(queries[0].values()) != "[9]" {
+		t.Fatalf("应先按主键加锁判断存在性: %+v", queries)
+	}
+	execs := fake.recorded()
+	if len(execs) != 2 || !strings.HasPrefix(execs[0].query, "INSERT INTO `golang_test` ") ||
+		!strings.HasPrefix(execs[1].query, "UPDATE `golang_test` SET ") || !strings.HasSuffix(execs[1].query, " WHERE `id` = ?") {
+		t.Fatalf("不存在时应INSERT、存在时应原地UPDATE: %+v", execs)
+	}
+
+	// 已在事务内时复用该事务
+	if err := pdb.RunInTransaction(func(tx *DB) error { return tx.Upsert(msg) }); err != nil {
+		t.Fatalf("事务内Upsert失败: %v", err)
+	}
+	if err := pdb.Upsert(&testpb.GolangTestList{}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("未注册的消息应返回ErrTableNotFound，实际: %v", err)
+	}
+}
+
+// TestUpsertDefaultWhere 单元测试：配置WithDefaultWhere时存在性判断带默认条件，
+// 其他租户的同主键行不算存在，走INSERT（由主键冲突报错）而不是静默影响0行的UPDATE
+func TestUpsertDefaultWhere(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithDefaultWhere("`group_id` = ?", 7))
+
+	if err := pdb.Upsert(&testpb.GolangTest{Id: 9, GroupId: 7}); err != nil {
+		t.Fatalf("Upsert失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || queries[0].query != "SELECT 1 FROM `golang_test` WHERE (`group_id` = ?) AND (`id` = ?) FOR UPDATE;" ||
+		fmt.Sprint(queries[0].values()) != "[7 9]" {
+		t.Fatalf("存在性判断应带默认条件: %+v", queries)
+	}
+	if execs := fake.recorded(); len(execs) != 1 || !strings.HasPrefix(execs[0].query, "INSERT INTO `golang_test` ") {
+		t.Errorf("默认条件下不存在时应INSERT: %+v", execs)
+	}
+}
+
+// TestUpsertKeepsForeignKeyChildren 集成测试：子表外键 ON DELETE CASCADE 指向golang_test时，
+// Save（REPLACE先删后插）会级联删掉子行，Upsert原地UPDATE则保留子行
+func TestUpsertKeepsForeignKeyChildren(t *testing.T) {
+	pdb := NewDB()
+	parent := &testpb.GolangTest{}
+	pdb.RegisterTable(parent, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	if _, err := db.Exec("DROP TABLE IF EXISTS `golang_test_child`"); err != nil {
+		t.Fatalf("清理子表失败: %v", err)
+	}
+	recreateTestTable(t, db, pdb, parent)
+	if _, err := db.Exec("CREATE TABLE `golang_test_child` (`id` int unsigned NOT NULL PRIMARY KEY, " +
+		"`parent_id` int unsigned NOT NULL, FOREIGN KEY (`parent_id`) REFERENCES `golang_test` (`id`) ON DELETE CASCADE) ENGINE=InnoDB"); err != nil {
+		t.Fatalf("创建子表失败: %v", err)
+	}
+	defer db.Exec("DROP TABLE IF EXISTS `golang_test_child`")
+
+	countChildren := func() int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM `golang_test_child` WHERE `parent_id` = 1").Scan(&n); err != nil {
+			t.Fatalf("统计子行失败: %v", err)
+		}
+		return n
+	}
+
+	if err := pdb.Upsert(&testpb.GolangTest{Id: 1, Ip: "10.0.0.1"}); err != nil {
+		t.Fatalf("Upsert插入失败: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO `golang_test_child` VALUES (1, 1), (2, 1)"); err != nil {
+		t.Fatalf("写入子行失败: %v", err)
+	}
+
+	if err := pdb.Upsert(&testpb.GolangTest{Id: 1, Ip: "10.0.0.2"}); err != nil {
+		t.Fatalf("Upsert更新失败: %v", err)
+	}
+	if n := countChildren(); n != 2 {
+		t.Errorf("Upsert应原地更新并保留子行，实际剩余: %d", n)
+	}
+	got := &testpb.GolangTest{Id: 1}
+	if err := pdb.FindOneByPK(got); err != nil || got.Ip != "10.0.0.2" {
+		t.Errorf("Upsert应更新字段: %v %v", got, err)
+	}
+
+	if err := pdb.Save(&testpb.GolangTest{Id: 1, Ip: "10.0.0.3"}); err != nil {
+		t.Fatalf("Save失败: %v", err)
+	}
+	if n := countChildren(); n != 0 {
+		t.Errorf("Save（REPLACE）应级联删除子行，实际剩余: %d", n)
+	}
+}
+
+// TestSetDefaultTimeout 单元测试：未绑定ctx时慢查询/慢写按默认超时中止，WithContext绑定的ctx优先，d<=0关闭超时
+func TestSetDefaultTimeout(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	pdb.SetDefaultTimeout(20 * time.Millisecond)
+	fake.queryDelay = time.Second
+	fake.execDelay = time.Second
+
+	start := time.Now()
+	list := &testpb.GolangTestList{}
+	if err := pdb.FindAll(list); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("慢查询应因默认超时返回DeadlineExceeded，实际: %v", err)
+	}
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("慢写入应因默认超时返回DeadlineExceeded，实际: %v", err)
+	}
+	if _, err := pdb.ExistsByPK(&testpb.GolangTest{Id: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("单行查询同样受默认超时约束，实际: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("三条慢语句应各自在超时后立即返回，实际耗时: %v", elapsed)
+	}
+	if err := pdb.RunInTransaction(func(tx *DB) error { return tx.Insert(&testpb.GolangTest{Id: 1}) }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("事务内语句沿用默认超时，实际: %v", err)
+	}
+
+	// 调用方显式传入的ctx优先于默认超时
+	fake.queryDelay = 50 * time.Millisecond
+	if err := pdb.WithContext(context.Background()).FindAll(list); err != nil {
+		t.Errorf("绑定ctx后不应再附加默认超时: %v", err)
+	}
+	pdb.SetDefaultTimeout(0)
+	if err := pdb.FindAll(list); err != nil {
+		t.Errorf("关闭默认超时后查询应成功: %v", err)
+	}
+}
+
+// TestDefaultTimeoutReleasedAfterQuery 单元测试：默认超时较长时，查询、单行查询与多语句查询在读完结果后即释放语句context，
+// 不等到超时才回收定时器
+func TestDefaultTimeoutReleasedAfterQuery(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	pdb.SetDefaultTimeout(time.Hour)
+	fake.queryRows = [][]driver.Value{{"1", "10.0.0.1", "80", "7", "", "0"}}
+
+	if err := pdb.FindAll(&testpb.GolangTestList{}); err != nil {
+		t.Fatalf("FindAll失败: %v", err)
+	}
+	fake.queryRows = [][]driver.Value{{int64(1)}}
+	if _, err := pdb.ExistsByPK(&testpb.GolangTest{Id: 1}); err != nil {
+		t.Fatalf("ExistsByPK失败: %v", err)
+	}
+	fake.queryRows = [][]driver.Value{{"1", "10.0.0.1", "80", "7", "", "0"}}
+	queries := []MultiQuery{{Message: &testpb.GolangTest{}, WhereClause: "id = ?", WhereArgs: []interface{}{1}}}
+	if err := pdb.StreamMultiByWhereClauses(queries, func(int, proto.Message) error { return nil }); err != nil {
+		t.Fatalf("StreamMultiByWhereClauses失败: %v", err)
+	}
+	if len(fake.queryCtxs) != 3 {
+		t.Fatalf("应记录3条查询，实际: %d", len(fake.queryCtxs))
+	}
+	if _, ok := fake.queryCtxs[2].Deadline(); !ok {
+		t.Error("多语句查询同样应受默认超时约束")
+	}
+	for i, ctx := range fake.queryCtxs {
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			t.Errorf("第%d条查询结束后语句context应已释放，实际: %v", i+1, ctx.Err())
+		}
+	}
+}
+
+// TestFindManyByCompositeKeys 单元测试：按 (group_id, player_id) 组合键生成行构造器IN，超过批量上限时分批查询并合并结果；
+// 空tuples不下发SQL，未知列与元素个数不符时报错
+func TestFindManyByCompositeKeys(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	if err := pdb.SetBatchSize(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按参数中的组合键返回对应行（player_id=0的键不存在）
+	fake.queryFor = func(_ string, args []driver.NamedValue) [][]driver.Value {
+		var rows [][]driver.Value
+		for i := 0; i+1 < len(args); i += 2 {
+			group, player := args[i].Value.(int64), args[i+1].Value.(int64)
+			if player != 0 {
+				rows = append(rows, []driver.Value{player*10 + group, []byte(""), int64(0), group, []byte(""), player})
+			}
+		}
+		return rows
+	}
+
+	list := &testpb.GolangTestList{TestList: []*testpb.GolangTest{{Id: 999}}}
+	keys := [][]interface{}{{1, 100}, {2, 100}, {1, 0}, {1, 101}, {3, 102}}
+	if err := pdb.FindManyByCompositeKeys(list, []string{"group_id", "player_id"}, keys); err != nil {
+		t.Fatalf("FindManyByCompositeKeys失败: %v", err)
+	}
+	var got []string
+	for _, row := range list.TestList {
+		got = append(got, fmt.Sprintf("%d/%d", row.GroupId, row.PlayerId))
+	}
+	if strings.Join(got, " ") != "1/100 2/100 1/101 3/102" {
+		t.Errorf("应按组合键合并各批结果（清空原有元素，跳过不存在的键），实际: %v", got)
+	}
+
+	queries := fake.recordedQueries()
+	if len(queries) != 3 {
+		t.Fatalf("5组键按每批2组应查询3次，实际: %d", len(queries))
+	}
+	if !strings.HasSuffix(queries[0].query, " WHERE (`group_id`, `player_id`) IN ((?, ?), (?, ?));") ||
+		fmt.Sprint(queries[0].values()) != "[1 100 2 100]" {
+		t.Errorf("首批SQL或参数错误: %s %v", queries[0].query, queries[0].values())
+	}
+	if !strings.HasSuffix(queries[2].query, " IN ((?, ?));") {
+		t.Errorf("末批只应有1组键: %s", queries[2].query)
+	}
+
+	if err := pdb.FindManyByCompositeKeys(list, []string{"group_id", "player_id"}, nil); err != nil || len(list.TestList) != 0 {
+		t.Errorf("空tuples应清空list: %v %v", list.TestList, err)
+	}
+	if len(fake.recordedQueries()) != 3 {
+		t.Error("空tuples不应下发SQL")
+	}
+	if err := pdb.FindManyByCompositeKeys(list, []string{"group_id", "nope"}, keys); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if err := pdb.FindManyByCompositeKeys(list, []string{"group_id", "player_id"}, [][]interface{}{{1}}); err == nil {
+		t.Error("键值个数与列数不符应报错")
+	}
+}
+
+// TestSetKindType 单元测试：类型映射按实例/按表覆盖，不修改全局MySQLFieldTypes，也不影响其他实例
+func TestSetKindType(t *testing.T) {
+	pdb := NewDB()
+	pdb.SetKindType(protoreflect.StringKind, "VARCHAR(255) NOT NULL DEFAULT ''")
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithNullableFields("player"))
+	table, _ := pdb.lookupTable(GetTableName(&testpb.GolangTest{}))
+
+	if got, _ := table.ColumnType("ip"); got != "VARCHAR(255) NOT NULL DEFAULT ''" {
+		t.Errorf("string字段应使用实例的类型映射，实际: %s", got)
+	}
+	if MySQLFieldTypes[protoreflect.StringKind] != "MEDIUMTEXT" {
+		t.Errorf("不应修改全局MySQLFieldTypes: %s", MySQLFieldTypes[protoreflect.StringKind])
+	}
+	if got, _ := newMessageTable(&testpb.GolangTest{}).ColumnType("ip"); got != "MEDIUMTEXT" {
+		t.Errorf("其他实例/表应使用默认映射，实际: %s", got)
+	}
+
+	// WithKindType 按表覆盖实例设置；可空等字段级配置照常叠加
+	override := newMessageTable(&testpb.GolangTest{}, WithKindType(protoreflect.Uint32Kind, "bigint unsigned NOT NULL DEFAULT 0"),
+		WithNullableFields("port"))
+	if got, _ := override.ColumnType("port"); got != "bigint unsigned DEFAULT 0" {
+		t.Errorf("可空应叠加在覆盖后的类型上，实际: %s", got)
+	}
+
+	// 实例设置在注册时拷贝，之后再改不影响已注册的表；sqlType为空恢复默认
+	pdb.SetKindType(protoreflect.StringKind, "")
+	if got, _ := table.ColumnType("ip"); got != "VARCHAR(255) NOT NULL DEFAULT ''" {
+		t.Errorf("已注册的表不应受之后的SetKindType影响，实际: %s", got)
+	}
+	pdb.RegisterTable(&testpb.GolangTest1{})
+	table1, _ := pdb.lookupTable(GetTableName(&testpb.GolangTest1{}))
+	if got, _ := table1.ColumnType("ip"); got != "MEDIUMTEXT" {
+		t.Errorf("恢复默认后注册的表应使用MEDIUMTEXT，实际: %s", got)
+	}
+}
+
+// TestZeroValueAsNull 单元测试：WithZeroValueAsNull字段建为可空列，零值写NULL，读到NULL时清空字段
+func TestZeroValueAsNull(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithZeroValueAsNull("port", "player"))
+	table, _ := pdb.lookupTable(GetTableName(&testpb.GolangTest{}))
+
+	if got, _ := table.ColumnType("port"); strings.Contains(got, "NOT NULL") {
+		t.Errorf("零值存NULL的列应可空: %s", got)
+	}
+	if got, _ := table.ColumnType("group_id"); !strings.Contains(got, "NOT NULL") {
+		t.Errorf("其他列不受影响: %s", got)
+	}
+
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1, Ip: "127.0.0.1", GroupId: 7}); err != nil {
+		t.Fatalf("Insert失败: %v", err)
+	}
+	if err := pdb.Update(&testpb.GolangTest{Id: 1, Port: 3306, Player: &testpb.Player{PlayerId: 9}}); err != nil {
+		t.Fatalf("Update失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 2 {
+		t.Fatalf("应执行2条语句: %+v", execs)
+	}
+	if got := fmt.Sprint(execs[0].values()); got != "[1 127.0.0.1 <nil> 7 <nil> 0]" {
+		t.Errorf("零值port与未设置的player应写NULL: %s", got)
+	}
+	if got := execs[1].values(); !strings.Contains(execs[1].query, "`port` = ?, `player` = ?") || got[1] == nil || got[2] == nil {
+		t.Errorf("非零值应照常写入: %v", got)
+	}
+
+	// 读到NULL时清空字段，其余列照常解析
+	row := &testpb.GolangTest{Port: 80, Player: &testpb.Player{PlayerId: 1}}
+	if err := table.parseRow(row, [][]byte{[]byte("1"), []byte("127.0.0.1"), nil, []byte("7"), nil, []byte("0")}); err != nil {
+		t.Fatalf("parseRow失败: %v", err)
+	}
+	if row.Port != 0 || row.Player != nil || row.GroupId != 7 {
+		t.Errorf("NULL列应清空字段: %v", row)
+	}
+
+	for _, opt := range []TableOption{WithZeroValueAsNull("missing"), WithZeroValueAsNull("id")} {
+		err := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), opt).Validate()
+		if !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("不存在的字段或主键应校验失败: %v", err)
+		}
+	}
+}
+
+// TestFindPageWithTotal 单元测试：同一事务内先COUNT(*)再查当前页，条件与参数一致；offset超出总数时不再查页数据
+func TestFindPageWithTotal(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	fake.queryFor = func(query string, args []driver.NamedValue) [][]driver.Value {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return [][]driver.Value{{int64(12)}}
+		}
+		return [][]driver.Value{
+			{int64(11), []byte("10.0.0.11"), int64(80), int64(7), []byte(""), int64(0)},
+			{int64(12), []byte("10.0.0.12"), int64(80), int64(7), []byte(""), int64(0)},
+		}
+	}
+
+	list := &testpb.GolangTestList{}
+	total, err := pdb.FindPageWithTotal(list, "group_id = ? ORDER BY id", []interface{}{7}, 10, 10)
+	if err != nil {
+		t.Fatalf("FindPageWithTotal失败: %v", err)
+	}
+	if total != 12 || len(list.TestList) != 2 || list.TestList[1].Id != 12 {
+		t.Fatalf("应返回总数与当前页: total=%d list=%v", total, list.TestList)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 2 ||
+		queries[0].query != "SELECT COUNT(*) FROM `golang_test` WHERE group_id = ? ORDER BY id;" ||
+		!strings.HasSuffix(queries[1].query, " FROM `golang_test` WHERE group_id = ? ORDER BY id LIMIT 10 OFFSET 10;") ||
+		fmt.Sprint(queries[0].values(), queries[1].values()) != "[7] [7]" {
+		t.Fatalf("SQL不符合预期: %+v", queries)
+	}
+
+	if total, err := pdb.FindPageWithTotal(list, "", nil, 10, 20); err != nil || total != 12 || len(list.TestList) != 0 {
+		t.Fatalf("offset超出总数应只返回总数: total=%d list=%v err=%v", total, list.TestList, err)
+	}
+	if n := len(fake.recordedQueries()); n != 3 {
+		t.Errorf("offset超出总数时不应查询页数据，实际查询次数: %d", n)
+	}
+
+	if _, err := pdb.FindPageWithTotal(list, "", nil, 0, 0); err == nil {
+		t.Error("limit<1应返回错误")
+	}
+}
+
+// TestWithTextSize 单元测试：各档位生成对应的TEXT/BLOB关键字，线上列与档位一致时同步结构不产生MODIFY
+func TestWithTextSize(t *testing.T) {
+	for _, tc := range []struct {
+		size       TextSize
+		text, blob string
+	}{
+		{TextSizeTiny, "TINYTEXT", "TINYBLOB"},
+		{TextSizeRegular, "TEXT", "BLOB"},
+		{TextSizeMedium, "MEDIUMTEXT", "MEDIUMBLOB"},
+		{TextSizeLong, "LONGTEXT", "LONGBLOB"},
+	} {
+		table := newMessageTable(&testpb.GolangTest{}, WithTextSize("ip", tc.size), WithTextSize("player", tc.size))
+		if err := table.Validate(); err != nil {
+			t.Fatalf("配置应校验通过: %v", err)
+		}
+		if got, _ := table.ColumnType("ip"); got != tc.text {
+			t.Errorf("string字段应为%s，实际: %s", tc.text, got)
+		}
+		if got, _ := table.ColumnType("player"); got != tc.blob {
+			t.Errorf("消息字段应为%s，实际: %s", tc.blob, got)
+		}
+		bytesTable := newMessageTable(&wrapperspb.BytesValue{}, WithTextSize("value", tc.size))
+		if got, _ := bytesTable.ColumnType("value"); got != tc.blob {
+			t.Errorf("bytes字段应为%s，实际: %s", tc.blob, got)
+		}
+		hexTable := newMessageTable(&wrapperspb.BytesValue{}, WithBytesAsHex("value"), WithTextSize("value", tc.size))
+		if got, _ := hexTable.ColumnType("value"); got != tc.text {
+			t.Errorf("十六进制bytes字段应为%s，实际: %s", tc.text, got)
+		}
+		listTable := newMessageTable(&testpb.GolangTestList{}, WithTextSize("test_list", tc.size))
+		if got, _ := listTable.ColumnType("test_list"); got != tc.blob {
+			t.Errorf("repeated字段应为%s，实际: %s", tc.blob, got)
+		}
+	}
+
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithTextSize("ip", TextSizeTiny))
+	current := map[string]columnMeta{
+		"id":        {colType: "int unsigned", fieldNum: 1},
+		"ip":        {colType: "tinytext", fieldNum: 2},
+		"port":      {colType: "int unsigned", fieldNum: 3},
+		"group_id":  {colType: "int unsigned", fieldNum: 4},
+		"player":    {colType: "mediumblob", fieldNum: 5},
+		"player_id": {colType: "bigint unsigned", fieldNum: 6},
+	}
+	if alters := table.buildAlterClauses(current); len(alters) != 0 {
+		t.Errorf("线上类型与档位一致时不应修改列，实际: %v", alters)
+	}
+	current["ip"] = columnMeta{colType: "mediumtext", fieldNum: 2}
+	if alters := table.buildAlterClauses(current); len(alters) != 1 || !strings.HasPrefix(alters[0], "MODIFY COLUMN `ip` TINYTEXT") {
+		t.Errorf("档位变化应MODIFY列，实际: %v", alters)
+	}
+
+	for _, opt := range []TableOption{
+		WithTextSize("no_such_field", TextSizeLong),
+		WithTextSize("port", TextSizeLong),
+		WithTextSize("ip", TextSize(0)),
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opt).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("不存在、非文本字段或非法档位应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestTableAndFieldComments 单元测试：表注释与字段说明写入建表SQL（转义），同步结构时与INFORMATION_SCHEMA比对，
+// 变化时生成 MODIFY COLUMN ... COMMENT 与 COMMENT='...'，一致时不产生ALTER
+func TestTableAndFieldComments(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB, pdb.DBName = sqlDB, "game"
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"),
+		WithTableComment("玩家'登录记录"), WithFieldComment("ip", "客户端IP\n(v4)"))
+	table, _ := pdb.lookupTable(GetTableName(&testpb.GolangTest{}))
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"`ip` MEDIUMTEXT COMMENT 'pb:2 客户端IP (v4)'",
+		"`port` int unsigned NOT NULL DEFAULT 0 COMMENT 'pb:3'",
+		"COMMENT='玩家\\'登录记录'",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	tableComment, ipComment := "golang_test", "pb:2 旧说明"
+	fake.queryFor = func(query string, _ []driver.NamedValue) [][]driver.Value {
+		switch {
+		case strings.Contains(query, "TABLE_COMMENT"):
+			return [][]driver.Value{{tableComment}}
+		case strings.Contains(query, "INFORMATION_SCHEMA.TABLES"):
+			return [][]driver.Value{{int64(1)}}
+		case strings.Contains(query, "INFORMATION_SCHEMA.COLUMNS"):
+			return [][]driver.Value{
+				{"id", "int unsigned", "pb:1"},
+				{"ip", "mediumtext", ipComment},
+				{"port", "int unsigned", "pb:3"},
+				{"group_id", "int unsigned", "pb:4"},
+				{"player", "mediumblob", "pb:5"},
+				{"player_id", "bigint unsigned", "pb:6"},
+			}
+		}
+		return nil
+	}
+	stmt, err := pdb.GenerateMigrationSQL(&testpb.GolangTest{})
+	if err != nil {
+		t.Fatalf("GenerateMigrationSQL失败: %v", err)
+	}
+	want := "ALTER TABLE `golang_test` MODIFY COLUMN `ip` MEDIUMTEXT COMMENT 'pb:2 客户端IP (v4)', COMMENT='玩家\\'登录记录';"
+	if stmt != want {
+		t.Errorf("注释变化应生成ALTER\n期望: %s\n实际: %s", want, stmt)
+	}
+
+	// 线上注释（换行已被写成空格）与配置一致时不再修改
+	tableComment, ipComment = "玩家'登录记录", "pb:2 客户端IP (v4)"
+	if stmt, err := pdb.GenerateMigrationSQL(&testpb.GolangTest{}); err != nil || stmt != "" {
+		t.Errorf("注释一致时不应生成ALTER: %q %v", stmt, err)
+	}
+
+	if got, ok := parseFieldNumFromComment("pb:2 客户端IP"); !ok || got != 2 {
+		t.Errorf("带说明的列注释应解析出字段号: %d %v", got, ok)
+	}
+	if err := newMessageTable(&testpb.GolangTest{}, WithFieldComment("missing", "x")).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("不存在的字段应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestFindRandom 单元测试：生成 ORDER BY RAND() LIMIT n，结果不超过n行；n<1时报错且不下发SQL
+func TestFindRandom(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	fake.queryRows = [][]driver.Value{
+		{int64(5), []byte("10.0.0.5"), int64(80), int64(7), []byte(""), int64(0)},
+		{int64(2), []byte("10.0.0.2"), int64(80), int64(7), []byte(""), int64(0)},
+	}
+
+	list := &testpb.GolangTestList{}
+	if err := pdb.FindRandom(list, 3, "group_id = ?", []interface{}{7}); err != nil {
+		t.Fatalf("FindRandom失败: %v", err)
+	}
+	if len(list.TestList) > 3 || len(list.TestList) != 2 {
+		t.Errorf("应返回至多3行: %v", list.TestList)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.HasSuffix(queries[0].query, " FROM `golang_test` WHERE group_id = ? ORDER BY RAND() LIMIT 3;") {
+		t.Fatalf("SQL不符合预期: %+v", queries)
+	}
+
+	if err := pdb.FindRandom(list, 0, "", nil); err == nil {
+		t.Error("n<1应返回错误")
+	}
+	if n := len(fake.recordedQueries()); n != 1 {
+		t.Errorf("参数非法时不应下发SQL，实际查询次数: %d", n)
+	}
+}
+
+// TestFindFirstLast 单元测试：FindFirst/FindLast 按时间列生成 ORDER BY ASC/DESC LIMIT 1 并填充单条消息；
+// 未知列返回ErrFieldNotFound且不下发SQL，无匹配行返回ErrNoRowsFound
+func TestFindFirstLast(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	list := newEventListTestMessage(t)
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(newEvent(list, 0, time.Now()), WithPrimaryKey("id"))
+
+	cases := []struct {
+		name   string
+		find   func(proto.Message, string, string, []interface{}) error
+		suffix string
+	}{
+		{"FindFirst", pdb.FindFirst, " FROM `testdyn.Event` WHERE id > ? ORDER BY `created_at` ASC LIMIT 1;"},
+		{"FindLast", pdb.FindLast, " FROM `testdyn.Event` WHERE id > ? ORDER BY `created_at` DESC LIMIT 1;"},
+	}
+	for i, c := range cases {
+		fake.queryRows = [][]driver.Value{{int64(i + 1), []byte("2024-03-01 08:00:00")}}
+		event := newEvent(list, 0, time.Unix(0, 0))
+		if err := c.find(event, "created_at", "id > ?", []interface{}{0}); err != nil {
+			t.Fatalf("%s失败: %v", c.name, err)
+		}
+		id := event.ProtoReflect().Get(event.ProtoReflect().Descriptor().Fields().ByName("id")).Uint()
+		if id != uint64(i+1) {
+			t.Errorf("%s应填充查询到的行，id: %d", c.name, id)
+		}
+		queries := fake.recordedQueries()
+		if last := queries[len(queries)-1].query; !strings.HasSuffix(last, c.suffix) {
+			t.Errorf("%s SQL不符合预期: %s", c.name, last)
+		}
+	}
+
+	queried := len(fake.recordedQueries())
+	if err := pdb.FindLast(newEvent(list, 0, time.Now()), "nope", "", nil); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("未知排序列应返回ErrFieldNotFound，实际: %v", err)
+	}
+	if n := len(fake.recordedQueries()); n != queried {
+		t.Errorf("排序列非法时不应下发SQL，实际查询次数: %d", n)
+	}
+
+	fake.queryRows = nil
+	if err := pdb.FindFirst(newEvent(list, 0, time.Now()), "created_at", "", nil); !errors.Is(err, ErrNoRowsFound) {
+		t.Errorf("无匹配行应返回ErrNoRowsFound，实际: %v", err)
+	}
+}
+
+// TestRegisterTableByDescriptor 单元测试：只凭描述符注册表，之后用dynamicpb消息保存与按主键读取
+func TestRegisterTableByDescriptor(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	md := newSignedTestMessage(t).Descriptor()
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTableByDescriptor(md, WithPrimaryKey("account_id"))
+	if _, ok := pdb.lookupTable(string(md.FullName())); !ok {
+		t.Fatalf("应按full name注册表: %s", md.FullName())
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("account_id"), protoreflect.ValueOfInt64(7))
+	msg.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("alice"))
+	if err := pdb.Save(msg); err != nil {
+		t.Fatalf("Save失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 1 || !strings.HasPrefix(execs[0].query, "REPLACE INTO `testdyn.Account`") ||
+		fmt.Sprint(execs[0].values()) != "[7 0 0 alice]" {
+		t.Fatalf("应按描述符生成REPLACE: %+v", execs)
+	}
+
+	fake.queryRows = [][]driver.Value{{int64(7), int64(-3), int64(2), []byte("alice")}}
+	got := dynamicpb.NewMessage(md)
+	got.Set(md.Fields().ByName("account_id"), protoreflect.ValueOfInt64(7))
+	if err := pdb.FindOneByPK(got); err != nil {
+		t.Fatalf("FindOneByPK失败: %v", err)
+	}
+	if got.Get(md.Fields().ByName("name")).String() != "alice" || got.Get(md.Fields().ByName("score")).Int() != -3 {
+		t.Errorf("读回的dynamicpb消息不符: %v", got)
+	}
+}
+
+// newProfileTestMessage 构造含Timestamp、子消息与repeated子消息字段的动态消息testdyn.Profile
+func newProfileTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	fd := testdyn.NewFile(t, "profile_test.proto",
+		testdyn.Message("Tag",
+			testdyn.Field("label", descriptorpb.FieldDescriptorProto_TYPE_STRING)),
+		testdyn.Message("Profile",
+			testdyn.Field("id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			testdyn.Field("name", descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			testdyn.Field("created_at", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, testdyn.Timestamp),
+			testdyn.Field("main_tag", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".testdyn.Tag"),
+			testdyn.Repeated(testdyn.Field("tags", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".testdyn.Tag"))))
+	return dynamicpb.NewMessage(fd.Messages().ByName("Profile"))
+}
+
+// TestDynamicMessageRoundTrip 单元测试：按描述符反序列化得到的dynamicpb消息（Timestamp/子消息/repeated字段均为dynamicpb）
+// 经Save写入的参数，作为查询结果由FindOneByKV读回后与原消息一致
+func TestDynamicMessageRoundTrip(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	md := newProfileTestMessage(t).Descriptor()
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTableByDescriptor(md, WithPrimaryKey("id"))
+
+	tagDesc := md.Fields().ByName("main_tag").Message()
+	newTag := func(label string) protoreflect.Value {
+		tag := dynamicpb.NewMessage(tagDesc)
+		tag.Set(tagDesc.Fields().ByName("label"), protoreflect.ValueOfString(label))
+		return protoreflect.ValueOfMessage(tag)
+	}
+	src := dynamicpb.NewMessage(md)
+	src.Set(md.Fields().ByName("id"), protoreflect.ValueOfUint64(9))
+	src.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("bob"))
+	src.Set(md.Fields().ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.New(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)).ProtoReflect()))
+	src.Set(md.Fields().ByName("main_tag"), newTag("vip"))
+	tags := src.Mutable(md.Fields().ByName("tags")).List()
+	tags.Append(newTag("a"))
+	tags.Append(newTag("b"))
+
+	// 模拟插件收到的字节流：反序列化后所有子消息都是dynamicpb
+	data, err := proto.Marshal(src)
+	if err != nil {
+		t.Fatalf("Marshal失败: %v", err)
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		t.Fatalf("Unmarshal失败: %v", err)
+	}
+	if err := pdb.Save(msg); err != nil {
+		t.Fatalf("Save失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 1 {
+		t.Fatalf("应执行1条REPLACE: %+v", execs)
+	}
+
+	row := make([]driver.Value, len(execs[0].args))
+	for i, v := range execs[0].values() {
+		row[i] = []byte(fmt.Sprint(v))
+	}
+	fake.queryRows = [][]driver.Value{row}
+	got := dynamicpb.NewMessage(md)
+	if err := pdb.FindOneByKV(got, "id", "9"); err != nil {
+		t.Fatalf("FindOneByKV失败: %v", err)
+	}
+	if !proto.Equal(got, src) {
+		t.Errorf("往返结果不一致\n期望: %v\n实际: %v", src, got)
+	}
+
+	var rows []*dynamicpb.Message
+	if err := pdb.FindInto(&rows, ""); err == nil {
+		t.Error("FindInto无法为dynamicpb元素创建消息，应返回错误")
+	}
+}
+
+// TestWithForeignKey 单元测试：建表SQL生成带 ON DELETE CASCADE / ON UPDATE RESTRICT 的外键约束，非法引用动作等配置校验失败
+func TestWithForeignKey(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"),
+		WithForeignKey("group_id", "player_group", "id", FKCascade, FKRestrict),
+		WithNullableFields("player_id"), WithForeignKey("player_id", "player", "id", FKSetNull, ""))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"  CONSTRAINT `fk_golang_test_group_id` FOREIGN KEY (`group_id`) REFERENCES `player_group` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT",
+		"  CONSTRAINT `fk_golang_test_player_id` FOREIGN KEY (`player_id`) REFERENCES `player` (`id`) ON DELETE SET NULL\n",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+
+	for _, opts := range [][]TableOption{
+		{WithForeignKey("group_id", "player_group", "id", FKAction("DROP"), "")},
+		{WithForeignKey("group_id", "player_group", "id", "", FKSetNull)},
+		{WithForeignKey("missing", "player_group", "id", FKCascade, "")},
+		{WithForeignKey("group_id", "", "id", FKCascade, "")},
+		{WithForeignKey("id", "player_group", "id", "", ""), WithHashPartition("id", 4)},
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, append([]TableOption{WithPrimaryKey("id")}, opts...)...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法的外键配置应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestAssertColumnOrder 单元测试：按ORDINAL_POSITION读取线上列序，与字段顺序一致时通过（忽略末尾多出的列），
+// 字段重排、缺列或映射列之间夹着多余列时返回ErrColumnOrderMismatch并列出问题列
+func TestAssertColumnOrder(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB, pdb.DBName = sqlDB, "game"
+	var live []string
+	fake.queryFor = func(string, []driver.NamedValue) [][]driver.Value {
+		rows := make([][]driver.Value, len(live))
+		for i, name := range live {
+			rows[i] = []driver.Value{name}
+		}
+		return rows
+	}
+
+	live = []string{"id", "ip", "port", "group_id", "player", "player_id", "legacy"}
+	if err := pdb.AssertColumnOrder(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("列序一致（末尾多出的列忽略）时应通过: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.Contains(queries[0].query, "ORDER BY ORDINAL_POSITION") ||
+		fmt.Sprint(queries[0].values()) != "[game golang_test]" {
+		t.Fatalf("应按ORDINAL_POSITION查询线上列序: %+v", queries)
+	}
+
+	live = []string{"id", "port", "ip", "group_id", "player"}
+	err := pdb.AssertColumnOrder(&testpb.GolangTest{})
+	if !errors.Is(err, ErrColumnOrderMismatch) {
+		t.Fatalf("字段重排应返回ErrColumnOrderMismatch，实际: %v", err)
+	}
+	for _, want := range []string{"missing column player_id", "column #2 is port, want ip", "column #3 is ip, want port"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("错误信息应包含 %q: %v", want, err)
+		}
+	}
+
+	live = []string{"id", "ip", "port", "legacy", "group_id", "player", "player_id"}
+	err = pdb.AssertColumnOrder(&testpb.GolangTest{})
+	if !errors.Is(err, ErrColumnOrderMismatch) || !strings.Contains(err.Error(), "extra column #4 legacy before mapped columns") {
+		t.Errorf("映射列之间夹着多余列应报错，实际: %v", err)
+	}
+}
+
+// TestWithBitColumn 单元测试：bool字段建为BIT(1)，写入单字节0x00/0x01，扫描得到的单字节按true/false解析
+func TestWithBitColumn(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	msg := &wrapperspb.BoolValue{}
+	pdb.RegisterTable(msg, WithBitColumn("value"))
+	table, _ := pdb.lookupTable(GetTableName(msg))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+	if got, _ := table.ColumnType("value"); got != "BIT(1) NOT NULL DEFAULT b'0'" {
+		t.Errorf("bool字段应建为BIT(1)，实际: %s", got)
+	}
+	if !isTypeMatch("bit(1)", "BIT(1) NOT NULL DEFAULT b'0'") {
+		t.Error("线上bit(1)列应与目标类型匹配")
+	}
+
+	for _, want := range []bool{true, false} {
+		if err := pdb.Insert(wrapperspb.Bool(want)); err != nil {
+			t.Fatalf("Insert失败: %v", err)
+		}
+		execs := fake.recorded()
+		arg := execs[len(execs)-1].values()[0]
+		if b, ok := arg.(string); !ok || len(b) != 1 || (b[0] == 1) != want {
+			t.Fatalf("%v应写入单字节，实际: %q", want, arg)
+		}
+
+		// MySQL以字节返回BIT列
+		raw := []byte{0}
+		if want {
+			raw[0] = 1
+		}
+		got := &wrapperspb.BoolValue{Value: !want}
+		if err := table.parseRow(got, [][]byte{raw}); err != nil {
+			t.Fatalf("parseRow失败: %v", err)
+		}
+		if got.Value != want {
+			t.Errorf("BIT字节应解析为%v，实际: %v", want, got.Value)
+		}
+	}
+
+	if err := newMessageTable(&testpb.GolangTest{}, WithBitColumn("ip")).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("非bool字段应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestSavepoint 单元测试：保存点语句在事务连接上按顺序下发，名字转义；事务外调用或非法名字返回错误
+func TestSavepoint(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	err := pdb.RunInTransaction(func(tx *DB) error {
+		if err := tx.Savepoint("sp_1"); err != nil {
+			return err
+		}
+		if err := tx.Insert(&testpb.GolangTest{Id: 1}); err != nil {
+			return err
+		}
+		if err := tx.RollbackTo("sp_1"); err != nil {
+			return err
+		}
+		if err := tx.ReleaseSavepoint("sp_1"); err != nil {
+			return err
+		}
+		if err := tx.Savepoint("bad`name"); err == nil {
+			t.Error("非法保存点名应返回错误")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("事务失败: %v", err)
+	}
+
+	execs := fake.recorded()
+	want := []string{"SAVEPOINT `sp_1`", "INSERT INTO `golang_test` ", "ROLLBACK TO SAVEPOINT `sp_1`", "RELEASE SAVEPOINT `sp_1`"}
+	if len(execs) != len(want) {
+		t.Fatalf("应执行%d条语句: %+v", len(want), execs)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(execs[i].query, prefix) {
+			t.Errorf("第%d条语句应以 %q 开头，实际: %s", i+1, prefix, execs[i].query)
+		}
+	}
+
+	if err := pdb.Savepoint("sp_1"); err == nil {
+		t.Error("事务外设置保存点应返回错误")
+	}
+}
+
+// TestSavepointRollback 集成测试：回滚到保存点只撤销其后的写入，外层事务继续并提交之前与之后的写入
+func TestSavepointRollback(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+
+	err := pdb.RunInTransaction(func(tx *DB) error {
+		if err := tx.Insert(&testpb.GolangTest{Id: 1}); err != nil {
+			return err
+		}
+		if err := tx.Savepoint("risky"); err != nil {
+			return err
+		}
+		if err := tx.Insert(&testpb.GolangTest{Id: 2}); err != nil {
+			return err
+		}
+		if err := tx.RollbackTo("risky"); err != nil {
+			return err
+		}
+		if n, err := tx.CountByWhereWithArgs(&testpb.GolangTest{}, "id = ?", []interface{}{2}); err != nil || n != 0 {
+			t.Errorf("回滚到保存点后事务内不应再看到id=2: %d %v", n, err)
+		}
+		return tx.Insert(&testpb.GolangTest{Id: 3})
+	})
+	if err != nil {
+		t.Fatalf("事务失败: %v", err)
+	}
+
+	list := &testpb.GolangTestList{}
+	if err := pdb.FindAllWithOptions(list, "", nil, QueryOptions{OrderBy: "id"}); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(list.TestList) != 2 || list.TestList[0].Id != 1 || list.TestList[1].Id != 3 {
+		t.Errorf("应只保留保存点之前与回滚之后的写入(1, 3)，实际: %v", list.TestList)
+	}
+}
+
+// TestWithUpdatedAtColumn 单元测试：Update总在SET中刷新指定列，只设置主键也不报"no fields to update"；
+// 按列的存储方式选择时间表达式，非Timestamp字段校验失败
+func TestWithUpdatedAtColumn(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	msg := newTimedTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(msg, WithPrimaryKey("id"), WithUpdatedAtColumn("updated_at"))
+
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfUint64(7))
+	msg.Set(fields.ByName("updated_at"), protoreflect.ValueOfMessage(timestamppb.Now().ProtoReflect()))
+	if err := pdb.Update(msg); err != nil {
+		t.Fatalf("只设置主键时Update也应执行: %v", err)
+	}
+	msg.Set(fields.ByName("name"), protoreflect.ValueOfString("sword"))
+	if err := pdb.Update(msg); err != nil {
+		t.Fatalf("Update失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 2 {
+		t.Fatalf("应执行2条UPDATE: %+v", execs)
+	}
+	if want := "SET `id` = ?, `updated_at` = UTC_TIMESTAMP() WHERE `id` = ?"; !strings.Contains(execs[0].query, want) || len(execs[0].args) != 2 {
+		t.Errorf("未变化的行也应刷新updated_at且不绑定其字段值: %s %v", execs[0].query, execs[0].values())
+	}
+	if want := "`name` = ?, `updated_at` = UTC_TIMESTAMP() WHERE"; !strings.Contains(execs[1].query, want) {
+		t.Errorf("刷新列应追加在其他字段之后: %s", execs[1].query)
+	}
+
+	// 按字段列表/单列更新也刷新，显式传入的刷新列不绑定消息中的值
+	if err := pdb.UpdateFieldsByPK(msg, "name", "updated_at"); err != nil {
+		t.Fatalf("UpdateFieldsByPK失败: %v", err)
+	}
+	if err := pdb.UpdateKVByPK(msg, "name", "axe"); err != nil {
+		t.Fatalf("UpdateKVByPK失败: %v", err)
+	}
+	execs = fake.recorded()[2:]
+	if want := "SET `name` = ?, `updated_at` = UTC_TIMESTAMP() WHERE"; !strings.Contains(execs[0].query, want) || len(execs[0].args) != 2 {
+		t.Errorf("UpdateFieldsByPK应刷新updated_at: %s %v", execs[0].query, execs[0].values())
+	}
+	if want := "SET `name` = ?, `updated_at` = UTC_TIMESTAMP() WHERE"; !strings.Contains(execs[1].query, want) {
+		t.Errorf("UpdateKVByPK应刷新updated_at: %s", execs[1].query)
+	}
+
+	for _, tc := range []struct {
+		opts []TableOption
+		want string
+	}{
+		{[]TableOption{WithTimestampAsEpoch("updated_at")}, "`updated_at` = UNIX_TIMESTAMP()"},
+		{[]TableOption{WithTimestamps("", "updated_at")}, "`updated_at` = CURRENT_TIMESTAMP"},
+	} {
+		table := newMessageTable(msg, append([]TableOption{WithPrimaryKey("id"), WithUpdatedAtColumn("updated_at")}, tc.opts...)...)
+		setClause, _, err := table.GetUpdateSetWithArgs(msg)
+		if err != nil || !strings.HasSuffix(setClause, tc.want) {
+			t.Errorf("SET应以 %q 结尾，实际 %q %v", tc.want, setClause, err)
+		}
+	}
+
+	for _, col := range []string{"name", "no_such_field"} {
+		bad := newMessageTable(msg, WithPrimaryKey("id"), WithUpdatedAtColumn(col))
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("%s 应返回ErrInvalidTableOption，实际: %v", col, err)
+		}
+	}
+}
+
+// TestUpdatedAtColumnTouch 测试行内容未变化时Update仍刷新updated_at
+func TestUpdatedAtColumnTouch(t *testing.T) {
+	msg := newTimedTestMessage(t)
+	fields := msg.Descriptor().Fields()
+	pdb := NewDB()
+	pdb.RegisterTable(msg, WithPrimaryKey("id"), WithUpdatedAtColumn("updated_at"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, msg)
+
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg.Set(fields.ByName("id"), protoreflect.ValueOfUint64(1))
+	msg.Set(fields.ByName("name"), protoreflect.ValueOfString("sword"))
+	msg.Set(fields.ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.New(old).ProtoReflect()))
+	msg.Set(fields.ByName("updated_at"), protoreflect.ValueOfMessage(timestamppb.New(old).ProtoReflect()))
+	if err := pdb.Insert(msg); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	if err := pdb.Update(msg); err != nil {
+		t.Fatalf("无变化的Update失败: %v", err)
+	}
+
+	read := dynamicpb.NewMessage(msg.Descriptor())
+	read.Set(fields.ByName("id"), protoreflect.ValueOfUint64(1))
+	if err := pdb.FindOneByPK(read); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	got := read.Get(fields.ByName("updated_at")).Message().Interface().(*timestamppb.Timestamp).AsTime()
+	if !got.After(old) {
+		t.Errorf("updated_at应被刷新到当前时间，实际 %v", got)
+	}
+}
+
+// TestCaptureModeMigration 单元测试：捕获模式下同步表结构读取线上结构走真实连接，只捕获生成的DDL
+func TestCaptureModeMigration(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	exists := int64(0)
+	fake.queryFor = func(query string, _ []driver.NamedValue) [][]driver.Value {
+		switch {
+		case strings.Contains(query, "COUNT(*)"):
+			return [][]driver.Value{{exists}}
+		case strings.Contains(query, "INFORMATION_SCHEMA.COLUMNS"):
+			return [][]driver.Value{{"id", "bigint unsigned", "pb:1"}}
+		}
+		return nil
+	}
+
+	pdb.SetCaptureMode(true)
+	defer pdb.SetCaptureMode(false)
+	if err := pdb.CreateOrUpdateTable(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("捕获模式下CreateOrUpdateTable失败: %v", err)
+	}
+	pdb.InvalidateTableCache(GetTableName(&testpb.GolangTest{}))
+	exists = 1
+	if err := pdb.CreateOrUpdateTable(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("捕获模式下表已存在时CreateOrUpdateTable失败: %v", err)
+	}
+
+	var ddl []string
+	for _, stmt := range pdb.CapturedStatements() {
+		if stmt.Op == CaptureOpExec {
+			ddl = append(ddl, stmt.SQL)
+		}
+	}
+	if len(ddl) != 2 || !strings.HasPrefix(ddl[0], "CREATE TABLE") || !strings.Contains(ddl[1], "ADD COLUMN `ip`") {
+		t.Errorf("应捕获建表与补列DDL: %q", ddl)
+	}
+	if len(fake.recorded()) != 0 || len(fake.recordedQueries()) == 0 {
+		t.Errorf("元数据应从真实连接读取且不执行DDL: %+v %+v", fake.recorded(), fake.recordedQueries())
+	}
+}
+
+// TestCaptureMode 单元测试：捕获模式下写入/查询（含事务与派生实例）只记录不下发，查询返回空结果集；关闭后恢复原连接
+func TestCaptureMode(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	if got := pdb.CapturedStatements(); got != nil {
+		t.Errorf("未开启时应返回nil: %v", got)
+	}
+
+	pdb.SetCaptureMode(true)
+	err := pdb.RunInTransaction(func(tx *DB) error {
+		return tx.Insert(&testpb.GolangTest{Id: 1, Ip: "127.0.0.1"})
+	})
+	if err != nil {
+		t.Fatalf("捕获模式下事务写入失败: %v", err)
+	}
+	list := &testpb.GolangTestList{}
+	if err := pdb.WithContext(context.Background()).FindAllWithOptions(list, "id > ?", []interface{}{0}, QueryOptions{}); err != nil {
+		t.Fatalf("捕获模式下查询失败: %v", err)
+	}
+	if len(list.TestList) != 0 {
+		t.Errorf("查询应返回空结果集: %v", list.TestList)
+	}
+
+	captured := pdb.CapturedStatements()
+	var insert, query *CapturedStatement
+	for i := range captured {
+		switch {
+		case captured[i].Op == CaptureOpExec && strings.HasPrefix(captured[i].SQL, "INSERT INTO"):
+			insert = &captured[i]
+		case captured[i].Op == CaptureOpQuery && strings.Contains(captured[i].SQL, "WHERE id > ?"):
+			query = &captured[i]
+		}
+	}
+	if insert == nil || fmt.Sprint(insert.Args[:2]) != "[1 127.0.0.1]" {
+		t.Errorf("应记录INSERT与原始参数: %+v", captured)
+	}
+	if query == nil || fmt.Sprint(query.Args) != "[0]" {
+		t.Errorf("派生实例的查询也应记录: %+v", captured)
+	}
+	if len(fake.recorded()) != 0 || len(fake.recordedQueries()) != 0 {
+		t.Errorf("捕获模式下不应访问原连接: %+v %+v", fake.recorded(), fake.recordedQueries())
+	}
+
+	pdb.SetCaptureMode(false)
+	if pdb.DB != sqlDB || pdb.CapturedStatements() != nil {
+		t.Fatal("关闭捕获后应恢复原连接并丢弃记录")
+	}
+	if err := pdb.Insert(&testpb.GolangTest{Id: 2}); err != nil {
+		t.Fatalf("Insert失败: %v", err)
+	}
+	if len(fake.recorded()) != 1 {
+		t.Errorf("关闭捕获后应照常执行: %+v", fake.recorded())
+	}
+}
+
+// TestValidateUTF8mb4 单元测试：非法UTF-8直接报错；4字节字符仅在线上列为utf8mb3时报错，
+// 普通文本不查询字符集，字符集查询结果按表缓存
+func TestValidateUTF8mb4(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+	fake.queryFor = func(query string, args []driver.NamedValue) [][]driver.Value {
+		return [][]driver.Value{{"ip", "utf8mb3"}, {"name", "utf8mb4"}}
+	}
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithValidateUTF8mb4("ip"))
+
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1, Ip: "127.0.0.1"}); err != nil {
+		t.Fatalf("普通文本应正常插入: %v", err)
+	}
+	if n := len(fake.recordedQueries()); n != 0 {
+		t.Errorf("不含4字节字符时不应查询字符集，实际查询%d次", n)
+	}
+
+	err := pdb.Insert(&testpb.GolangTest{Id: 2, Ip: "host😀"})
+	if !errors.Is(err, ErrInvalidText) || !strings.Contains(err.Error(), "U+1F600") || !strings.Contains(err.Error(), "utf8mb3") {
+		t.Errorf("emoji写入utf8mb3列应返回说明性错误，实际: %v", err)
+	}
+	err = pdb.BatchInsert([]proto.Message{&testpb.GolangTest{Id: 3}, &testpb.GolangTest{Id: 4, Ip: "\xff"}})
+	if !errors.Is(err, ErrInvalidText) || !strings.Contains(err.Error(), "not valid UTF-8") {
+		t.Errorf("非法UTF-8应报错，实际: %v", err)
+	}
+	if n := len(fake.recorded()); n != 1 {
+		t.Errorf("校验失败时不应下发INSERT，实际执行%d条", n)
+	}
+	if n := len(fake.recordedQueries()); n != 1 {
+		t.Errorf("字符集应只查询一次并缓存，实际查询%d次", n)
+	}
+
+	bad := newMessageTable(&testpb.GolangTest{}, WithValidateUTF8mb4("port"))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("非string字段应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestValidateUTF8mb4OnUTF8Column 测试向3字节utf8列插入emoji时返回说明性错误而不是1366
+func TestValidateUTF8mb4OnUTF8Column(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithValidateUTF8mb4("ip"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+	if err := pdb.ExecDDLf("ALTER TABLE %s MODIFY %s MEDIUMTEXT CHARACTER SET utf8mb3 NOT NULL", "golang_test", "ip"); err != nil {
+		t.Fatalf("修改列字符集失败: %v", err)
+	}
+
+	err := pdb.Insert(&testpb.GolangTest{Id: 1, Ip: "😀"})
+	if !errors.Is(err, ErrInvalidText) || !strings.Contains(err.Error(), "convert it to utf8mb4") {
+		t.Errorf("应在插入前返回说明性错误，实际: %v", err)
+	}
+	if err := pdb.Insert(&testpb.GolangTest{Id: 2, Ip: "中文"}); err != nil {
+		t.Errorf("3字节字符应正常插入: %v", err)
+	}
+}
+
+// TestBulkLoadSQL 单元测试：TSV行按LOAD DATA规则转义，语句按INSERT列顺序读取注册的reader
+func TestBulkLoadSQL(t *testing.T) {
+	var buf bytes.Buffer
+	appendBulkLoadRow(&buf, []interface{}{"1", "a\tb\nc\\d\re\x00", nil, ""})
+	if got, want := buf.String(), "1\ta\\tb\\nc\\\\d\\re\\0\t\\N\t\n"; got != want {
+		t.Errorf("TSV行转义错误:\n got %q\nwant %q", got, want)
+	}
+
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	if err := pdb.BulkLoad(nil); err == nil {
+		t.Error("空列表应报错")
+	}
+	if err := pdb.BulkLoad([]proto.Message{&testpb.GolangTest{Id: 1}, &testpb.GolangTest{Id: 2}}); err != nil {
+		t.Fatalf("BulkLoad失败: %v", err)
+	}
+	execs := fake.recorded()
+	if len(execs) != 1 {
+		t.Fatalf("应只执行一条LOAD DATA: %+v", execs)
+	}
+	for _, want := range []string{
+		"LOAD DATA LOCAL INFILE 'Reader::proto2mysql_bulk_",
+		"INTO TABLE `golang_test` CHARACTER SET utf8mb4 FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n'",
+		"(`id`, `ip`, `port`, `group_id`, `player`, `player_id`)",
+	} {
+		if !strings.Contains(execs[0].query, want) {
+			t.Errorf("LOAD DATA语句缺少 %q\nSQL: %s", want, execs[0].query)
+		}
+	}
+}
+
+// TestBulkLoad 测试LOAD DATA导入10万行（含需转义的文本），并且比BatchInsert更快
+func TestBulkLoad(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+
+	const rows = 100000
+	messages := make([]proto.Message, rows)
+	for i := range messages {
+		messages[i] = &testpb.GolangTest{Id: uint32(i + 1), Ip: "line1\tline2\n\\", Port: uint32(i), Player: &testpb.Player{PlayerId: uint64(i)}}
+	}
+
+	start := time.Now()
+	if err := pdb.BulkLoad(messages); err != nil {
+		t.Fatalf("BulkLoad失败（需服务端local_infile=ON）: %v", err)
+	}
+	bulkElapsed := time.Since(start)
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + testTableSQLName(&testpb.GolangTest{})).Scan(&count); err != nil || count != rows {
+		t.Fatalf("应导入%d行，实际 %d %v", rows, count, err)
+	}
+	got := &testpb.GolangTest{Id: rows}
+	if err := pdb.FindOneByPK(got); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if !proto.Equal(got, messages[rows-1]) {
+		t.Errorf("导入的行与原消息不一致: %v", got)
+	}
+
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+	start = time.Now()
+	if err := pdb.BatchInsert(messages); err != nil {
+		t.Fatalf("BatchInsert失败: %v", err)
+	}
+	batchElapsed := time.Since(start)
+	t.Logf("BulkLoad %v, BatchInsert %v", bulkElapsed, batchElapsed)
+	if bulkElapsed >= batchElapsed {
+		t.Errorf("BulkLoad应快于BatchInsert: %v >= %v", bulkElapsed, batchElapsed)
+	}
+}
+
+// TestWithCompositeIndex 单元测试：逐列前缀长度与排序方向写入建表/补齐索引语句，未指定长度的文本列沿用默认前缀
+func TestWithCompositeIndex(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"),
+		WithCompositeIndex("idx_group_rank", []IndexPart{
+			{Column: "ip", Length: 20},
+			{Column: "group_id"},
+			{Column: "port", Desc: true},
+		}),
+		WithCompositeIndex("idx_player", []IndexPart{{Column: "player", Desc: true}}))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"INDEX `idx_group_rank` (`ip`(20) ASC,`group_id` ASC,`port` DESC)",
+		"INDEX `idx_player` (`player`(191) DESC)",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表SQL缺少 %q\nSQL: %s", want, createSQL)
+		}
+	}
+	clauses := table.buildIndexAlterClauses(map[string]bool{"PRIMARY": true, "idx_player": true})
+	if len(clauses) != 1 || clauses[0] != "ADD INDEX `idx_group_rank` (`ip`(20) ASC,`group_id` ASC,`port` DESC)" {
+		t.Errorf("线上缺失的复合索引应按定义补齐: %v", clauses)
+	}
+
+	for _, parts := range [][]IndexPart{
+		{{Column: "port", Length: 10}},
+		{{Column: "ip", Length: -1}},
+		{{Column: "no_such_field"}},
+		nil,
+	} {
+		bad := newMessageTable(&testpb.GolangTest{}, WithCompositeIndex("idx_bad", parts))
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("%+v 应返回ErrInvalidTableOption，实际: %v", parts, err)
+		}
+	}
+}
+
+// TestFindOneWhereTail 单元测试：单行查询的LIMIT 2插在锁定读子句之前，条件尾部已有LIMIT时不再追加
+func TestFindOneWhereTail(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	fake.queryRows = [][]driver.Value{{"1", "10.0.0.1", "80", "7", "", "0"}}
+
+	cases := map[string]string{
+		"group_id = ?":                       "WHERE group_id = ? LIMIT 2;",
+		"group_id = ? ORDER BY id":           "WHERE group_id = ? ORDER BY id LIMIT 2;",
+		"group_id = ? ORDER BY id LIMIT 1":   "WHERE group_id = ? ORDER BY id LIMIT 1;",
+		"group_id = ? FOR UPDATE":            "WHERE group_id = ? LIMIT 2 FOR UPDATE;",
+		"group_id = ? ORDER BY id FOR SHARE": "WHERE group_id = ? ORDER BY id LIMIT 2 FOR SHARE;",
+		"group_id = ? LOCK IN SHARE MODE":    "WHERE group_id = ? LIMIT 2 LOCK IN SHARE MODE;",
+		"group_id = ? LIMIT 1 FOR UPDATE":    "WHERE group_id = ? LIMIT 1 FOR UPDATE;",
+		"ip IN (SELECT ip FROM t LIMIT 5)":   "WHERE ip IN (SELECT ip FROM t LIMIT 5) LIMIT 2;",
+		"ip = 'FOR UPDATE' AND group_id = ?": "WHERE ip = 'FOR UPDATE' AND group_id = ? LIMIT 2;",
+	}
+	for where, want := range cases {
+		if err := pdb.FindOneByWhereWithArgs(&testpb.GolangTest{}, where, []interface{}{7}); err != nil {
+			t.Fatalf("%s: 查询失败: %v", where, err)
+		}
+		queries := fake.recordedQueries()
+		if got := queries[len(queries)-1].query; !strings.HasSuffix(got, " FROM `golang_test` "+want) {
+			t.Errorf("%s: SQL不符合预期: %s", where, got)
+		}
+	}
+}
+
+// TestFindOneMultipleRowsLeavesMessage 单元测试：单行查询带LIMIT 2，匹配多行时返回ErrMultipleRowsFound且不改动传入的消息
+func TestFindOneMultipleRowsLeavesMessage(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+	fake.queryRows = [][]driver.Value{
+		{"1", "10.0.0.1", "80", "2", "", "9"},
+		{"2", "10.0.0.2", "81", "2", "", "9"},
+	}
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+
+	msg := &testpb.GolangTest{Ip: "original", GroupId: 2}
+	err := pdb.FindOneByKV(msg, "group_id", "2")
+	if !errors.Is(err, ErrMultipleRowsFound) {
+		t.Fatalf("多行匹配应返回ErrMultipleRowsFound，实际: %v", err)
+	}
+	if want := (&testpb.GolangTest{Ip: "original", GroupId: 2}); !proto.Equal(msg, want) {
+		t.Errorf("出错时不应改动传入的消息，实际: %v", msg)
+	}
+	if q := fake.recordedQueries(); len(q) != 1 || !strings.HasSuffix(q[0].query, "WHERE `group_id` = ? LIMIT 2;") {
+		t.Errorf("单行查询应带LIMIT 2: %v", q)
+	}
+
+	fake.queryRows = fake.queryRows[:1]
+	if err := pdb.FindOneByKV(msg, "group_id", "2"); err != nil {
+		t.Fatalf("唯一匹配应成功: %v", err)
+	}
+	if want := (&testpb.GolangTest{Id: 1, Ip: "10.0.0.1", Port: 80, GroupId: 2, PlayerId: 9}); !proto.Equal(msg, want) {
+		t.Errorf("查询结果不符: %v", msg)
+	}
+}
+
+// TestWithNullableMessage 单元测试：未设置的子消息写NULL，已设置的空子消息写空值；读回时NULL为未设置、空值为已设置
+func TestWithNullableMessage(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithNullableMessage("player"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+
+	absent, err := table.GetInsertSQLWithArgs(&testpb.GolangTest{Id: 1})
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	present, err := table.GetInsertSQLWithArgs(&testpb.GolangTest{Id: 2, Player: &testpb.Player{}})
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	if absent.Args[4] != nil || present.Args[4] != "" {
+		t.Errorf("未设置应写NULL、空子消息应写空值，实际 %#v %#v", absent.Args[4], present.Args[4])
+	}
+
+	for _, tc := range []struct {
+		raw  []byte
+		want bool
+	}{
+		{nil, false},
+		{[]byte{}, true},
+	} {
+		row := &testpb.GolangTest{Player: &testpb.Player{PlayerId: 3}}
+		if err := table.parseRow(row, [][]byte{[]byte("1"), []byte(""), []byte("0"), []byte("0"), tc.raw, []byte("0")}); err != nil {
+			t.Fatalf("parseRow失败: %v", err)
+		}
+		if got := row.Player != nil; got != tc.want || (got && row.Player.PlayerId != 0) {
+			t.Errorf("raw=%#v 子消息应 present=%v，实际 %v", tc.raw, tc.want, row.Player)
+		}
+	}
+
+	for _, opts := range [][]TableOption{
+		{WithNullableMessage("port")},
+		{WithNullableMessage("no_such_field")},
+		{WithNullableMessage("player"), WithZeroValueAsNull("player")},
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opts...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法配置应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestNullableMessageRoundTrip 测试全默认值的子消息写入后仍读回为已设置，未设置的读回为nil
+func TestNullableMessageRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithNullableMessage("player"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+
+	if err := pdb.BatchInsert([]proto.Message{
+		&testpb.GolangTest{Id: 1, Player: &testpb.Player{}},
+		&testpb.GolangTest{Id: 2},
+	}); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	var nulls int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + testTableSQLName(&testpb.GolangTest{}) + " WHERE `player` IS NULL").Scan(&nulls); err != nil || nulls != 1 {
+		t.Errorf("只有未设置的子消息应存为NULL，实际 %d %v", nulls, err)
+	}
+
+	present := &testpb.GolangTest{Id: 1}
+	if err := pdb.FindOneByPK(present); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if present.Player == nil {
+		t.Error("全默认值的子消息应读回为已设置")
+	}
+	absent := &testpb.GolangTest{Id: 2}
+	if err := pdb.FindOneByPK(absent); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if absent.Player != nil {
+		t.Errorf("未设置的子消息应读回为nil，实际 %v", absent.Player)
+	}
+}
+
+// TestWithRowHook 单元测试：钩子在每行解析后、加入结果前调用，可改写字段；钩子出错时查询失败且不改动传入的消息
+func TestWithRowHook(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+	fake.queryRows = [][]driver.Value{
+		{"1", "host-a", "80", "2", "", "9"},
+		{"2", "host-b", "81", "2", "", "9"},
+	}
+
+	var hookErr error
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithRowHook(func(m proto.Message) error {
+		row := m.(*testpb.GolangTest)
+		row.Ip = strings.ToUpper(row.Ip)
+		return hookErr
+	}))
+
+	list := &testpb.GolangTestList{}
+	if err := pdb.FindAll(list); err != nil {
+		t.Fatalf("FindAll失败: %v", err)
+	}
+	if len(list.TestList) != 2 || list.TestList[0].Ip != "HOST-A" || list.TestList[1].Ip != "HOST-B" {
+		t.Errorf("钩子应处理每一行: %v", list.TestList)
+	}
+
+	fake.queryRows = fake.queryRows[:1]
+	one := &testpb.GolangTest{Id: 1}
+	if err := pdb.FindOneByPK(one); err != nil || one.Ip != "HOST-A" {
+		t.Errorf("单行查询也应调用钩子: %v %v", one, err)
+	}
+
+	hookErr = errors.New("decrypt failed")
+	untouched := &testpb.GolangTest{Id: 1}
+	if err := pdb.FindOneByPK(untouched); !errors.Is(err, hookErr) {
+		t.Errorf("钩子出错时查询应失败，实际: %v", err)
+	}
+	if untouched.Ip != "" {
+		t.Errorf("钩子出错时不应改动传入的消息: %v", untouched)
+	}
+}
+
+// TestWithEncryptedColumn 单元测试：加密列建为MEDIUMBLOB，写入值不含明文且每次不同，parseRow解密后与原值一致；
+// 非法密钥、主键与错误密钥解密报错
+func TestWithEncryptedColumn(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"),
+		WithEncryptedColumn("ip", key), WithEncryptedColumn("player", key))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+	if got, _ := table.ColumnType("ip"); got != "MEDIUMBLOB" {
+		t.Errorf("加密列应建为MEDIUMBLOB，实际 %s", got)
+	}
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "13800138000", Port: 80, Player: &testpb.Player{PlayerId: 9}}
+	first, err := table.GetInsertSQLWithArgs(msg)
+	if err != nil {
+		t.Fatalf("生成INSERT失败: %v", err)
+	}
+	second, _ := table.GetInsertSQLWithArgs(msg)
+	stored := first.Args[1].(string)
+	if strings.Contains(stored, msg.Ip) || stored == second.Args[1] {
+		t.Errorf("密文不应包含明文且每次加密结果不同: %s %s", stored, second.Args[1])
+	}
+	if first.Args[2] != "80" {
+		t.Errorf("未加密列不受影响: %v", first.Args[2])
+	}
+
+	row := make([][]byte, len(first.Args))
+	for i, arg := range first.Args {
+		row[i] = []byte(arg.(string))
+	}
+	got := &testpb.GolangTest{}
+	if err := table.parseRow(got, row); err != nil {
+		t.Fatalf("解密解析失败: %v", err)
+	}
+	if !proto.Equal(got, msg) {
+		t.Errorf("往返结果不一致: %v", got)
+	}
+
+	other := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithEncryptedColumn("ip", []byte("fedcba9876543210")))
+	if err := other.parseRow(&testpb.GolangTest{}, row); err == nil || !strings.Contains(err.Error(), "decrypt column ip") {
+		t.Errorf("错误的密钥应解密失败，实际: %v", err)
+	}
+	for _, opts := range [][]TableOption{
+		{WithEncryptedColumn("ip", []byte("short"))},
+		{WithEncryptedColumn("id", key)},
+		{WithEncryptedColumn("no_such_field", key)},
+		{WithEncryptedColumn("ip", key), WithIndexes("ip")},
+		{WithEncryptedColumn("ip", key), WithUniqueKey("group_id,ip")},
+		{WithEncryptedColumn("ip", key), WithNamedIndex("idx_ip", "ip")},
+	} {
+		opts = append([]TableOption{WithPrimaryKey("id")}, opts...)
+		if err := newMessageTable(&testpb.GolangTest{}, opts...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法加密配置应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestEncryptedColumnByNameParse 单元测试：按列名解析的QueryIntoList与FindAggregate同样解密加密列
+func TestEncryptedColumnByNameParse(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	key := []byte("0123456789abcdef")
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithEncryptedColumn("ip", key))
+	table := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+	cipherText, err := table.encryptColumnValue("ip", "13800138000")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+
+	fake.queryColumns = []string{"id", "ip"}
+	fake.queryRows = [][]driver.Value{{"1", cipherText}, {"2", ""}}
+	list := &testpb.GolangTestList{}
+	if err := pdb.QueryIntoList(list, "SELECT `id`, `ip` FROM `golang_test`"); err != nil {
+		t.Fatalf("QueryIntoList失败: %v", err)
+	}
+	if len(list.TestList) != 2 || list.TestList[0].Ip != "13800138000" || list.TestList[1].Ip != "" {
+		t.Errorf("QueryIntoList应解密加密列: %v", list.TestList)
+	}
+
+	fake.queryColumns = nil
+	fake.queryRows = [][]driver.Value{{cipherText}}
+	got := &testpb.GolangTest{}
+	if err := pdb.FindAggregate(got, map[string]string{"ip": "ANY_VALUE(`ip`)"}, "id = ?", []interface{}{1}); err != nil {
+		t.Fatalf("FindAggregate失败: %v", err)
+	}
+	if got.Ip != "13800138000" {
+		t.Errorf("FindAggregate应解密加密列: %q", got.Ip)
+	}
+}
+
+// TestEncryptedColumnRoundTrip 测试加密列写入后库中不是明文，读回解密后与原值一致
+func TestEncryptedColumnRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithEncryptedColumn("ip", []byte("0123456789abcdef")))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "alice@example.com", Port: 80}
+	if err := pdb.Insert(msg); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	var raw []byte
+	if err := db.QueryRow("SELECT `ip` FROM " + testTableSQLName(&testpb.GolangTest{}) + " WHERE id = 1").Scan(&raw); err != nil {
+		t.Fatalf("读取原始列失败: %v", err)
+	}
+	if bytes.Contains(raw, []byte(msg.Ip)) {
+		t.Errorf("库中不应存明文: %s", raw)
+	}
+
+	got := &testpb.GolangTest{Id: 1}
+	if err := pdb.FindOneByPK(got); err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if !proto.Equal(got, msg) {
+		t.Errorf("读回结果不一致: %v", got)
+	}
+}
+
+// TestWithZerofill 单元测试：补零列带默认显示宽度；已有的 int(10) unsigned zerofill 列同步时不产生变更，
+// 宽度或补零属性不同则需要MODIFY
+func TestWithZerofill(t *testing.T) {
+	table := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithZerofill("port"), WithZerofill("player_id"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("配置应校验通过: %v", err)
+	}
+	for field, want := range map[string]string{
+		"port":      "int(10) unsigned zerofill NOT NULL DEFAULT 0",
+		"player_id": "bigint(20) unsigned zerofill NOT NULL DEFAULT 0",
+		"group_id":  "int unsigned NOT NULL DEFAULT 0",
+	} {
+		if got, _ := table.ColumnType(field); got != want {
+			t.Errorf("%s 列类型应为 %q，实际 %q", field, want, got)
+		}
+	}
+
+	live := make(map[string]columnMeta)
+	for _, field := range table.columns {
+		live[string(field.Name())] = columnMeta{colType: table.getMySQLFieldType(field), fieldNum: field.Number()}
+	}
+	live["port"] = columnMeta{colType: "int(10) unsigned zerofill", fieldNum: 3}
+	if clauses := table.buildAlterClauses(live); len(clauses) != 0 {
+		t.Errorf("与已有的补零列一致时不应产生变更: %v", clauses)
+	}
+
+	target, _ := table.ColumnType("port")
+	for _, current := range []string{"int(8) unsigned zerofill", "int unsigned", "int(10) zerofill"} {
+		if want := current == "int(10) zerofill"; isTypeMatch(current, target) != want {
+			t.Errorf("isTypeMatch(%q, %q) 应为 %v", current, target, want)
+		}
+	}
+	if isTypeMatch("int(10) unsigned zerofill", "int unsigned NOT NULL DEFAULT 0") {
+		t.Error("去掉WithZerofill后应MODIFY为普通unsigned列")
+	}
+
+	for _, opts := range [][]TableOption{
+		{WithZerofill("ip")},
+		{WithZerofill("no_such_field")},
+		{WithZerofill("port"), WithSignedColumns("port")},
+	} {
+		if err := newMessageTable(&testpb.GolangTest{}, opts...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法补零配置应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestWithAuditTable 单元测试：Update/Delete前在同一事务内加锁读出旧行，把其protobuf二进制写入审计表后再执行写操作；
+// 行不存在时不写审计记录；审计表不能与主表同名
+func TestWithAuditTable(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAuditTable("golang_test_audit"))
+
+	fake.queryRows = [][]driver.Value{{"1", "10.0.0.1", "80", "7", "", "0"}}
+	if err := pdb.Update(&testpb.GolangTest{Id: 1, Ip: "10.0.0.2", Port: 80, GroupId: 7, Player: &testpb.Player{PlayerId: 99}}); err != nil {
+		t.Fatalf("Update失败: %v", err)
+	}
+	queries := fake.recordedQueries()
+	if len(queries) != 1 || !strings.HasSuffix(queries[0].query, "WHERE `id` = ? FOR UPDATE;") {
+		t.Fatalf("应按主键加锁读出旧行: %+v", queries)
+	}
+	execs := fake.recorded()
+	if len(execs) != 2 || !strings.HasPrefix(execs[0].query, "INSERT INTO `golang_test_audit` (`op`, `pk`, `row_data`, `changed_at`)") ||
+		!strings.HasPrefix(execs[1].query, "UPDATE ") {
+		t.Fatalf("应先写审计表再更新: %+v", execs)
+	}
+	args := execs[0].values()
+	if args[0] != AuditOpUpdate || args[1] != "1" {
+		t.Errorf("审计记录的操作类型与主键不符: %v", args[:2])
+	}
+	old := &testpb.GolangTest{}
+	if err := proto.Unmarshal(args[2].([]byte), old); err != nil || old.Ip != "10.0.0.1" || old.Player != nil {
+		t.Errorf("审计记录应为更新前的行（不含本次设置的player），实际 %v %v", old, err)
+	}
+
+	fake.queryRows = nil
+	if err := pdb.Delete(&testpb.GolangTest{Id: 2}); err != nil {
+		t.Fatalf("Delete失败: %v", err)
+	}
+	execs = fake.recorded()[2:]
+	if len(execs) != 1 || !strings.HasPrefix(execs[0].query, "DELETE FROM ") {
+		t.Errorf("行不存在时不应写审计记录: %+v", execs)
+	}
+
+	// 其他按主键的写入同样审计；乐观锁版本不匹配时不写审计记录
+	fake.queryRows = [][]driver.Value{{"1", "10.0.0.1", "80", "7", "", "0"}}
+	if err := pdb.UpdateFieldsByPK(&testpb.GolangTest{Id: 1, Port: 81}, "port"); err != nil {
+		t.Fatalf("UpdateFieldsByPK失败: %v", err)
+	}
+	if err := pdb.BatchDelete([]proto.Message{&testpb.GolangTest{Id: 1}, &testpb.GolangTest{Id: 1}}); err != nil {
+		t.Fatalf("BatchDelete失败: %v", err)
+	}
+	if _, err := pdb.UpdateIfVersion(&testpb.GolangTest{Id: 1, Ip: "10.0.0.3", Port: 81}, "port"); err != nil {
+		t.Fatalf("UpdateIfVersion失败: %v", err)
+	}
+	var ops []string
+	for _, exec := range fake.recorded()[3:] {
+		if strings.HasPrefix(exec.query, "INSERT INTO `golang_test_audit`") {
+			ops = append(ops, exec.values()[0].(string))
+		} else {
+			ops = append(ops, strings.Fields(exec.query)[0])
+		}
+	}
+	if got := strings.Join(ops, " "); got != "update UPDATE delete delete DELETE UPDATE" {
+		t.Errorf("审计记录与写入顺序不符: %s", got)
+	}
+
+	gormDB := NewGormDB(nil, "")
+	gormDB.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAuditTable("golang_test_audit"))
+	if err := gormDB.Delete(&testpb.GolangTest{Id: 1}); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("GormDB不记录审计，应返回ErrInvalidTableOption，实际: %v", err)
+	}
+
+	latin := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAuditTable("golang_test_audit"), WithCharset("latin1", "latin1_bin"))
+	if want := " DEFAULT CHARSET=latin1 COLLATE=latin1_bin COMMENT="; !strings.Contains(latin.GetCreateAuditTableSQL(), want) {
+		t.Errorf("审计表应沿用主表字符集 %q: %s", want, latin.GetCreateAuditTableSQL())
+	}
+
+	sameName := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"))
+	WithAuditTable(sameName.tableName)(sameName)
+	if err := sameName.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("审计表与主表同名应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestAuditKeepsCiphertext 单元测试：审计快照中的加密列保留库中密文、不调用行钩子；非string/bytes的加密列不能审计
+func TestAuditKeepsCiphertext(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	key := []byte("0123456789abcdef")
+	hooked := false
+	pdb := NewDB()
+	pdb.DB = sqlDB
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAuditTable("golang_test_audit"),
+		WithEncryptedColumn("ip", key), WithRowHook(func(proto.Message) error { hooked = true; return nil }))
+	table := pdb.Tables[GetTableName(&testpb.GolangTest{})]
+
+	sealed, err := table.encryptColumnValue("ip", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	fake.queryRows = [][]driver.Value{{"1", sealed, "80", "7", "", "0"}}
+	if err := pdb.Update(&testpb.GolangTest{Id: 1, Ip: "10.0.0.2", Port: 80}); err != nil {
+		t.Fatalf("Update失败: %v", err)
+	}
+	old := &testpb.GolangTest{}
+	if err := proto.Unmarshal(fake.recorded()[0].values()[2].([]byte), old); err != nil || old.Ip != sealed {
+		t.Errorf("审计快照应保留密文而不是明文，实际 %q %v", old.Ip, err)
+	}
+	if hooked {
+		t.Error("读取审计快照不应调用行钩子")
+	}
+
+	bad := newMessageTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAuditTable("golang_test_audit"), WithEncryptedColumn("port", key))
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidTableOption) {
+		t.Errorf("审计表的加密列为数值字段时应返回ErrInvalidTableOption，实际: %v", err)
+	}
+}
+
+// TestAuditTableRoundTrip 集成测试：更新后审计表中保存了更新前的行，删除后保存了删除前的行
+func TestAuditTableRoundTrip(t *testing.T) {
+	pdb := NewDB()
+	pdb.RegisterTable(&testpb.GolangTest{}, WithPrimaryKey("id"), WithAuditTable("golang_test_audit"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	if _, err := db.Exec("DROP TABLE IF EXISTS `golang_test_audit`"); err != nil {
+		t.Fatalf("清理审计表失败: %v", err)
+	}
+	recreateTestTable(t, db, pdb, &testpb.GolangTest{})
+	if err := pdb.CreateOrUpdateTable(&testpb.GolangTest{}); err != nil {
+		t.Fatalf("同步表结构失败: %v", err)
+	}
+
+	if err := pdb.Insert(&testpb.GolangTest{Id: 1, Ip: "10.0.0.1", Port: 80}); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	if err := pdb.Update(&testpb.GolangTest{Id: 1, Ip: "10.0.0.2", Port: 81}); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	if err := pdb.Delete(&testpb.GolangTest{Id: 1}); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	rows, err := db.Query("SELECT `op`, `pk`, `row_data` FROM `golang_test_audit` ORDER BY `id`")
+	if err != nil {
+		t.Fatalf("查询审计表失败: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var op, pk string
+		var data []byte
+		if err := rows.Scan(&op, &pk, &data); err != nil {
+			t.Fatalf("读取审计记录失败: %v", err)
+		}
+		old := &testpb.GolangTest{}
+		if err := proto.Unmarshal(data, old); err != nil {
+			t.Fatalf("解析审计记录失败: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s %s %s:%d", op, pk, old.Ip, old.Port))
+	}
+	want := []string{"update 1 10.0.0.1:80", "delete 1 10.0.0.2:81"}
+	if !slices.Equal(got, want) {
+		t.Errorf("审计记录不符合预期: %v, 期望 %v", got, want)
+	}
+}
+
+// newAccountTestMessage 构造带软删除时间字段的动态消息 testdyn.Account（id, email, deleted_at）
+func newAccountTestMessage(t *testing.T) *dynamicpb.Message {
+	t.Helper()
+	return testdyn.NewMessage(t, "account_test.proto", "Account",
+		testdyn.Field("id", descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+		testdyn.Field("email", descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		testdyn.Field("deleted_at", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, testdyn.Timestamp))
+}
+
+// newAccount 构造一条testdyn.Account，deletedAt为零值时不设置（未删除）
+func newAccount(template *dynamicpb.Message, id uint64, email string, deletedAt time.Time) *dynamicpb.Message {
+	account := dynamicpb.NewMessage(template.Descriptor())
+	fields := account.Descriptor().Fields()
+	account.Set(fields.ByName("id"), protoreflect.ValueOfUint64(id))
+	account.Set(fields.ByName("email"), protoreflect.ValueOfString(email))
+	if !deletedAt.IsZero() {
+		account.Set(fields.ByName("deleted_at"), protoreflect.ValueOfMessage(timestamppb.New(deletedAt).ProtoReflect()))
+	}
+	return account
+}
+
+// TestWithActiveUniqueKey 单元测试：为唯一列生成只在未删除时取值的VIRTUAL列并在其上建唯一键，
+// 生成列不参与写入；软删除字段不可空、唯一列不存在或被改名时返回ErrInvalidTableOption
+func TestWithActiveUniqueKey(t *testing.T) {
+	msg := newAccountTestMessage(t)
+	table := newMessageTable(msg, WithPrimaryKey("id"), WithNullableFields("deleted_at"), WithActiveUniqueKey("deleted_at", "email"))
+	if err := table.Validate(); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	createSQL := table.GetCreateTableSQL()
+	for _, want := range []string{
+		"`email_active` VARCHAR(255) GENERATED ALWAYS AS (IF(`deleted_at` IS NULL, `email`, NULL)) VIRTUAL",
+		"UNIQUE KEY `uk_active_email` (`email_active`)",
+	} {
+		if !strings.Contains(createSQL, want) {
+			t.Errorf("建表语句缺少 %s:\n%s", want, createSQL)
+		}
+	}
+	if strings.Contains(table.insertFieldsListSQL, "email_active") {
+		t.Errorf("生成列不应出现在INSERT列中: %s", table.insertFieldsListSQL)
+	}
+
+	for _, opts := range [][]TableOption{
+		{WithActiveUniqueKey("deleted_at", "email")},
+		{WithNullableFields("deleted_at"), WithActiveUniqueKey("deleted_at", "nope")},
+		{WithNullableFields("deleted_at"), WithActiveUniqueKey("deleted_at")},
+		{WithNullableFields("deleted_at"), WithColumnMapping(map[string]string{"email": "mail"}), WithActiveUniqueKey("deleted_at", "email")},
+	} {
+		if err := newMessageTable(msg, append([]TableOption{WithPrimaryKey("id")}, opts...)...).Validate(); !errors.Is(err, ErrInvalidTableOption) {
+			t.Errorf("非法配置应返回ErrInvalidTableOption，实际: %v", err)
+		}
+	}
+}
+
+// TestActiveUniqueKeySoftDelete 集成测试：未删除的行受唯一约束，软删除旧行后可以重新插入相同email
+func TestActiveUniqueKeySoftDelete(t *testing.T) {
+	msg := newAccountTestMessage(t)
+	pdb := NewDB()
+	pdb.RegisterTable(msg, WithPrimaryKey("id"), WithNullableFields("deleted_at"), WithActiveUniqueKey("deleted_at", "email"))
+
+	db := mustOpenTestDB(t, pdb)
+	defer closeTestDB(t, db)
+	recreateTestTable(t, db, pdb, msg)
+
+	if err := pdb.Insert(newAccount(msg, 1, "a@example.com", time.Time{})); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+	if err := pdb.Insert(newAccount(msg, 2, "a@example.com", time.Time{})); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("未删除的行应受唯一约束，实际: %v", err)
+	}
+	if err := pdb.Update(newAccount(msg, 1, "a@example.com", time.Now())); err != nil {
+		t.Fatalf("软删除失败: %v", err)
+	}
+	if err := pdb.Insert(newAccount(msg, 2, "a@example.com", time.Time{})); err != nil {
+		t.Fatalf("软删除后应能重新插入相同email: %v", err)
+	}
+}
+
+// TestFindMultiSequential 单元测试：每条查询单独下发（不拼多语句），逐条填充消息；
+// 某条无结果时返回ErrNoRowsFound、多行时返回ErrMultipleRowsFound，未注册的表不下发SQL
+func TestFindMultiSequential(t *testing.T) {
+	sqlDB, fake := newFakeDB()
+	defer sqlDB.Close()
+
+	pdb := newCacheTestDB(nil)
+	pdb.DB = sqlDB
+	rowsByID := map[int64][][]driver.Value{
+		1: {{"1", "10.0.0.1", "80", "7", "", "0"}},
+		2: {{"2", "10.0.0.2", "81", "7", "", "0"}},
+		3: {{"3", "", "0", "0", "", "0"}, {"3", "", "0", "0", "", "0"}},
+	}
+	fake.queryFor = func(_ string, args []driver.NamedValue) [][]driver.Value {
+		return rowsByID[args[0].Value.(int64)]
+	}
+
+	first, second := &testpb.GolangTest{}, &testpb.GolangTest{}
+	if err := pdb.FindMultiSequential([]MultiQuery{
+		{Message: first, WhereClause: "id = ?", WhereArgs: []interface{}{1}},
+		{Message: second, WhereClause: "id = ?", WhereArgs: []interface{}{2}},
+	}); err != nil {
+		t.Fatalf("FindMultiSequential失败: %v", err)
+	}
+	if first.Ip != "10.0.0.1" || second.Ip != "10.0.0.2" {
+		t.Errorf("应按顺序填充每条查询的结果: %v %v", first, second)
+	}
+	for _, q := range fake.recordedQueries() {
+		if strings.Count(q.query, ";") != 1 || !strings.HasSuffix(q.query, "WHERE id = ? LIMIT 2;") {
+			t.Errorf("每条查询应单独下发: %s", q.query)
+		}
+	}
+
+	err := pdb.FindMultiSequential([]MultiQuery{
+		{Message: &testpb.GolangTest{}, WhereClause: "id = ?", WhereArgs: []interface{}{1}},
+		{Message: &testpb.GolangTest{}, WhereClause: "id = ?", WhereArgs: []interface{}{4}},
+	})
+	if !errors.Is(err, ErrNoRowsFound) || !strings.HasPrefix(err.Error(), "query 1: ") || strings.Count(err.Error(), "golang_test") != 1 {
+		t.Errorf("无结果应返回带查询下标、表名只出现一次的ErrNoRowsFound，实际: %v", err)
+	}
+	err = pdb.FindMultiSequential([]MultiQuery{{Message: &testpb.GolangTest{}, WhereClause: "id = ?", WhereArgs: []interface{}{3}}})
+	if !errors.Is(err, ErrMultipleRowsFound) {
+		t.Errorf("多行应返回ErrMultipleRowsFound，实际: %v", err)
+	}
+
+	queried := len(fake.recordedQueries())
+	err = pdb.FindMultiSequential([]MultiQuery{
+		{Message: &testpb.GolangTest{}, WhereClause: "id = ?", WhereArgs: []interface{}{1}},
+		{Message: &testpb.GolangTestList{}, WhereClause: "id = ?", WhereArgs: []interface{}{1}},
+	})
+	if !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("未注册的表应返回ErrTableNotFound，实际: %v", err)
+	}
+	if n := len(fake.recordedQueries()); n != queried {
+		t.Errorf("存在未注册的表时不应下发SQL，实际查询次数: %d", n-queried)
+	}
+	if err := pdb.FindMultiSequential(nil); err == nil {
+		t.Error("空查询应返回错误")
+	}
+}
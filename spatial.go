@@ -0,0 +1,147 @@
+package proto2mysql
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/luyuancpp/proto2mysql/pbconv"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// spatialColumnType POINT列类型（WGS84经纬度）
+	spatialColumnType = "POINT NOT NULL SRID 4326"
+	// spatialWriteExpr 写入POINT的占位表达式。SRID 4326默认纬度在前，这里显式指定经度在前，
+	// 与WKT惯用的 POINT(lng lat) 一致
+	spatialWriteExpr = "ST_GeomFromText(?, 4326, 'axis-order=long-lat')"
+	// spatialReadFmt 读取POINT为WKT文本 POINT(lng lat)，参数为转义后的列名与别名（字段名）
+	spatialReadFmt = "ST_AsText(%s, 'axis-order=long-lat') AS %s"
+)
+
+// spatialPoint 由两个经纬度字段合成的POINT列（WithSpatialPoint）
+type spatialPoint struct {
+	field    string // POINT列对应的string字段，查询后为WKT文本 POINT(lng lat)
+	latField string // 纬度字段（double/float）
+	lngField string // 经度字段（double/float）
+}
+
+// WithSpatialPoint 把string字段field映射为 POINT NOT NULL SRID 4326 列并建 SPATIAL INDEX，用于附近的人等距离查询。
+// 写入时不使用field本身的值，而是由latField/lngField（double或float字段，照常各自建列）合成
+// ST_GeomFromText('POINT(lng lat)')；查询时以 ST_AsText 读回WKT文本到field。
+// 需要MySQL 8.0+；给已有数据的表新增POINT列时，需先手工回填（NOT NULL列无默认值）。
+//
+//	WithSpatialPoint("position", "lat", "lng")
+//	// SELECT ... WHERE ST_Distance_Sphere(`position`, ST_GeomFromText(?, 4326, 'axis-order=long-lat')) < ?
+func WithSpatialPoint(field, latField, lngField string) TableOption {
+	return func(t *MessageTable) {
+		t.spatialPoints = append(t.spatialPoints, spatialPoint{field: field, latField: latField, lngField: lngField})
+	}
+}
+
+// spatialPointFor 返回字段对应的POINT配置
+func (m *MessageTable) spatialPointFor(fieldName string) (spatialPoint, bool) {
+	for _, sp := range m.spatialPoints {
+		if sp.field == fieldName {
+			return sp, true
+		}
+	}
+	return spatialPoint{}, false
+}
+
+// validateSpatialPoints 校验WithSpatialPoint：POINT字段为string，经纬度字段为double/float
+func (m *MessageTable) validateSpatialPoints() error {
+	fields := m.Descriptor.Fields()
+	for _, sp := range m.spatialPoints {
+		field := fields.ByName(protoreflect.Name(sp.field))
+		if field == nil {
+			return fmt.Errorf("%w: spatial column %s not found in table %s", ErrInvalidTableOption, sp.field, m.tableName)
+		}
+		if field.Kind() != protoreflect.StringKind || field.IsList() || field.IsMap() {
+			return fmt.Errorf("%w: spatial column %s in table %s must be a string field, got %s",
+				ErrInvalidTableOption, sp.field, m.tableName, field.Kind())
+		}
+		if slices.Contains(m.primaryKey, sp.field) || m.isIgnoredField(sp.field) {
+			return fmt.Errorf("%w: spatial column %s in table %s cannot be a primary key or ignored field",
+				ErrInvalidTableOption, sp.field, m.tableName)
+		}
+		for _, coord := range []string{sp.latField, sp.lngField} {
+			fd := fields.ByName(protoreflect.Name(coord))
+			if fd == nil {
+				return fmt.Errorf("%w: spatial coordinate %s not found in table %s", ErrInvalidTableOption, coord, m.tableName)
+			}
+			if (fd.Kind() != protoreflect.DoubleKind && fd.Kind() != protoreflect.FloatKind) || fd.IsList() {
+				return fmt.Errorf("%w: spatial coordinate %s in table %s must be a double or float field, got %s",
+					ErrInvalidTableOption, coord, m.tableName, fd.Kind())
+			}
+		}
+	}
+	return nil
+}
+
+// wkt 由消息的经纬度字段生成 POINT(lng lat)
+func (sp spatialPoint) wkt(reflection protoreflect.Message) string {
+	fields := reflection.Descriptor().Fields()
+	lat := reflection.Get(fields.ByName(protoreflect.Name(sp.latField))).Float()
+	lng := reflection.Get(fields.ByName(protoreflect.Name(sp.lngField))).Float()
+	return "POINT(" + strconv.FormatFloat(lng, 'g', -1, 64) + " " + strconv.FormatFloat(lat, 'g', -1, 64) + ")"
+}
+
+// columnValue 序列化写入列的参数：POINT列为经纬度合成的WKT，WithZeroValueAsNull字段的零值为nil（SQL NULL），
+// 其余字段按表的字段选项序列化，WithEncryptedColumn字段再加密
+func (m *MessageTable) columnValue(message proto.Message, fieldDesc protoreflect.FieldDescriptor) (interface{}, error) {
+	if sp, ok := m.spatialPointFor(string(fieldDesc.Name())); ok {
+		return sp.wkt(message.ProtoReflect()), nil
+	}
+	if m.isZeroAsNullField(string(fieldDesc.Name())) && isZeroField(message.ProtoReflect(), fieldDesc) {
+		return nil, nil
+	}
+	if m.isNullableMessageField(string(fieldDesc.Name())) && !message.ProtoReflect().Has(fieldDesc) {
+		return nil, nil
+	}
+	val, err := pbconv.SerializeFieldWithOptions(message, fieldDesc, m.fieldOptions(fieldDesc))
+	if err != nil || !m.isEncryptedField(string(fieldDesc.Name())) {
+		return val, err
+	}
+	return m.encryptColumnValue(string(fieldDesc.Name()), val)
+}
+
+// columnPlaceholder 写入列的占位符：POINT列为ST_GeomFromText(?)，其余为?
+func (m *MessageTable) columnPlaceholder(fieldDesc protoreflect.FieldDescriptor) string {
+	if _, ok := m.spatialPointFor(string(fieldDesc.Name())); ok {
+		return spatialWriteExpr
+	}
+	return "?"
+}
+
+// hasColumnValue 按Has语义判断列是否需要写入：POINT列须经纬度字段都已设置才写入，
+// 只设置其一的部分更新不改POINT列（否则未设置的坐标按0写入，覆盖库中原值）
+func (m *MessageTable) hasColumnValue(reflection protoreflect.Message, fieldDesc protoreflect.FieldDescriptor) bool {
+	sp, ok := m.spatialPointFor(string(fieldDesc.Name()))
+	if !ok {
+		return reflection.Has(fieldDesc)
+	}
+	fields := reflection.Descriptor().Fields()
+	return reflection.Has(fields.ByName(protoreflect.Name(sp.latField))) &&
+		reflection.Has(fields.ByName(protoreflect.Name(sp.lngField)))
+}
+
+// selectColumnSQL SELECT列表中的列表达式：POINT列以ST_AsText读回WKT；
+// 列名与字段名不同（WithColumnMapping）时以字段名作别名，结果集列名始终是proto字段名
+func (m *MessageTable) selectColumnSQL(fieldDesc protoreflect.FieldDescriptor) string {
+	fieldName := string(fieldDesc.Name())
+	column := m.quotedColumn(fieldName)
+	if _, ok := m.spatialPointFor(fieldName); ok {
+		return fmt.Sprintf(spatialReadFmt, column, escapeMySQLName(fieldName))
+	}
+	if m.columnName(fieldName) != fieldName {
+		return column + " AS " + escapeMySQLName(fieldName)
+	}
+	return column
+}
+
+// setClauseSQL UPDATE SET中的单列赋值，如 `a` = ?
+func (m *MessageTable) setClauseSQL(fieldDesc protoreflect.FieldDescriptor) string {
+	return m.quotedColumn(string(fieldDesc.Name())) + " = " + m.columnPlaceholder(fieldDesc)
+}
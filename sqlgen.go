@@ -5,7 +5,6 @@ import (
 	"io"
 	"os"
 	"sort"
-	"strings"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -19,16 +18,20 @@ func GenerateCreateTableSQL(m proto.Message, opts ...TableOption) string {
 }
 
 // WriteCreateTableSQL 把所有已注册表的 CREATE TABLE 语句写入 w（按表名排序，输出稳定），
-// 用于离线生成 schema.sql，无需连库。建议在 RegisterTable 完成后调用。
+// 用于离线生成 schema.sql，无需连库。建议在 RegisterTable 完成后调用；表配置不合法（Validate）时返回错误。
 func (p *DB) WriteCreateTableSQL(w io.Writer) error {
-	names := make([]string, 0, len(p.Tables))
-	for name := range p.Tables {
+	tables := p.tablesSnapshot()
+	names := make([]string, 0, len(tables))
+	for name := range tables {
 		names = append(names, name)
 	}
 	sort.Strings(names)
 
 	for _, name := range names {
-		if _, err := fmt.Fprintln(w, p.Tables[name].GetCreateTableSQL()); err != nil {
+		if err := tables[name].Validate(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, tables[name].GetCreateTableSQL()); err != nil {
 			return err
 		}
 		if _, err := fmt.Fprintln(w); err != nil {
@@ -54,19 +57,22 @@ func (p *DB) DumpCreateTableSQLFile(path string) error {
 
 // GenerateMigrationSQL 生成把线上表结构对齐到 proto 定义所需的 SQL：
 //   - 表不存在   → 返回 CREATE TABLE 语句
-//   - 表已存在   → 返回 ALTER TABLE（新增字段 / 按字段号改名 / 类型对齐）语句
+//   - 表已存在   → 返回 ALTER TABLE（新增字段 / 按字段号改名 / 类型对齐 / 补齐缺失索引）语句
 //   - 无任何差异 → 返回空串
 //
 // 需要已连库（读 information_schema 比对当前结构），且该消息对应表已 RegisterTable。
 // 与 UpdateTableField 的区别：只产出 SQL 不执行，便于生成迁移文件供人工/CI 审核。
 func (p *DB) GenerateMigrationSQL(m proto.Message) (string, error) {
 	tableName := GetTableName(m)
-	table, ok := p.Tables[tableName]
+	table, ok := p.lookupTable(tableName)
 	if !ok {
 		return "", fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
 	}
+	if err := table.Validate(); err != nil {
+		return "", err
+	}
 
-	exists, err := p.IsTableExists(table.tableName)
+	exists, err := p.tableExistsIn(p.tableSchema(table), table.tableName)
 	if err != nil {
 		return "", fmt.Errorf("check table %s exists: %w", table.tableName, err)
 	}
@@ -79,11 +85,22 @@ func (p *DB) GenerateMigrationSQL(m proto.Message) (string, error) {
 		return "", fmt.Errorf("get table %s columns: %w", tableName, err)
 	}
 
-	alterSQLs := table.buildAlterClauses(currentCols)
+	indexClauses, err := p.indexAlterClauses(tableName, table)
+	if err != nil {
+		return "", fmt.Errorf("get table %s indexes: %w", tableName, err)
+	}
+
+	commentClauses, err := p.tableCommentAlterClauses(table)
+	if err != nil {
+		return "", fmt.Errorf("get table %s comment: %w", tableName, err)
+	}
+
+	alterSQLs := append(table.buildAlterClauses(currentCols), indexClauses...)
+	alterSQLs = append(alterSQLs, commentClauses...)
 	if len(alterSQLs) == 0 {
 		return "", nil
 	}
-	return fmt.Sprintf("ALTER TABLE %s %s;", escapeMySQLName(table.tableName), strings.Join(alterSQLs, ", ")), nil
+	return table.alterTableSQL(alterSQLs) + ";", nil
 }
 
 // WriteMigrationSQL 依次为每个消息生成迁移 SQL 并写入 w（无差异的表自动跳过），需连库。
@@ -120,3 +137,80 @@ func (p *DB) DumpMigrationSQLFile(path string, messages ...proto.Message) error
 	}
 	return f.Close()
 }
+
+// ColumnMismatch 线上列类型与 proto 推导的目标类型不兼容的列
+type ColumnMismatch struct {
+	Name     string // 列名
+	Current  string // 线上 COLUMN_TYPE，如 int(11)
+	Expected string // proto 推导出的目标类型，如 BIGINT NOT NULL DEFAULT 0
+}
+
+// SchemaDiff 线上表结构与 proto 定义的差异，全部为空表示一致
+type SchemaDiff struct {
+	MissingColumns []string         // proto 有、线上表没有的列（按字段顺序）
+	ExtraColumns   []string         // 线上表有、proto 没有的列（按列名排序）
+	TypeMismatches []ColumnMismatch // 类型不兼容的列（按字段顺序）
+}
+
+// Empty 判断是否无任何差异（CI 中可据此失败）
+func (d SchemaDiff) Empty() bool {
+	return len(d.MissingColumns) == 0 && len(d.ExtraColumns) == 0 && len(d.TypeMismatches) == 0
+}
+
+// DiffSchema 比对线上表结构与 proto 定义，返回结构化差异（只读，不修改表）。
+// 表不存在时所有列都计入 MissingColumns。需要已连库且该消息对应表已 RegisterTable。
+//
+//	diff, err := db.DiffSchema(&pb.Player{})
+//	if err == nil && !diff.Empty() { /* CI 失败 */ }
+func (p *DB) DiffSchema(m proto.Message) (SchemaDiff, error) {
+	tableName := GetTableName(m)
+	table, ok := p.lookupTable(tableName)
+	if !ok {
+		return SchemaDiff{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	// 直接读INFORMATION_SCHEMA而不用cachedColumns：表外的ALTER也要能发现
+	metas, err := p.getTableColumnMeta(tableName)
+	if err != nil {
+		return SchemaDiff{}, fmt.Errorf("get table %s columns: %w", tableName, err)
+	}
+	currentCols := make(map[string]string, len(metas))
+	for name, meta := range metas {
+		currentCols[name] = meta.colType
+	}
+	return table.diffColumns(currentCols), nil
+}
+
+// diffColumns 按列名比对线上列（列名→COLUMN_TYPE）与表定义，差异中均为库列名
+func (m *MessageTable) diffColumns(currentCols map[string]string) SchemaDiff {
+	var diff SchemaDiff
+	expected := make(map[string]bool, len(m.columns))
+	for _, fieldDesc := range m.columns {
+		name := m.columnName(string(fieldDesc.Name()))
+		expected[name] = true
+
+		current, ok := currentCols[name]
+		if !ok {
+			diff.MissingColumns = append(diff.MissingColumns, name)
+			continue
+		}
+		if target := m.getMySQLFieldType(fieldDesc); !isTypeMatch(current, target) {
+			diff.TypeMismatches = append(diff.TypeMismatches, ColumnMismatch{Name: name, Current: current, Expected: target})
+		}
+	}
+
+	for _, gc := range m.standaloneGeneratedColumns() {
+		expected[gc.name] = true
+		if _, ok := currentCols[gc.name]; !ok {
+			diff.MissingColumns = append(diff.MissingColumns, gc.name)
+		}
+	}
+
+	for name := range currentCols {
+		if !expected[name] {
+			diff.ExtraColumns = append(diff.ExtraColumns, name)
+		}
+	}
+	sort.Strings(diff.ExtraColumns)
+	return diff
+}
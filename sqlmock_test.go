@@ -0,0 +1,61 @@
+package proto2mysql
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	testpb "github.com/luyuancpp/proto2mysql/internal/testpb"
+)
+
+// newSQLMockDB 以go-sqlmock驱动的*sql.DB初始化DB（精确匹配SQL），无需MySQL即可断言生成的SQL与参数。
+// OpenDB只执行 SELECT DATABASE() 校验库名，同样由mock应答。
+func newSQLMockDB(t *testing.T, opts ...TableOption) (*DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectQuery("SELECT DATABASE()").WillReturnRows(sqlmock.NewRows([]string{"DATABASE()"}).AddRow("testdb"))
+	pdb := NewDB()
+	if err := pdb.OpenDB(db, "testdb"); err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	pdb.RegisterTable(&testpb.GolangTest{}, opts...)
+	return pdb, mock
+}
+
+// TestSQLMockInsert 单元测试：Insert生成的SQL与参数（全部经p.DB执行，可被sqlmock断言）
+func TestSQLMockInsert(t *testing.T) {
+	pdb, mock := newSQLMockDB(t, WithPrimaryKey("id"))
+
+	mock.ExpectExec("INSERT INTO `golang_test` (`id`, `ip`, `port`, `group_id`, `player`, `player_id`) VALUES (?, ?, ?, ?, ?, ?)").
+		WithArgs("1", "127.0.0.1", "3306", "7", "", "42").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "127.0.0.1", Port: 3306, GroupId: 7, PlayerId: 42}
+	if err := pdb.Insert(msg); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSQLMockUpdate 单元测试：Update按主键生成的SQL与参数
+func TestSQLMockUpdate(t *testing.T) {
+	pdb, mock := newSQLMockDB(t, WithPrimaryKey("id"))
+
+	mock.ExpectExec("UPDATE `golang_test` SET `id` = ?, `ip` = ?, `port` = ?, `group_id` = ?, `player_id` = ? WHERE `id` = ?").
+		WithArgs("1", "10.0.0.1", "8080", "7", "42", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	msg := &testpb.GolangTest{Id: 1, Ip: "10.0.0.1", Port: 8080, GroupId: 7, PlayerId: 42}
+	if err := pdb.Update(msg); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
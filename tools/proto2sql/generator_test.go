@@ -35,8 +35,8 @@ func TestGenerate(t *testing.T) {
 		"`id` bigint unsigned NOT NULL AUTO_INCREMENT",
 		"`email` MEDIUMTEXT",
 		"PRIMARY KEY (`id`)",
-		"INDEX `idx_account_0` (`name`)",
-		"UNIQUE KEY `uk_account` (`email`)",
+		"INDEX `idx_account_0` (`name`(191))",
+		"UNIQUE KEY `uk_account` (`email`(191))",
 	}
 	for _, c := range checks {
 		if !strings.Contains(sql, c) {